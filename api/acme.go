@@ -103,6 +103,9 @@ func AcmeAddHandler(c *gin.Context) {
 		CreatedAt:   time.Now(),
 	}
 
+	SetAuditTarget(c, "acme", cert.Subject.CommonName)
+	SetAuditDiff(c, nil, JsonObject{"subject": cert.Subject.String(), "dns_names": cert.DNSNames, "expire_at": expireData})
+
 	if _, err := dao.RedisCache.Del(c.Request.Context(), AcmeRedisKey).Result(); err != nil {
 		log.Errorf("AcmeAddHandler error: %v", err)
 		c.JSON(500, gin.H{"error": "Internal server error"})
@@ -275,6 +275,9 @@ func DeleteKOLHandler(c *gin.Context) {
 		return
 	}
 
+	SetAuditTarget(c, "kol", kol.UserId)
+	SetAuditDiff(c, kol, nil)
+
 	if err := dao.DeleteKOL(c.Request.Context(), kol.UserId); err != nil {
 		log.Errorf("delete kol: %v", err)
 		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
@@ -296,6 +299,11 @@ func UpdateKOLHandler(c *gin.Context) {
 		return
 	}
 
+	SetAuditTarget(c, "kol", params.UserId)
+	if before, err := dao.GetKOLByUserId(c.Request.Context(), params.UserId); err == nil {
+		SetAuditDiff(c, before, params)
+	}
+
 	if err := dao.UpdateKOL(c.Request.Context(), &params); err != nil {
 		log.Errorf("update kol: %v", err)
 		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
@@ -458,6 +466,9 @@ func BugEditHandler(c *gin.Context) {
 	username := claims[identityKey].(string)
 	bug.Operator = username
 
+	SetAuditTarget(c, "bug", bug.ID)
+	SetAuditDiff(c, nil, bug)
+
 	if err := dao.BugUpdateCtx(c.Request.Context(), &bug); err != nil {
 		log.Errorf("UpdateBug: %v", err)
 		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
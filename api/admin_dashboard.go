@@ -16,6 +16,7 @@ import (
 	"github.com/gnasnik/titan-explorer/core/dao"
 	"github.com/gnasnik/titan-explorer/core/errors"
 	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/core/scheduler"
 	"github.com/gnasnik/titan-explorer/core/statistics"
 )
 
@@ -511,6 +512,24 @@ func GetAreasHandler(c *gin.Context) {
 	}))
 }
 
+// GetSchedulerHealthHandler 获取所有调度器的健康状态
+func GetSchedulerHealthHandler(c *gin.Context) {
+	list := scheduler.Health()
+
+	var healthy int
+	for _, s := range list {
+		if s.Healthy {
+			healthy++
+		}
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list":    list,
+		"total":   len(list),
+		"healthy": healthy,
+	}))
+}
+
 func GetProjectOverviewHandler(c *gin.Context) {
 	nodeId := c.Query("node_id")
 	areaId := c.Query("area_id")
@@ -541,10 +560,9 @@ func GetProjectOverviewHandler(c *gin.Context) {
 	}
 
 	if areaId == "" {
-		areaSchMaps.Range(func(key, value any) bool {
-			areaId = key.(string)
-			return false
-		})
+		if areas := scheduler.Areas(); len(areas) > 0 {
+			areaId = areas[0]
+		}
 	}
 
 	schedulerClient, err := getSchedulerClient(c.Request.Context(), areaId)
@@ -89,6 +89,8 @@ func DeleteAdsHandler(c *gin.Context) {
 		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
 		return
 	}
+	SetAuditTarget(c, "ads", ads.ID)
+
 	if err := dao.AdsDelCtx(c.Request.Context(), ads.ID); err != nil {
 		log.Errorf("DeleteAdsHandler: %v", err)
 		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
@@ -105,6 +107,9 @@ func UpdateAdsHandler(c *gin.Context) {
 	}
 
 	ads.UpdatedAt = time.Now()
+	SetAuditTarget(c, "ads", ads.ID)
+	SetAuditDiff(c, nil, ads)
+
 	if err := dao.AdsUpdateCtx(c.Request.Context(), &ads); err != nil {
 		log.Errorf("UpdateAdsHandler: %v", err)
 		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
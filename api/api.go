@@ -2,23 +2,18 @@ package api
 
 import (
 	"context"
-	"errors"
-	"fmt"
 	"image/color"
-	"net/http"
 	"strings"
-	"sync"
 
 	"github.com/Filecoin-Titan/titan/api"
-	"github.com/Filecoin-Titan/titan/api/client"
 	config2 "github.com/TestsLing/aj-captcha-go/config"
 	constant "github.com/TestsLing/aj-captcha-go/const"
 	"github.com/TestsLing/aj-captcha-go/service"
 	"github.com/gin-gonic/gin"
 	"github.com/gnasnik/titan-explorer/config"
 	"github.com/gnasnik/titan-explorer/core/cleanup"
+	"github.com/gnasnik/titan-explorer/core/scheduler"
 	"github.com/gnasnik/titan-explorer/core/statistics"
-	"github.com/go-redis/redis/v9"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
@@ -28,10 +23,6 @@ var (
 	SchedulerConfigKeyPrefix = "TITAN::SCHEDULERCFG"
 )
 
-var (
-	areaSchMaps = new(sync.Map)
-)
-
 // 行为校验初始化
 var (
 	factory *service.CaptchaServiceFactory
@@ -49,7 +40,7 @@ func NewServer(cfg config.Config) (*Server, error) {
 	gin.SetMode(cfg.Mode)
 	// router := gin.Default()
 	router := gin.New()
-	router.Use(gin.Recovery())
+	router.Use(RecoveryMiddleware())
 
 	//router.Use(Cors())
 
@@ -104,42 +95,10 @@ func (s *Server) Close() {
 }
 
 // getSchedulerClient 获取调度器的 rpc 客户端实例, titan 节点是有区域区分的,不同的节点会连接不同区域的调度器,当需要查询该节点的数据时,需要连接对应的调度器
-// areaId 区域Id在同步的节点的时候会写入到 device_info表,可以查询节点的信息,获得对应的区域ID,如果没有传区域ID,那么会遍历所有的调度器,可能会有性能问题.
+// areaId 区域Id在同步的节点的时候会写入到 device_info表,可以查询节点的信息,获得对应的区域ID.
+// 客户端由 scheduler.DefaultRegistry 统一管理, 不可用的调度器会自动切换到同区域的下一个调度器.
 func getSchedulerClient(ctx context.Context, areaId string) (api.Scheduler, error) {
-	v, ok := areaSchMaps.Load(areaId)
-	if ok {
-		return v.(api.Scheduler), nil
-	}
-	schedulers, err := statistics.GetSchedulerConfigs(ctx, fmt.Sprintf("%s::%s", SchedulerConfigKeyPrefix, areaId))
-	if err == redis.Nil && areaId != DefaultAreaId {
-		return getSchedulerClient(ctx, DefaultAreaId)
-	}
-
-	if err != nil || len(schedulers) == 0 {
-		log.Errorf("no scheduler found")
-		return nil, errors.New("no scheduler found")
-	}
-
-	// maps, err := statistics.LoadSchedulerConfigs()
-	// if err != nil {
-	// 	return nil, err
-	// }
-	// schedulers := maps[areaId]
-
-	schedulerApiUrl := schedulers[0].SchedulerURL
-	schedulerApiToken := schedulers[0].AccessToken
-	SchedulerURL := strings.Replace(schedulerApiUrl, "https", "http", 1)
-	headers := http.Header{}
-	headers.Add("Authorization", "Bearer "+schedulerApiToken)
-	schedulerClient, _, err := client.NewScheduler(ctx, SchedulerURL, headers)
-	if err != nil {
-		log.Errorf("create scheduler rpc client: %v", err)
-		return nil, err
-	}
-
-	areaSchMaps.Store(areaId, schedulerClient)
-
-	return schedulerClient, nil
+	return scheduler.Get(ctx, areaId)
 }
 
 // GetSchedulerClient getSchedulerClient的外部调用方式
@@ -0,0 +1,436 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Filecoin-Titan/titan/api"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/core/opasynq"
+	"github.com/gnasnik/titan-explorer/core/storage"
+	"github.com/google/uuid"
+)
+
+const (
+	assetBatchOpDelete  = "delete"
+	assetBatchOpMove    = "move"
+	assetBatchOpShare   = "share"
+	assetBatchOpUnshare = "unshare"
+	assetBatchOpTag     = "tag"
+	assetBatchOpExport  = "export"
+
+	// maxAssetBatchParamsLength 任务参数的最大长度, 与 asset_batch_job.params 的字段长度一致
+	maxAssetBatchParamsLength = 2048
+)
+
+// assetBatchItemError 单项处理失败的原因, 会记录到任务中返回给用户
+type assetBatchItemError string
+
+func (e assetBatchItemError) Error() string {
+	return string(e)
+}
+
+const (
+	errBatchAssetNotFound     assetBatchItemError = "asset not found"
+	errBatchGroupNotFound     assetBatchItemError = "group not found"
+	errBatchTargetGroup       assetBatchItemError = "target group not found"
+	errBatchUnsupported       assetBatchItemError = "operation not supported for group"
+	errBatchIPFSUnavailable   assetBatchItemError = "ipfs node unavailable"
+	errBatchInternal          assetBatchItemError = "internal server error"
+	errBatchOperationNotFound assetBatchItemError = "unknown operation"
+)
+
+type assetBatchReq struct {
+	Operation string   `json:"operation" binding:"required"`
+	AssetCIDs []string `json:"asset_cids"`
+	GroupIDs  []int64  `json:"group_ids"`
+	assetBatchParams
+}
+
+// assetBatchParams 批量操作的参数, 保存在任务中供执行时使用
+type assetBatchParams struct {
+	TargetGroupID *int64   `json:"target_group_id,omitempty"`
+	AddTags       []string `json:"add_tags,omitempty"`
+	RemoveTags    []string `json:"remove_tags,omitempty"`
+}
+
+// buildAssetBatchItems 校验批量操作的参数并生成任务中的每一项, 重复的文件和文件组只处理一次
+func buildAssetBatchItems(req *assetBatchReq) ([]*model.AssetBatchItem, bool) {
+	switch req.Operation {
+	case assetBatchOpDelete, assetBatchOpShare, assetBatchOpUnshare:
+	case assetBatchOpMove:
+		if req.TargetGroupID == nil || *req.TargetGroupID < 0 {
+			return nil, false
+		}
+	case assetBatchOpTag:
+		var ok bool
+		if req.AddTags, ok = normalizeTags(req.AddTags); !ok {
+			return nil, false
+		}
+		if req.RemoveTags, ok = normalizeTags(req.RemoveTags); !ok {
+			return nil, false
+		}
+		if len(req.AddTags) == 0 && len(req.RemoveTags) == 0 || len(req.GroupIDs) > 0 {
+			return nil, false
+		}
+	case assetBatchOpExport:
+		if len(req.GroupIDs) > 0 {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+
+	seen := make(map[string]bool)
+	items := make([]*model.AssetBatchItem, 0, len(req.AssetCIDs)+len(req.GroupIDs))
+	for _, cid := range req.AssetCIDs {
+		if _, err := storage.CIDToHash(cid); err != nil {
+			return nil, false
+		}
+		if seen[cid] {
+			continue
+		}
+		seen[cid] = true
+		items = append(items, &model.AssetBatchItem{ItemType: dao.AssetBatchItemAsset, Target: cid})
+	}
+	for _, gid := range req.GroupIDs {
+		if gid <= 0 {
+			return nil, false
+		}
+		target := strconv.FormatInt(gid, 10)
+		if seen[target] {
+			continue
+		}
+		seen[target] = true
+		items = append(items, &model.AssetBatchItem{ItemType: dao.AssetBatchItemGroup, Target: target})
+	}
+
+	return items, len(items) > 0 && len(items) <= maxBulkAssetCount
+}
+
+// RunAssetBatchJob 执行批量任务中还未处理的项, 每一项的结果单独记录, 单项失败不影响其他项;
+// 最后一次重试仍然失败时把任务标记为失败, 避免任务一直处于执行中
+func RunAssetBatchJob(ctx context.Context, jobID string) error {
+	err := runAssetBatchJob(ctx, jobID)
+	if err == nil {
+		return nil
+	}
+
+	if isLastRetry(ctx) {
+		// 任务超时时 ctx 已经取消, 使用新的 context 更新状态
+		if uerr := dao.UpdateAssetBatchJobState(context.Background(), jobID, dao.AssetBatchStateFailed); uerr != nil {
+			log.Errorf("mark asset batch job %s failed: %v", jobID, uerr)
+		}
+	}
+
+	return err
+}
+
+func runAssetBatchJob(ctx context.Context, jobID string) error {
+	job, err := dao.GetAssetBatchJob(ctx, jobID, "")
+	if err == sql.ErrNoRows {
+		log.Errorf("asset batch job %s not found", jobID)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("get asset batch job error:%w", err)
+	}
+	if job.State == dao.AssetBatchStateDone || job.State == dao.AssetBatchStateFailed {
+		return nil
+	}
+
+	var params assetBatchParams
+	if job.Params != "" {
+		if err := json.Unmarshal([]byte(job.Params), &params); err != nil {
+			return fmt.Errorf("unmarshal asset batch params error:%w", err)
+		}
+	}
+
+	if err := dao.UpdateAssetBatchJobState(ctx, job.ID, dao.AssetBatchStateRunning); err != nil {
+		return fmt.Errorf("update asset batch job state error:%w", err)
+	}
+
+	items, err := dao.ListPendingAssetBatchItems(ctx, job.ID)
+	if err != nil {
+		return fmt.Errorf("list pending asset batch items error:%w", err)
+	}
+
+	for _, item := range items {
+		// 任务超时或服务退出时停止, 重试时继续处理剩余的项
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		state, msg := dao.AssetBatchStateSuccess, ""
+		if err := runAssetBatchItem(ctx, job, &params, item); err != nil {
+			state, msg = dao.AssetBatchStateFailed, assetBatchErrorMessage(job, item, err)
+		}
+		if err := dao.FinishAssetBatchItem(ctx, item, state, msg); err != nil {
+			return fmt.Errorf("finish asset batch item error:%w", err)
+		}
+	}
+
+	return dao.UpdateAssetBatchJobState(ctx, job.ID, dao.AssetBatchStateDone)
+}
+
+// assetBatchErrorMessage 返回记录到任务中的错误信息, 内部错误只写日志
+func assetBatchErrorMessage(job *model.AssetBatchJob, item *model.AssetBatchItem, err error) string {
+	switch e := err.(type) {
+	case assetBatchItemError:
+		return e.Error()
+	case *api.ErrWeb:
+		return e.Message
+	}
+
+	log.Errorf("asset batch job %s %s %s %s error: %v", job.ID, job.Operation, item.ItemType, item.Target, err)
+	return errBatchInternal.Error()
+}
+
+func runAssetBatchItem(ctx context.Context, job *model.AssetBatchJob, params *assetBatchParams, item *model.AssetBatchItem) error {
+	if item.ItemType == dao.AssetBatchItemGroup {
+		gid, err := strconv.ParseInt(item.Target, 10, 64)
+		if err != nil {
+			return errBatchGroupNotFound
+		}
+		return runAssetBatchGroup(ctx, job.UserID, job.Operation, params, gid)
+	}
+
+	hash, err := storage.CIDToHash(item.Target)
+	if err != nil {
+		return errBatchAssetNotFound
+	}
+	// 与分享时的判断一致, 回收站中的文件和回收站中文件组下的文件都不处理
+	available, err := dao.AssetAvailable(ctx, job.UserID, hash)
+	if err != nil {
+		return err
+	}
+	if !available {
+		return errBatchAssetNotFound
+	}
+	asset, err := dao.GetUserAsset(ctx, hash, job.UserID)
+	if err == sql.ErrNoRows {
+		return errBatchAssetNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	switch job.Operation {
+	case assetBatchOpDelete:
+		_, err = dao.TrashUserAsset(ctx, hash, job.UserID, trashPurgeAt())
+		if err == sql.ErrNoRows {
+			return errBatchAssetNotFound
+		}
+		return err
+	case assetBatchOpMove:
+		_, err = dao.BulkUpdateAssets(ctx, job.UserID, []string{hash}, nil, nil, params.TargetGroupID)
+		if err == sql.ErrNoRows {
+			return errBatchTargetGroup
+		}
+		return err
+	case assetBatchOpShare:
+		return dao.UpdateAssetShareStatus(ctx, hash, job.UserID)
+	case assetBatchOpUnshare:
+		return dao.CancelAssetShareStatus(ctx, hash, job.UserID)
+	case assetBatchOpTag:
+		_, err = dao.BulkUpdateAssets(ctx, job.UserID, []string{hash}, params.AddTags, params.RemoveTags, nil)
+		return err
+	case assetBatchOpExport:
+		if ipfsCli == nil {
+			return errBatchIPFSUnavailable
+		}
+		cid := asset.Cid
+		if cid == "" {
+			cid = item.Target
+		}
+		return ipfsCli.AddFileByCID(ctx, cid)
+	}
+
+	return errBatchOperationNotFound
+}
+
+func runAssetBatchGroup(ctx context.Context, userID, operation string, params *assetBatchParams, gid int64) error {
+	available, err := dao.AssetGroupAvailable(ctx, userID, gid)
+	if err != nil {
+		return err
+	}
+	if !available {
+		return errBatchGroupNotFound
+	}
+
+	switch operation {
+	case assetBatchOpDelete:
+		_, err = dao.TrashAssetGroup(ctx, userID, int(gid), trashPurgeAt())
+		if err == sql.ErrNoRows {
+			return errBatchGroupNotFound
+		}
+		return err
+	case assetBatchOpMove:
+		return dao.MoveAssetGroup(ctx, userID, int(gid), int(*params.TargetGroupID))
+	case assetBatchOpShare:
+		return dao.UpdateGroupShareStatus(ctx, userID, gid)
+	case assetBatchOpUnshare:
+		return dao.CancelGroupShareStatus(ctx, userID, gid)
+	}
+
+	return errBatchUnsupported
+}
+
+// CreateAssetBatchHandler 新建文件批量操作任务, 在 explorer 队列中异步执行
+// @Summary 文件批量操作
+// @Description operation: delete, move, share, unshare, tag, export; tag 和 export 只支持文件
+// @Security ApiKeyAuth
+// @Tags storage
+// @Param req body assetBatchReq true "请求参数"
+// @Success 200 {object} JsonObject "{job_id:"",total:0}"
+// @Router /api/v1/storage/asset_batch [post]
+func CreateAssetBatchHandler(c *gin.Context) {
+	username := jwt.ExtractClaims(c)[identityKey].(string)
+
+	var req assetBatchReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	items, ok := buildAssetBatchItems(&req)
+	if !ok {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	params, err := json.Marshal(req.assetBatchParams)
+	if err != nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+	if utf8.RuneCount(params) > maxAssetBatchParamsLength {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	now := time.Now()
+	job := &model.AssetBatchJob{
+		ID:        uuid.NewString(),
+		UserID:    username,
+		Operation: req.Operation,
+		Params:    string(params),
+		State:     dao.AssetBatchStatePending,
+		Total:     int64(len(items)),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	SetAuditTarget(c, "asset_batch", job.ID)
+	SetAuditDiff(c, nil, req)
+
+	if err := dao.CreateAssetBatchJob(c.Request.Context(), job, items); err != nil {
+		log.Errorf("CreateAssetBatchJob error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	if err := opasynq.DefaultCli.EnqueueAssetBatch(c.Request.Context(), opasynq.AssetBatchPayload{JobID: job.ID}); err != nil {
+		log.Errorf("EnqueueAssetBatch error: %v", err)
+		if err := dao.UpdateAssetBatchJobState(c.Request.Context(), job.ID, dao.AssetBatchStateFailed); err != nil {
+			log.Errorf("UpdateAssetBatchJobState error: %v", err)
+		}
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"job_id": job.ID,
+		"total":  job.Total,
+	}))
+}
+
+// GetAssetBatchHandler 获取批量任务的进度及每一项的处理结果
+// @Summary 获取文件批量操作任务的进度
+// @Security ApiKeyAuth
+// @Tags storage
+// @Param job_id query string true "任务 ID"
+// @Param state query string false "只返回指定状态的项 pending, success, failed"
+// @Param page query int false "页码"
+// @Param page_size query int false "每页数量"
+// @Success 200 {object} JsonObject "{job:{},list:[],total:0}"
+// @Router /api/v1/storage/asset_batch [get]
+func GetAssetBatchHandler(c *gin.Context) {
+	username := jwt.ExtractClaims(c)[identityKey].(string)
+
+	job, err := dao.GetAssetBatchJob(c.Request.Context(), c.Query("job_id"), username)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusOK, respErrorCode(errors.AssetBatchJobNotFound, c))
+		return
+	}
+	if err != nil {
+		log.Errorf("GetAssetBatchJob error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	page, _ := strconv.Atoi(c.Query("page"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > maxAssetSearchLimit {
+		pageSize = 20
+	}
+
+	total, items, err := dao.ListAssetBatchItems(c.Request.Context(), job.ID, c.Query("state"), pageSize, (page-1)*pageSize)
+	if err != nil {
+		log.Errorf("ListAssetBatchItems error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"job":   job,
+		"list":  items,
+		"total": total,
+	}))
+}
+
+// ListAssetBatchJobsHandler 获取用户的批量任务列表
+// @Summary 获取文件批量操作任务列表
+// @Security ApiKeyAuth
+// @Tags storage
+// @Param page query int false "页码"
+// @Param page_size query int false "每页数量"
+// @Success 200 {object} JsonObject "{list:[],total:0}"
+// @Router /api/v1/storage/asset_batch_list [get]
+func ListAssetBatchJobsHandler(c *gin.Context) {
+	username := jwt.ExtractClaims(c)[identityKey].(string)
+
+	page, _ := strconv.Atoi(c.Query("page"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > maxAssetSearchLimit {
+		pageSize = 20
+	}
+
+	total, list, err := dao.ListAssetBatchJobs(c.Request.Context(), username, pageSize, (page-1)*pageSize)
+	if err != nil {
+		log.Errorf("ListAssetBatchJobs error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list":  list,
+		"total": total,
+	}))
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/dao/daotest"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/core/scheduler"
+	"github.com/gnasnik/titan-explorer/core/storage"
+	"github.com/google/uuid"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+)
+
+func TestBuildAssetBatchItems(t *testing.T) {
+	const cid = "bafkreidtuosuw37f5xmn65b3ksdiikajy7pwjjslzj2lxxz2vc4wdy3zku"
+	target := int64(0)
+
+	cases := []struct {
+		name string
+		req  assetBatchReq
+		want int
+		ok   bool
+	}{
+		{"delete", assetBatchReq{Operation: assetBatchOpDelete, AssetCIDs: []string{cid, cid}, GroupIDs: []int64{1, 1}}, 2, true},
+		{"unknown operation", assetBatchReq{Operation: "copy", AssetCIDs: []string{cid}}, 0, false},
+		{"empty", assetBatchReq{Operation: assetBatchOpShare}, 0, false},
+		{"invalid cid", assetBatchReq{Operation: assetBatchOpUnshare, AssetCIDs: []string{"abc"}}, 0, false},
+		{"invalid group", assetBatchReq{Operation: assetBatchOpDelete, GroupIDs: []int64{0}}, 0, false},
+		{"move without target", assetBatchReq{Operation: assetBatchOpMove, AssetCIDs: []string{cid}}, 0, false},
+		{"move to root", assetBatchReq{Operation: assetBatchOpMove, AssetCIDs: []string{cid}, assetBatchParams: assetBatchParams{TargetGroupID: &target}}, 1, true},
+		{"tag without tags", assetBatchReq{Operation: assetBatchOpTag, AssetCIDs: []string{cid}, assetBatchParams: assetBatchParams{AddTags: []string{" "}}}, 0, false},
+		{"tag group", assetBatchReq{Operation: assetBatchOpTag, GroupIDs: []int64{1}, assetBatchParams: assetBatchParams{AddTags: []string{"a"}}}, 0, false},
+		{"tag", assetBatchReq{Operation: assetBatchOpTag, AssetCIDs: []string{cid}, assetBatchParams: assetBatchParams{RemoveTags: []string{"a"}}}, 1, true},
+		{"export group", assetBatchReq{Operation: assetBatchOpExport, GroupIDs: []int64{1}}, 0, false},
+	}
+
+	for _, c := range cases {
+		items, ok := buildAssetBatchItems(&c.req)
+		if ok != c.ok || len(items) != c.want {
+			t.Errorf("%s: got %d items ok=%v, want %d ok=%v", c.name, len(items), ok, c.want, c.ok)
+		}
+	}
+}
+
+// testBatchCID 根据内容生成测试用的 cid
+func testBatchCID(t *testing.T, data string) (string, string) {
+	t.Helper()
+
+	c, err := cid.Prefix{Version: 1, Codec: cid.Raw, MhType: multihash.SHA2_256, MhLength: -1}.Sum([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := storage.CIDToHash(c.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.String(), hash
+}
+
+func TestRunAssetBatchJob(t *testing.T) {
+	db := daotest.Open(t)
+	ctx := context.Background()
+
+	const username = "asset_batch_test_user"
+	rootCID, rootHash := testBatchCID(t, "asset_batch_test_root")
+	trashedCID, trashedHash := testBatchCID(t, "asset_batch_test_trashed")
+	missingCID, _ := testBatchCID(t, "asset_batch_test_missing")
+
+	cleanup := func() {
+		for _, table := range []string{"user_asset", "user_asset_area", "user_asset_map", "user_asset_group", "user_trash"} {
+			daotest.Exec(t, db, `DELETE FROM `+table+` WHERE user_id = ?`, username)
+		}
+		daotest.Exec(t, db, `DELETE FROM asset_batch_item WHERE job_id IN (SELECT id FROM asset_batch_job WHERE user_id = ?)`, username)
+		daotest.Exec(t, db, `DELETE FROM asset_batch_job WHERE user_id = ?`, username)
+		daotest.Exec(t, db, `DELETE FROM users WHERE username = ?`, username)
+		daotest.Exec(t, db, `DELETE FROM content WHERE hash IN (?, ?)`, rootHash, trashedHash)
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+
+	daotest.Exec(t, db, `INSERT INTO users (username, used_storage_size) VALUES (?, 0)`, username)
+	group, err := dao.CreateAssetGroup(ctx, username, "archive", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range []struct {
+		cid, hash string
+		gid       int64
+	}{{rootCID, rootHash, 0}, {trashedCID, trashedHash, group.ID}} {
+		err := dao.AddAssetAndUpdateSize(ctx, &model.UserAsset{
+			UserID: username, Hash: a.hash, Cid: a.cid, AssetName: a.cid, TotalSize: 10, GroupID: a.gid, CreatedTime: time.Now(),
+		}, []string{scheduler.DefaultAreaId}, scheduler.DefaultAreaId)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := dao.TrashAssetGroup(ctx, username, int(group.ID), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	job := &model.AssetBatchJob{
+		ID: uuid.NewString(), UserID: username, Operation: assetBatchOpShare, State: dao.AssetBatchStatePending,
+		Total: 4, CreatedAt: time.Now(), UpdatedAt: time.Now(),
+	}
+	items := []*model.AssetBatchItem{
+		{ItemType: dao.AssetBatchItemAsset, Target: rootCID},
+		{ItemType: dao.AssetBatchItemAsset, Target: trashedCID},
+		{ItemType: dao.AssetBatchItemAsset, Target: missingCID},
+		{ItemType: dao.AssetBatchItemGroup, Target: strconv.FormatInt(group.ID, 10)},
+	}
+	if err := dao.CreateAssetBatchJob(ctx, job, items); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RunAssetBatchJob(ctx, job.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := dao.GetAssetBatchJob(ctx, job.ID, username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.State != dao.AssetBatchStateDone || got.Succeeded != 1 || got.Failed != 3 {
+		t.Fatalf("unexpected job result %+v", got)
+	}
+
+	_, results, err := dao.ListAssetBatchItems(ctx, job.ID, "", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 回收站中文件组下的文件和文件组本身都按不存在处理
+	want := map[string]string{
+		rootCID:                         "",
+		trashedCID:                      errBatchAssetNotFound.Error(),
+		missingCID:                      errBatchAssetNotFound.Error(),
+		strconv.FormatInt(group.ID, 10): errBatchGroupNotFound.Error(),
+	}
+	for _, item := range results {
+		if item.Error != want[item.Target] {
+			t.Errorf("item %s: expected error %q, got %q", item.Target, want[item.Target], item.Error)
+		}
+	}
+
+	var shared, trashedShared int64
+	if err := db.Get(&shared, `SELECT share_status FROM user_asset WHERE user_id = ? AND hash = ?`, username, rootHash); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Get(&trashedShared, `SELECT share_status FROM user_asset WHERE user_id = ? AND hash = ?`, username, trashedHash); err != nil {
+		t.Fatal(err)
+	}
+	if shared != 1 || trashedShared != 0 {
+		t.Fatalf("expect only the available asset to be shared, got %d %d", shared, trashedShared)
+	}
+
+	// 已完成的任务再次执行时直接跳过
+	if err := RunAssetBatchJob(ctx, job.ID); err != nil {
+		t.Fatal(err)
+	}
+}
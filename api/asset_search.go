@@ -0,0 +1,366 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Filecoin-Titan/titan/api/terrors"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/core/storage"
+	"github.com/gnasnik/titan-explorer/pkg/formatter"
+)
+
+const (
+	maxAssetTags        = 20
+	maxAssetTagLength   = 64
+	maxAssetMetaKeys    = 50
+	maxAssetMetaKeyLen  = 64
+	maxAssetMetaValLen  = 1024
+	maxBulkAssetCount   = 1000
+	maxAssetSearchLimit = 100
+)
+
+type assetSearchItem struct {
+	*dao.UserAssetDetail
+	Tags []string          `json:"tags"`
+	Meta map[string]string `json:"meta"`
+}
+
+type updateAssetMetaReq struct {
+	AssetCID string            `json:"asset_cid" binding:"required"`
+	Tags     []string          `json:"tags"`
+	Meta     map[string]string `json:"meta"`
+}
+
+type bulkAssetReq struct {
+	AssetCIDs  []string `json:"asset_cids" binding:"required"`
+	AddTags    []string `json:"add_tags"`
+	RemoveTags []string `json:"remove_tags"`
+	GroupID    *int64   `json:"group_id"`
+}
+
+// normalizeTags 去掉标签的首尾空白和重复项, 标签过长或数量过多时返回 false; 参数为 nil 时返回 nil
+func normalizeTags(tags []string) ([]string, bool) {
+	if tags == nil {
+		return nil, true
+	}
+
+	out := make([]string, 0, len(tags))
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxAssetTagLength {
+			return nil, false
+		}
+		seen[tag] = true
+		out = append(out, tag)
+	}
+
+	return out, len(out) <= maxAssetTags
+}
+
+// normalizeAssetMeta 校验文件元数据的键和值的长度以及数量; 参数为 nil 时返回 nil
+func normalizeAssetMeta(meta map[string]string) (map[string]string, bool) {
+	if meta == nil {
+		return nil, true
+	}
+	if len(meta) > maxAssetMetaKeys {
+		return nil, false
+	}
+
+	out := make(map[string]string, len(meta))
+	for k, v := range meta {
+		k = strings.TrimSpace(k)
+		if k == "" || utf8.RuneCountInString(k) > maxAssetMetaKeyLen || utf8.RuneCountInString(v) > maxAssetMetaValLen {
+			return nil, false
+		}
+		out[k] = v
+	}
+
+	return out, true
+}
+
+// parseAssetSearchOption 解析文件搜索的查询参数
+func parseAssetSearchOption(c *gin.Context) (*dao.AssetSearchOption, bool) {
+	opt := &dao.AssetSearchOption{
+		Name:      strings.TrimSpace(c.Query("name")),
+		AssetType: c.Query("type"),
+		AreaID:    c.Query("area_id"),
+		SortBy:    c.DefaultQuery("sort", "created_time"),
+		Desc:      c.DefaultQuery("order", "desc") != "asc",
+	}
+
+	tags, ok := normalizeTags(c.QueryArray("tag"))
+	if !ok {
+		return nil, false
+	}
+	opt.Tags = tags
+
+	var err error
+	if v := c.Query("min_size"); v != "" {
+		if opt.MinSize, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, false
+		}
+	}
+	if v := c.Query("max_size"); v != "" {
+		if opt.MaxSize, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, false
+		}
+	}
+	if v := c.Query("start"); v != "" {
+		if opt.CreatedFrom, err = time.ParseInLocation(formatter.TimeFormatDateOnly, v, time.Local); err != nil {
+			return nil, false
+		}
+	}
+	if v := c.Query("end"); v != "" {
+		end, err := time.ParseInLocation(formatter.TimeFormatDateOnly, v, time.Local)
+		if err != nil {
+			return nil, false
+		}
+		opt.CreatedTo = end.AddDate(0, 0, 1)
+	}
+	if v := c.Query("share_status"); v != "" {
+		status, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		opt.ShareStatus = &status
+	}
+	if v := c.Query("group_id"); v != "" {
+		gid, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || gid < 0 {
+			return nil, false
+		}
+		opt.GroupID = &gid
+	}
+
+	page, _ := strconv.Atoi(c.Query("page"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > maxAssetSearchLimit {
+		pageSize = 20
+	}
+	opt.Limit = pageSize
+	opt.Offset = (page - 1) * pageSize
+
+	return opt, true
+}
+
+// SearchAssetsHandler 搜索用户的文件
+// @Summary 搜索用户的文件
+// @Security ApiKeyAuth
+// @Tags storage
+// @Param name query string false "文件名包含的内容"
+// @Param type query string false "文件类型"
+// @Param tag query []string false "标签, 可以指定多个, 需要同时包含"
+// @Param min_size query int false "最小文件大小"
+// @Param max_size query int false "最大文件大小"
+// @Param start query string false "创建日期开始 2006-01-02"
+// @Param end query string false "创建日期结束 2006-01-02"
+// @Param share_status query int false "分享状态"
+// @Param area_id query string false "区域"
+// @Param group_id query int false "文件组"
+// @Param sort query string false "排序字段 created_time, name, size"
+// @Param order query string false "asc 或 desc, 默认 desc"
+// @Param page query int false "页码"
+// @Param page_size query int false "每页数量"
+// @Success 200 {object} JsonObject "{list:[],total:0}"
+// @Router /api/v1/storage/asset_search [get]
+func SearchAssetsHandler(c *gin.Context) {
+	username := jwt.ExtractClaims(c)[identityKey].(string)
+
+	opt, ok := parseAssetSearchOption(c)
+	if !ok {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	total, infos, err := dao.SearchAssets(c.Request.Context(), username, opt)
+	if err != nil {
+		log.Errorf("SearchAssets error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	hashes := make([]string, 0, len(infos))
+	for _, info := range infos {
+		hashes = append(hashes, info.Hash)
+	}
+	tags, metas, err := dao.GetAssetsTagsAndMeta(c.Request.Context(), username, hashes)
+	if err != nil {
+		log.Errorf("GetAssetsTagsAndMeta error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	areaIDs, err := dao.GetUserAssetsAreaIDs(c.Request.Context(), username, hashes)
+	if err != nil {
+		log.Errorf("GetUserAssetsAreaIDs error: %v", err)
+	}
+
+	list := make([]*assetSearchItem, 0, len(infos))
+	for _, info := range infos {
+		info.AreaIDs = areaIDs[info.Hash]
+		if info.Cid == "" {
+			info.Cid, _ = storage.HashToCID(info.Hash)
+		}
+
+		list = append(list, &assetSearchItem{
+			UserAssetDetail: info,
+			Tags:            tags[info.Hash],
+			Meta:            metas[info.Hash],
+		})
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list":  list,
+		"total": total,
+	}))
+}
+
+// GetAssetTagsHandler 获取用户所有的标签
+// @Summary 获取用户所有的标签
+// @Security ApiKeyAuth
+// @Tags storage
+// @Success 200 {object} JsonObject "{list:[{tag:"",count:0}]}"
+// @Router /api/v1/storage/asset_tags [get]
+func GetAssetTagsHandler(c *gin.Context) {
+	username := jwt.ExtractClaims(c)[identityKey].(string)
+
+	list, err := dao.ListUserAssetTags(c.Request.Context(), username)
+	if err != nil {
+		log.Errorf("ListUserAssetTags error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list": list,
+	}))
+}
+
+// UpdateAssetMetaHandler 修改文件的标签和元数据, 不传的字段保持不变, 传空时清空
+// @Summary 修改文件的标签和元数据
+// @Security ApiKeyAuth
+// @Tags storage
+// @Param req body updateAssetMetaReq true "请求参数"
+// @Success 200 {object} JsonObject "{msg:"success"}"
+// @Router /api/v1/storage/asset_meta [post]
+func UpdateAssetMetaHandler(c *gin.Context) {
+	username := jwt.ExtractClaims(c)[identityKey].(string)
+
+	var req updateAssetMetaReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	tags, ok := normalizeTags(req.Tags)
+	if !ok {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+	meta, ok := normalizeAssetMeta(req.Meta)
+	if !ok {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	hash, err := storage.CIDToHash(req.AssetCID)
+	if err != nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	_, err = dao.GetUserAsset(c.Request.Context(), hash, username)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
+		return
+	}
+	if err != nil {
+		log.Errorf("GetUserAsset error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	SetAuditTarget(c, "asset", req.AssetCID)
+
+	if err := dao.UpdateAssetTagsAndMeta(c.Request.Context(), username, hash, tags, meta); err != nil {
+		log.Errorf("UpdateAssetTagsAndMeta error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"msg": "success",
+	}))
+}
+
+// BulkAssetHandler 批量给文件添加、删除标签或移动到指定的文件组
+// @Summary 批量修改文件的标签和文件组
+// @Security ApiKeyAuth
+// @Tags storage
+// @Param req body bulkAssetReq true "请求参数"
+// @Success 200 {object} JsonObject "{moved:0}"
+// @Router /api/v1/storage/asset_bulk [post]
+func BulkAssetHandler(c *gin.Context) {
+	username := jwt.ExtractClaims(c)[identityKey].(string)
+
+	var req bulkAssetReq
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.AssetCIDs) == 0 || len(req.AssetCIDs) > maxBulkAssetCount ||
+		(req.GroupID != nil && *req.GroupID < 0) {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	addTags, ok := normalizeTags(req.AddTags)
+	if !ok {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+	removeTags, ok := normalizeTags(req.RemoveTags)
+	if !ok {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	hashes := make([]string, 0, len(req.AssetCIDs))
+	for _, cid := range req.AssetCIDs {
+		hash, err := storage.CIDToHash(cid)
+		if err != nil {
+			c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+			return
+		}
+		hashes = append(hashes, hash)
+	}
+
+	SetAuditTarget(c, "asset", username)
+	SetAuditDiff(c, nil, req)
+
+	moved, err := dao.BulkUpdateAssets(c.Request.Context(), username, hashes, addTags, removeTags, req.GroupID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusOK, respErrorCode(int(terrors.GroupNotExist), c))
+		return
+	}
+	if err != nil {
+		log.Errorf("BulkUpdateAssets error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"moved": moved,
+	}))
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tags, ok := normalizeTags([]string{" work ", "", "photo", "work"})
+	if !ok || !reflect.DeepEqual(tags, []string{"work", "photo"}) {
+		t.Errorf("normalizeTags = %v, %v", tags, ok)
+	}
+
+	if tags, ok := normalizeTags(nil); !ok || tags != nil {
+		t.Errorf("normalizeTags(nil) = %v, %v", tags, ok)
+	}
+
+	if _, ok := normalizeTags([]string{strings.Repeat("标", maxAssetTagLength+1)}); ok {
+		t.Error("normalizeTags should reject long tag")
+	}
+
+	many := make([]string, maxAssetTags+1)
+	for i := range many {
+		many[i] = strings.Repeat("a", i+1)
+	}
+	if _, ok := normalizeTags(many); ok {
+		t.Error("normalizeTags should reject too many tags")
+	}
+}
+
+func TestParseAssetSearchOption(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	parse := func(query string) (*assetSearchOptionResult, bool) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/storage/asset_search?"+query, nil)
+		opt, ok := parseAssetSearchOption(c)
+		if !ok {
+			return nil, false
+		}
+		return &assetSearchOptionResult{opt.Tags, opt.MinSize, opt.MaxSize, opt.CreatedFrom, opt.CreatedTo, opt.Limit, opt.Offset}, true
+	}
+
+	got, ok := parse("tag=work&tag=+photo+&tag=work&min_size=10&max_size=100&start=2025-05-01&end=2025-05-02&page=3&page_size=10")
+	if !ok {
+		t.Fatal("valid query should be parsed")
+	}
+	want := &assetSearchOptionResult{
+		Tags:        []string{"work", "photo"},
+		MinSize:     10,
+		MaxSize:     100,
+		CreatedFrom: time.Date(2025, 5, 1, 0, 0, 0, 0, time.Local),
+		// 结束日期包含当天
+		CreatedTo: time.Date(2025, 5, 3, 0, 0, 0, 0, time.Local),
+		Limit:     10,
+		Offset:    20,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseAssetSearchOption = %+v, want %+v", got, want)
+	}
+
+	if got, _ := parse("page_size=1000"); got.Limit != 20 || got.Offset != 0 {
+		t.Errorf("page size over the limit should use the default, got %+v", got)
+	}
+
+	for _, query := range []string{"min_size=abc", "start=2025/05/01", "group_id=-1", "share_status=x"} {
+		if _, ok := parse(query); ok {
+			t.Errorf("query %q should be rejected", query)
+		}
+	}
+}
+
+type assetSearchOptionResult struct {
+	Tags        []string
+	MinSize     int64
+	MaxSize     int64
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	Limit       int
+	Offset      int
+}
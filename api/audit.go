@@ -0,0 +1,352 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/core/oplog"
+	"github.com/gnasnik/titan-explorer/pkg/formatter"
+	"github.com/gnasnik/titan-explorer/pkg/iptool"
+)
+
+const (
+	auditContextKey = "AUDIT_OPERATION_LOG"
+
+	// 审计记录中请求参数和响应结果的最大长度
+	auditMaxBodySize   = 64 << 10
+	auditMaxParamSize  = 2000
+	auditMaxResultSize = 2000
+
+	// operation_log 中 varchar 字段的长度
+	auditMaxTitleSize  = 50
+	auditMaxActionSize = 64
+	auditMaxActorSize  = 128
+	auditMaxURLSize    = 500
+	auditMaxTargetSize = 255
+	auditMaxAgentSize  = 512
+	auditMaxErrorSize  = 2000
+
+	auditRedacted = "******"
+)
+
+const (
+	operationStatusFailure = iota
+	operationStatusSuccess
+)
+
+const (
+	operatorTypeUser = iota
+	operatorTypeTenant
+)
+
+// auditGetRoutes 使用 GET 方法但会修改数据的接口, 其余 GET 请求不记录
+var auditGetRoutes = map[string]string{
+	"/api/v1/storage/delete_asset":        "asset.delete",
+	"/api/v1/storage/share_status_set":    "asset.share_status",
+	"/api/v1/storage/move_asset_to_group": "asset.move",
+	"/api/v1/storage/create_group":        "group.create",
+	"/api/v1/storage/delete_group":        "group.delete",
+	"/api/v1/storage/move_group_to_group": "group.move",
+	"/api/v1/storage/create_key":          "key.create",
+	"/api/v1/storage/delete_key":          "key.delete",
+	"/api/v1/storage/new_secret":          "key.new_secret",
+}
+
+// auditSkipRoutes 调用频繁的数据面接口, 不记录操作日志
+var auditSkipRoutes = map[string]bool{
+	"/api/v1/storage/transfer/report":       true,
+	"/api/v1/storage/upload_session/part":   true,
+	"/api/v1/storage/upload_session/resume": true,
+	"/api/v1/storage/ipfs_info":             true,
+}
+
+// auditSensitiveKeys 请求参数中需要脱敏的字段
+var auditSensitiveKeys = []string{
+	"password", "passwd", "pass", "secret", "token", "sign", "signature", "verify_code", "code",
+	"key", "api_key", "private_key", "public_key", "crt",
+}
+
+// OperationAuditMiddleware 自动记录修改类请求的操作日志, 操作者取自 JWT, 请求参数会脱敏后保存
+func OperationAuditMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		action, ok := auditAction(c)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		record := &model.OperationLog{
+			Title:         action,
+			Action:        action,
+			Method:        c.HandlerName(),
+			RequestMethod: c.Request.Method,
+			OperatorUrl:   redactURL(c.Request.URL),
+			OperatorIp:    iptool.GetClientIP(c.Request),
+			OperatorParam: formatter.Truncate(redactRequestBody(c), auditMaxParamSize),
+			UserAgent:     c.Request.UserAgent(),
+			CreatedAt:     time.Now(),
+		}
+		c.Set(auditContextKey, record)
+
+		writer := &auditResponseWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		c.Next()
+
+		// 处理完请求后再取操作者, 登录态可能由后续的中间件写入
+		fillAuditOperator(c, record)
+		fillAuditResult(record, writer)
+		fitAuditRecord(record)
+
+		oplog.AddOperationLog(record)
+	}
+}
+
+// SetAuditTarget 设置本次操作的对象, 只在经过审计中间件的请求中生效
+func SetAuditTarget(c *gin.Context, targetType string, targetID interface{}) {
+	record := getAuditRecord(c)
+	if record == nil {
+		return
+	}
+
+	record.TargetType = targetType
+	switch v := targetID.(type) {
+	case string:
+		record.TargetID = v
+	default:
+		b, _ := json.Marshal(v)
+		record.TargetID = strings.Trim(string(b), `"`)
+	}
+}
+
+// SetAuditDiff 设置本次操作对象修改前后的数据
+func SetAuditDiff(c *gin.Context, before, after interface{}) {
+	record := getAuditRecord(c)
+	if record == nil {
+		return
+	}
+
+	record.SetDiff(before, after)
+}
+
+// SetAuditAction 覆盖按路由生成的操作类型
+func SetAuditAction(c *gin.Context, action string) {
+	record := getAuditRecord(c)
+	if record == nil {
+		return
+	}
+
+	record.Action = action
+	record.Title = action
+}
+
+func getAuditRecord(c *gin.Context) *model.OperationLog {
+	v, ok := c.Get(auditContextKey)
+	if !ok {
+		return nil
+	}
+	record, _ := v.(*model.OperationLog)
+	return record
+}
+
+// auditAction 根据路由生成操作类型, 如 /api/v1/admin/kol/add => admin.kol.add
+func auditAction(c *gin.Context) (string, bool) {
+	path := c.FullPath()
+	if path == "" || auditSkipRoutes[path] {
+		return "", false
+	}
+
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead || c.Request.Method == http.MethodOptions {
+		action, ok := auditGetRoutes[path]
+		return action, ok
+	}
+
+	action := strings.TrimPrefix(path, "/api/v1/")
+	action = strings.Trim(action, "/")
+	action = strings.ReplaceAll(action, "/", ".")
+	if c.Request.Method == http.MethodDelete {
+		action += ".delete"
+	}
+	return action, true
+}
+
+func fillAuditOperator(c *gin.Context, record *model.OperationLog) {
+	claims := jwt.ExtractClaims(c)
+
+	username, _ := claims[identityKey].(string)
+	tenant, _ := claims[tenantID].(string)
+
+	record.OperatorUsername = username
+	record.Actor = username
+	record.OperatorType = operatorTypeUser
+
+	if username == "" && tenant != "" {
+		record.Actor = tenant
+		record.OperatorType = operatorTypeTenant
+	}
+}
+
+// fillAuditResult 根据响应设置操作结果, 响应内容同样需要脱敏
+func fillAuditResult(record *model.OperationLog, writer *auditResponseWriter) {
+	record.Status = operationStatusSuccess
+
+	var result interface{}
+	if err := json.Unmarshal(writer.body.Bytes(), &result); err == nil {
+		b, _ := json.Marshal(redactJSON(result))
+		record.JsonResult = formatter.Truncate(string(b), auditMaxResultSize)
+	} else if !writer.truncated {
+		record.JsonResult = formatter.Truncate(writer.body.String(), auditMaxResultSize)
+	}
+
+	if writer.Status() >= http.StatusBadRequest {
+		record.Status = operationStatusFailure
+		record.ErrorMsg = record.JsonResult
+		return
+	}
+
+	var resp struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if err := json.Unmarshal(writer.body.Bytes(), &resp); err == nil && resp.Code != 0 {
+		record.Status = operationStatusFailure
+		record.ErrorMsg = resp.Msg
+	}
+}
+
+// redactRequestBody 读取并脱敏请求体, 读取后会恢复请求体供后续处理使用; 上传文件等大请求只记录类型
+func redactRequestBody(c *gin.Context) string {
+	if c.Request.Method == http.MethodGet || c.Request.Body == nil {
+		return ""
+	}
+
+	contentType := c.ContentType()
+	if contentType == gin.MIMEMultipartPOSTForm {
+		return "[multipart]"
+	}
+	if c.Request.ContentLength > auditMaxBodySize {
+		return "[body too large]"
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, auditMaxBodySize+1))
+	if err != nil {
+		return ""
+	}
+	c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+
+	if len(body) > auditMaxBodySize {
+		return "[body too large]"
+	}
+
+	switch contentType {
+	case gin.MIMEPOSTForm:
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return ""
+		}
+		return redactValues(values).Encode()
+	default:
+		var v interface{}
+		if err := json.Unmarshal(body, &v); err != nil {
+			return ""
+		}
+		b, _ := json.Marshal(redactJSON(v))
+		return string(b)
+	}
+}
+
+func redactURL(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.Path
+	}
+
+	return u.Path + "?" + redactValues(u.Query()).Encode()
+}
+
+func redactValues(values url.Values) url.Values {
+	for k := range values {
+		if isSensitiveKey(k) {
+			values[k] = []string{auditRedacted}
+		}
+	}
+	return values
+}
+
+func redactJSON(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, item := range val {
+			if isSensitiveKey(k) {
+				val[k] = auditRedacted
+				continue
+			}
+			val[k] = redactJSON(item)
+		}
+		return val
+	case []interface{}:
+		for i, item := range val {
+			val[i] = redactJSON(item)
+		}
+		return val
+	default:
+		return v
+	}
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	if strings.Contains(key, "password") || strings.Contains(key, "secret") {
+		return true
+	}
+	for _, s := range auditSensitiveKeys {
+		if key == s || strings.HasSuffix(key, "_"+s) {
+			return true
+		}
+	}
+	return false
+}
+
+// fitAuditRecord 按字符截断超过字段长度的内容, 避免写入时因为字段过长导致整条记录丢失
+func fitAuditRecord(record *model.OperationLog) {
+	record.Title = formatter.Truncate(record.Title, auditMaxTitleSize)
+	record.Action = formatter.Truncate(record.Action, auditMaxActionSize)
+	record.Actor = formatter.Truncate(record.Actor, auditMaxActorSize)
+	record.OperatorUrl = formatter.Truncate(record.OperatorUrl, auditMaxURLSize)
+	record.TargetType = formatter.Truncate(record.TargetType, auditMaxActionSize)
+	record.TargetID = formatter.Truncate(record.TargetID, auditMaxTargetSize)
+	record.UserAgent = formatter.Truncate(record.UserAgent, auditMaxAgentSize)
+	record.ErrorMsg = formatter.Truncate(record.ErrorMsg, auditMaxErrorSize)
+}
+
+// auditResponseWriter 记录响应结果的前 auditMaxBodySize 个字节
+type auditResponseWriter struct {
+	gin.ResponseWriter
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	remain := auditMaxBodySize - w.body.Len()
+	switch {
+	case remain <= 0:
+		w.truncated = true
+	case len(b) > remain:
+		w.body.Write(b[:remain])
+		w.truncated = true
+	default:
+		w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *auditResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
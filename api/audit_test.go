@@ -0,0 +1,131 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAuditAction(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var (
+		action string
+		ok     bool
+	)
+	handler := func(c *gin.Context) { action, ok = auditAction(c) }
+
+	r := gin.New()
+	r.POST("/api/v1/admin/kol/add", handler)
+	r.DELETE("/api/v1/tenant/user", handler)
+	r.GET("/api/v1/storage/delete_asset", handler)
+	r.GET("/api/v1/storage/get_asset_list", handler)
+	r.POST("/api/v1/storage/upload_session/part", handler)
+	r.POST("/api/v1/storage/transfer/report", handler)
+
+	cases := []struct {
+		method string
+		path   string
+		action string
+		ok     bool
+	}{
+		{http.MethodPost, "/api/v1/admin/kol/add", "admin.kol.add", true},
+		{http.MethodDelete, "/api/v1/tenant/user", "tenant.user.delete", true},
+		// 会修改数据的 GET 接口按配置的操作类型记录
+		{http.MethodGet, "/api/v1/storage/delete_asset", "asset.delete", true},
+		{http.MethodGet, "/api/v1/storage/get_asset_list", "", false},
+		// 数据面接口不记录
+		{http.MethodPost, "/api/v1/storage/upload_session/part", "", false},
+		{http.MethodPost, "/api/v1/storage/transfer/report", "", false},
+	}
+
+	for _, cs := range cases {
+		action, ok = "", false
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(cs.method, cs.path, nil))
+		if action != cs.action || ok != cs.ok {
+			t.Errorf("%s %s: expected %q %v, got %q %v", cs.method, cs.path, cs.action, cs.ok, action, ok)
+		}
+	}
+}
+
+func TestRedactRequestBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		contentType string
+		body        string
+		contains    []string
+		excludes    []string
+	}{
+		{
+			contentType: gin.MIMEJSON,
+			body:        `{"username":"alice","password":"p@ss","nested":{"api_key":"k1","list":[{"secret_token":"s1"}]}}`,
+			contains:    []string{`"username":"alice"`, `"password":"` + auditRedacted + `"`, `"api_key":"` + auditRedacted + `"`},
+			excludes:    []string{"p@ss", "k1", "s1"},
+		},
+		{
+			contentType: gin.MIMEPOSTForm,
+			body:        "username=alice&verify_code=123456&new_password=p@ss",
+			contains:    []string{"username=alice", "verify_code=" + url.QueryEscape(auditRedacted)},
+			excludes:    []string{"123456", "p@ss"},
+		},
+		{
+			contentType: gin.MIMEMultipartPOSTForm,
+			body:        "--boundary--",
+			contains:    []string{"[multipart]"},
+		},
+	}
+
+	for _, cs := range cases {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/admin/kol/add", strings.NewReader(cs.body))
+		c.Request.Header.Set("Content-Type", cs.contentType)
+
+		got := redactRequestBody(c)
+		for _, s := range cs.contains {
+			if !strings.Contains(got, s) {
+				t.Errorf("%s: expected %q in %q", cs.contentType, s, got)
+			}
+		}
+		for _, s := range cs.excludes {
+			if strings.Contains(got, s) {
+				t.Errorf("%s: %q should be redacted in %q", cs.contentType, s, got)
+			}
+		}
+
+		// 读取后请求体需要恢复给后续的处理函数
+		if body, _ := io.ReadAll(c.Request.Body); string(body) != cs.body {
+			t.Errorf("%s: request body not restored, got %q", cs.contentType, body)
+		}
+	}
+}
+
+func TestRedactURL(t *testing.T) {
+	u, _ := url.Parse("/api/v1/storage/create_key?key_name=k&token=abc&sign=xyz")
+	got := redactURL(u)
+	if strings.Contains(got, "abc") || strings.Contains(got, "xyz") || !strings.Contains(got, "key_name=k") {
+		t.Fatalf("unexpected redacted url %q", got)
+	}
+
+	if got := redactURL(&url.URL{Path: "/api/v1/admin/kol/add"}); got != "/api/v1/admin/kol/add" {
+		t.Fatalf("url without query should be kept, got %q", got)
+	}
+}
+
+func TestIsSensitiveKey(t *testing.T) {
+	for _, key := range []string{"password", "Old_Password", "app_secret", "token", "access_token", "verify_code", "private_key"} {
+		if !isSensitiveKey(key) {
+			t.Errorf("%s should be sensitive", key)
+		}
+	}
+	for _, key := range []string{"username", "area_id", "group_id", "keyword"} {
+		if isSensitiveKey(key) {
+			t.Errorf("%s should not be sensitive", key)
+		}
+	}
+}
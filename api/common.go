@@ -26,11 +26,13 @@ import (
 	"github.com/gnasnik/titan-explorer/core/generated/model"
 	"github.com/gnasnik/titan-explorer/core/geo"
 	"github.com/gnasnik/titan-explorer/core/oprds"
+	"github.com/gnasnik/titan-explorer/core/scheduler"
 	"github.com/gnasnik/titan-explorer/core/statistics"
 	"github.com/gnasnik/titan-explorer/core/storage"
 	"github.com/shopspring/decimal"
 )
 
+// 没有配置套餐时的每月流量上限
 const (
 	maxTotalFlow    = 1 * 1024 * 1024 * 1024
 	maxVipTotalFlow = 1000 * 1024 * 1024 * 1024
@@ -560,19 +562,20 @@ func GetAreaIPByID(ctx context.Context, areaID string) (string, error) {
 		return ip.(string), nil
 	}
 
-	schedulers, err := statistics.GetSchedulerConfigs(ctx, fmt.Sprintf("%s::%s", SchedulerConfigKeyPrefix, areaID))
+	uri, err := scheduler.URL(ctx, areaID)
 	if err != nil {
 		return "", err
 	}
-	uri := schedulers[0].SchedulerURL
 	aurl, err := url.Parse(uri)
 	if err != nil {
 		return "", err
 	}
-	uri, _, _ = strings.Cut(aurl.Host, ":")
-	ips, err := net.LookupIP(uri)
+	ips, err := net.LookupIP(aurl.Hostname())
 	if err != nil {
-		return "", nil
+		return "", err
+	}
+	if len(ips) == 0 {
+		return "", fmt.Errorf("no ip found for scheduler %s", uri)
 	}
 	AreaIDIPMaps.Store(areaID, ips[0].String())
 	AreaIPIDMaps.Store(ips[0].String(), areaID)
@@ -843,53 +846,6 @@ func getAreaIDsCountry(areaIDs []string) []string {
 	return newAreaIDs
 }
 
-// checkUserTotalFlow 判断用户使用总流量是否到达最大限制
-func checkUserTotalFlow(ctx context.Context, username string) (bool, error) {
-	if username == "titan17ljevhtqu4vx6y7k743jyca0w8gyfu2466e8x3" {
-		return true, nil
-	}
-	var (
-		fInfo = new(dao.UserStorageFlowInfo)
-	)
-
-	// 获取用户信息，判断用户是否为vip
-	user, err := dao.GetUserByUsername(ctx, username)
-	if err != nil {
-		return false, fmt.Errorf("get userInfo error:%w", err)
-	}
-
-	// 获取用户已使用的总流量
-	value, err := oprds.GetClient().GetUserStorageFlowInfo(ctx, username)
-	if err != nil {
-		fInfo, err = dao.GetUserStorageFlowInfo(ctx, username)
-		if err != nil {
-			fInfo = new(dao.UserStorageFlowInfo)
-			return false, err
-		}
-		ib, _ := json.Marshal(fInfo)
-		oprds.GetClient().StoreUserStorageFlowInfo(ctx, username, string(ib))
-	} else {
-		json.Unmarshal([]byte(value), fInfo)
-	}
-	// 判断是否为vip
-	switch {
-	case user.EnableVIP:
-		if fInfo.TotalTraffic < maxVipTotalFlow {
-			return true, nil
-		}
-
-	case user.TenantID != "":
-		return true, nil
-
-	default:
-		if fInfo.TotalTraffic < maxTotalFlow {
-			return true, nil
-		}
-	}
-
-	return false, nil
-}
-
 // 判断 apikey 是否存在
 func checkAPIKeyIsExist(apiKey, uid string) (bool, error) {
 	info, err := dao.GetUserByUsername(context.Background(), uid)
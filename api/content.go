@@ -0,0 +1,60 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/core/opasynq"
+)
+
+const defaultDedupTopSize = 20
+
+// removeReleasedContents 区域中已经没有用户引用的内容, 加入队列从调度器中删除
+func removeReleasedContents(ctx context.Context, released []*model.Content) {
+	for _, content := range released {
+		err := opasynq.DefaultCli.EnqueueDeleteAssetOperation(ctx, opasynq.DeleteAssetPayload{
+			CID: content.Cid, AreaID: content.AreaID,
+		})
+		if err != nil {
+			log.Errorf("EnqueueDeleteAssetOperation error %+v", err)
+		}
+	}
+}
+
+// GetContentDedupReportHandler 内容去重节省的存储空间报告
+// @Summary 内容去重报告
+// @Tags admin
+// @Param top query int false "返回节省空间最多的内容数量, 默认20"
+// @Success 200 {object} JsonObject "{total:{},areas:[],top:[]}"
+// @Router /api/v1/admin/storage/dedup_report [get]
+func GetContentDedupReportHandler(c *gin.Context) {
+	top, _ := strconv.Atoi(c.Query("top"))
+	if top <= 0 || top > 100 {
+		top = defaultDedupTopSize
+	}
+
+	total, areas, err := dao.GetContentDedupReport(c.Request.Context())
+	if err != nil {
+		log.Errorf("GetContentDedupReport error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	contents, err := dao.ListTopDedupContents(c.Request.Context(), top)
+	if err != nil {
+		log.Errorf("ListTopDedupContents error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"total": total,
+		"areas": areas,
+		"top":   contents,
+	}))
+}
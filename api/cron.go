@@ -0,0 +1,124 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/core/statistics"
+	"github.com/gnasnik/titan-explorer/pkg/formatter"
+)
+
+// maxBackfillWindow 单次回补的最大时间段
+const maxBackfillWindow = 31 * 24 * time.Hour
+
+// GetCronJobStatusHandler 获取每个定时任务最近一次的执行状态
+func GetCronJobStatusHandler(c *gin.Context) {
+	list, err := dao.GetLatestJobRuns(c.Request.Context())
+	if err != nil {
+		log.Errorf("get latest job runs: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list": list,
+	}))
+}
+
+// GetCronJobRunsHandler 获取定时任务的执行记录
+func GetCronJobRunsHandler(c *gin.Context) {
+	page, _ := strconv.ParseInt(c.Query("page"), 10, 64)
+	size, _ := strconv.ParseInt(c.Query("size"), 10, 64)
+	opt := dao.QueryOption{
+		Page:     int(page),
+		PageSize: int(size),
+	}
+
+	list, total, err := dao.ListJobRuns(c.Request.Context(), c.Query("name"), c.Query("status"), opt)
+	if err != nil {
+		log.Errorf("list job runs: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list":  list,
+		"total": total,
+	}))
+}
+
+// GetFetcherProgressHandler 获取数据拉取任务的配置和最近一次运行的进度
+func GetFetcherProgressHandler(c *gin.Context) {
+	if statistics.DefaultStatistic == nil {
+		c.JSON(http.StatusOK, respJSON(JsonObject{"list": []interface{}{}}))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list": statistics.DefaultStatistic.Progress(),
+	}))
+}
+
+type BackfillFetcherReq struct {
+	Fetcher   string `json:"fetcher"`
+	AreaID    string `json:"area_id"`
+	StartTime string `json:"start_time"`
+	EndTime   string `json:"end_time"`
+}
+
+// BackfillFetcherHandler 回补拉取任务在某个时间段的数据, 如停机后重建 device_info_hour 或 assets
+func BackfillFetcherHandler(c *gin.Context) {
+	var req BackfillFetcherReq
+	if err := c.ShouldBindJSON(&req); err != nil || req.Fetcher == "" {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	start, err := time.ParseInLocation(formatter.TimeFormatDatetime, req.StartTime, time.Local)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(errors.InvalidParams, fmt.Errorf("invalid start_time: %s", req.StartTime)))
+		return
+	}
+
+	end, err := time.ParseInLocation(formatter.TimeFormatDatetime, req.EndTime, time.Local)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(errors.InvalidParams, fmt.Errorf("invalid end_time: %s", req.EndTime)))
+		return
+	}
+
+	if now := time.Now(); end.After(now) {
+		end = now
+	}
+
+	if !start.Before(end) || end.Sub(start) > maxBackfillWindow {
+		c.JSON(http.StatusOK, respError(errors.InvalidParams, fmt.Errorf("invalid time window, max %v", maxBackfillWindow)))
+		return
+	}
+
+	if statistics.DefaultStatistic == nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	err = statistics.DefaultStatistic.Backfill(req.Fetcher, req.AreaID, start, end)
+	switch err {
+	case nil:
+	case statistics.ErrFetcherNotFound:
+		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
+		return
+	default:
+		c.JSON(http.StatusOK, respError(errors.InvalidParams, err))
+		return
+	}
+
+	SetAuditTarget(c, "fetcher", req.Fetcher)
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"msg": "success",
+	}))
+}
@@ -5,7 +5,6 @@ import (
 	"crypto/md5"
 	"database/sql"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"math"
 	"math/rand"
@@ -271,14 +270,9 @@ func GetAllocateStorageHandler(c *gin.Context) {
 // @Description 获取用户存储空间信息
 // @Security ApiKeyAuth
 // @Tags storage
-// @Success 200 {object} JsonObject "{PeakBandwidth:0,TotalTraffic:0,TotalSize:0,UsedSize:0}"
+// @Success 200 {object} JsonObject "{PeakBandwidth:0,TotalTraffic:0,UsedTraffic:0,TotalSize:0,UsedSize:0,Plan:"",Warnings:[]}"
 // @Router /api/v1/storage/get_storage_size [get]
 func GetStorageSizeHandler(c *gin.Context) {
-	var (
-		fInfo        = new(dao.UserStorageFlowInfo)
-		totaltraffic = maxTotalFlow
-	)
-
 	claims := jwt.ExtractClaims(c)
 	username, ok := claims[identityKey].(string)
 	if !ok {
@@ -290,29 +284,22 @@ func GetStorageSizeHandler(c *gin.Context) {
 		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
 		return
 	}
-	value, err := oprds.GetClient().GetUserStorageFlowInfo(c.Request.Context(), username)
+
+	quota, err := getUserQuota(c.Request.Context(), user)
 	if err != nil {
-		fInfo, err = dao.GetUserStorageFlowInfo(c.Request.Context(), username)
-		if err != nil {
-			fInfo = new(dao.UserStorageFlowInfo)
-			log.Error(err)
-		} else {
-			ib, _ := json.Marshal(fInfo)
-			oprds.GetClient().StoreUserStorageFlowInfo(c.Request.Context(), username, string(ib))
-		}
-	} else {
-		json.Unmarshal([]byte(value), fInfo)
-	}
-	if user.EnableVIP {
-		totaltraffic = maxVipTotalFlow
+		log.Errorf("getUserQuota error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
 	}
 
 	c.JSON(http.StatusOK, respJSON(JsonObject{
-		"PeakBandwidth": fInfo.PeakBandwidth,
-		"TotalTraffic":  totaltraffic,
-		"UsedTraffic":   fInfo.TotalTraffic,
-		"TotalSize":     user.TotalStorageSize,
-		"UsedSize":      user.UsedStorageSize,
+		"PeakBandwidth": quota.UsedPeakBandwidth,
+		"TotalTraffic":  quota.MonthlyTraffic,
+		"UsedTraffic":   quota.UsedTraffic,
+		"TotalSize":     quota.StorageSize,
+		"UsedSize":      quota.UsedStorage,
+		"Plan":          quota.Plan.Name,
+		"Warnings":      quota.Warnings,
 	}))
 }
 
@@ -321,7 +308,7 @@ func GetStorageSizeHandler(c *gin.Context) {
 // @Description 判断用户是否是vip
 // @Security ApiKeyAuth
 // @Tags storage
-// @Success 200 {object} JsonObject "{vip:false}"
+// @Success 200 {object} JsonObject "{vip:false,plan:""}"
 // @Router /api/v1/storage/get_vip_info [get]
 func GetUserVipInfoHandler(c *gin.Context) {
 	claims := jwt.ExtractClaims(c)
@@ -332,9 +319,16 @@ func GetUserVipInfoHandler(c *gin.Context) {
 		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
 		return
 	}
+	plan, _, err := getUserQuotaPlan(c.Request.Context(), user)
+	if err != nil {
+		log.Errorf("getUserQuotaPlan: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
 	c.JSON(http.StatusOK, respJSON(JsonObject{
-		"vip": user.EnableVIP,
-		"uid": username,
+		"vip":  user.EnableVIP || plan.Name == quotaPlanVIP,
+		"uid":  username,
+		"plan": plan.Name,
 	}))
 	return
 }
@@ -543,9 +537,15 @@ func CreateAssetHandler(c *gin.Context) {
 		return
 	}
 
-	// 判断用户存储空间是否够用 (租户子账户除外)
-	if user.TenantID == "" && user.TotalStorageSize-user.UsedStorageSize < createAssetReq.AssetSize {
-		c.JSON(http.StatusOK, respErrorCode(int(terrors.UserStorageSizeNotEnough), c))
+	// 按用户的套餐判断文件大小、文件数量和存储空间, 租户子账户按租户的存储空间上限判断
+	code, err := checkUserUploadQuota(c.Request.Context(), user, createAssetReq.AssetSize)
+	if err != nil {
+		log.Errorf("checkUserUploadQuota error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+	if code != 0 {
+		c.JSON(http.StatusOK, respErrorCode(code, c))
 		return
 	}
 
@@ -745,19 +745,25 @@ func CreateAssetPostHandler(c *gin.Context) {
 		c.JSON(http.StatusOK, resp)
 		return
 	}
-	// 判断用户存储空间是否够用(租户子账户除外)
-	if user.TenantID == "" && user.TotalStorageSize-user.UsedStorageSize < createAssetReq.AssetSize {
-		c.JSON(http.StatusOK, respErrorCode(int(terrors.UserStorageSizeNotEnough), c))
+	// 按用户的套餐判断文件大小、文件数量和存储空间, 租户子账户按租户的存储空间上限判断
+	code, err := checkUserUploadQuota(c.Request.Context(), user, createAssetReq.AssetSize)
+	if err != nil {
+		log.Errorf("checkUserUploadQuota error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+	if code != 0 {
+		c.JSON(http.StatusOK, respErrorCode(code, c))
 		return
 	}
 
-	// 判断所选区域(areaIds[0])是否同步成功，默认已经同步成功
+	// 所选区域(areaIds[0])中已经存在相同的内容时直接引用, 不需要再上传
 	var (
 		createAssetRsp = new(types.UploadInfo)
 		traceID        string
 	)
 	createAssetRsp.AlreadyExists = true
-	if !dao.CheckAssetIsSyncByAreaID(c.Request.Context(), hash, areaIds[0]) {
+	if !dao.ContentAvailable(c.Request.Context(), hash, areaIds[0]) {
 		// 调用调度器
 		schedulerClient, err := getSchedulerClient(c.Request.Context(), areaIds[0])
 		if err != nil {
@@ -960,6 +966,17 @@ func CreateKeyHandler(c *gin.Context) {
 		c.JSON(http.StatusOK, respErrorCode(errors.UserNotFound, c))
 		return
 	}
+	// 判断是否超过套餐的 API key 数量
+	code, err := checkUserApiKeyQuota(c.Request.Context(), info)
+	if err != nil {
+		log.Errorf("checkUserApiKeyQuota error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+	if code != 0 {
+		c.JSON(http.StatusOK, respErrorCode(code, c))
+		return
+	}
 	buf, keyStr, secretStr, err := storage.CreateAPIKeySecret(c.Request.Context(), userId, keyName, info.ApiKeys)
 	if err != nil {
 		if webErr, ok := err.(*api.ErrWeb); ok {
@@ -1037,11 +1054,6 @@ func DeleteKeyHandler(c *gin.Context) {
 // @Success 200 {object} JsonObject "{msg:""}"
 // @Router /api/v1/storage/delete_asset [get]
 func DeleteAssetHandler(c *gin.Context) {
-	var (
-		wg          = new(sync.WaitGroup)
-		mu          = new(sync.Mutex)
-		execAreaIds []string
-	)
 	claims := jwt.ExtractClaims(c)
 	userID := claims[identityKey].(string)
 	cid := c.Query("asset_cid")
@@ -1055,6 +1067,8 @@ func DeleteAssetHandler(c *gin.Context) {
 	}
 	// 获取文件信息
 	assetInfo, _ := dao.GetUserAsset(c.Request.Context(), hash, userID)
+	SetAuditTarget(c, "asset", cid)
+	SetAuditDiff(c, assetInfo, nil)
 
 	areaIds, isNeedDel, err := dao.CheckUserAseetNeedDel(c.Request.Context(), hash, userID, areaIds)
 	if err != nil {
@@ -1066,89 +1080,42 @@ func DeleteAssetHandler(c *gin.Context) {
 		c.JSON(http.StatusOK, respErrorCode(int(terrors.NotFound), c))
 		return
 	}
-	// 调用scheduler接口删除文件
-	for _, v := range areaIds {
-		wg.Add(1)
-		go func(v string) {
-			defer func() {
-				wg.Done()
-				mu.Lock()
-				execAreaIds = append(execAreaIds, v)
-				mu.Unlock()
-			}()
-			// 判断文件是否为唯一存在的
-			isOnly, err := dao.CheckUserAssetIsOnly(c.Request.Context(), hash, v)
-			if err != nil {
-				return
-			}
-			if !isOnly {
-				return
-			}
-			// 修改为加入队列进行处理删除
-			// scli, err := getSchedulerClient(c.Request.Context(), v)
-			// if err != nil {
-			// 	return
-			// }
-			// err = scli.RemoveAssetRecord(c.Request.Context(), cid)
-			// if err != nil {
-			// 	log.Errorf("get areaIds error: %+v", err)
-			// }
-			opasynq.DefaultCli.EnqueueDeleteAssetOperation(c.Request.Context(), opasynq.DeleteAssetPayload{
-				CID: cid, AreaID: v,
-			})
-		}(v)
-	}
-	wg.Wait()
-	if len(execAreaIds) == 0 {
-		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
-		return
-	}
-	// 判断是否需要进行删除
-	msg := "delete success"
-	if len(areaIds) != len(execAreaIds) {
-		if isNeedDel {
-			isNeedDel = false
+
+	// 删除文件的所有区域时放入回收站, 保留期内可以恢复, 到期后再彻底删除
+	if isNeedDel {
+		item, err := dao.TrashUserAsset(c.Request.Context(), hash, userID, trashPurgeAt())
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusOK, respErrorCode(int(terrors.NotFound), c))
+			return
 		}
-		msg = "Partially deleted successfully"
+		if err != nil {
+			log.Errorf("api TrashUserAsset: %v", err)
+			c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+			return
+		}
+
+		c.JSON(http.StatusOK, respJSON(JsonObject{
+			"msg":      "delete success",
+			"trash_id": item.ID,
+		}))
+		return
 	}
-	err = dao.DelAssetAndUpdateSize(c.Request.Context(), hash, userID, execAreaIds, isNeedDel)
+
+	released, err := dao.DelAssetAndUpdateSize(c.Request.Context(), hash, userID, areaIds, isNeedDel)
 	if err != nil {
 		log.Errorf("api DeleteAsset: %v", err)
 		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
 		return
 	}
 
-	// handle tenant asset delete callback
-	{
-		if assetInfo == nil || assetInfo.ExtraID == "" {
-			log.Infof("GetUserAsset() error: %+v or assetInfo != nil or assetInfo.ExtraID is empty", err)
-			goto End
-		}
-
-		userInfo, err := dao.GetUserByUsername(c.Request.Context(), userID)
-		if err != nil || userInfo == nil || userInfo.TenantID == "" {
-			log.Errorf("GetUserByUsername() error: %+v or userInfo == nil or userInfo.TenantID is empty", err)
-			goto End
-		}
-
-		tenantInfo, err := dao.GetTenantByBuilder(c.Request.Context(), squirrel.Select("*").Where("tenant_id=?", userInfo.TenantID))
-		if err != nil || tenantInfo == nil || tenantInfo.ApiKey == nil || tenantInfo.DeleteNotifyUrl == "" {
-			log.Errorf("GetTenantByBuilder() error: %+v or  tenantInfo != nil or tenantInfo.ApiKey == nil or tenantInfo.UploadNotifyUrl is empty", err)
-			goto End
-		}
-
-		opasynq.DefaultCli.EnqueueAssetDeleteNotify(c.Request.Context(), opasynq.AssetDeleteNotifyPayload{
-			ExtraID:  assetInfo.ExtraID,
-			TenantID: tenantInfo.TenantID,
-			UserID:   userID,
+	// 区域中已经没有用户引用该内容时, 加入队列从调度器中删除
+	removeReleasedContents(c.Request.Context(), released)
 
-			AssetCID: assetInfo.Cid,
-		})
-	}
+	// handle tenant asset delete callback
+	notifyTenantAssetDeleted(c.Request.Context(), userID, assetInfo)
 
-End:
 	c.JSON(http.StatusOK, respJSON(JsonObject{
-		"msg": msg,
+		"msg": "delete success",
 	}))
 }
 
@@ -1179,12 +1146,14 @@ func ShareAssetsHandler(c *gin.Context) {
 	}
 
 	// 判断是否超过流量限额
-	ok, err := checkUserTotalFlow(c.Request.Context(), userId)
+	code, err := checkUserFlowQuota(c.Request.Context(), userId)
 	if err != nil {
-		log.Error("check user total flow error: ", cid)
+		log.Errorf("checkUserFlowQuota error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
 	}
-	if !ok {
-		c.JSON(http.StatusOK, respErrorCode(errors.OutTotalFlow, c))
+	if code != 0 {
+		c.JSON(http.StatusOK, respErrorCode(code, c))
 		return
 	}
 
@@ -1401,11 +1370,11 @@ func getFileSize(cid string, urls []string) int64 {
 	return 0
 }
 
+// OpenAssetHandler 通过分享链接打开文件, 文件的所有者和访问策略以 share_token 对应的分享链接为准;
+// 分享文件组时需要指定文件组中的文件, 分享文件时不指定则为分享的文件
 func OpenAssetHandler(c *gin.Context) {
 	var (
 		cid     = c.Query("asset_cid")
-		gid     = strings.TrimSpace(c.Query("group_id"))
-		userId  = c.Query("user_id")
 		areaIds []string
 		areaId  string
 	)
@@ -1414,18 +1383,29 @@ func OpenAssetHandler(c *gin.Context) {
 		areaIds = getAreaIDs(c)
 	}
 
-	if userId == "" {
-		c.JSON(http.StatusOK, respErrorCode(errors.MissingUserId, c))
+	link, country, ok := getShareLink(c)
+	if !ok {
 		return
 	}
+	userId := link.UserName
+	gid := linkGroupID(link)
+	if gid == 0 {
+		if cid != "" && cid != link.Cid {
+			c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
+			return
+		}
+		cid = link.Cid
+	}
 
 	// 判断是否超过流量限额
-	ok, err := checkUserTotalFlow(c.Request.Context(), userId)
+	code, err := checkUserFlowQuota(c.Request.Context(), userId)
 	if err != nil {
-		log.Error("check user total flow error: ", cid)
+		log.Errorf("checkUserFlowQuota error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
 	}
-	if !ok {
-		c.JSON(http.StatusOK, respErrorCode(errors.OutTotalFlow, c))
+	if code != 0 {
+		c.JSON(http.StatusOK, respErrorCode(code, c))
 		return
 	}
 
@@ -1436,6 +1416,24 @@ func OpenAssetHandler(c *gin.Context) {
 		return
 	}
 
+	if !checkShareTarget(c, userId, hash, 0) {
+		return
+	}
+
+	// 分享文件组时只能打开文件组中的文件
+	if gid != 0 {
+		in, err := dao.AssetInGroup(c.Request.Context(), userId, hash, gid)
+		if err != nil {
+			log.Errorf("AssetInGroup error %v", err)
+			c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+			return
+		}
+		if !in {
+			c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
+			return
+		}
+	}
+
 	// 如果用户指定了区域，则先判断区域是否存在
 	if len(areaIds) > 0 {
 		exist, err := dao.CheckUserAssetIsInAreaID(c.Request.Context(), userId, hash, areaIds[0])
@@ -1496,7 +1494,7 @@ func OpenAssetHandler(c *gin.Context) {
 		return
 	}
 
-	if gid == "" {
+	if gid == 0 {
 		dao.AddVisitCount(c.Request.Context(), hash, userId)
 
 		n, _ := dao.GetVisitCount(c.Request.Context(), hash, userId)
@@ -1538,7 +1536,7 @@ func OpenAssetHandler(c *gin.Context) {
 	// 	ret = urls[cid]
 	// }
 
-	traceid, err := dao.NewLogTrace(c.Request.Context(), userId, dao.AssetTransferTypeDownload, areaId)
+	traceid, err := dao.NewLinkLogTrace(c.Request.Context(), userId, areaId, link.ID, country)
 	if err != nil {
 		log.Errorf("NewLogTrace error: %v", err)
 		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
@@ -1561,9 +1559,25 @@ func OpenAssetHandler(c *gin.Context) {
 		return
 	}
 
+	// 获取下载地址时都计入链接的下载次数, 预览返回的也是完整文件的地址, 不计入时可以绕过下载次数限制
+	ok, err := dao.IncrLinkDownloadCount(c.Request.Context(), link.ID)
+	if err != nil {
+		log.Errorf("IncrLinkDownloadCount error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusOK, respErrorCode(errors.ShareLinkDownloadLimit, c))
+		return
+	}
+
+	// 禁止预览的链接只返回以附件形式下载的地址
 	var urls = make([]string, len(ret.URLs))
 	for i := range ret.URLs {
 		urls[i] = fmt.Sprintf("%s&filename=%s", ret.URLs[i], url.QueryEscape(userAsset.AssetName))
+		if link.DisablePreview {
+			urls[i] += "&download=true"
+		}
 	}
 
 	// 成功的时候，下载量+1
@@ -1576,6 +1590,7 @@ func OpenAssetHandler(c *gin.Context) {
 		"redirect":        false,
 		"trace_id":        traceid,
 		"available_nodes": ret.NodeCount,
+		"preview":         !link.DisablePreview,
 	}))
 }
 
@@ -1606,6 +1621,12 @@ type ShareLinkUpdateReq struct {
 	ID        int64  `json:"id"`
 	ShortPass string `json:"short_pass"`
 	ExpireAt  int64  `json:"expire_at"`
+
+	// 以下访问策略为空时不修改
+	MaxDownloads     *int64   `json:"max_downloads"`
+	AllowedCountries []string `json:"allowed_countries"`
+	AllowedReferers  []string `json:"allowed_referers"`
+	DisablePreview   *bool    `json:"disable_preview"`
 }
 
 func ShareLinkUpdateHandler(c *gin.Context) {
@@ -1649,14 +1670,52 @@ func ShareLinkUpdateHandler(c *gin.Context) {
 	link.ShortPass = req.ShortPass
 	// }
 
-	if err := dao.UpdateLinkPassAndExpiration(c.Request.Context(), link); err != nil {
+	if req.MaxDownloads != nil {
+		if *req.MaxDownloads < 0 {
+			c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+			return
+		}
+		user, err := dao.GetUserByUsername(c.Request.Context(), userId)
+		if err != nil {
+			log.Errorf("GetUserByUsername error %v", err)
+			c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+			return
+		}
+		plan, _, err := getUserQuotaPlan(c.Request.Context(), user)
+		if err != nil {
+			log.Errorf("getUserQuotaPlan error %v", err)
+			c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+			return
+		}
+		link.MaxDownloads = linkMaxDownloads(plan, *req.MaxDownloads)
+	}
+	if req.AllowedCountries != nil {
+		link.AllowedCountries = joinList(req.AllowedCountries)
+	}
+	if req.AllowedReferers != nil {
+		link.AllowedReferers = joinList(req.AllowedReferers)
+	}
+	if req.DisablePreview != nil {
+		link.DisablePreview = *req.DisablePreview
+	}
+
+	if err := dao.UpdateLinkPolicy(c.Request.Context(), link); err != nil {
 		log.Errorf("UpdateLink error %v", err)
 		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
 		return
 	}
 
+	// 短链接中带有过期时间的签名, 修改过期时间后重新生成
+	shortLink, err := signedShortLink(c.Request.Context(), link)
+	if err != nil {
+		log.Errorf("signedShortLink error %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
 	c.JSON(http.StatusOK, respJSON(JsonObject{
 		"msg": "success",
+		"url": shortLink,
 	}))
 }
 
@@ -1779,12 +1838,43 @@ func ShareLinkHandler(c *gin.Context) {
 	// 	}
 	// }
 
+	// 旧格式的短链接也返回带签名的短链接
+	shortLink, err := signedShortLink(c.Request.Context(), link)
+	if err != nil {
+		log.Errorf("signedShortLink error %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
 	c.JSON(http.StatusOK, respJSON(JsonObject{
-		"url": link.ShortLink,
+		"url": shortLink,
 	}))
 
 }
 
+// checkShareTarget 分享或打开的文件, 文件组必须存在并且不在回收站中, gid 不为 0 时检查文件组, 否则检查文件
+func checkShareTarget(c *gin.Context, userID, hash string, gid int64) bool {
+	var (
+		available bool
+		err       error
+	)
+	if gid != 0 {
+		available, err = dao.AssetGroupAvailable(c.Request.Context(), userID, gid)
+	} else {
+		available, err = dao.AssetAvailable(c.Request.Context(), userID, hash)
+	}
+	if err != nil {
+		log.Errorf("check share target available: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return false
+	}
+	if !available {
+		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
+		return false
+	}
+	return true
+}
+
 // CreateShareLinkHandler 获取分享链接
 // @Summary 获取分享链接
 // @Description 获取分享链接
@@ -1821,17 +1911,11 @@ func CreateShareLinkHandler(c *gin.Context) {
 			c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
 			return
 		}
-		_, err = dao.GetUserAsset(c.Request.Context(), hash, username)
-		if err != nil {
-			log.Errorf("database getUserAsset: %v", err)
-			c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		if !checkShareTarget(c, username, hash, 0) {
 			return
 		}
 	} else {
-		_, err := dao.GetUserAssetGroupInfo(c.Request.Context(), username, gid)
-		if err != nil {
-			log.Errorf("database getUserAssetGroup: %v", err)
-			c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		if !checkShareTarget(c, username, "", int64(gid)) {
 			return
 		}
 	}
@@ -1888,6 +1972,12 @@ func CreateShareLinkHandler(c *gin.Context) {
 	// 	return
 	// }
 
+	maxDownloads, _ := strconv.ParseInt(c.Query("max_downloads"), 10, 64)
+	if maxDownloads < 0 {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
 	var link model.Link
 	link.UserName = username
 	link.Cid = cid
@@ -1896,21 +1986,76 @@ func CreateShareLinkHandler(c *gin.Context) {
 	link.ExpireAt = expireAt
 	link.CreatedAt = time.Now()
 	link.UpdatedAt = time.Now()
-	shortLink := dao.GetShortLink(c.Request.Context(), u)
-	if shortLink == "" {
-		link.ShortLink = "/link?" + "cid=" + cid + "&ts=" + strconv.FormatInt(time.Now().Unix(), 10)
-		shortLink = link.ShortLink
-		err := dao.CreateLink(c.Request.Context(), &link)
+	link.MaxDownloads = maxDownloads
+	link.AllowedCountries = joinList(strings.Split(c.Query("allowed_countries"), ","))
+	link.AllowedReferers = joinList(strings.Split(c.Query("allowed_referers"), ","))
+	link.DisablePreview = c.Query("disable_preview") == "true"
+	exists, err := dao.GetLinkByLongLink(c.Request.Context(), u)
+	if err != nil && err != sql.ErrNoRows {
+		log.Errorf("GetLinkByLongLink: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+	if err == nil {
+		// 已有旧格式 /link?cid=&ts= 短链接的分享页面返回带签名的短链接
+		if strings.HasPrefix(exists.ShortLink, shortLinkPrefix) {
+			c.JSON(http.StatusOK, respErrorCode(errors.LinkAlreadyExist, c))
+			return
+		}
+		shortLink, err := signedShortLink(c.Request.Context(), exists)
 		if err != nil {
-			log.Errorf("database createLink: %v", err)
+			log.Errorf("signedShortLink: %v", err)
 			c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
 			return
 		}
-	} else {
-		c.JSON(http.StatusOK, respErrorCode(errors.LinkAlreadyExist, c))
+		c.JSON(http.StatusOK, respJSON(JsonObject{
+			"url": shortLink,
+		}))
 		return
 	}
 
+	user, err := dao.GetUserByUsername(c.Request.Context(), username)
+	if err != nil {
+		log.Errorf("GetUserByUsername: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+	code, err := checkUserShareQuota(c.Request.Context(), user)
+	if err != nil {
+		log.Errorf("checkUserShareQuota: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+	if code != 0 {
+		c.JSON(http.StatusOK, respErrorCode(code, c))
+		return
+	}
+	plan, _, err := getUserQuotaPlan(c.Request.Context(), user)
+	if err != nil {
+		log.Errorf("getUserQuotaPlan: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+	link.MaxDownloads = linkMaxDownloads(plan, link.MaxDownloads)
+
+	link.ShortID, err = newShortID()
+	if err != nil {
+		log.Errorf("newShortID: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+	link.ShortLink = shortLinkURL(&link)
+	shortLink := link.ShortLink
+	if err := dao.CreateLink(c.Request.Context(), &link); err != nil {
+		log.Errorf("database createLink: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	PublishTenantUserEvent(c.Request.Context(), username, opasynq.WebhookEventShareCreated, "", WebhookShareData{
+		UserID: username, Cid: cid, ShortLink: shortLink, ExpireAt: expireAt,
+	})
+
 	c.JSON(http.StatusOK, respJSON(JsonObject{
 		"url": shortLink,
 	}))
@@ -1933,7 +2078,8 @@ func ShareNeedPassHandler(c *gin.Context) {
 		return
 	}
 	c.JSON(http.StatusOK, respJSON(JsonObject{
-		"NeedPass": lk.ShortPass != "",
+		"NeedPass":       lk.ShortPass != "",
+		"DisablePreview": lk.DisablePreview,
 	}))
 }
 
@@ -1967,6 +2113,11 @@ func CheckShareLinkHandler(c *gin.Context) {
 		return
 	}
 
+	if _, code := checkLinkPolicy(c, link); code != 0 {
+		c.JSON(http.StatusOK, respErrorCode(code, c))
+		return
+	}
+
 	if link.ShortPass != "" && req.Password == "" {
 		c.JSON(http.StatusOK, respErrorCode(errors.ShareLinkPassRequired, c))
 		return
@@ -2014,35 +2165,25 @@ func ShareBeforeHandler(c *gin.Context) {
 	}))
 }
 
+// GetShareLinkHandler 兼容旧格式的短链接 /link?cid=xx&ts=xx, 必须与保存的短链接完全一致, 不再支持只通过 cid 访问
 func GetShareLinkHandler(c *gin.Context) {
-	cid := c.Query("cid")
-	if cid == "" {
+	if c.Query("cid") == "" || c.Query("ts") == "" {
 		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
 		return
 	}
-	link := dao.GetLongLink(c.Request.Context(), cid)
-	if link == "" {
-		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+
+	link, err := dao.GetLinkByShortLink(c.Request.Context(), "/link?"+c.Request.URL.RawQuery)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
 		return
 	}
-	// 解码 URL
-	decodedLink, err := url.QueryUnescape(link)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode URL"})
+		log.Errorf("GetLinkByShortLink error %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
 		return
 	}
 
-	c.Redirect(http.StatusMovedPermanently, decodedLink)
-
-	// 获取请求的host
-	// origin := c.Request.Header.Get("origin")
-	// du, err := url.Parse(decodedLink)
-	// if origin == "" || err != nil {
-	// 	c.Redirect(http.StatusMovedPermanently, decodedLink)
-	// 	return
-	// }
-
-	// c.Redirect(http.StatusMovedPermanently, origin+du.Path+"?"+du.RawQuery)
+	redirectLongLink(c, link)
 }
 
 func UpdateShareStatusHandler(c *gin.Context) {
@@ -2060,12 +2201,18 @@ func UpdateShareStatusHandler(c *gin.Context) {
 			c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
 			return
 		}
+		if !checkShareTarget(c, userId, hash, 0) {
+			return
+		}
 		err = dao.UpdateAssetShareStatus(c.Request.Context(), hash, userId)
 	} else {
 		if gid == 0 {
 			c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
 			return
 		}
+		if !checkShareTarget(c, userId, "", gid) {
+			return
+		}
 		err = dao.UpdateGroupShareStatus(c.Request.Context(), userId, gid)
 	}
 
@@ -2764,6 +2911,11 @@ func CreateGroupHandler(c *gin.Context) {
 		}
 		return
 	}
+
+	PublishTenantUserEvent(c.Request.Context(), userId, opasynq.WebhookEventGroupCreated, "", WebhookGroupData{
+		UserID: userId, GroupID: group.ID, Name: group.Name, Parent: group.Parent,
+	})
+
 	c.JSON(http.StatusOK, respJSON(JsonObject{
 		"group": group,
 	}))
@@ -2947,15 +3099,19 @@ func DeleteGroupHandler(c *gin.Context) {
 		return
 	}
 
-	// 数据库将最外层的文件组删除
-	err := dao.DeleteAssetGroupAndUpdateSize(c.Request.Context(), uid, gid)
+	SetAuditTarget(c, "group", gid)
+
+	// 文件组放入回收站, 到期后再删除文件组及其中的文件
+	item, err := dao.TrashAssetGroup(c.Request.Context(), uid, gid, trashPurgeAt())
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusOK, respErrorCode(int(terrors.GroupNotExist), c))
+		return
+	}
 	if err != nil {
-		log.Errorf("delete outer asset group error: %v", err)
+		log.Errorf("trash asset group error: %v", err)
 		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
 		return
 	}
-	// 将用户对应的文件组id塞到asynq中去处理
-	opasynq.DefaultCli.EnqueueAssetGroupID(c.Request.Context(), opasynq.AssetGroupPayload{UserID: uid, GroupID: []int64{int64(gid)}})
 
 	// err := dao.DeleteAssetGroup(c.Request.Context(), uid, gid)
 	// if err != nil {
@@ -2967,7 +3123,8 @@ func DeleteGroupHandler(c *gin.Context) {
 	// 	return
 	// }
 	c.JSON(http.StatusOK, respJSON(JsonObject{
-		"msg": "success",
+		"msg":      "success",
+		"trash_id": item.ID,
 	}))
 }
 
@@ -2993,6 +3150,8 @@ func RenameGroupHandler(c *gin.Context) {
 	}
 
 	if req.AssetCID != "" {
+		SetAuditAction(c, "asset.rename")
+		SetAuditTarget(c, "asset", req.AssetCID)
 		// 获取文件hash
 		hash, err := storage.CIDToHash(req.AssetCID)
 		if err != nil {
@@ -3007,11 +3166,16 @@ func RenameGroupHandler(c *gin.Context) {
 			return
 		}
 	} else {
+		SetAuditTarget(c, "group", req.GroupID)
 		err = dao.UpdateAssetGroupName(c.Request.Context(), userId, req.NewName, req.GroupID)
 		if err != nil {
 			c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
 			return
 		}
+
+		PublishTenantUserEvent(c.Request.Context(), userId, opasynq.WebhookEventGroupRenamed, "", WebhookGroupData{
+			UserID: userId, GroupID: int64(req.GroupID), Name: req.NewName,
+		})
 	}
 
 	c.JSON(http.StatusOK, respJSON(JsonObject{
@@ -3097,6 +3261,21 @@ func MoveAssetToGroupHandler(c *gin.Context) {
 		return
 	}
 
+	// 回收站中的文件需要先还原, 也不能移动到回收站中的文件组
+	available, err := dao.AssetAvailable(c.Request.Context(), userId, hash)
+	if err == nil && available && groupId != 0 {
+		available, err = dao.AssetGroupAvailable(c.Request.Context(), userId, int64(groupId))
+	}
+	if err != nil {
+		log.Errorf("check asset available error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+	if !available {
+		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
+		return
+	}
+
 	err = dao.UpdateAssetGroup(c.Request.Context(), userId, hash, groupId)
 	if err != nil {
 		log.Errorf("UpdateAssetGroup error: %v", err)
@@ -3333,6 +3512,8 @@ func AssetTransferReport(c *gin.Context) {
 			goto End
 		}
 
+		notifyStorageQuota(c.Request.Context(), userInfo)
+
 		tenantInfo, err := dao.GetTenantByBuilder(c.Request.Context(), squirrel.Select("*").Where("tenant_id=?", userInfo.TenantID))
 		if err != nil || tenantInfo == nil || tenantInfo.ApiKey == nil || tenantInfo.UploadNotifyUrl == "" {
 			log.Errorf("GetTenantByBuilder() error: %+v or  tenantInfo != nil or tenantInfo.ApiKey == nil or tenantInfo.UploadNotifyUrl is empty", err)
@@ -0,0 +1,597 @@
+package api
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Filecoin-Titan/titan/api/terrors"
+	"github.com/Filecoin-Titan/titan/api/types"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/core/oprds"
+	"github.com/gnasnik/titan-explorer/core/storage"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	ft "github.com/ipfs/boxo/ipld/unixfs"
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+	carv2 "github.com/ipld/go-car/v2"
+	carstorage "github.com/ipld/go-car/v2/storage"
+)
+
+const (
+	groupArchiveZip = "zip"
+	groupArchiveCar = "car"
+
+	// maxGroupArchiveAssets 单次打包下载的最大文件数量
+	maxGroupArchiveAssets = 1000
+	// groupArchiveURLExpire 打包时获取的文件下载地址的有效期
+	groupArchiveURLExpire = 2 * time.Hour
+	// groupArchiveErrorsFile zip 中记录下载失败的文件
+	groupArchiveErrorsFile = "_errors.txt"
+)
+
+// archiveDir 打包下载的目录, 同一目录下的文件和子目录名称不重复
+type archiveDir struct {
+	Name  string
+	Dirs  []*archiveDir
+	Files []*archiveFile
+
+	names map[string]int
+}
+
+type archiveFile struct {
+	Name  string
+	Asset *model.UserAsset
+}
+
+func newArchiveDir(name string) *archiveDir {
+	return &archiveDir{Name: name, names: make(map[string]int)}
+}
+
+// uniqueName 返回目录下不重复的名称, 重名时在扩展名前加上序号
+func (d *archiveDir) uniqueName(name string) string {
+	name = strings.TrimSpace(strings.NewReplacer("/", "_", "\\", "_").Replace(name))
+	if name == "" || name == "." || name == ".." {
+		name = "_"
+	}
+
+	n := d.names[name]
+	d.names[name] = n + 1
+	if n == 0 {
+		return name
+	}
+
+	ext := path.Ext(name)
+	for {
+		candidate := fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext)
+		if d.names[candidate] == 0 {
+			d.names[candidate] = 1
+			return candidate
+		}
+		n++
+	}
+}
+
+// buildArchiveTree 按文件组的层级生成目录树, groups 需要按层级顺序排列
+func buildArchiveTree(name string, gid int64, groups []*dao.AssetGroup, assets []*model.UserAsset) *archiveDir {
+	root := newArchiveDir(name)
+	dirs := map[int64]*archiveDir{gid: root}
+
+	for _, g := range groups {
+		parent, ok := dirs[g.Parent]
+		if !ok {
+			continue
+		}
+		dir := newArchiveDir(parent.uniqueName(g.Name))
+		parent.Dirs = append(parent.Dirs, dir)
+		dirs[g.ID] = dir
+	}
+
+	for _, asset := range assets {
+		dir, ok := dirs[asset.GroupID]
+		// 发布生成的目录不作为文件打包
+		if !ok || asset.AssetType == publishAssetType {
+			continue
+		}
+		dir.Files = append(dir.Files, &archiveFile{Name: dir.uniqueName(asset.AssetName), Asset: asset})
+	}
+
+	return root
+}
+
+// groupArchive 打包下载一个文件组, 文件内容通过调度器返回的下载地址获取
+type groupArchive struct {
+	owner string
+	ip    string
+	root  *archiveDir
+}
+
+// assetDownloadURLs 获取文件在最近区域的下载地址
+func (ga *groupArchive) assetDownloadURLs(ctx context.Context, asset *model.UserAsset) ([]string, error) {
+	areaIDs, err := dao.GetUserAssetAreaIDs(ctx, asset.Hash, ga.owner)
+	if err != nil {
+		return nil, err
+	}
+	if len(areaIDs) == 0 {
+		return nil, fmt.Errorf("no area found")
+	}
+
+	areaID := areaIDs[0]
+	if ga.ip != "" {
+		if nearest, err := GetNearestAreaID(ctx, ga.ip, areaIDs); err == nil {
+			areaID = nearest
+		}
+	}
+
+	schedulerClient, err := getSchedulerClient(ctx, areaID)
+	if err != nil {
+		return nil, err
+	}
+
+	ret, err := schedulerClient.ShareAssetV2(ctx, &types.ShareAssetReq{
+		UserID:     ga.owner,
+		AssetCID:   archiveAssetCID(asset),
+		FilePass:   asset.Password,
+		ExpireTime: time.Now().Add(groupArchiveURLExpire),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret.URLs, nil
+}
+
+// openAsset 依次尝试下载地址, 返回第一个可用的文件内容, car 为 true 时以 CAR 格式获取
+func openAsset(ctx context.Context, urls []string, car bool) (io.ReadCloser, error) {
+	lastErr := fmt.Errorf("no download url")
+	for _, u := range urls {
+		if car {
+			u = u + "&format=car"
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if car {
+			req.Header.Set("Accept", "application/vnd.ipld.car")
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			lastErr = fmt.Errorf("download status %d", resp.StatusCode)
+			continue
+		}
+		return resp.Body, nil
+	}
+
+	return nil, lastErr
+}
+
+func archiveAssetCID(asset *model.UserAsset) string {
+	if asset.Cid != "" {
+		return asset.Cid
+	}
+	c, _ := storage.HashToCID(asset.Hash)
+	return c
+}
+
+// writeZip 以 zip 格式输出目录树, 没有开始写入就下载失败的文件记录到 _errors.txt 中;
+// 写入中途失败时文件内容已经不完整, 返回错误中断下载
+func (ga *groupArchive) writeZip(ctx context.Context, w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	var failures []string
+	var walk func(dir *archiveDir, prefix string) error
+	walk = func(dir *archiveDir, prefix string) error {
+		for _, f := range dir.Files {
+			name := prefix + f.Name
+			started, err := ga.writeZipFile(ctx, zw, name, f.Asset)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				if started {
+					return fmt.Errorf("write %s error:%w", name, err)
+				}
+				log.Errorf("group archive %s %s error: %v", ga.owner, name, err)
+				failures = append(failures, fmt.Sprintf("%s\t%s", name, archiveAssetCID(f.Asset)))
+			}
+		}
+		for _, d := range dir.Dirs {
+			if _, err := zw.Create(prefix + d.Name + "/"); err != nil {
+				return err
+			}
+			if err := walk(d, prefix+d.Name+"/"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(ga.root, ""); err != nil {
+		return err
+	}
+
+	if len(failures) > 0 {
+		ew, err := zw.Create(groupArchiveErrorsFile)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(ew, strings.Join(failures, "\n")+"\n"); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// writeZipFile 写入一个文件, started 为 true 表示已经写入了文件头, 失败时 zip 中的文件不完整
+func (ga *groupArchive) writeZipFile(ctx context.Context, zw *zip.Writer, name string, asset *model.UserAsset) (started bool, err error) {
+	urls, err := ga.assetDownloadURLs(ctx, asset)
+	if err != nil {
+		return false, err
+	}
+	body, err := openAsset(ctx, urls, false)
+	if err != nil {
+		return false, err
+	}
+	defer body.Close()
+
+	// 文件大多已经压缩过, 不再压缩以减少 CPU 消耗
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: asset.CreatedTime})
+	if err != nil {
+		return true, err
+	}
+	if _, err := io.Copy(fw, body); err != nil {
+		return true, err
+	}
+
+	oprds.GetClient().IncrAssetHourDownload(ctx, asset.Hash, ga.owner)
+	return true, nil
+}
+
+// buildDirNode 生成目录树对应的 UnixFS 目录节点, 返回根节点和所有的目录节点
+func buildDirNode(dir *archiveDir) (*merkledag.ProtoNode, []*merkledag.ProtoNode, error) {
+	node := merkledag.NodeWithData(ft.FolderPBData())
+	if err := node.SetCidBuilder(merkledag.V1CidPrefix()); err != nil {
+		return nil, nil, err
+	}
+
+	var nodes []*merkledag.ProtoNode
+	for _, d := range dir.Dirs {
+		sub, subNodes, err := buildDirNode(d)
+		if err != nil {
+			return nil, nil, err
+		}
+		size, err := sub.Size()
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := node.AddRawLink(d.Name, &format.Link{Cid: sub.Cid(), Size: size}); err != nil {
+			return nil, nil, err
+		}
+		nodes = append(nodes, subNodes...)
+	}
+
+	for _, f := range dir.Files {
+		c, err := cid.Decode(archiveAssetCID(f.Asset))
+		if err != nil {
+			return nil, nil, fmt.Errorf("decode cid of %s error:%w", f.Name, err)
+		}
+		if err := node.AddRawLink(f.Name, &format.Link{Cid: c, Size: uint64(f.Asset.TotalSize)}); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return node, append([]*merkledag.ProtoNode{node}, nodes...), nil
+}
+
+// writeCar 以 CARv1 格式输出, 根节点是包含所有文件的 UnixFS 目录; 任一文件失败时 DAG 不完整, 返回错误中断下载
+func (ga *groupArchive) writeCar(ctx context.Context, w io.Writer) error {
+	root, nodes, err := buildDirNode(ga.root)
+	if err != nil {
+		return err
+	}
+
+	wc, err := carstorage.NewWritable(w, []cid.Cid{root.Cid()}, carv2.WriteAsCarV1(true))
+	if err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		if err := wc.Put(ctx, n.Cid().KeyString(), n.RawData()); err != nil {
+			return err
+		}
+	}
+
+	var walk func(dir *archiveDir) error
+	walk = func(dir *archiveDir) error {
+		for _, f := range dir.Files {
+			if err := ga.writeCarFile(ctx, wc, f.Asset); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				return fmt.Errorf("write %s error:%w", f.Name, err)
+			}
+		}
+		for _, d := range dir.Dirs {
+			if err := walk(d); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(ga.root); err != nil {
+		return err
+	}
+
+	return wc.Finalize()
+}
+
+// writeCarFile 写入文件的所有块, 一个地址中途失败时换下一个地址, 已写入的块不会重复写入
+func (ga *groupArchive) writeCarFile(ctx context.Context, wc carstorage.WritableCar, asset *model.UserAsset) error {
+	urls, err := ga.assetDownloadURLs(ctx, asset)
+	if err != nil {
+		return err
+	}
+
+	for i := range urls {
+		body, err := openAsset(ctx, urls[i:i+1], true)
+		if err != nil {
+			continue
+		}
+		err = copyCarBlocks(ctx, wc, body)
+		body.Close()
+		if err == nil {
+			oprds.GetClient().IncrAssetHourDownload(ctx, asset.Hash, ga.owner)
+			return nil
+		}
+		log.Errorf("copy car blocks of %s error: %v", asset.Hash, err)
+	}
+
+	return fmt.Errorf("all download urls failed")
+}
+
+func copyCarBlocks(ctx context.Context, wc carstorage.WritableCar, r io.Reader) error {
+	br, err := carv2.NewBlockReader(r)
+	if err != nil {
+		return err
+	}
+	for {
+		blk, err := br.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := wc.Put(ctx, blk.Cid().KeyString(), blk.RawData()); err != nil {
+			return err
+		}
+	}
+}
+
+// streamGroupArchive 解析文件组下所有层级的文件并以 zip 或 CAR 格式输出;
+// link 不为空时为通过分享链接下载, 跳过加密的文件, 开始输出前计入链接的下载次数
+func streamGroupArchive(c *gin.Context, owner string, gid int64, name string, link *model.Link) {
+	ctx := c.Request.Context()
+
+	archiveFormat := c.DefaultQuery("format", groupArchiveZip)
+	if archiveFormat != groupArchiveZip && archiveFormat != groupArchiveCar {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	// 判断是否超过流量限额
+	code, err := checkUserFlowQuota(ctx, owner)
+	if err != nil {
+		log.Errorf("checkUserFlowQuota error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+	if code != 0 {
+		c.JSON(http.StatusOK, respErrorCode(code, c))
+		return
+	}
+
+	groups, err := dao.ListSubAssetGroups(ctx, owner, gid)
+	if err != nil {
+		log.Errorf("ListSubAssetGroups error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+	gids := []int64{gid}
+	for _, g := range groups {
+		gids = append(gids, g.ID)
+	}
+
+	assets, err := dao.ListAssetsByGroups(ctx, owner, gids, maxGroupArchiveAssets+1)
+	if err != nil {
+		log.Errorf("ListAssetsByGroups error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+	if len(assets) > maxGroupArchiveAssets {
+		c.JSON(http.StatusOK, respErrorCode(errors.GroupArchiveTooLarge, c))
+		return
+	}
+	if link != nil {
+		visible := assets[:0]
+		for _, asset := range assets {
+			if asset.Password == "" {
+				visible = append(visible, asset)
+			}
+		}
+		assets = visible
+	}
+
+	if link != nil {
+		ok, err := dao.IncrLinkDownloadCount(ctx, link.ID)
+		if err != nil {
+			log.Errorf("IncrLinkDownloadCount error: %v", err)
+			c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusOK, respErrorCode(errors.ShareLinkDownloadLimit, c))
+			return
+		}
+	}
+
+	ip, _ := GetIPFromRequest(c.Request)
+	ga := &groupArchive{owner: owner, ip: ip, root: buildArchiveTree(name, gid, groups, assets)}
+
+	contentType := "application/zip"
+	if archiveFormat == groupArchiveCar {
+		contentType = "application/vnd.ipld.car; version=1"
+	}
+	filename := name + "." + archiveFormat
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename*=UTF-8''%s", url.PathEscape(filename)))
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+
+	if archiveFormat == groupArchiveCar {
+		err = ga.writeCar(ctx, c.Writer)
+	} else {
+		err = ga.writeZip(ctx, c.Writer)
+	}
+	if err != nil {
+		// 已经开始输出内容, 只能中断下载
+		log.Errorf("stream group archive %s %d error: %v", owner, gid, err)
+		abortStream()
+	}
+}
+
+// abortStream 已经开始输出内容后出错时中断响应, 客户端收到不完整的响应, 不会把损坏的文件当作下载成功;
+// 由 RecoveryMiddleware 交给 net/http 处理, HTTP/2 下同样有效
+func abortStream() {
+	panic(http.ErrAbortHandler)
+}
+
+// DownloadGroupHandler 打包下载自己的文件夹及其所有子文件夹中的文件
+// @Summary 打包下载文件夹
+// @Security ApiKeyAuth
+// @Tags storage
+// @Param group_id query int true "文件夹 id, 0 表示根目录"
+// @Param format query string false "zip 或 car, 默认 zip"
+// @Success 200 {file} file
+// @Router /api/v1/storage/group_download [get]
+func DownloadGroupHandler(c *gin.Context) {
+	username := jwt.ExtractClaims(c)[identityKey].(string)
+
+	gid, err := strconv.ParseInt(c.Query("group_id"), 10, 64)
+	if err != nil || gid < 0 {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	name := "titan-storage"
+	if gid > 0 {
+		available, err := dao.AssetGroupAvailable(c.Request.Context(), username, gid)
+		if err != nil {
+			log.Errorf("AssetGroupAvailable error: %v", err)
+			c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+			return
+		}
+		if !available {
+			c.JSON(http.StatusOK, respErrorCode(int(terrors.GroupNotExist), c))
+			return
+		}
+		info, err := dao.GetUserAssetGroupInfo(c.Request.Context(), username, int(gid))
+		if err != nil {
+			log.Errorf("GetUserAssetGroupInfo error: %v", err)
+			c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+			return
+		}
+		name = info.Name
+	}
+
+	streamGroupArchive(c, username, gid, name, nil)
+}
+
+// DownloadShareGroupHandler 通过分享链接打包下载别人分享的文件夹及其子文件夹, 加密的文件不会下载;
+// 与打开分享的文件一样检查链接的访问策略并计入下载次数
+// @Summary 打包下载分享的文件夹
+// @Tags storage
+// @Param share_token query string true "分享链接 token"
+// @Param group_id query int false "文件夹 id, 默认为分享的文件夹, 只能是分享的文件夹或其子文件夹"
+// @Param format query string false "zip 或 car, 默认 zip"
+// @Success 200 {file} file
+// @Router /api/v1/storage/share_group_download [get]
+func DownloadShareGroupHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	link, _, ok := getShareLink(c)
+	if !ok {
+		return
+	}
+	shareGid := linkGroupID(link)
+	if shareGid <= 0 {
+		c.JSON(http.StatusOK, respErrorCode(errors.PermissionNotAllowed, c))
+		return
+	}
+	owner := link.UserName
+
+	gid := shareGid
+	if v := c.Query("group_id"); v != "" {
+		var err error
+		if gid, err = strconv.ParseInt(v, 10, 64); err != nil || gid <= 0 {
+			c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+			return
+		}
+	}
+
+	inGroup, err := dao.GroupInGroup(ctx, owner, gid, shareGid)
+	if err != nil {
+		log.Errorf("GroupInGroup error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+	if !inGroup {
+		c.JSON(http.StatusOK, respErrorCode(errors.PermissionNotAllowed, c))
+		return
+	}
+
+	shared, err := dao.AssetGroupShared(ctx, owner, gid)
+	if err != nil {
+		log.Errorf("AssetGroupShared error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+	if !shared {
+		c.JSON(http.StatusOK, respErrorCode(errors.PermissionNotAllowed, c))
+		return
+	}
+
+	info, err := dao.GetUserAssetGroupInfo(ctx, owner, int(gid))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusOK, respErrorCode(int(terrors.GroupNotExist), c))
+		return
+	}
+	if err != nil {
+		log.Errorf("GetUserAssetGroupInfo error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	streamGroupArchive(c, owner, gid, info.Name, link)
+}
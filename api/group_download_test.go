@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/config"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+)
+
+func TestArchiveUniqueName(t *testing.T) {
+	dir := newArchiveDir("root")
+
+	for _, c := range []struct{ name, want string }{
+		{"a.txt", "a.txt"},
+		{"a.txt", "a (1).txt"},
+		{"a (1).txt", "a (1) (1).txt"},
+		{"a.txt", "a (2).txt"},
+		{"../x/y", ".._x_y"},
+		{"..", "_"},
+		{" ", "_ (1)"},
+	} {
+		if got := dir.uniqueName(c.name); got != c.want {
+			t.Errorf("uniqueName(%q) = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestBuildArchiveTree(t *testing.T) {
+	groups := []*dao.AssetGroup{
+		{ID: 2, Name: "docs", Parent: 1},
+		{ID: 3, Name: "docs", Parent: 1},
+		{ID: 4, Name: "img", Parent: 2},
+	}
+	assets := []*model.UserAsset{
+		{AssetName: "a.txt", GroupID: 1},
+		{AssetName: "b.png", GroupID: 4},
+		{AssetName: "c.txt", GroupID: 9},
+		{AssetName: "docs@v1", AssetType: publishAssetType, GroupID: 1},
+	}
+
+	root := buildArchiveTree("root", 1, groups, assets)
+	if len(root.Files) != 1 || len(root.Dirs) != 2 {
+		t.Fatalf("root has %d files and %d dirs, want 1 and 2", len(root.Files), len(root.Dirs))
+	}
+	if root.Dirs[0].Name != "docs" || root.Dirs[1].Name != "docs (1)" {
+		t.Errorf("dir names = %q, %q", root.Dirs[0].Name, root.Dirs[1].Name)
+	}
+	if img := root.Dirs[0].Dirs; len(img) != 1 || len(img[0].Files) != 1 || img[0].Files[0].Name != "b.png" {
+		t.Errorf("nested dir not built")
+	}
+}
+
+func TestDownloadShareGroupWithoutToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config.Cfg.ShareLinkSecret = "test-secret"
+	defer func() { config.Cfg.ShareLinkSecret = "" }()
+
+	// 只有 user_id 和 group_id 时不能下载
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/storage/share_group_download?user_id=alice&group_id=1", nil)
+	DownloadShareGroupHandler(c)
+
+	var resp struct {
+		Err int `json:"err"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Err != errors.NotFound {
+		t.Fatalf("expected NotFound, got %s", w.Body.String())
+	}
+}
+
+func TestAbortStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(RecoveryMiddleware())
+	r.GET("/archive", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+		c.Writer.WriteString("partial")
+		c.Writer.Flush()
+		abortStream()
+	})
+
+	for _, http2 := range []bool{false, true} {
+		srv := httptest.NewUnstartedServer(r)
+		srv.EnableHTTP2 = http2
+		srv.StartTLS()
+
+		resp, err := srv.Client().Get(srv.URL + "/archive")
+		if err != nil {
+			srv.Close()
+			t.Fatal(err)
+		}
+		// 中断后客户端读取响应出错, 不会得到完整的响应
+		_, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		srv.Close()
+		if err == nil {
+			t.Errorf("http2=%v: expected the response to be aborted", http2)
+		}
+		if http2 && resp.ProtoMajor != 2 {
+			t.Errorf("expected HTTP/2 response, got %s", resp.Proto)
+		}
+	}
+}
@@ -0,0 +1,409 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Filecoin-Titan/titan/api/terrors"
+	"github.com/Filecoin-Titan/titan/api/types"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/config"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/core/opasynq"
+	"github.com/gnasnik/titan-explorer/core/oprds"
+	"github.com/gnasnik/titan-explorer/core/storage"
+	"github.com/gnasnik/titan-explorer/pkg/formatter"
+	"github.com/hibiken/asynq"
+)
+
+const (
+	// publishAssetType 发布文件组生成的目录在用户文件中的类型
+	publishAssetType = "dir"
+	// maxGroupPublishErrorLength 发布失败时记录的错误信息长度上限
+	maxGroupPublishErrorLength = 512
+	// groupPublishCarOverhead CAR 头等固定的额外空间, 块头和文件中间节点另外按内容大小的 2% 估算, 用于限制临时文件的大小
+	groupPublishCarOverhead = 16 << 20
+	// defaultGroupPublishMaxSize 发布文件组默认的总大小上限
+	defaultGroupPublishMaxSize = 10 << 30
+)
+
+var errGroupPublishTooLarge = fmt.Errorf("car exceeds the expected size")
+
+// groupPublishMaxSize 发布文件组的总大小上限
+func groupPublishMaxSize() int64 {
+	if config.Cfg.GroupPublish.MaxSize > 0 {
+		return config.Cfg.GroupPublish.MaxSize
+	}
+	return defaultGroupPublishMaxSize
+}
+
+// isLastRetry 队列任务是否已经是最后一次重试
+func isLastRetry(ctx context.Context) bool {
+	retried, _ := asynq.GetRetryCount(ctx)
+	maxRetry, ok := asynq.GetMaxRetry(ctx)
+	return ok && retried >= maxRetry
+}
+
+// limitedWriter 写入超过上限时返回错误, 避免临时文件无限增长
+type limitedWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > l.n {
+		return 0, errGroupPublishTooLarge
+	}
+	n, err := l.w.Write(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+type groupPublishReq struct {
+	GroupID int64    `json:"group_id" binding:"required"`
+	AreaID  []string `json:"area_id"`
+}
+
+// RunGroupPublish 将文件组生成 UnixFS 目录的 CAR 并通过调度器上传, 上传后作为用户的文件保存;
+// 失败时记录原因, 用户可以重新发布
+func RunGroupPublish(ctx context.Context, id int64) error {
+	err := runGroupPublish(ctx, id)
+	if err != nil && isLastRetry(ctx) {
+		failGroupPublish(id, err)
+	}
+	return err
+}
+
+// failGroupPublish 队列不再重试时将发布记录标记为失败, 避免一直处于发布中
+func failGroupPublish(id int64, cause error) {
+	// 任务超时时 ctx 已经取消, 使用新的 context 更新状态
+	if err := dao.FailGroupPublish(context.Background(), id, formatter.Truncate(cause.Error(), maxGroupPublishErrorLength)); err != nil {
+		log.Errorf("mark group publish %d failed: %v", id, err)
+	}
+}
+
+func runGroupPublish(ctx context.Context, id int64) error {
+	p, err := dao.GetGroupPublish(ctx, id)
+	if err == sql.ErrNoRows {
+		log.Errorf("group publish %d not found", id)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("get group publish error:%w", err)
+	}
+	if p.State != dao.GroupPublishStatePending {
+		return nil
+	}
+
+	if err := publishGroup(ctx, p); err != nil {
+		// 服务退出时由队列重试
+		if ctx.Err() != nil {
+			return err
+		}
+		log.Errorf("publish group %s %d v%d error: %v", p.UserID, p.GroupID, p.Version, err)
+		p.State, p.Error = dao.GroupPublishStateFailed, formatter.Truncate(err.Error(), maxGroupPublishErrorLength)
+	} else {
+		p.State, p.Error = dao.GroupPublishStatePublished, ""
+	}
+
+	return dao.FinishGroupPublish(ctx, p)
+}
+
+func publishGroup(ctx context.Context, p *model.AssetGroupPublish) error {
+	user, err := dao.GetUserByUsername(ctx, p.UserID)
+	if err != nil {
+		return fmt.Errorf("get user error:%w", err)
+	}
+
+	available, err := dao.AssetGroupAvailable(ctx, p.UserID, p.GroupID)
+	if err != nil {
+		return err
+	}
+	if !available {
+		return fmt.Errorf("group not found")
+	}
+	info, err := dao.GetUserAssetGroupInfo(ctx, p.UserID, int(p.GroupID))
+	if err != nil {
+		return err
+	}
+
+	groups, err := dao.ListSubAssetGroups(ctx, p.UserID, p.GroupID)
+	if err != nil {
+		return err
+	}
+	gids := []int64{p.GroupID}
+	for _, g := range groups {
+		gids = append(gids, g.ID)
+	}
+	assets, err := dao.ListAssetsByGroups(ctx, p.UserID, gids, maxGroupArchiveAssets+1)
+	if err != nil {
+		return err
+	}
+	if len(assets) > maxGroupArchiveAssets {
+		return fmt.Errorf("too many files in the group")
+	}
+
+	// 加密的文件不能公开发布
+	visible := assets[:0]
+	for _, asset := range assets {
+		if asset.Password == "" {
+			visible = append(visible, asset)
+		}
+	}
+
+	ga := &groupArchive{owner: p.UserID, root: buildArchiveTree(info.Name, p.GroupID, groups, visible)}
+	root, nodes, err := buildDirNode(ga.root)
+	if err != nil {
+		return err
+	}
+	p.RootCID = root.Cid().String()
+	p.AssetCount = int64(len(visible))
+
+	// 文件已经计入了已使用的存储空间, 发布只新增目录节点
+	var dirSize, filesSize int64
+	for _, n := range nodes {
+		dirSize += int64(len(n.RawData()))
+	}
+	for _, asset := range visible {
+		filesSize += asset.TotalSize
+	}
+	p.Size = dirSize + filesSize
+	if maxSize := groupPublishMaxSize(); p.Size > maxSize {
+		return fmt.Errorf("group size %d exceeds the publish limit %d", p.Size, maxSize)
+	}
+
+	hash, err := storage.CIDToHash(p.RootCID)
+	if err != nil {
+		return err
+	}
+
+	// 内容没有变化时根 CID 相同, 不需要重新上传
+	if _, err := dao.GetUserAsset(ctx, hash, p.UserID); err == nil {
+		return nil
+	}
+
+	// 写入 CAR 之前检查存储空间
+	code, err := checkUserUploadQuota(ctx, user, dirSize)
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return fmt.Errorf("quota exceeded, code %d", code)
+	}
+
+	f, err := os.CreateTemp("", "titan-publish-*.car")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := ga.writeCar(ctx, &limitedWriter{w: f, n: p.Size + p.Size/50 + groupPublishCarOverhead}); err != nil {
+		return err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	carSize := stat.Size()
+
+	if !dao.ContentAvailable(ctx, hash, p.AreaID) {
+		schedulerClient, err := getSchedulerClient(ctx, p.AreaID)
+		if err != nil {
+			return err
+		}
+		rsp, err := schedulerClient.CreateAsset(ctx, &types.CreateAssetReq{
+			UserID: p.UserID, AssetCID: p.RootCID, AssetSize: carSize, Owner: p.UserID, ExpirationDay: 4 * 365})
+		if err != nil {
+			return fmt.Errorf("create asset error:%w", err)
+		}
+		if !rsp.AlreadyExists {
+			if err := uploadCarToCandidates(ctx, f, p.RootCID, rsp); err != nil {
+				return err
+			}
+		}
+	}
+
+	notExistsAids, err := dao.GetUserAssetNotAreaIDs(ctx, hash, p.UserID, []string{p.AreaID})
+	if err != nil {
+		return err
+	}
+	if len(notExistsAids) > 0 {
+		err = oprds.GetClient().PushSchedulerInfo(ctx, &oprds.Payload{UserID: p.UserID, CID: p.RootCID, Hash: hash, AreaID: p.AreaID, Owner: p.UserID})
+		if err != nil {
+			log.Errorf("PushSchedulerInfo error: %v", err)
+		}
+	}
+
+	return dao.AddAssetAndUpdateSize(ctx, &model.UserAsset{
+		UserID:      p.UserID,
+		Hash:        hash,
+		Cid:         p.RootCID,
+		AssetName:   fmt.Sprintf("%s@v%d", info.Name, p.Version),
+		AssetType:   publishAssetType,
+		CreatedTime: time.Now(),
+		TotalSize:   dirSize,
+		GroupID:     info.Parent,
+	}, notExistsAids, p.AreaID)
+}
+
+// uploadCarToCandidates 依次尝试调度器分配的上传地址, 有一个上传成功即可
+func uploadCarToCandidates(ctx context.Context, f *os.File, name string, info *types.UploadInfo) error {
+	lastErr := fmt.Errorf("no upload candidate")
+	for _, candidate := range info.List {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if lastErr = uploadCar(ctx, candidate.UploadURL, candidate.Token, name, f); lastErr == nil {
+			return nil
+		}
+		log.Errorf("upload car to %s error: %v", candidate.UploadURL, lastErr)
+	}
+	return lastErr
+}
+
+// uploadCar 以表单的方式上传 CAR 文件到节点
+func uploadCar(ctx context.Context, uploadURL, token, name string, r io.Reader) error {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		fw, err := mw.CreateFormFile("file", name+".car")
+		if err == nil {
+			_, err = io.Copy(fw, r)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uploadURL, pr)
+	if err != nil {
+		pr.CloseWithError(err)
+		return err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("upload status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// PublishGroupHandler 将文件夹发布为 UnixFS 目录, 每次发布生成新的版本, 在 explorer 队列中异步执行
+// @Summary 发布文件夹
+// @Security ApiKeyAuth
+// @Tags storage
+// @Param req body groupPublishReq true "请求参数"
+// @Success 200 {object} JsonObject "{id:0,version:0}"
+// @Router /api/v1/storage/group_publish [post]
+func PublishGroupHandler(c *gin.Context) {
+	username := jwt.ExtractClaims(c)[identityKey].(string)
+
+	var req groupPublishReq
+	if err := c.ShouldBindJSON(&req); err != nil || req.GroupID <= 0 {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	areaIds := getAreaIDsByArea(c, req.AreaID)
+	if len(areaIds) == 0 {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	available, err := dao.AssetGroupAvailable(c.Request.Context(), username, req.GroupID)
+	if err != nil {
+		log.Errorf("AssetGroupAvailable error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+	if !available {
+		c.JSON(http.StatusOK, respErrorCode(int(terrors.GroupNotExist), c))
+		return
+	}
+
+	SetAuditTarget(c, "group", req.GroupID)
+
+	now := time.Now()
+	p := &model.AssetGroupPublish{
+		UserID:    username,
+		GroupID:   req.GroupID,
+		AreaID:    areaIds[0],
+		State:     dao.GroupPublishStatePending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	err = dao.CreateGroupPublish(c.Request.Context(), p)
+	if err == dao.ErrGroupPublishing {
+		c.JSON(http.StatusOK, respErrorCode(errors.GroupPublishInProgress, c))
+		return
+	}
+	if err != nil {
+		log.Errorf("CreateGroupPublish error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	if err := opasynq.DefaultCli.EnqueueGroupPublish(c.Request.Context(), opasynq.GroupPublishPayload{ID: p.ID}); err != nil {
+		log.Errorf("EnqueueGroupPublish error: %v", err)
+		p.State, p.Error = dao.GroupPublishStateFailed, "enqueue failed"
+		if err := dao.FinishGroupPublish(c.Request.Context(), p); err != nil {
+			log.Errorf("FinishGroupPublish error: %v", err)
+		}
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"id":      p.ID,
+		"version": p.Version,
+	}))
+}
+
+// ListGroupPublishHandler 获取文件夹所有的发布版本, 旧版本的根 CID 仍然可以访问
+// @Summary 获取文件夹的发布版本
+// @Security ApiKeyAuth
+// @Tags storage
+// @Param group_id query int true "文件夹 id"
+// @Success 200 {object} JsonObject "{list:[]}"
+// @Router /api/v1/storage/group_publish [get]
+func ListGroupPublishHandler(c *gin.Context) {
+	username := jwt.ExtractClaims(c)[identityKey].(string)
+
+	gid, err := strconv.ParseInt(c.Query("group_id"), 10, 64)
+	if err != nil || gid <= 0 {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	list, err := dao.ListGroupPublishes(c.Request.Context(), username, gid)
+	if err != nil {
+		log.Errorf("ListGroupPublishes error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list": list,
+	}))
+}
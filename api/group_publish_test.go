@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gnasnik/titan-explorer/config"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/dao/daotest"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/core/scheduler"
+	"github.com/gnasnik/titan-explorer/core/storage"
+)
+
+func TestRunGroupPublish(t *testing.T) {
+	db := daotest.Open(t)
+	ctx := context.Background()
+
+	const username = "group_publish_test_user"
+	fileCID, fileHash := testBatchCID(t, "group_publish_test_file")
+
+	var rootHash string
+	cleanup := func() {
+		for _, table := range []string{"user_asset", "user_asset_area", "user_asset_map", "user_asset_group", "asset_group_publish"} {
+			daotest.Exec(t, db, `DELETE FROM `+table+` WHERE user_id = ?`, username)
+		}
+		daotest.Exec(t, db, `DELETE FROM users WHERE username = ?`, username)
+		daotest.Exec(t, db, `DELETE FROM content WHERE hash IN (?, ?)`, fileHash, rootHash)
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+
+	daotest.Exec(t, db, `INSERT INTO users (username, used_storage_size) VALUES (?, 0)`, username)
+	group, err := dao.CreateAssetGroup(ctx, username, "site", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dao.AddAssetAndUpdateSize(ctx, &model.UserAsset{
+		UserID: username, Hash: fileHash, Cid: fileCID, AssetName: "index.html", TotalSize: 10, GroupID: group.ID, CreatedTime: time.Now(),
+	}, []string{scheduler.DefaultAreaId}, scheduler.DefaultAreaId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newPublish := func() *model.AssetGroupPublish {
+		t.Helper()
+		p := &model.AssetGroupPublish{
+			UserID: username, GroupID: group.ID, AreaID: scheduler.DefaultAreaId, State: dao.GroupPublishStatePending,
+			CreatedAt: time.Now(), UpdatedAt: time.Now(),
+		}
+		if err := dao.CreateGroupPublish(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	getPublish := func(id int64) *model.AssetGroupPublish {
+		t.Helper()
+		p, err := dao.GetGroupPublish(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	// 超过大小上限时不生成 CAR, 直接标记为失败
+	config.Cfg.GroupPublish.MaxSize = 1
+	p := newPublish()
+	err = RunGroupPublish(ctx, p.ID)
+	config.Cfg.GroupPublish.MaxSize = 0
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := getPublish(p.ID)
+	if got.State != dao.GroupPublishStateFailed || !strings.Contains(got.Error, "exceeds the publish limit") {
+		t.Fatalf("expect publish over the size limit to fail, got %+v", got)
+	}
+	if got.RootCID == "" || got.AssetCount != 1 {
+		t.Fatalf("expect the failed publish to record the root cid, got %+v", got)
+	}
+	rootCID := got.RootCID
+
+	// 服务退出时保持发布中由队列重试, 不再重试时标记为失败
+	p = newPublish()
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	err = RunGroupPublish(cctx, p.ID)
+	if err == nil {
+		t.Fatal("expect an error with a cancelled context")
+	}
+	if got := getPublish(p.ID); got.State != dao.GroupPublishStatePending {
+		t.Fatalf("expect the publish to stay pending for retry, got %s", got.State)
+	}
+	failGroupPublish(p.ID, err)
+	if got := getPublish(p.ID); got.State != dao.GroupPublishStateFailed || got.Error == "" {
+		t.Fatalf("expect the publish to fail on the last retry, got %+v", got)
+	}
+
+	// 内容没有变化时根 CID 相同, 已存在的目录不需要重新上传
+	rootHash, err = storage.CIDToHash(rootCID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dao.AddAssetAndUpdateSize(ctx, &model.UserAsset{
+		UserID: username, Hash: rootHash, Cid: rootCID, AssetName: "site@v1", AssetType: publishAssetType, TotalSize: 1, CreatedTime: time.Now(),
+	}, []string{scheduler.DefaultAreaId}, scheduler.DefaultAreaId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = newPublish()
+	if err := RunGroupPublish(ctx, p.ID); err != nil {
+		t.Fatal(err)
+	}
+	got = getPublish(p.ID)
+	if got.State != dao.GroupPublishStatePublished || got.RootCID != rootCID || got.Version != 3 {
+		t.Fatalf("expect the unchanged group to be published, got %+v", got)
+	}
+
+	// 已完成的发布再次执行时直接跳过
+	if err := RunGroupPublish(ctx, p.ID); err != nil {
+		t.Fatal(err)
+	}
+}
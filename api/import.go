@@ -47,8 +47,8 @@ func SyncIPFSInfoByCIDs(c *gin.Context) {
 		irs      []model.SyncIPFSRecord
 		tnow     = time.Now().Unix()
 
-		cids      []string
-		totalSize int64
+		cids  []string
+		sizes []int64
 	)
 
 	err := c.ShouldBindJSON(&req)
@@ -94,13 +94,19 @@ func SyncIPFSInfoByCIDs(c *gin.Context) {
 		if len(links) > 0 && links[0].Name != "" {
 			name = links[0].Name
 		}
-		totalSize += int64(size)
+		sizes = append(sizes, int64(size))
 		irs = append(irs, model.SyncIPFSRecord{Username: username, CID: v, Timestamp: tnow, AreaID: areaIds[0],
 			GroupID: req.GroupID, Size: int64(size), Name: name})
 	}
-	// 判断用户存储空间是否够用
-	if user.TotalStorageSize-user.UsedStorageSize < totalSize {
-		c.JSON(http.StatusOK, respErrorCode(int(terrors.UserStorageSizeNotEnough), c))
+	// 按用户的套餐判断文件大小、文件数量和存储空间是否够用
+	code, err := checkUserUploadQuota(c.Request.Context(), user, sizes...)
+	if err != nil {
+		log.Errorf("checkUserUploadQuota error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+	if code != 0 {
+		c.JSON(http.StatusOK, respErrorCode(code, c))
 		return
 	}
 
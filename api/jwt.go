@@ -359,6 +359,12 @@ func AuthRequired(authMiddleware *jwt.GinJWTMiddleware) gin.HandlerFunc {
 					authMiddleware.Unauthorized(ctx, http.StatusUnauthorized, authMiddleware.HTTPStatusMessageFunc(jwt.ErrForbidden, ctx))
 					return
 				}
+				// 轮换后只有当前的 key 以及宽限期内的旧 key 有效
+				valid, err := checkTenantApiKey(ctx.Request.Context(), payload.TenantID, tenantKey)
+				if err != nil || !valid {
+					authMiddleware.Unauthorized(ctx, http.StatusUnauthorized, authMiddleware.HTTPStatusMessageFunc(jwt.ErrForbidden, ctx))
+					return
+				}
 				ctx.Set("JWT_PAYLOAD", jwt.MapClaims{
 					tenantID:   payload.TenantID,
 					tenantName: payload.Name,
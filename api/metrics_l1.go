@@ -2,7 +2,9 @@ package api
 
 import (
 	"context"
+	"strings"
 
+	"github.com/gnasnik/titan-explorer/core/generated/model"
 	"github.com/gnasnik/titan-explorer/core/statistics"
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -49,7 +51,16 @@ func init() {
 }
 
 func setL1Gatherer(ctx context.Context) {
-	for _, node := range statistics.AllL1NodesMap {
+	nodes := statistics.Nodes.Filter(func(node *model.DeviceInfo) bool {
+		return strings.Contains(node.DeviceID, "c_")
+	})
+
+	// 已经移除的节点不再上报
+	for _, gauge := range []*prometheus.GaugeVec{cpuGauge, cpuUsageGauge, memoryGauge, memoryUsageGauge, diskGauge, diskUsageGauge} {
+		gauge.Reset()
+	}
+
+	for _, node := range nodes {
 		cpuGauge.WithLabelValues(node.DeviceID).Set(float64(node.CpuCores))
 		cpuUsageGauge.WithLabelValues(node.DeviceID).Set(node.CpuUsage)
 		memoryGauge.WithLabelValues(node.DeviceID).Set(node.Memory)
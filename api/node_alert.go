@@ -0,0 +1,315 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/config"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/core/statistics"
+	"github.com/gnasnik/titan-explorer/pkg/formatter"
+	"github.com/gnasnik/titan-explorer/pkg/iptool"
+	"github.com/hibiken/asynq"
+)
+
+const (
+	nodeAlertChannelEmail   = "email"
+	nodeAlertChannelWebhook = "webhook"
+
+	defaultNodeAlertDiskThreshold = 90
+
+	// maxNodeAlertErrorLength 发送失败时记录的错误信息长度上限
+	maxNodeAlertErrorLength = 512
+)
+
+// nodeAlertHTTPClient 告警回调地址由用户设置, 只允许连接公网地址
+var nodeAlertHTTPClient = iptool.NewPublicHTTPClient(10 * time.Second)
+
+// RunNodeAlertNotify 按用户的告警规则发送节点告警, 已发送成功的通知方式在重试时不会重复发送
+func RunNodeAlertNotify(ctx context.Context, id int64) error {
+	alert, err := dao.GetNodeAlert(ctx, id)
+	if err == sql.ErrNoRows {
+		log.Errorf("node alert %d not found", id)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("get node alert error:%w", err)
+	}
+	if alert.State != dao.NodeAlertStatePending {
+		return nil
+	}
+
+	rule, err := dao.GetNodeAlertRule(ctx, alert.UserID)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("get node alert rule error:%w", err)
+	}
+	if rule == nil || !rule.Enabled {
+		return skipNodeAlert(ctx, alert, "alert rule disabled")
+	}
+
+	// 免打扰期间延后的离线告警, 节点已经恢复时不再发送
+	if alert.AlertType == dao.NodeAlertTypeOffline || alert.AlertType == dao.NodeAlertTypeOfflineLong {
+		device, err := dao.GetDeviceInfo(ctx, alert.DeviceID)
+		if err == nil && device.DeviceStatus != statistics.DeviceStatusOffline {
+			return skipNodeAlert(ctx, alert, "node recovered")
+		}
+	}
+
+	if !rule.NotifyEmail && rule.WebhookURL == "" {
+		return skipNodeAlert(ctx, alert, "no notification channel")
+	}
+
+	sent := make(map[string]bool)
+	for _, channel := range strings.Split(alert.Channels, ",") {
+		sent[channel] = true
+	}
+
+	var errs []string
+	if rule.NotifyEmail && !sent[nodeAlertChannelEmail] {
+		if err := sendNodeAlertEmail(ctx, alert); err != nil {
+			errs = append(errs, fmt.Sprintf("email: %v", err))
+		} else {
+			sent[nodeAlertChannelEmail] = true
+		}
+	}
+	if rule.WebhookURL != "" && !sent[nodeAlertChannelWebhook] {
+		if err := sendNodeAlertWebhook(ctx, rule.WebhookURL, alert); err != nil {
+			errs = append(errs, fmt.Sprintf("webhook: %v", err))
+		} else {
+			sent[nodeAlertChannelWebhook] = true
+		}
+	}
+
+	var channels []string
+	for _, channel := range []string{nodeAlertChannelEmail, nodeAlertChannelWebhook} {
+		if sent[channel] {
+			channels = append(channels, channel)
+		}
+	}
+	alert.Channels = strings.Join(channels, ",")
+	alert.State, alert.Error = dao.NodeAlertStateSent, ""
+
+	var notifyErr error
+	if len(errs) > 0 {
+		notifyErr = fmt.Errorf("%s", strings.Join(errs, "; "))
+		alert.Error = formatter.Truncate(notifyErr.Error(), maxNodeAlertErrorLength)
+
+		alert.State = dao.NodeAlertStatePending
+		retried, _ := asynq.GetRetryCount(ctx)
+		if maxRetry, ok := asynq.GetMaxRetry(ctx); ok && retried >= maxRetry {
+			alert.State = dao.NodeAlertStateFailed
+		}
+	}
+
+	if err := dao.UpdateNodeAlert(ctx, alert); err != nil {
+		log.Errorf("UpdateNodeAlert error: %v", err)
+	}
+
+	return notifyErr
+}
+
+func skipNodeAlert(ctx context.Context, alert *model.NodeAlert, reason string) error {
+	alert.State, alert.Error = dao.NodeAlertStateSkipped, reason
+	return dao.UpdateNodeAlert(ctx, alert)
+}
+
+// sendNodeAlertEmail 发送告警到用户的账号邮箱
+func sendNodeAlertEmail(ctx context.Context, alert *model.NodeAlert) error {
+	user, err := dao.GetUserByUsername(ctx, alert.UserID)
+	if err != nil {
+		return err
+	}
+
+	sendTo := user.Username
+	if !strings.Contains(sendTo, "@") {
+		sendTo = user.UserEmail
+	}
+	if sendTo == "" {
+		return fmt.Errorf("user has no email address")
+	}
+
+	content := fmt.Sprintf("%s\r\n\r\nNode ID: %s\r\nTime: %s\r\n", alert.Message, alert.DeviceID, alert.CreatedAt.Format(time.DateTime))
+	return sendMail([]string{sendTo}, "[Titan Network] Node alert", "text/plain", content)
+}
+
+// sendNodeAlertWebhook 以 json 格式推送告警到用户设置的地址, 返回 2xx 视为成功
+func sendNodeAlertWebhook(ctx context.Context, webhookURL string, alert *model.NodeAlert) error {
+	body, err := json.Marshal(JsonObject{
+		"event":      "node.alert",
+		"id":         alert.ID,
+		"device_id":  alert.DeviceID,
+		"alert_type": alert.AlertType,
+		"message":    alert.Message,
+		"created_at": alert.CreatedAt.Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := nodeAlertHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// 不记录响应内容, 避免通过错误信息读取回调地址返回的数据
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// defaultNodeAlertRule 用户没有设置告警规则时的默认值
+func defaultNodeAlertRule(userID string) *model.NodeAlertRule {
+	offline, dedup := config.Cfg.NodeAlert.OfflineWindow, config.Cfg.NodeAlert.DedupWindow
+	if offline <= 0 {
+		offline = 30 * time.Minute
+	}
+	if dedup <= 0 {
+		dedup = time.Hour
+	}
+
+	return &model.NodeAlertRule{
+		UserID:         userID,
+		NotifyEmail:    true,
+		OfflineMinutes: int64(offline / time.Minute),
+		NATDegrade:     true,
+		DiskThreshold:  defaultNodeAlertDiskThreshold,
+		DedupMinutes:   int64(dedup / time.Minute),
+	}
+}
+
+// validateNodeAlertRule 校验告警规则, 回调地址必须解析到公网地址
+func validateNodeAlertRule(ctx context.Context, rule *model.NodeAlertRule) bool {
+	if rule.OfflineMinutes < 0 || rule.DedupMinutes < 0 || rule.DiskThreshold < 0 || rule.DiskThreshold > 100 {
+		return false
+	}
+
+	if rule.WebhookURL != "" {
+		if err := iptool.CheckPublicURL(ctx, rule.WebhookURL); err != nil {
+			log.Errorf("invalid node alert webhook: %v", err)
+			return false
+		}
+	}
+
+	if (rule.QuietStart == "") != (rule.QuietEnd == "") {
+		return false
+	}
+	for _, clock := range []string{rule.QuietStart, rule.QuietEnd} {
+		if _, err := time.Parse("15:04", clock); clock != "" && err != nil {
+			return false
+		}
+	}
+
+	if rule.Timezone != "" {
+		if _, err := time.LoadLocation(rule.Timezone); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// GetNodeAlertRuleHandler 获取节点告警规则, 没有设置时返回默认规则
+// @Summary 获取节点告警规则
+// @Security ApiKeyAuth
+// @Tags node
+// @Success 200 {object} JsonObject "{rule:{}}"
+// @Router /api/v2/node/alert/rule [get]
+func GetNodeAlertRuleHandler(c *gin.Context) {
+	username := jwt.ExtractClaims(c)[identityKey].(string)
+
+	rule, err := dao.GetNodeAlertRule(c.Request.Context(), username)
+	if err == sql.ErrNoRows {
+		rule, err = defaultNodeAlertRule(username), nil
+	}
+	if err != nil {
+		log.Errorf("GetNodeAlertRule error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"rule": rule,
+	}))
+}
+
+// SetNodeAlertRuleHandler 设置节点告警规则, 离线, NAT 变差和磁盘使用率告警通过邮件或 webhook 通知,
+// 免打扰时段内的告警延后到时段结束时发送
+// @Summary 设置节点告警规则
+// @Security ApiKeyAuth
+// @Tags node
+// @Param req body model.NodeAlertRule true "请求参数"
+// @Success 200 {object} JsonObject "{}"
+// @Router /api/v2/node/alert/rule [post]
+func SetNodeAlertRuleHandler(c *gin.Context) {
+	username := jwt.ExtractClaims(c)[identityKey].(string)
+
+	var rule model.NodeAlertRule
+	if err := c.ShouldBindJSON(&rule); err != nil || !validateNodeAlertRule(c.Request.Context(), &rule) {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	now := time.Now()
+	rule.UserID, rule.CreatedAt, rule.UpdatedAt = username, now, now
+	if err := dao.UpsertNodeAlertRule(c.Request.Context(), &rule); err != nil {
+		log.Errorf("UpsertNodeAlertRule error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(nil))
+}
+
+// ListNodeAlertHandler 获取节点告警记录
+// @Summary 获取节点告警记录
+// @Security ApiKeyAuth
+// @Tags node
+// @Param device_id query string false "节点 id"
+// @Param alert_type query string false "offline, offline_long, nat_degraded, disk_usage"
+// @Param page query int false "页码"
+// @Param page_size query int false "每页数量"
+// @Success 200 {object} JsonObject "{list:[],total:0}"
+// @Router /api/v2/node/alert/list [get]
+func ListNodeAlertHandler(c *gin.Context) {
+	username := jwt.ExtractClaims(c)[identityKey].(string)
+
+	page, _ := strconv.Atoi(c.Query("page"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	total, list, err := dao.ListNodeAlerts(c.Request.Context(), username, c.Query("device_id"), c.Query("alert_type"), pageSize, (page-1)*pageSize)
+	if err != nil {
+		log.Errorf("ListNodeAlerts error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list":  list,
+		"total": total,
+	}))
+}
@@ -0,0 +1,528 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+)
+
+const (
+	fleetActionRename           = "rename"
+	fleetActionDeactivate       = "deactivate"
+	fleetActionCancelDeactivate = "cancel_deactivate"
+	fleetActionUnbind           = "unbind"
+	fleetActionEdgeConfig       = "edge_config"
+	fleetActionLabel            = "label"
+	fleetActionGroup            = "group"
+)
+
+const (
+	// maxFleetActionNodes 一次批量操作的最大节点数量
+	maxFleetActionNodes = 500
+	// fleetActionConcurrency 批量操作同时处理的节点数量
+	fleetActionConcurrency = 10
+
+	maxDeviceLabels      = 20
+	maxDeviceLabelLength = 64
+)
+
+// fleetSelection 批量操作选择的节点, 可以指定节点 id, 分组或标签
+type fleetSelection struct {
+	NodeIDs []string `json:"node_ids"`
+	GroupID int64    `json:"group_id"`
+	Label   string   `json:"label"`
+}
+
+type fleetActionReq struct {
+	fleetSelection
+	Action string `json:"action" binding:"required"`
+	// Name 重命名后的名称, 其中的 {n} 替换为节点的序号
+	Name   string `json:"name"`
+	Hours  int    `json:"hours"`
+	Code   string `json:"code"`
+	Config string `json:"config"`
+
+	AddLabels    []string `json:"add_labels"`
+	RemoveLabels []string `json:"remove_labels"`
+
+	TargetGroupID int64 `json:"target_group_id"`
+	// Remove 为 true 时从 TargetGroupID 分组中移除节点
+	Remove bool `json:"remove"`
+}
+
+// fleetActionResult 单个节点的执行结果, 失败时 Code 为错误码, Error 为对应的提示信息
+type fleetActionResult struct {
+	NodeID  string `json:"node_id"`
+	Success bool   `json:"success"`
+	Code    int    `json:"code,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type fleetNode struct {
+	*model.DeviceInfo
+	Labels []string `json:"labels"`
+}
+
+type deviceGroupReq struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// normalizeDeviceLabels 去掉标签首尾的空格并去重, 标签为空或过长时返回 false
+func normalizeDeviceLabels(labels []string) ([]string, bool) {
+	if len(labels) > maxDeviceLabels {
+		return nil, false
+	}
+
+	seen := make(map[string]bool)
+	out := make([]string, 0, len(labels))
+	for _, label := range labels {
+		label = strings.TrimSpace(label)
+		if label == "" || utf8.RuneCountInString(label) > maxDeviceLabelLength {
+			return nil, false
+		}
+		if seen[label] {
+			continue
+		}
+		seen[label] = true
+		out = append(out, label)
+	}
+	return out, true
+}
+
+// fleetNodeName 返回第 i 个节点重命名后的名称
+func fleetNodeName(name string, i int) string {
+	return strings.ReplaceAll(name, "{n}", strconv.Itoa(i+1))
+}
+
+// validateFleetAction 校验各个操作需要的参数, 并规范化标签
+func validateFleetAction(req *fleetActionReq) bool {
+	if len(req.NodeIDs) == 0 && req.GroupID <= 0 && req.Label == "" {
+		return false
+	}
+	if len(req.NodeIDs) > maxFleetActionNodes {
+		return false
+	}
+
+	switch req.Action {
+	case fleetActionRename:
+		name := strings.TrimSpace(req.Name)
+		return name != "" && utf8.RuneCountInString(name) <= maxDeviceLabelLength
+	case fleetActionDeactivate:
+		return req.Hours > 0 && req.Code != ""
+	case fleetActionCancelDeactivate, fleetActionUnbind:
+		return true
+	case fleetActionEdgeConfig:
+		return json.Valid([]byte(req.Config))
+	case fleetActionLabel:
+		var ok bool
+		if req.AddLabels, ok = normalizeDeviceLabels(req.AddLabels); !ok {
+			return false
+		}
+		if req.RemoveLabels, ok = normalizeDeviceLabels(req.RemoveLabels); !ok {
+			return false
+		}
+		return len(req.AddLabels)+len(req.RemoveLabels) > 0
+	case fleetActionGroup:
+		return req.TargetGroupID > 0
+	}
+	return false
+}
+
+// resolveFleetSelection 获取选择的节点中属于用户的节点, 指定的节点 id 不属于用户时在结果中报告
+func resolveFleetSelection(ctx context.Context, uid string, sel fleetSelection) ([]*model.DeviceInfo, []*fleetActionResult, error) {
+	_, nodes, err := dao.ListFleetDevices(ctx, uid, &dao.FleetFilter{DeviceIDs: sel.NodeIDs, GroupID: sel.GroupID, Label: sel.Label}, maxFleetActionNodes+1, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	owned := make(map[string]bool)
+	for _, node := range nodes {
+		owned[node.DeviceID] = true
+	}
+
+	var missing []*fleetActionResult
+	for _, id := range sel.NodeIDs {
+		if !owned[id] {
+			owned[id] = true
+			missing = append(missing, &fleetActionResult{NodeID: id, Code: errors.DeviceNotExists})
+		}
+	}
+	return nodes, missing, nil
+}
+
+func runFleetAction(ctx context.Context, uid string, req *fleetActionReq, i int, node *model.DeviceInfo) error {
+	switch req.Action {
+	case fleetActionRename:
+		return dao.UpdateDeviceName(ctx, &model.DeviceInfo{DeviceID: node.DeviceID, DeviceName: fleetNodeName(strings.TrimSpace(req.Name), i)})
+
+	case fleetActionDeactivate:
+		status, err := dao.CheckIsNodeOwner(ctx, uid, node.DeviceID)
+		if err != nil {
+			return err
+		}
+		// 与单个节点停用时的判断一致, 状态为 0 的节点也不能停用
+		if status == 0 || status == 11 {
+			return errors.GenericError{Code: errors.NodeCannotDeactivate, Err: fmt.Errorf("node can not be deactivated, status %d", status)}
+		}
+		scli, err := getSchedulerClient(ctx, node.AreaID)
+		if err != nil {
+			return errors.GenericError{Code: errors.NotFound, Err: err}
+		}
+		if err := scli.DeactivateNode(ctx, node.DeviceID, req.Hours); err != nil {
+			return err
+		}
+		return dao.UpdateNodeOperationStatus(ctx, uid, node.DeviceID, 1, req.Hours)
+
+	case fleetActionCancelDeactivate:
+		status, err := dao.CheckIsNodeOwner(ctx, uid, node.DeviceID)
+		if err != nil {
+			return err
+		}
+		if status != 11 {
+			return errors.GenericError{Code: errors.NodeNotDeactivated, Err: fmt.Errorf("node is not deactivated, status %d", status)}
+		}
+		scli, err := getSchedulerClient(ctx, node.AreaID)
+		if err != nil {
+			return errors.GenericError{Code: errors.NotFound, Err: err}
+		}
+		if err := scli.UndoNodeDeactivation(ctx, node.DeviceID); err != nil {
+			return err
+		}
+		return dao.UpdateNodeOperationStatus(ctx, uid, node.DeviceID, 0)
+
+	case fleetActionUnbind:
+		err := dao.UpdateUserDeviceInfo(ctx, &model.DeviceInfo{DeviceID: node.DeviceID, BindStatus: "unbinding", ActiveStatus: 2})
+		if err != nil {
+			return err
+		}
+		if err := dao.DelDeviceUserIdFromCache(ctx, node.DeviceID, node.AreaID); err != nil {
+			log.Errorf("DelDeviceUserIdFromCache error: %v", err)
+		}
+		return dao.ClearDeviceFleetInfo(ctx, node.DeviceID)
+
+	case fleetActionEdgeConfig:
+		now := time.Now()
+		return dao.SetEdgeConfig(ctx, &model.EdgeConfig{NodeId: node.DeviceID, Config: req.Config, CreatedAt: now, UpdatedAt: now})
+
+	case fleetActionLabel:
+		if err := dao.AddDeviceLabels(ctx, uid, node.DeviceID, req.AddLabels); err != nil {
+			return err
+		}
+		return dao.RemoveDeviceLabels(ctx, node.DeviceID, req.RemoveLabels)
+
+	case fleetActionGroup:
+		if req.Remove {
+			return dao.RemoveDeviceGroupMember(ctx, req.TargetGroupID, node.DeviceID)
+		}
+		return dao.AddDeviceGroupMember(ctx, req.TargetGroupID, node.DeviceID)
+	}
+
+	return fmt.Errorf("unsupported action %s", req.Action)
+}
+
+// FleetActionHandler 对选择的节点执行批量操作, 返回每个节点的执行结果
+// 支持的操作: rename, deactivate, cancel_deactivate, unbind, edge_config, label, group
+// @Summary 节点批量操作
+// @Security ApiKeyAuth
+// @Tags node
+// @Param req body fleetActionReq true "请求参数"
+// @Success 200 {object} JsonObject "{total:0,succeeded:0,failed:0,results:[]}"
+// @Router /api/v2/node/fleet/action [post]
+func FleetActionHandler(c *gin.Context) {
+	uid := jwt.ExtractClaims(c)[identityKey].(string)
+
+	var req fleetActionReq
+	if err := c.ShouldBindJSON(&req); err != nil || !validateFleetAction(&req) {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	switch req.Action {
+	case fleetActionDeactivate:
+		// 校验验证码是否正确
+		code, err := getNonceFromCache(c.Request.Context(), uid, NonceStringTypeDeactive)
+		if err != nil {
+			c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+			return
+		}
+		if !strings.EqualFold(code, req.Code) {
+			c.JSON(http.StatusOK, respErrorCode(errors.InvalidVerifyCode, c))
+			return
+		}
+	case fleetActionGroup:
+		_, err := dao.GetDeviceGroup(c.Request.Context(), uid, req.TargetGroupID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusOK, respErrorCode(errors.DeviceGroupNotFound, c))
+			return
+		}
+		if err != nil {
+			log.Errorf("GetDeviceGroup error: %v", err)
+			c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+			return
+		}
+	}
+
+	nodes, results, err := resolveFleetSelection(c.Request.Context(), uid, req.fleetSelection)
+	if err != nil {
+		log.Errorf("resolveFleetSelection error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+	if len(nodes) > maxFleetActionNodes {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	nodeResults := make([]*fleetActionResult, len(nodes))
+	sem := make(chan struct{}, fleetActionConcurrency)
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, node *model.DeviceInfo) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			result := &fleetActionResult{NodeID: node.DeviceID, Success: true}
+			if err := runFleetAction(c.Request.Context(), uid, &req, i, node); err != nil {
+				// 错误详情只记录在日志中, 返回给用户的是错误码
+				log.Errorf("fleet action %s of %s error: %v", req.Action, node.DeviceID, err)
+				result.Success, result.Code = false, errors.InternalServer
+				if ge, ok := err.(errors.GenericError); ok {
+					result.Code = ge.Code
+				}
+			}
+			nodeResults[i] = result
+		}(i, node)
+	}
+	wg.Wait()
+
+	results = append(nodeResults, results...)
+	var succeeded int
+	for _, result := range results {
+		if result.Success {
+			succeeded++
+			continue
+		}
+		result.Error = errors.NewErrorCode(result.Code, c).Error()
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"action":    req.Action,
+		"total":     len(results),
+		"succeeded": succeeded,
+		"failed":    len(results) - succeeded,
+		"results":   results,
+	}))
+}
+
+// GetFleetHandler 按状态, 区域, NAT 类型, 版本, 收益范围, 标签和分组过滤用户的节点
+// @Summary 节点列表
+// @Security ApiKeyAuth
+// @Tags node
+// @Param status query string false "online, offline, abnormal"
+// @Param area_id query string false "区域"
+// @Param nat_type query string false "NAT 类型"
+// @Param version query string false "系统版本"
+// @Param min_profit query number false "最小累计收益"
+// @Param max_profit query number false "最大累计收益"
+// @Param label query string false "标签"
+// @Param group_id query int false "分组 id"
+// @Param page query int false "页码"
+// @Param page_size query int false "每页数量"
+// @Success 200 {object} JsonObject "{list:[],total:0}"
+// @Router /api/v2/node/fleet [get]
+func GetFleetHandler(c *gin.Context) {
+	uid := jwt.ExtractClaims(c)[identityKey].(string)
+
+	filter := &dao.FleetFilter{
+		Status:  c.Query("status"),
+		AreaID:  c.Query("area_id"),
+		NATType: c.Query("nat_type"),
+		Version: c.Query("version"),
+		Label:   c.Query("label"),
+	}
+	for key, dst := range map[string]**float64{"min_profit": &filter.MinProfit, "max_profit": &filter.MaxProfit} {
+		if v := c.Query(key); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+				return
+			}
+			*dst = &f
+		}
+	}
+	if v := c.Query("group_id"); v != "" {
+		gid, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || gid <= 0 {
+			c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+			return
+		}
+		filter.GroupID = gid
+	}
+
+	page, _ := strconv.Atoi(c.Query("page"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	total, devices, err := dao.ListFleetDevices(c.Request.Context(), uid, filter, pageSize, (page-1)*pageSize)
+	if err != nil {
+		log.Errorf("ListFleetDevices error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	ids := make([]string, 0, len(devices))
+	for _, device := range devices {
+		ids = append(ids, device.DeviceID)
+	}
+	labels, err := dao.GetDeviceLabels(c.Request.Context(), ids)
+	if err != nil {
+		log.Errorf("GetDeviceLabels error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	list := make([]*fleetNode, 0, len(devices))
+	for _, device := range devices {
+		list = append(list, &fleetNode{DeviceInfo: device, Labels: labels[device.DeviceID]})
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list":  list,
+		"total": total,
+	}))
+}
+
+// ListDeviceLabelsHandler 获取用户使用过的节点标签
+// @Summary 节点标签列表
+// @Security ApiKeyAuth
+// @Tags node
+// @Success 200 {object} JsonObject "{list:[]}"
+// @Router /api/v2/node/labels [get]
+func ListDeviceLabelsHandler(c *gin.Context) {
+	uid := jwt.ExtractClaims(c)[identityKey].(string)
+
+	list, err := dao.ListUserDeviceLabels(c.Request.Context(), uid)
+	if err != nil {
+		log.Errorf("ListUserDeviceLabels error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list": list,
+	}))
+}
+
+// ListDeviceGroupsHandler 获取用户的节点分组
+// @Summary 节点分组列表
+// @Security ApiKeyAuth
+// @Tags node
+// @Success 200 {object} JsonObject "{list:[]}"
+// @Router /api/v2/node/groups [get]
+func ListDeviceGroupsHandler(c *gin.Context) {
+	uid := jwt.ExtractClaims(c)[identityKey].(string)
+
+	list, err := dao.ListDeviceGroups(c.Request.Context(), uid)
+	if err != nil {
+		log.Errorf("ListDeviceGroups error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list": list,
+	}))
+}
+
+// CreateDeviceGroupHandler 新建节点分组, 通过批量操作 group 添加节点
+// @Summary 新建节点分组
+// @Security ApiKeyAuth
+// @Tags node
+// @Param req body deviceGroupReq true "请求参数"
+// @Success 200 {object} JsonObject "{group:{}}"
+// @Router /api/v2/node/groups [post]
+func CreateDeviceGroupHandler(c *gin.Context) {
+	uid := jwt.ExtractClaims(c)[identityKey].(string)
+
+	var req deviceGroupReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || utf8.RuneCountInString(req.Name) > maxDeviceLabelLength {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	exists, err := dao.DeviceGroupNameExists(c.Request.Context(), uid, req.Name)
+	if err != nil {
+		log.Errorf("DeviceGroupNameExists error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+	if exists {
+		c.JSON(http.StatusOK, respErrorCode(errors.DeviceGroupNameExists, c))
+		return
+	}
+
+	now := time.Now()
+	group := &model.DeviceGroup{UserID: uid, Name: req.Name, CreatedAt: now, UpdatedAt: now}
+	if err := dao.CreateDeviceGroup(c.Request.Context(), group); err != nil {
+		log.Errorf("CreateDeviceGroup error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"group": group,
+	}))
+}
+
+// DeleteDeviceGroupHandler 删除节点分组, 分组中的节点不受影响
+// @Summary 删除节点分组
+// @Security ApiKeyAuth
+// @Tags node
+// @Param req body deviceGroupReq true "请求参数"
+// @Success 200 {object} JsonObject "{}"
+// @Router /api/v2/node/groups/delete [post]
+func DeleteDeviceGroupHandler(c *gin.Context) {
+	uid := jwt.ExtractClaims(c)[identityKey].(string)
+
+	var req deviceGroupReq
+	if err := c.ShouldBindJSON(&req); err != nil || req.ID <= 0 {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	if err := dao.DeleteDeviceGroup(c.Request.Context(), uid, req.ID); err != nil {
+		log.Errorf("DeleteDeviceGroup error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(nil))
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateFleetAction(t *testing.T) {
+	sel := fleetSelection{NodeIDs: []string{"e_1"}}
+
+	cases := []struct {
+		req  fleetActionReq
+		want bool
+	}{
+		{fleetActionReq{Action: fleetActionRename, Name: "node-{n}"}, false},
+		{fleetActionReq{fleetSelection: sel, Action: fleetActionRename, Name: "node-{n}"}, true},
+		{fleetActionReq{fleetSelection: sel, Action: fleetActionRename, Name: "  "}, false},
+		{fleetActionReq{fleetSelection: sel, Action: fleetActionDeactivate, Hours: 24}, false},
+		{fleetActionReq{fleetSelection: sel, Action: fleetActionDeactivate, Hours: 24, Code: "123456"}, true},
+		{fleetActionReq{fleetSelection: sel, Action: fleetActionEdgeConfig, Config: "{"}, false},
+		{fleetActionReq{fleetSelection: sel, Action: fleetActionEdgeConfig, Config: `{"a":1}`}, true},
+		{fleetActionReq{fleetSelection: sel, Action: fleetActionLabel}, false},
+		{fleetActionReq{fleetSelection: sel, Action: fleetActionLabel, AddLabels: []string{strings.Repeat("a", maxDeviceLabelLength+1)}}, false},
+		{fleetActionReq{fleetSelection: fleetSelection{Label: "hk"}, Action: fleetActionGroup, TargetGroupID: 1}, true},
+		{fleetActionReq{fleetSelection: sel, Action: "reboot"}, false},
+	}
+
+	for i, tc := range cases {
+		if got := validateFleetAction(&tc.req); got != tc.want {
+			t.Errorf("case %d: expect %v, got %v", i, tc.want, got)
+		}
+	}
+
+	req := fleetActionReq{fleetSelection: sel, Action: fleetActionLabel, AddLabels: []string{" hk ", "hk", "gpu"}}
+	if !validateFleetAction(&req) || len(req.AddLabels) != 2 || req.AddLabels[0] != "hk" {
+		t.Fatalf("unexpected labels %v", req.AddLabels)
+	}
+
+	if name := fleetNodeName("hk-{n}", 2); name != "hk-3" {
+		t.Fatalf("unexpected name %s", name)
+	}
+}
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/pkg/formatter"
+)
+
+// nodeSLA 节点在一个月内的可用性
+type nodeSLA struct {
+	DeviceID        string `json:"device_id"`
+	DeviceName      string `json:"device_name"`
+	ObservedSeconds int64  `json:"observed_seconds"`
+	DownSeconds     int64  `json:"down_seconds"`
+	// Availability 可用性百分比, 没有统计数据时为空
+	Availability  *float64              `json:"availability"`
+	OutageCount   int64                 `json:"outage_count"`
+	LongestOutage int64                 `json:"longest_outage"`
+	Outages       []*model.DeviceOutage `json:"outages,omitempty"`
+}
+
+// slaReport 用户所有节点在一个月内的可用性报告
+type slaReport struct {
+	Month               string     `json:"month"`
+	NodeCount           int        `json:"node_count"`
+	ObservedSeconds     int64      `json:"observed_seconds"`
+	DownSeconds         int64      `json:"down_seconds"`
+	Availability        *float64   `json:"availability"`
+	OutageCount         int64      `json:"outage_count"`
+	LongestOutage       int64      `json:"longest_outage"`
+	LongestOutageDevice string     `json:"longest_outage_device"`
+	Nodes               []*nodeSLA `json:"nodes"`
+
+	outages []*model.DeviceOutage
+}
+
+// parseSLAMonth 解析 2006-01 格式的月份, 为空时为当前月份, 返回该月的起止时间
+func parseSLAMonth(month string, now time.Time) (time.Time, time.Time, bool) {
+	if month == "" {
+		month = now.Format("2006-01")
+	}
+	start, err := time.ParseInLocation("2006-01", month, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	return start, start.AddDate(0, 1, 0), true
+}
+
+func availability(observed, down int64) *float64 {
+	if observed <= 0 {
+		return nil
+	}
+	v := formatter.ToFixed(float64(observed-down)/float64(observed)*100, 4)
+	return &v
+}
+
+// buildSLAReport 汇总节点每日的可用性和离线区间, 离线区间按月份的起止时间截断后计算时长
+func buildSLAReport(ctx context.Context, userID, deviceID string, start, end time.Time) (*slaReport, error) {
+	summaries, err := dao.SumDeviceUptime(ctx, userID, deviceID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	outages, err := dao.ListDeviceOutages(ctx, userID, deviceID, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &slaReport{Month: start.Format("2006-01"), outages: outages}
+	nodes := make(map[string]*nodeSLA)
+	for _, s := range summaries {
+		node := &nodeSLA{DeviceID: s.DeviceID, DeviceName: s.DeviceName, ObservedSeconds: s.ObservedSeconds, DownSeconds: s.DownSeconds}
+		nodes[s.DeviceID] = node
+		report.Nodes = append(report.Nodes, node)
+	}
+
+	for _, o := range outages {
+		node, ok := nodes[o.DeviceID]
+		if !ok {
+			node = &nodeSLA{DeviceID: o.DeviceID}
+			nodes[o.DeviceID] = node
+			report.Nodes = append(report.Nodes, node)
+		}
+
+		from, to := o.StartTime, o.EndTime
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(end) {
+			to = end
+		}
+		duration := int64(to.Sub(from) / time.Second)
+
+		node.OutageCount++
+		if duration > node.LongestOutage {
+			node.LongestOutage = duration
+		}
+		if deviceID != "" {
+			node.Outages = append(node.Outages, o)
+		}
+	}
+
+	for _, node := range report.Nodes {
+		node.Availability = availability(node.ObservedSeconds, node.DownSeconds)
+
+		report.ObservedSeconds += node.ObservedSeconds
+		report.DownSeconds += node.DownSeconds
+		report.OutageCount += node.OutageCount
+		if node.LongestOutage > report.LongestOutage {
+			report.LongestOutage = node.LongestOutage
+			report.LongestOutageDevice = node.DeviceID
+		}
+	}
+	report.Availability = availability(report.ObservedSeconds, report.DownSeconds)
+	report.NodeCount = len(report.Nodes)
+
+	return report, nil
+}
+
+func respondSLAReport(c *gin.Context, userID string) {
+	start, end, ok := parseSLAMonth(c.Query("month"), time.Now())
+	if !ok || userID == "" {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	report, err := buildSLAReport(c.Request.Context(), userID, c.Query("device_id"), start, end)
+	if err != nil {
+		log.Errorf("buildSLAReport error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"report": report,
+	}))
+}
+
+// exportSLAReport 导出 CSV, view 为 outages 时导出离线区间, 否则导出每个节点的可用性
+func exportSLAReport(c *gin.Context, userID string) {
+	start, end, ok := parseSLAMonth(c.Query("month"), time.Now())
+	if !ok || userID == "" {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	report, err := buildSLAReport(c.Request.Context(), userID, c.Query("device_id"), start, end)
+	if err != nil {
+		log.Errorf("buildSLAReport error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	view := c.DefaultQuery("view", "nodes")
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=node_sla_%s_%s.csv", view, report.Month))
+
+	w := csv.NewWriter(c.Writer)
+	if view == "outages" {
+		w.Write([]string{"device_id", "start_time", "end_time", "duration_seconds", "ongoing"})
+		for _, o := range report.outages {
+			w.Write([]string{o.DeviceID, o.StartTime.Format(time.DateTime), o.EndTime.Format(time.DateTime),
+				strconv.FormatInt(o.Duration, 10), strconv.FormatBool(o.Ongoing)})
+		}
+	} else {
+		w.Write([]string{"device_id", "device_name", "observed_seconds", "down_seconds", "availability", "outage_count", "longest_outage_seconds"})
+		for _, node := range report.Nodes {
+			var percent string
+			if node.Availability != nil {
+				percent = strconv.FormatFloat(*node.Availability, 'f', -1, 64)
+			}
+			w.Write([]string{node.DeviceID, node.DeviceName, strconv.FormatInt(node.ObservedSeconds, 10), strconv.FormatInt(node.DownSeconds, 10),
+				percent, strconv.FormatInt(node.OutageCount, 10), strconv.FormatInt(node.LongestOutage, 10)})
+		}
+	}
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		log.Errorf("write sla csv: %v", err)
+	}
+}
+
+// GetNodeSLAHandler 节点的月度可用性报告, 包括可用性百分比, 离线次数和最长离线时长; 指定 device_id 时返回离线区间
+// @Summary 节点可用性报告
+// @Security ApiKeyAuth
+// @Tags node
+// @Param month query string false "月份, 如 2025-04, 默认为当月"
+// @Param device_id query string false "节点 id"
+// @Success 200 {object} JsonObject "{report:{}}"
+// @Router /api/v2/node/sla [get]
+func GetNodeSLAHandler(c *gin.Context) {
+	respondSLAReport(c, jwt.ExtractClaims(c)[identityKey].(string))
+}
+
+// ExportNodeSLAHandler 导出节点的月度可用性报告
+// @Summary 导出节点可用性报告
+// @Security ApiKeyAuth
+// @Tags node
+// @Param month query string false "月份, 如 2025-04, 默认为当月"
+// @Param device_id query string false "节点 id"
+// @Param view query string false "nodes: 每个节点的可用性, outages: 离线区间"
+// @Success 200 {file} file "csv"
+// @Router /api/v2/node/sla/export [get]
+func ExportNodeSLAHandler(c *gin.Context) {
+	exportSLAReport(c, jwt.ExtractClaims(c)[identityKey].(string))
+}
+
+// GetUserNodeSLAHandler 管理员查看用户的节点可用性报告
+func GetUserNodeSLAHandler(c *gin.Context) {
+	respondSLAReport(c, c.Query("user_id"))
+}
+
+// ExportUserNodeSLAHandler 管理员导出用户的节点可用性报告
+func ExportUserNodeSLAHandler(c *gin.Context) {
+	exportSLAReport(c, c.Query("user_id"))
+}
@@ -754,6 +754,25 @@ func GetNodesInfoHandler(c *gin.Context) {
 		Order:      order,
 		OrderField: orderField,
 	}
+	if option.Page <= 0 {
+		option.Page = 1
+	}
+	if option.PageSize <= 0 {
+		option.PageSize = 50
+	}
+
+	// 本实例在拉取节点数据时直接使用内存中的索引, 索引过期时查询数据库
+	if statistics.Nodes.Fresh() {
+		all := statistics.Nodes.NodesInfoByUser(option.OrderField, option.Order)
+		start, end := min((option.Page-1)*option.PageSize, len(all)), min(option.Page*option.PageSize, len(all))
+		list := all[start:end]
+		c.JSON(http.StatusOK, respJSON(JsonObject{
+			"list":  handleNodesRank(&list, option),
+			"total": len(all),
+		}))
+		return
+	}
+
 	var total int64
 	total, list, err := dao.GetNodesInfo(c.Request.Context(), option)
 	if err != nil {
@@ -4,8 +4,10 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gnasnik/titan-explorer/core/dao"
 	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/pkg/formatter"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 func GetLoginLogHandler(c *gin.Context) {
@@ -26,6 +28,7 @@ func GetLoginLogHandler(c *gin.Context) {
 	}))
 }
 
+// GetOperationLogHandler 查询操作日志, 支持按用户、操作类型、时间段和操作对象过滤
 func GetOperationLogHandler(c *gin.Context) {
 	page, _ := strconv.ParseInt(c.Query("page"), 10, 64)
 	size, _ := strconv.ParseInt(c.Query("size"), 10, 64)
@@ -33,8 +36,31 @@ func GetOperationLogHandler(c *gin.Context) {
 		Page:     int(page),
 		PageSize: int(size),
 	}
-	list, total, err := dao.ListOperationLog(c.Request.Context(), opt)
+
+	filter := dao.OperationLogFilter{
+		Username:   c.Query("username"),
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+	}
+
+	var ok bool
+	if st := c.Query("start_time"); st != "" {
+		if filter.Start, ok = parseLogTime(st, false); !ok {
+			c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+			return
+		}
+	}
+	if et := c.Query("end_time"); et != "" {
+		if filter.End, ok = parseLogTime(et, true); !ok {
+			c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+			return
+		}
+	}
+
+	list, total, err := dao.ListOperationLog(c.Request.Context(), filter, opt)
 	if err != nil {
+		log.Errorf("list operation log: %v", err)
 		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
 		return
 	}
@@ -43,3 +69,20 @@ func GetOperationLogHandler(c *gin.Context) {
 		"total": total,
 	}))
 }
+
+// parseLogTime 解析日志查询的时间, 支持 2006-01-02 15:04:05 和 2006-01-02 两种格式, 只有日期的结束时间包含当天
+func parseLogTime(v string, end bool) (time.Time, bool) {
+	if t, err := time.ParseInLocation(formatter.TimeFormatDatetime, v, time.Local); err == nil {
+		return t, true
+	}
+
+	t, err := time.ParseInLocation(formatter.TimeFormatDateOnly, v, time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, true
+}
@@ -0,0 +1,614 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Filecoin-Titan/titan/api/terrors"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/core/storage"
+	"github.com/go-redis/redis/v9"
+)
+
+const (
+	quotaTrafficCacheKeyPrefix = "TITAN::QUOTA::TRAFFIC"
+	quotaTrafficCacheTTL       = 5 * time.Minute
+
+	// quotaPlanVIP 未分配套餐的 vip 用户使用的套餐
+	quotaPlanVIP = "vip"
+	// quotaPlanTemp 未登录用户上传的临时文件使用的套餐
+	quotaPlanTemp = "temp"
+
+	// 没有配置 temp 套餐时临时文件使用原来的限制
+	legacyTempShareCount    int64 = 60
+	legacyTempDownloadCount int64 = 20
+)
+
+// 用户生效套餐的来源
+const (
+	quotaSourceUser    = "user"
+	quotaSourceTenant  = "tenant"
+	quotaSourceVIP     = "vip"
+	quotaSourceDefault = "default"
+)
+
+// quotaWarningThresholds 用量提醒的阈值(百分比)
+var quotaWarningThresholds = []int64{80, 100}
+
+// userQuota 用户的套餐上限和当前用量, 上限为 0 表示不限制, 流量和峰值带宽按自然月统计, 超过上限后不能下载和分享
+type userQuota struct {
+	Plan              *model.QuotaPlan `json:"plan"`
+	PlanSource        string           `json:"plan_source"`
+	StorageSize       int64            `json:"storage_size"`
+	UsedStorage       int64            `json:"used_storage"`
+	MonthlyTraffic    int64            `json:"monthly_traffic"`
+	UsedTraffic       int64            `json:"used_traffic"`
+	PeakBandwidth     int64            `json:"peak_bandwidth"`
+	UsedPeakBandwidth int64            `json:"used_peak_bandwidth"`
+	FileCount         int64            `json:"file_count"`
+	UsedFileCount     int64            `json:"used_file_count"`
+	MaxFileSize       int64            `json:"max_file_size"`
+	ApiKeyCount       int64            `json:"api_key_count"`
+	UsedApiKeyCount   int64            `json:"used_api_key_count"`
+	ShareCount        int64            `json:"share_count"`
+	UsedShareCount    int64            `json:"used_share_count"`
+	DownloadCount     int64            `json:"download_count"`
+	Warnings          []*quotaWarning  `json:"warnings"`
+}
+
+// quotaWarning 用量达到提醒阈值
+type quotaWarning struct {
+	Item      string `json:"item"`
+	Threshold int64  `json:"threshold"`
+	Used      int64  `json:"used"`
+	Limit     int64  `json:"limit"`
+}
+
+type saveQuotaPlanReq struct {
+	ID             int64  `json:"id"`
+	Name           string `json:"name" binding:"required"`
+	StorageSize    int64  `json:"storage_size"`
+	MonthlyTraffic int64  `json:"monthly_traffic"`
+	PeakBandwidth  int64  `json:"peak_bandwidth"`
+	FileCount      int64  `json:"file_count"`
+	MaxFileSize    int64  `json:"max_file_size"`
+	ApiKeyCount    int64  `json:"api_key_count"`
+	ShareCount     int64  `json:"share_count"`
+	DownloadCount  int64  `json:"download_count"`
+	IsDefault      bool   `json:"is_default"`
+}
+
+type deleteQuotaPlanReq struct {
+	ID int64 `json:"id" binding:"required"`
+}
+
+type assignQuotaPlanReq struct {
+	SubjectType string `json:"subject_type" binding:"required"`
+	SubjectID   string `json:"subject_id" binding:"required"`
+	PlanID      int64  `json:"plan_id"`
+}
+
+// legacyQuotaPlan 没有配置默认套餐时使用原来的流量限制
+func legacyQuotaPlan(user *model.User) *model.QuotaPlan {
+	if user.EnableVIP {
+		return &model.QuotaPlan{Name: quotaPlanVIP, MonthlyTraffic: maxVipTotalFlow}
+	}
+	return &model.QuotaPlan{Name: "free", MonthlyTraffic: maxTotalFlow}
+}
+
+// getUserQuotaPlan 获取用户生效的套餐, 依次查找分配给用户、所属租户的套餐, vip 用户使用 vip 套餐, 其他用户使用默认套餐
+func getUserQuotaPlan(ctx context.Context, user *model.User) (*model.QuotaPlan, string, error) {
+	plan, err := dao.GetAssignedQuotaPlan(ctx, dao.QuotaSubjectUser, user.Username)
+	if err != sql.ErrNoRows {
+		return plan, quotaSourceUser, err
+	}
+
+	if user.TenantID != "" {
+		plan, err = dao.GetAssignedQuotaPlan(ctx, dao.QuotaSubjectTenant, user.TenantID)
+		if err != sql.ErrNoRows {
+			return plan, quotaSourceTenant, err
+		}
+	}
+
+	if user.EnableVIP {
+		plan, err = dao.GetQuotaPlanByName(ctx, quotaPlanVIP)
+		if err != sql.ErrNoRows {
+			return plan, quotaSourceVIP, err
+		}
+	}
+
+	plan, err = dao.GetDefaultQuotaPlan(ctx)
+	if err == sql.ErrNoRows {
+		return legacyQuotaPlan(user), quotaSourceDefault, nil
+	}
+	return plan, quotaSourceDefault, err
+}
+
+// getTempQuotaPlan 获取临时文件使用的套餐, 分享次数和下载次数按每个文件计算
+func getTempQuotaPlan(ctx context.Context) (*model.QuotaPlan, error) {
+	plan, err := dao.GetQuotaPlanByName(ctx, quotaPlanTemp)
+	if err == sql.ErrNoRows {
+		return &model.QuotaPlan{Name: quotaPlanTemp, ShareCount: legacyTempShareCount, DownloadCount: legacyTempDownloadCount}, nil
+	}
+	return plan, err
+}
+
+// quotaReached 用量是否已经到达上限, 上限为 0 表示不限制
+func quotaReached(used, limit int64) bool {
+	return limit > 0 && used >= limit
+}
+
+// quotaPerUser 套餐的存储空间和流量是否按子账户单独计算, 租户子账户未单独分配套餐时只按租户的上限判断
+func quotaPerUser(user *model.User, source string) bool {
+	return user.TenantID == "" || source == quotaSourceUser
+}
+
+// userStorageLimit 用户的存储空间上限, 套餐未设置时使用账户原有的存储空间
+func userStorageLimit(user *model.User, plan *model.QuotaPlan) int64 {
+	if plan.StorageSize > 0 {
+		return plan.StorageSize
+	}
+	return user.TotalStorageSize
+}
+
+// quotaMonthStart 流量统计周期的开始时间
+func quotaMonthStart(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+}
+
+// getUserMonthlyFlow 获取用户本月的下载流量和峰值带宽, 数据来自 asset_storage_hour, 缓存 5 分钟
+func getUserMonthlyFlow(ctx context.Context, username string) (*dao.UserStorageFlowInfo, error) {
+	start := quotaMonthStart(time.Now())
+	key := fmt.Sprintf("%s::%s::%s", quotaTrafficCacheKeyPrefix, username, start.Format("200601"))
+
+	info := new(dao.UserStorageFlowInfo)
+	value, err := dao.RedisCache.Get(ctx, key).Bytes()
+	if err == nil && json.Unmarshal(value, info) == nil {
+		return info, nil
+	}
+	if err != nil && err != redis.Nil {
+		log.Errorf("get user traffic cache: %v", err)
+	}
+
+	info, err = dao.GetUserStorageFlowInfoSince(ctx, username, start)
+	if err != nil {
+		return nil, err
+	}
+
+	ib, _ := json.Marshal(info)
+	dao.RedisCache.Set(ctx, key, ib, quotaTrafficCacheTTL)
+	return info, nil
+}
+
+// checkUserUploadQuota 判断用户能否上传 sizes 大小的文件, 检查单个文件大小、文件数量和存储空间; 超过限制时返回错误码
+func checkUserUploadQuota(ctx context.Context, user *model.User, sizes ...int64) (int, error) {
+	plan, source, err := getUserQuotaPlan(ctx, user)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, size := range sizes {
+		if plan.MaxFileSize > 0 && size > plan.MaxFileSize {
+			return errors.QuotaFileSizeExceeded, nil
+		}
+		total += size
+	}
+
+	if plan.FileCount > 0 {
+		count, err := dao.CountUserAssets(ctx, user.Username)
+		if err != nil {
+			return 0, err
+		}
+		if count+int64(len(sizes)) > plan.FileCount {
+			return errors.QuotaFileCountExceeded, nil
+		}
+	}
+
+	enough, err := checkUserStorageQuota(ctx, user, plan, source, total)
+	if err != nil {
+		return 0, err
+	}
+	if !enough {
+		return int(terrors.UserStorageSizeNotEnough), nil
+	}
+
+	return 0, nil
+}
+
+// flowQuotaCode 本月的下载流量或峰值带宽超过套餐上限时返回错误码
+func flowQuotaCode(plan *model.QuotaPlan, flow *dao.UserStorageFlowInfo) int {
+	if quotaReached(flow.TotalTraffic, plan.MonthlyTraffic) {
+		return errors.OutTotalFlow
+	}
+	if plan.PeakBandwidth > 0 && flow.PeakBandwidth > plan.PeakBandwidth {
+		return errors.QuotaPeakBandwidthExceeded
+	}
+	return 0
+}
+
+// checkUserFlowQuota 判断用户本月的下载流量和峰值带宽是否超过套餐的上限, 租户子账户还要判断租户的流量上限; 超过限制时返回错误码
+func checkUserFlowQuota(ctx context.Context, username string) (int, error) {
+	if username == "titan17ljevhtqu4vx6y7k743jyca0w8gyfu2466e8x3" {
+		return 0, nil
+	}
+
+	user, err := dao.GetUserByUsername(ctx, username)
+	if err != nil {
+		return 0, fmt.Errorf("get userInfo error:%w", err)
+	}
+
+	if user.TenantID != "" {
+		ok, err := checkTenantTotalFlow(ctx, user.TenantID)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return errors.OutTotalFlow, nil
+		}
+	}
+
+	plan, source, err := getUserQuotaPlan(ctx, user)
+	if err != nil {
+		return 0, err
+	}
+	if (plan.MonthlyTraffic <= 0 && plan.PeakBandwidth <= 0) || !quotaPerUser(user, source) {
+		return 0, nil
+	}
+
+	flow, err := getUserMonthlyFlow(ctx, username)
+	if err != nil {
+		return 0, err
+	}
+
+	return flowQuotaCode(plan, flow), nil
+}
+
+// checkUserShareQuota 判断用户能否创建分享链接, 流量或峰值带宽超过上限时分享的文件不能下载, 也不能再分享; 超过限制时返回错误码
+func checkUserShareQuota(ctx context.Context, user *model.User) (int, error) {
+	code, err := checkUserFlowQuota(ctx, user.Username)
+	if err != nil || code != 0 {
+		return code, err
+	}
+
+	plan, _, err := getUserQuotaPlan(ctx, user)
+	if err != nil {
+		return 0, err
+	}
+	if plan.ShareCount <= 0 {
+		return 0, nil
+	}
+
+	count, err := dao.CountUserLinks(ctx, user.Username)
+	if err != nil {
+		return 0, err
+	}
+	if quotaReached(count, plan.ShareCount) {
+		return errors.QuotaShareCountExceeded, nil
+	}
+
+	return 0, nil
+}
+
+// linkMaxDownloads 分享链接的下载次数上限, 未设置或超过套餐的下载次数时使用套餐的下载次数
+func linkMaxDownloads(plan *model.QuotaPlan, maxDownloads int64) int64 {
+	if plan.DownloadCount > 0 && (maxDownloads == 0 || maxDownloads > plan.DownloadCount) {
+		return plan.DownloadCount
+	}
+	return maxDownloads
+}
+
+// checkUserApiKeyQuota 判断用户能否再创建 API key, 超过限制时返回错误码
+func checkUserApiKeyQuota(ctx context.Context, user *model.User) (int, error) {
+	plan, _, err := getUserQuotaPlan(ctx, user)
+	if err != nil {
+		return 0, err
+	}
+
+	if plan.ApiKeyCount <= 0 || len(user.ApiKeys) == 0 {
+		return 0, nil
+	}
+
+	keys, err := storage.DecodeAPIKeySecrets(user.ApiKeys)
+	if err != nil {
+		return 0, err
+	}
+	if int64(len(keys)) >= plan.ApiKeyCount {
+		return errors.QuotaApiKeyExceeded, nil
+	}
+
+	return 0, nil
+}
+
+// getUserQuota 获取用户的套餐上限和当前用量, 并计算用量提醒
+func getUserQuota(ctx context.Context, user *model.User) (*userQuota, error) {
+	plan, source, err := getUserQuotaPlan(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	flow, err := getUserMonthlyFlow(ctx, user.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := dao.CountUserAssets(ctx, user.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	var keyCount int64
+	if len(user.ApiKeys) > 0 {
+		keys, err := storage.DecodeAPIKeySecrets(user.ApiKeys)
+		if err != nil {
+			return nil, err
+		}
+		keyCount = int64(len(keys))
+	}
+
+	shareCount, err := dao.CountUserLinks(ctx, user.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &userQuota{
+		Plan:              plan,
+		PlanSource:        source,
+		StorageSize:       userStorageLimit(user, plan),
+		UsedStorage:       user.UsedStorageSize,
+		MonthlyTraffic:    plan.MonthlyTraffic,
+		UsedTraffic:       flow.TotalTraffic,
+		PeakBandwidth:     plan.PeakBandwidth,
+		UsedPeakBandwidth: flow.PeakBandwidth,
+		FileCount:         plan.FileCount,
+		UsedFileCount:     count,
+		MaxFileSize:       plan.MaxFileSize,
+		ApiKeyCount:       plan.ApiKeyCount,
+		UsedApiKeyCount:   keyCount,
+		ShareCount:        plan.ShareCount,
+		UsedShareCount:    shareCount,
+		DownloadCount:     plan.DownloadCount,
+		Warnings:          make([]*quotaWarning, 0),
+	}
+
+	q.addWarning("storage", q.UsedStorage, q.StorageSize)
+	q.addWarning("traffic", q.UsedTraffic, q.MonthlyTraffic)
+	q.addWarning("peak_bandwidth", q.UsedPeakBandwidth, q.PeakBandwidth)
+	q.addWarning("file_count", q.UsedFileCount, q.FileCount)
+	q.addWarning("api_key_count", q.UsedApiKeyCount, q.ApiKeyCount)
+	q.addWarning("share_count", q.UsedShareCount, q.ShareCount)
+
+	return q, nil
+}
+
+// addWarning 用量达到提醒阈值时添加提醒, 取达到的最高阈值
+func (q *userQuota) addWarning(item string, used, limit int64) {
+	if limit <= 0 {
+		return
+	}
+
+	var level int64
+	usage := used * 100 / limit
+	for _, t := range quotaWarningThresholds {
+		if usage >= t {
+			level = t
+		}
+	}
+
+	if level > 0 {
+		q.Warnings = append(q.Warnings, &quotaWarning{Item: item, Threshold: level, Used: used, Limit: limit})
+	}
+}
+
+// GetUserQuotaHandler 获取用户的套餐、用量和用量提醒
+// @Summary 获取用户的套餐和用量
+// @Security ApiKeyAuth
+// @Tags storage
+// @Success 200 {object} JsonObject "{plan:{},storage_size:0,used_storage:0,warnings:[]}"
+// @Router /api/v1/storage/quota [get]
+func GetUserQuotaHandler(c *gin.Context) {
+	username := jwt.ExtractClaims(c)[identityKey].(string)
+	respUserQuota(c, username)
+}
+
+// GetUserQuotaAdminHandler 管理员获取用户的套餐和用量
+func GetUserQuotaAdminHandler(c *gin.Context) {
+	respUserQuota(c, c.Query("username"))
+}
+
+func respUserQuota(c *gin.Context, username string) {
+	user, err := dao.GetUserByUsername(c.Request.Context(), username)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusOK, respErrorCode(errors.UserNotFound, c))
+		return
+	}
+	if err != nil {
+		log.Errorf("GetUserByUsername error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	quota, err := getUserQuota(c.Request.Context(), user)
+	if err != nil {
+		log.Errorf("getUserQuota error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(quota))
+}
+
+// ListQuotaPlansHandler 管理员获取所有套餐
+func ListQuotaPlansHandler(c *gin.Context) {
+	list, err := dao.ListQuotaPlans(c.Request.Context())
+	if err != nil {
+		log.Errorf("ListQuotaPlans error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list": list,
+	}))
+}
+
+// SaveQuotaPlanHandler 管理员新增或修改套餐, id 为 0 时新增
+func SaveQuotaPlanHandler(c *gin.Context) {
+	var req saveQuotaPlanReq
+	if err := c.ShouldBindJSON(&req); err != nil || req.StorageSize < 0 || req.MonthlyTraffic < 0 || req.PeakBandwidth < 0 ||
+		req.FileCount < 0 || req.MaxFileSize < 0 || req.ApiKeyCount < 0 || req.ShareCount < 0 || req.DownloadCount < 0 {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	plan := &model.QuotaPlan{
+		ID:             req.ID,
+		Name:           req.Name,
+		StorageSize:    req.StorageSize,
+		MonthlyTraffic: req.MonthlyTraffic,
+		PeakBandwidth:  req.PeakBandwidth,
+		FileCount:      req.FileCount,
+		MaxFileSize:    req.MaxFileSize,
+		ApiKeyCount:    req.ApiKeyCount,
+		ShareCount:     req.ShareCount,
+		DownloadCount:  req.DownloadCount,
+		IsDefault:      req.IsDefault,
+	}
+
+	if req.ID > 0 {
+		before, err := dao.GetQuotaPlan(c.Request.Context(), req.ID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusOK, respErrorCode(errors.QuotaPlanNotFound, c))
+			return
+		}
+		if err != nil {
+			log.Errorf("GetQuotaPlan error: %v", err)
+			c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+			return
+		}
+		plan.CreatedAt = before.CreatedAt
+		SetAuditDiff(c, before, plan)
+	}
+
+	if err := dao.SaveQuotaPlan(c.Request.Context(), plan); err != nil {
+		log.Errorf("SaveQuotaPlan error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	SetAuditTarget(c, "quota_plan", plan.ID)
+
+	c.JSON(http.StatusOK, respJSON(plan))
+}
+
+// DeleteQuotaPlanHandler 管理员删除套餐
+func DeleteQuotaPlanHandler(c *gin.Context) {
+	var req deleteQuotaPlanReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	plan, err := dao.GetQuotaPlan(c.Request.Context(), req.ID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusOK, respErrorCode(errors.QuotaPlanNotFound, c))
+		return
+	}
+	if err != nil {
+		log.Errorf("GetQuotaPlan error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	SetAuditTarget(c, "quota_plan", plan.ID)
+	SetAuditDiff(c, plan, nil)
+
+	deleted, err := dao.DeleteQuotaPlan(c.Request.Context(), plan.ID)
+	if err != nil {
+		log.Errorf("DeleteQuotaPlan error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusOK, respErrorCode(errors.QuotaPlanInUse, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"msg": "success",
+	}))
+}
+
+// AssignQuotaPlanHandler 管理员给用户或租户分配套餐, plan_id 为 0 时取消分配
+func AssignQuotaPlanHandler(c *gin.Context) {
+	var req assignQuotaPlanReq
+	if err := c.ShouldBindJSON(&req); err != nil || req.PlanID < 0 ||
+		(req.SubjectType != dao.QuotaSubjectUser && req.SubjectType != dao.QuotaSubjectTenant) {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	ctx := c.Request.Context()
+	switch req.SubjectType {
+	case dao.QuotaSubjectUser:
+		_, err := dao.GetUserByUsername(ctx, req.SubjectID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusOK, respErrorCode(errors.UserNotFound, c))
+			return
+		}
+		if err != nil {
+			log.Errorf("GetUserByUsername error: %v", err)
+			c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+			return
+		}
+	case dao.QuotaSubjectTenant:
+		_, err := getTenant(ctx, req.SubjectID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
+			return
+		}
+		if err != nil {
+			log.Errorf("getTenant error: %v", err)
+			c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+			return
+		}
+	}
+
+	if req.PlanID > 0 {
+		_, err := dao.GetQuotaPlan(ctx, req.PlanID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusOK, respErrorCode(errors.QuotaPlanNotFound, c))
+			return
+		}
+		if err != nil {
+			log.Errorf("GetQuotaPlan error: %v", err)
+			c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+			return
+		}
+	}
+
+	SetAuditTarget(c, req.SubjectType, req.SubjectID)
+	var before int64
+	if prev, err := dao.GetAssignedQuotaPlan(ctx, req.SubjectType, req.SubjectID); err == nil {
+		before = prev.ID
+	}
+	SetAuditDiff(c, JsonObject{"plan_id": before}, JsonObject{"plan_id": req.PlanID})
+
+	if err := dao.AssignQuotaPlan(ctx, req.SubjectType, req.SubjectID, req.PlanID); err != nil {
+		log.Errorf("AssignQuotaPlan error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"msg": "success",
+	}))
+}
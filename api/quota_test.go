@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/dao/daotest"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+)
+
+func TestQuotaWarnings(t *testing.T) {
+	cases := []struct {
+		used, limit int64
+		want        int64
+	}{
+		{0, 100, 0},
+		{79, 100, 0},
+		{80, 100, 80},
+		{99, 100, 80},
+		{100, 100, 100},
+		{150, 100, 100},
+		{1000, 0, 0},
+	}
+
+	for _, c := range cases {
+		q := &userQuota{}
+		q.addWarning("storage", c.used, c.limit)
+
+		var got int64
+		if len(q.Warnings) > 0 {
+			got = q.Warnings[0].Threshold
+		}
+		if got != c.want {
+			t.Errorf("addWarning(%d, %d) threshold = %d, want %d", c.used, c.limit, got, c.want)
+		}
+	}
+}
+
+func TestFlowQuotaCode(t *testing.T) {
+	plan := &model.QuotaPlan{MonthlyTraffic: 1000, PeakBandwidth: 100}
+
+	cases := []struct {
+		traffic, bandwidth int64
+		want               int
+	}{
+		{999, 100, 0},
+		{1000, 50, errors.OutTotalFlow},
+		{10, 101, errors.QuotaPeakBandwidthExceeded},
+		{1000, 101, errors.OutTotalFlow},
+	}
+	for _, c := range cases {
+		flow := &dao.UserStorageFlowInfo{TotalTraffic: c.traffic, PeakBandwidth: c.bandwidth}
+		if got := flowQuotaCode(plan, flow); got != c.want {
+			t.Errorf("flowQuotaCode(%d, %d) = %d, want %d", c.traffic, c.bandwidth, got, c.want)
+		}
+	}
+
+	// 上限为 0 时不限制
+	if got := flowQuotaCode(&model.QuotaPlan{}, &dao.UserStorageFlowInfo{TotalTraffic: 1 << 40, PeakBandwidth: 1 << 40}); got != 0 {
+		t.Errorf("unlimited plan should not be exceeded, got %d", got)
+	}
+}
+
+func TestLinkMaxDownloads(t *testing.T) {
+	plan := &model.QuotaPlan{DownloadCount: 20}
+	cases := []struct{ req, want int64 }{
+		{0, 20},
+		{5, 5},
+		{20, 20},
+		{100, 20},
+	}
+	for _, c := range cases {
+		if got := linkMaxDownloads(plan, c.req); got != c.want {
+			t.Errorf("linkMaxDownloads(%d) = %d, want %d", c.req, got, c.want)
+		}
+	}
+
+	if got := linkMaxDownloads(&model.QuotaPlan{}, 0); got != 0 {
+		t.Errorf("unlimited plan should keep unlimited downloads, got %d", got)
+	}
+}
+
+func TestCheckUserShareQuota(t *testing.T) {
+	db := daotest.Open(t)
+	ctx := context.Background()
+
+	const (
+		username = "quota_share_test_user"
+		planName = "quota_share_test_plan"
+	)
+	cleanup := func() {
+		daotest.Exec(t, db, `DELETE FROM users WHERE username = ?`, username)
+		daotest.Exec(t, db, `DELETE FROM link WHERE username = ?`, username)
+		daotest.Exec(t, db, `DELETE FROM quota_plan_assign WHERE subject_id = ?`, username)
+		daotest.Exec(t, db, `DELETE FROM quota_plan WHERE name = ?`, planName)
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+
+	daotest.Exec(t, db, `INSERT INTO users (username, used_storage_size) VALUES (?, 0)`, username)
+	plan := &model.QuotaPlan{Name: planName, ShareCount: 1, DownloadCount: 10}
+	if err := dao.SaveQuotaPlan(ctx, plan); err != nil {
+		t.Fatal(err)
+	}
+	if err := dao.AssignQuotaPlan(ctx, dao.QuotaSubjectUser, username, plan.ID); err != nil {
+		t.Fatal(err)
+	}
+	user, err := dao.GetUserByUsername(ctx, username)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code, err := checkUserShareQuota(ctx, user); err != nil || code != 0 {
+		t.Fatalf("first share should be allowed, got %d %v", code, err)
+	}
+
+	link := &model.Link{UserName: username, Cid: "1", LongLink: "quota_share_test_1", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := dao.CreateLink(ctx, link); err != nil {
+		t.Fatal(err)
+	}
+	if code, err := checkUserShareQuota(ctx, user); err != nil || code != errors.QuotaShareCountExceeded {
+		t.Fatalf("share count should be exceeded, got %d %v", code, err)
+	}
+
+	// 撤销和过期的链接不计入分享链接数量
+	daotest.Exec(t, db, `UPDATE link SET revoked = 1 WHERE username = ?`, username)
+	expired := &model.Link{UserName: username, Cid: "2", LongLink: "quota_share_test_2", ExpireAt: time.Now().Add(-time.Hour), CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := dao.CreateLink(ctx, expired); err != nil {
+		t.Fatal(err)
+	}
+	if code, err := checkUserShareQuota(ctx, user); err != nil || code != 0 {
+		t.Fatalf("revoked and expired links should not be counted, got %d %v", code, err)
+	}
+}
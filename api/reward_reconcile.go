@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/core/opasynq"
+	"github.com/gnasnik/titan-explorer/pkg/formatter"
+)
+
+// maxReconcileErrorLength 修复失败时记录的错误信息长度上限
+const maxReconcileErrorLength = 1024
+
+type approveRewardRepairReq struct {
+	RunID int64 `json:"run_id" binding:"required"`
+	// ItemIDs 为空时批准该次对账所有待处理的差异
+	ItemIDs []int64 `json:"item_ids"`
+}
+
+func reconcilePage(c *gin.Context) (int, int) {
+	page, _ := strconv.Atoi(c.Query("page"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 20
+	}
+	return pageSize, (page - 1) * pageSize
+}
+
+// RunRewardRepair 修复对账中已批准的差异, 按 device_info_hour 逐天重新计算节点的每日收益;
+// 单个节点修复失败或修复后差异仍超过容差时记录错误, 可以重新批准后再次修复
+func RunRewardRepair(ctx context.Context, runID int64) error {
+	run, err := dao.GetRewardReconcileRun(ctx, runID)
+	if err == sql.ErrNoRows {
+		log.Errorf("reward reconcile run %d not found", runID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var repaired, total int
+	// 修复期间新批准的差异不会重复入队, 处理完后重新获取, 直到没有待修复的差异
+	for {
+		items, err := dao.GetApprovedRewardReconcileItems(ctx, runID)
+		if err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			break
+		}
+
+		for _, item := range items {
+			adjustment, err := dao.RepairDeviceDailyIncome(ctx, item.DeviceID, item.UserID)
+			if err == nil {
+				err = checkRepairResidual(item, adjustment, run.Tolerance)
+			}
+
+			item.State, item.Adjustment, item.Error, item.UpdatedAt = dao.RewardReconcileItemStateRepaired, adjustment, "", time.Now()
+			if err != nil {
+				log.Errorf("repair reward of %s in run %d: %v", item.DeviceID, runID, err)
+				item.State, item.Error = dao.RewardReconcileItemStateFailed, formatter.Truncate(err.Error(), maxReconcileErrorLength)
+			} else {
+				repaired++
+			}
+
+			if err := dao.UpdateRewardReconcileItem(ctx, item); err != nil {
+				return fmt.Errorf("update reward reconcile item %d: %w", item.ID, err)
+			}
+		}
+		total += len(items)
+	}
+
+	log.Infof("repair rewards of run %d: %d/%d repaired", runID, repaired, total)
+	return nil
+}
+
+// checkRepairResidual 对账时的差值减去修复调整的收益为修复后剩余的差异, 仍然超过容差时返回错误
+func checkRepairResidual(item *model.RewardReconcileItem, adjustment, tolerance float64) error {
+	residual := formatter.ToFixed(item.Diff-adjustment, 6)
+	if math.Abs(residual) > tolerance {
+		return fmt.Errorf("diff %v remains after repair, exceeds tolerance %v", residual, tolerance)
+	}
+	return nil
+}
+
+// ListReconcileRunsHandler 获取收益对账记录
+// @Summary 收益对账记录
+// @Tags admin
+// @Param area_id query string false "区域"
+// @Param page query int false "页码"
+// @Param page_size query int false "每页数量"
+// @Success 200 {object} JsonObject "{list:[],total:0}"
+// @Router /api/v1/admin/reconcile/runs [get]
+func ListReconcileRunsHandler(c *gin.Context) {
+	limit, offset := reconcilePage(c)
+
+	total, list, err := dao.ListRewardReconcileRuns(c.Request.Context(), c.Query("area_id"), limit, offset)
+	if err != nil {
+		log.Errorf("ListRewardReconcileRuns error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list":  list,
+		"total": total,
+	}))
+}
+
+// ListReconcileItemsHandler 获取一次对账中收益不一致的节点, 按差异从大到小排序
+// @Summary 收益对账差异
+// @Tags admin
+// @Param run_id query int true "对账记录 id"
+// @Param state query string false "flagged, approved, repaired, failed"
+// @Param page query int false "页码"
+// @Param page_size query int false "每页数量"
+// @Success 200 {object} JsonObject "{list:[],total:0}"
+// @Router /api/v1/admin/reconcile/items [get]
+func ListReconcileItemsHandler(c *gin.Context) {
+	runID, err := strconv.ParseInt(c.Query("run_id"), 10, 64)
+	if err != nil || runID <= 0 {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+	limit, offset := reconcilePage(c)
+
+	total, list, err := dao.ListRewardReconcileItems(c.Request.Context(), runID, c.Query("state"), limit, offset)
+	if err != nil {
+		log.Errorf("ListRewardReconcileItems error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list":  list,
+		"total": total,
+	}))
+}
+
+// ApproveRewardRepairHandler 批准修复对账差异, 修复在后台执行, 结果通过差异列表查询
+// @Summary 批准修复收益差异
+// @Tags admin
+// @Param req body approveRewardRepairReq true "请求参数"
+// @Success 200 {object} JsonObject "{approved:0}"
+// @Router /api/v1/admin/reconcile/repair [post]
+func ApproveRewardRepairHandler(c *gin.Context) {
+	username := jwt.ExtractClaims(c)[identityKey].(string)
+
+	var req approveRewardRepairReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	_, err := dao.GetRewardReconcileRun(c.Request.Context(), req.RunID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusOK, respErrorCode(errors.ReconcileRunNotFound, c))
+		return
+	}
+	if err != nil {
+		log.Errorf("GetRewardReconcileRun error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	approved, err := dao.ApproveRewardReconcileItems(c.Request.Context(), req.RunID, req.ItemIDs, username)
+	if err != nil {
+		log.Errorf("ApproveRewardReconcileItems error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	if approved > 0 {
+		if err := opasynq.DefaultCli.EnqueueRewardRepair(c.Request.Context(), opasynq.RewardRepairPayload{RunID: req.RunID}); err != nil {
+			log.Errorf("EnqueueRewardRepair error: %v", err)
+			// 没有修复任务处理时恢复为待处理, 可以重新批准
+			if _, err := dao.RevertRewardReconcileItems(c.Request.Context(), req.RunID, req.ItemIDs, username); err != nil {
+				log.Errorf("RevertRewardReconcileItems error: %v", err)
+			}
+			c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"approved": approved,
+	}))
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/dao/daotest"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+)
+
+func TestCheckRepairResidual(t *testing.T) {
+	item := &model.RewardReconcileItem{Diff: 4}
+
+	if err := checkRepairResidual(item, 4.005, 0.01); err != nil {
+		t.Fatalf("expect the residual within tolerance, got %v", err)
+	}
+	if err := checkRepairResidual(item, 1, 0.01); err == nil {
+		t.Fatal("expect an error when the residual exceeds tolerance")
+	}
+	if err := checkRepairResidual(&model.RewardReconcileItem{Diff: -2}, 0, 0.01); err == nil {
+		t.Fatal("expect an error for a negative residual")
+	}
+}
+
+func TestRunRewardRepair(t *testing.T) {
+	db := daotest.Open(t)
+	ctx := context.Background()
+
+	const (
+		userID   = "reward_repair_test_user"
+		deviceID = "reward_repair_test_node"
+	)
+
+	var runID int64
+	cleanup := func() {
+		daotest.Exec(t, db, `DELETE FROM device_info_hour WHERE device_id = ?`, deviceID)
+		daotest.Exec(t, db, `DELETE FROM device_info_daily WHERE device_id = ?`, deviceID)
+		daotest.Exec(t, db, `DELETE FROM reward_reconcile_item WHERE device_id = ?`, deviceID)
+		daotest.Exec(t, db, `DELETE FROM reward_reconcile_run WHERE id = ?`, runID)
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+
+	// 每天最大的累计收益为 10, 15, 21, 每日收益应为 5 和 6, 记录的第二天收益有误
+	y, m, d := time.Now().Date()
+	today := time.Date(y, m, d, 12, 0, 0, 0, time.Local)
+	for i, income := range []float64{10, 15, 21} {
+		day := today.AddDate(0, 0, i-3)
+		daotest.Exec(t, db, `INSERT INTO device_info_hour (user_id, device_id, time, hour_income) VALUES (?, ?, ?, ?)`, userID, deviceID, day, income)
+	}
+	for i, income := range []float64{1, 6} {
+		day := today.AddDate(0, 0, i-2)
+		daotest.Exec(t, db, `INSERT INTO device_info_daily (created_at, updated_at, user_id, device_id, time, income) VALUES (now(), now(), ?, ?, ?, ?)`,
+			userID, deviceID, day, income)
+	}
+
+	run := &model.RewardReconcileRun{AreaID: "reward-repair-test", State: dao.RewardReconcileRunStateDone, Tolerance: 0.01, StartedAt: time.Now()}
+	if err := dao.AddRewardReconcileRun(ctx, run); err != nil {
+		t.Fatal(err)
+	}
+	runID = run.ID
+
+	// 修复后第一个差异消除; 同一节点再次修复时收益不再变化, 第二个差异仍然存在
+	items := []*model.RewardReconcileItem{
+		{RunID: run.ID, DeviceID: deviceID, UserID: userID, SchedulerProfit: 11, DailySum: 7, Diff: 4},
+		{RunID: run.ID, DeviceID: deviceID, UserID: userID, SchedulerProfit: 17, DailySum: 7, Diff: 10},
+	}
+	for _, item := range items {
+		item.State, item.CreatedAt, item.UpdatedAt = dao.RewardReconcileItemStateFlagged, time.Now(), time.Now()
+	}
+	if err := dao.AddRewardReconcileItems(ctx, items); err != nil {
+		t.Fatal(err)
+	}
+
+	if approved, err := dao.ApproveRewardReconcileItems(ctx, run.ID, nil, "admin"); err != nil || approved != 2 {
+		t.Fatalf("approve items: %d %v", approved, err)
+	}
+	if err := RunRewardRepair(ctx, run.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	_, got, err := dao.ListRewardReconcileItems(ctx, run.ID, "", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := make(map[float64]*model.RewardReconcileItem)
+	for _, item := range got {
+		states[item.Diff] = item
+	}
+	if item := states[4]; item == nil || item.State != dao.RewardReconcileItemStateRepaired || item.Adjustment != 4 {
+		t.Fatalf("expect the first item to be repaired, got %+v", item)
+	}
+	if item := states[10]; item == nil || item.State != dao.RewardReconcileItemStateFailed || item.Error == "" {
+		t.Fatalf("expect the second item to fail with a residual diff, got %+v", item)
+	}
+
+	// 入队失败时恢复为待处理
+	if approved, err := dao.ApproveRewardReconcileItems(ctx, run.ID, nil, "admin"); err != nil || approved != 1 {
+		t.Fatalf("approve failed item: %d %v", approved, err)
+	}
+	if reverted, err := dao.RevertRewardReconcileItems(ctx, run.ID, nil, "admin"); err != nil || reverted != 1 {
+		t.Fatalf("revert items: %d %v", reverted, err)
+	}
+	if total, _, err := dao.ListRewardReconcileItems(ctx, run.ID, dao.RewardReconcileItemStateFlagged, 10, 0); err != nil || total != 1 {
+		t.Fatalf("expect the reverted item to be flagged, got %d %v", total, err)
+	}
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"bytes"
 	"io"
+	"net/http"
 	"strings"
 
 	jwt "github.com/appleboy/gin-jwt/v2"
@@ -37,6 +38,17 @@ func RequestLoggerMiddleware() gin.HandlerFunc {
 	}
 }
 
+// RecoveryMiddleware 与 gin.Recovery 相同, 但 http.ErrAbortHandler 继续抛给 net/http, 用于中断已经开始输出的响应,
+// HTTP/1 断开连接, HTTP/2 重置 stream
+func RecoveryMiddleware() gin.HandlerFunc {
+	return gin.CustomRecovery(func(c *gin.Context, err any) {
+		if err == http.ErrAbortHandler {
+			panic(err)
+		}
+		c.AbortWithStatus(http.StatusInternalServerError)
+	})
+}
+
 // var ignoreRouterMap = map[string]bool{
 // 	"/api/v1/user/ads/banners": true,
 // 	"/api/v2/app_version":      true,
@@ -111,6 +123,17 @@ func RegisterRouterWithJWT(router *gin.Engine, cfg config.Config) {
 	tnode.GET("/list", GetNodeList)
 	tnode.POST("/deactive", DeactiveNodeHanlder)
 	tnode.PUT("/deactive/cancel", CancelDeactiveNodeHanlder)
+	tnode.GET("/alert/rule", GetNodeAlertRuleHandler)
+	tnode.POST("/alert/rule", SetNodeAlertRuleHandler)
+	tnode.GET("/alert/list", ListNodeAlertHandler)
+	tnode.GET("/fleet", GetFleetHandler)
+	tnode.POST("/fleet/action", FleetActionHandler)
+	tnode.GET("/labels", ListDeviceLabelsHandler)
+	tnode.GET("/groups", ListDeviceGroupsHandler)
+	tnode.POST("/groups", CreateDeviceGroupHandler)
+	tnode.POST("/groups/delete", DeleteDeviceGroupHandler)
+	tnode.GET("/sla", GetNodeSLAHandler)
+	tnode.GET("/sla/export", ExportNodeSLAHandler)
 
 	// request from titan api
 	apiV2.GET("/get_cache_list", GetCacheListHandler)
@@ -174,6 +197,7 @@ func RegisterRouterWithJWT(router *gin.Engine, cfg config.Config) {
 	}
 
 	admin.Use(adminMiddleware.MiddlewareFunc())
+	admin.Use(OperationAuditMiddleware())
 	admin.GET("/get_login_log", GetLoginLogHandler)
 	admin.GET("/get_operation_log", GetOperationLogHandler)
 	admin.GET("/get_node_daily_trend", GetNodeDailyTrendHandler)
@@ -208,6 +232,27 @@ func RegisterRouterWithJWT(router *gin.Engine, cfg config.Config) {
 
 	// dashboards
 	admin.GET("/areas", GetAreasHandler)
+	admin.GET("/schedulers/health", GetSchedulerHealthHandler)
+	admin.GET("/jobs/status", GetCronJobStatusHandler)
+	admin.GET("/jobs/runs", GetCronJobRunsHandler)
+	admin.GET("/statistics/fetchers", GetFetcherProgressHandler)
+	admin.POST("/statistics/backfill", BackfillFetcherHandler)
+	admin.GET("/node/sla", GetUserNodeSLAHandler)
+	admin.GET("/node/sla/export", ExportUserNodeSLAHandler)
+	admin.GET("/reconcile/runs", ListReconcileRunsHandler)
+	admin.GET("/reconcile/items", ListReconcileItemsHandler)
+	admin.POST("/reconcile/repair", ApproveRewardRepairHandler)
+	admin.POST("/tenant/create", CreateTenantHandler)
+	admin.GET("/tenant/list", ListTenantsHandler)
+	admin.POST("/tenant/rotate_key", RotateTenantKeyHandler)
+	admin.POST("/tenant/quota", UpdateTenantQuotaHandler)
+	admin.GET("/tenant/usage", GetTenantUsageHandler)
+	admin.GET("/storage/dedup_report", GetContentDedupReportHandler)
+	admin.GET("/quota/plans", ListQuotaPlansHandler)
+	admin.POST("/quota/plan/save", SaveQuotaPlanHandler)
+	admin.POST("/quota/plan/delete", DeleteQuotaPlanHandler)
+	admin.POST("/quota/assign", AssignQuotaPlanHandler)
+	admin.GET("/quota/user", GetUserQuotaAdminHandler)
 	admin.GET("/total_stats", GetTotalStatsHandler)
 	admin.GET("/ip_changed_records", GetNodeIPChangedRecordsHandler)
 	admin.GET("/asset_records", GetAssetRecordsHandler)
@@ -237,6 +282,7 @@ func RegisterRouterWithJWT(router *gin.Engine, cfg config.Config) {
 	storage.POST("/login", authMiddleware.LoginHandler)
 	storage.POST("/logout", authMiddleware.LogoutHandler)
 	link.GET("/", GetShareLinkHandler)
+	link.GET("/s/:token", ShortLinkRedirectHandler)
 	storage.GET("/get_link", ShareLinkHandler)
 	storage.GET("/create_link", CreateShareLinkHandler)
 	storage.GET("/share_need_pass", ShareNeedPassHandler)
@@ -264,28 +310,47 @@ func RegisterRouterWithJWT(router *gin.Engine, cfg config.Config) {
 	storage.POST("/sync_data", SyncHourData)
 	storage.GET("/count", GetStorageCount)
 	storage.GET("/get_group_info", GetShareGroupInfo)
+	storage.GET("/share_group_download", DownloadShareGroupHandler)
 
 	storage.POST("/transfer/report", AssetTransferReport)
 
 	storage.Use(AuthRequired(authMiddleware))
+	storage.Use(OperationAuditMiddleware())
 	storage.GET("/share_before", ShareBeforeHandler)
 	storage.GET("/share_asset", ShareAssetsHandler)
 
 	storage.GET("/share_link_info", ShareLinkInfoHandler)
 	storage.POST("/share_link_update", ShareLinkUpdateHandler)
+	storage.POST("/share_link_revoke", RevokeShareLinkHandler)
+	storage.GET("/share_link_stats", GetShareLinkStatsHandler)
 
 	storage.GET("/get_locateStorage", GetAllocateStorageHandler)
 	storage.GET("/get_storage_size", GetStorageSizeHandler) // 获取用户存储空间信息
 	storage.GET("/get_vip_info", GetUserVipInfoHandler)     // 判断用户是否为vip
+	storage.GET("/quota", GetUserQuotaHandler)              // 获取用户的套餐、用量和用量提醒
 	storage.GET("/get_user_access_token", GetUserAccessTokenHandler)
 	storage.GET("/get_upload_info", GetUploadInfoHandler)
 	// storage.GET("/create_asset", CreateAssetHandler)
 	storage.POST("/create_asset", CreateAssetPostHandler)
+	storage.POST("/upload_session/create", CreateUploadSessionHandler)
+	storage.GET("/upload_session/info", GetUploadSessionHandler)
+	storage.GET("/upload_session/list", ListUploadSessionsHandler)
+	storage.POST("/upload_session/resume", ResumeUploadSessionHandler)
+	storage.POST("/upload_session/part", ReportUploadPartHandler)
+	storage.POST("/upload_session/commit", CommitUploadSessionHandler)
+	storage.POST("/upload_session/abort", AbortUploadSessionHandler)
 	storage.POST("/import_from_ipfs", CreateAssetFromIPFSHandler)
 	storage.POST("/export_to_ipfs", ExportAssetToIPFSHandler)
 	storage.GET("/delete_asset", DeleteAssetHandler)
 	storage.GET("/get_asset_info", GetAssetInfoHandler)
 	storage.GET("/get_asset_list", GetAssetListHandler)
+	storage.GET("/asset_search", SearchAssetsHandler)
+	storage.GET("/asset_tags", GetAssetTagsHandler)
+	storage.POST("/asset_meta", UpdateAssetMetaHandler)
+	storage.POST("/asset_bulk", BulkAssetHandler)
+	storage.POST("/asset_batch", CreateAssetBatchHandler)
+	storage.GET("/asset_batch", GetAssetBatchHandler)
+	storage.GET("/asset_batch_list", ListAssetBatchJobsHandler)
 	storage.GET("/get_all_asset_list", GetAssetAllListHandler)
 	storage.GET("/share_status_set", UpdateShareStatusHandler) // 修改分享状态
 	storage.GET("/create_key", CreateKeyHandler)               // TODO: 需要讨论key生成方式
@@ -301,7 +366,14 @@ func RegisterRouterWithJWT(router *gin.Engine, cfg config.Config) {
 	storage.GET("/get_groups", GetGroupsHandler)         // 获取文件夹信息
 	storage.GET("/get_asset_group_list", GetAssetGroupListHandler)
 	storage.GET("/get_asset_group_info", GetAssetGroupInfoHandler)
+	storage.GET("/group_download", DownloadGroupHandler)
+	storage.POST("/group_publish", PublishGroupHandler)
+	storage.GET("/group_publish", ListGroupPublishHandler)
 	storage.GET("/delete_group", DeleteGroupHandler)
+	storage.GET("/trash/list", GetTrashListHandler)
+	storage.POST("/trash/restore", RestoreTrashHandler)
+	storage.POST("/trash/delete", PurgeTrashHandler)
+	storage.POST("/trash/empty", EmptyTrashHandler)
 	storage.POST("/rename_group", RenameGroupHandler)
 	storage.POST("/rename_asset", RenameAssetHandler)
 	storage.GET("/move_group_to_group", MoveGroupToGroupHandler)
@@ -343,6 +415,15 @@ func RegisterRouterWithJWT(router *gin.Engine, cfg config.Config) {
 	tenant.POST("/sync_user", SubUserSyncHandler)
 	tenant.DELETE("/user", SubUserDeleteHandler)
 	tenant.GET("/refresh_token", SubUserRefreshTokenHandler)
+	tenant.POST("/rotate_key", TenantRotateKeyHandler)
+	tenant.GET("/usage", TenantUsageHandler)
+	tenant.GET("/webhook/deliveries", ListWebhookDeliveriesHandler)
+	tenant.GET("/webhook/delivery", GetWebhookDeliveryHandler)
+	tenant.POST("/webhook/redeliver", RedeliverWebhookHandler)
+	tenant.GET("/webhook/subscriptions", ListWebhookSubscriptionsHandler)
+	tenant.POST("/webhook/subscription", CreateWebhookSubscriptionHandler)
+	tenant.POST("/webhook/subscription/update", UpdateWebhookSubscriptionHandler)
+	tenant.POST("/webhook/subscription/delete", DeleteWebhookSubscriptionHandler)
 
 	// platform 容器平台
 	platform := apiV1.Group("/platform")
@@ -0,0 +1,293 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/core/geo"
+	"github.com/gnasnik/titan-explorer/core/storage"
+	"github.com/gnasnik/titan-explorer/pkg/formatter"
+)
+
+// linkStatsMaxDays 分享链接访问统计最多查询的天数
+const linkStatsMaxDays = 90
+
+type revokeShareLinkReq struct {
+	ID int64 `json:"id" binding:"required"`
+}
+
+// getLinkCountry 获取访问者所在的国家, 获取失败时返回空
+func getLinkCountry(c *gin.Context) string {
+	ip, err := GetIPFromRequest(c.Request)
+	if err != nil {
+		return ""
+	}
+
+	loc, err := geo.GetIpLocation(c.Request.Context(), ip, model.LanguageEN)
+	if err != nil || loc == nil {
+		log.Errorf("GetIpLocation %s: %v", ip, err)
+		return ""
+	}
+
+	return loc.Country
+}
+
+// checkLinkPolicy 检查分享链接的访问策略, 返回访问者所在的国家; 不允许访问时返回错误码
+func checkLinkPolicy(c *gin.Context, link *model.Link) (string, int) {
+	if link.Revoked {
+		return "", errors.ShareLinkRevoked
+	}
+
+	if linkExpired(link) {
+		return "", errors.ShareLinkExpired
+	}
+
+	if link.MaxDownloads > 0 && link.DownloadCount >= link.MaxDownloads {
+		return "", errors.ShareLinkDownloadLimit
+	}
+
+	if referers := link.Referers(); len(referers) > 0 && !refererAllowed(c.Request.Referer(), referers) {
+		return "", errors.ShareLinkRefererDenied
+	}
+
+	country := getLinkCountry(c)
+	if countries := link.Countries(); len(countries) > 0 && !containsFold(countries, country) {
+		return country, errors.ShareLinkRegionDenied
+	}
+
+	return country, 0
+}
+
+// getShareLink 通过请求中的分享链接 token 获取分享链接并检查访问策略, 返回访问者所在的国家;
+// 没有 token 或链接不存在时不允许访问
+func getShareLink(c *gin.Context) (*model.Link, string, bool) {
+	shortID, err := parseLinkToken(c.Query(shareTokenParam), time.Now())
+	if err == errLinkTokenExpired {
+		c.JSON(http.StatusOK, respErrorCode(errors.ShareLinkExpired, c))
+		return nil, "", false
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
+		return nil, "", false
+	}
+
+	link, err := dao.GetLinkByShortID(c.Request.Context(), shortID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
+		return nil, "", false
+	}
+	if err != nil {
+		log.Errorf("GetLinkByShortID error %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return nil, "", false
+	}
+
+	country, code := checkLinkPolicy(c, link)
+	if code != 0 {
+		c.JSON(http.StatusOK, respErrorCode(code, c))
+		return nil, "", false
+	}
+
+	return link, country, true
+}
+
+// linkGroupID 分享文件组时链接的 cid 为文件组 id, 分享文件时返回 0
+func linkGroupID(link *model.Link) int64 {
+	gid, err := strconv.ParseInt(link.Cid, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return gid
+}
+
+// refererAllowed 来源域名是否在允许的列表中, 允许列表中的域名同时匹配其子域名
+func refererAllowed(referer string, allowed []string) bool {
+	u, err := url.Parse(referer)
+	if err != nil || u.Hostname() == "" {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, domain := range allowed {
+		domain = strings.ToLower(domain)
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsFold(list []string, s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinList 去掉空白项后用逗号连接
+func joinList(list []string) string {
+	var out []string
+	for _, v := range list {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return strings.Join(out, ",")
+}
+
+// cancelLinkShareStatus 撤销分享链接后取消文件或文件组的分享状态, 同一个文件或文件组还有其他未撤销的链接时保留
+func cancelLinkShareStatus(ctx context.Context, link *model.Link) error {
+	_, err := dao.GetLink(ctx, squirrel.Select("*").Where("username = ? AND cid = ? AND revoked = 0", link.UserName, link.Cid))
+	if err == nil {
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	if gid := linkGroupID(link); gid > 0 {
+		return dao.CancelGroupShareStatus(ctx, link.UserName, gid)
+	}
+
+	hash, err := storage.CIDToHash(link.Cid)
+	if err != nil {
+		return nil
+	}
+	return dao.CancelAssetShareStatus(ctx, hash, link.UserName)
+}
+
+// RevokeShareLinkHandler 撤销分享链接
+// @Summary 撤销分享链接
+// @Security ApiKeyAuth
+// @Tags storage
+// @Param req body revokeShareLinkReq true "请求参数"
+// @Success 200 {object} JsonObject "{msg:"success"}"
+// @Router /api/v1/storage/share_link_revoke [post]
+func RevokeShareLinkHandler(c *gin.Context) {
+	username := jwt.ExtractClaims(c)[identityKey].(string)
+
+	var req revokeShareLinkReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	link, ok := getUserLink(c, req.ID, username)
+	if !ok {
+		return
+	}
+
+	SetAuditTarget(c, "link", link.ID)
+
+	if err := dao.RevokeLink(c.Request.Context(), link.ID, username); err != nil {
+		log.Errorf("RevokeLink error %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	if err := cancelLinkShareStatus(c.Request.Context(), link); err != nil {
+		log.Errorf("cancelLinkShareStatus error %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"msg": "success",
+	}))
+}
+
+// GetShareLinkStatsHandler 分享链接的访问统计
+// @Summary 分享链接的访问统计
+// @Security ApiKeyAuth
+// @Tags storage
+// @Param id query int true "链接id"
+// @Param start query string false "开始日期 2006-01-02, 默认 30 天前"
+// @Param end query string false "结束日期 2006-01-02, 默认今天"
+// @Success 200 {object} JsonObject "{link:{},daily:[],countries:[]}"
+// @Router /api/v1/storage/share_link_stats [get]
+func GetShareLinkStatsHandler(c *gin.Context) {
+	username := jwt.ExtractClaims(c)[identityKey].(string)
+	id, _ := strconv.ParseInt(c.Query("id"), 10, 64)
+
+	link, ok := getUserLink(c, id, username)
+	if !ok {
+		return
+	}
+
+	end := time.Now()
+	if v := c.Query("end"); v != "" {
+		t, err := time.ParseInLocation(formatter.TimeFormatDateOnly, v, time.Local)
+		if err != nil {
+			c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+			return
+		}
+		end = t
+	}
+	end = time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.Local).AddDate(0, 0, 1)
+
+	start := end.AddDate(0, 0, -30)
+	if v := c.Query("start"); v != "" {
+		t, err := time.ParseInLocation(formatter.TimeFormatDateOnly, v, time.Local)
+		if err != nil {
+			c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+			return
+		}
+		start = t
+	}
+
+	if !start.Before(end) || end.Sub(start) > linkStatsMaxDays*24*time.Hour {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	daily, countries, err := dao.GetLinkAccessStats(c.Request.Context(), link.ID, start, end)
+	if err != nil {
+		log.Errorf("GetLinkAccessStats error %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"link":      link,
+		"daily":     daily,
+		"countries": countries,
+	}))
+}
+
+// getUserLink 获取用户自己的分享链接
+func getUserLink(c *gin.Context, id int64, username string) (*model.Link, bool) {
+	link, err := dao.GetLink(c.Request.Context(), squirrel.Select("*").Where("id = ?", id))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
+		return nil, false
+	}
+	if err != nil {
+		log.Errorf("GetLink error %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return nil, false
+	}
+
+	if link.UserName != username {
+		c.JSON(http.StatusOK, respErrorCode(errors.LinkUserNotMatch, c))
+		return nil, false
+	}
+
+	return link, true
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/config"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+)
+
+func TestRefererAllowed(t *testing.T) {
+	allowed := []string{"example.com", "Partner.io"}
+
+	cases := []struct {
+		referer string
+		want    bool
+	}{
+		{"https://example.com/share?id=1", true},
+		{"https://cdn.example.com/a", true},
+		{"https://PARTNER.io", true},
+		{"https://badexample.com", false},
+		{"https://example.com.evil.net", false},
+		{"", false},
+		{"not a url", false},
+	}
+
+	for _, c := range cases {
+		if got := refererAllowed(c.referer, allowed); got != c.want {
+			t.Errorf("refererAllowed(%q) = %v, want %v", c.referer, got, c.want)
+		}
+	}
+}
+
+func TestCheckLinkPolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		name string
+		link model.Link
+		code int
+	}{
+		{"revoked", model.Link{Revoked: true}, errors.ShareLinkRevoked},
+		{"expired", model.Link{ExpireAt: time.Now().Add(-time.Minute)}, errors.ShareLinkExpired},
+		{"download limit", model.Link{MaxDownloads: 2, DownloadCount: 2}, errors.ShareLinkDownloadLimit},
+		{"referer", model.Link{AllowedReferers: "example.com"}, errors.ShareLinkRefererDenied},
+	}
+
+	for _, cs := range cases {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/storage/open_asset", nil)
+		c.Request.Header.Set("Referer", "https://other.com/")
+
+		if _, code := checkLinkPolicy(c, &cs.link); code != cs.code {
+			t.Errorf("%s: expected code %d, got %d", cs.name, cs.code, code)
+		}
+	}
+}
+
+func TestGetShareLinkWithoutToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config.Cfg.ShareLinkSecret = "test-secret"
+	defer func() { config.Cfg.ShareLinkSecret = "" }()
+
+	// 没有 token 或签名不正确时不查询分享链接, 直接拒绝访问
+	for _, query := range []string{"", "?share_token=forged.sign", "?asset_cid=bafy&user_id=alice"} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/storage/open_asset"+query, nil)
+
+		if _, _, ok := getShareLink(c); ok {
+			t.Fatalf("%q: expected share link to be rejected", query)
+		}
+
+		var resp struct {
+			Err int `json:"err"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Err != errors.NotFound {
+			t.Fatalf("%q: expected NotFound, got %s", query, w.Body.String())
+		}
+	}
+}
+
+func TestGetShareLinkExpiredToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config.Cfg.ShareLinkSecret = "test-secret"
+	defer func() { config.Cfg.ShareLinkSecret = "" }()
+
+	// token 中的过期时间已过时不查询数据库
+	token := signLinkToken("abc", time.Now().Add(-time.Minute))
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/storage/open_asset?share_token="+token, nil)
+
+	if _, _, ok := getShareLink(c); ok {
+		t.Fatalf("expected expired share link to be rejected")
+	}
+	var resp struct {
+		Err int `json:"err"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Err != errors.ShareLinkExpired {
+		t.Fatalf("expected ShareLinkExpired, got %s", w.Body.String())
+	}
+}
+
+func TestRedirectLongLink(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config.Cfg.ShareLinkSecret = "test-secret"
+	defer func() { config.Cfg.ShareLinkSecret = "" }()
+
+	link := &model.Link{ShortID: "abc", LongLink: url.QueryEscape("https://example.com/share?cid=bafy&username=alice")}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/link/s/token", nil)
+	redirectLongLink(c, link)
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("expected 302, got %d", w.Code)
+	}
+	u, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 分享页面需要使用 token 打开文件
+	if q := u.Query(); q.Get("cid") != "bafy" || q.Get(shareTokenParam) != signLinkToken("abc", time.Time{}) {
+		t.Fatalf("unexpected redirect location %s", u)
+	}
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	stderrors "errors"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/config"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+)
+
+const (
+	shortIDLength   = 22
+	shortLinkPrefix = "/link/s/"
+	// shareTokenParam 跳转到分享页面时附带的短链接 token, 分享页面打开或下载文件时需要携带
+	shareTokenParam = "share_token"
+	// linkSignSize 签名截取的字节数
+	linkSignSize = 16
+)
+
+var (
+	errInvalidLinkToken = stderrors.New("invalid link token")
+	errLinkTokenExpired = stderrors.New("link token expired")
+)
+
+// newShortID 生成短链接的随机 ID
+func newShortID() (string, error) {
+	out := make([]byte, shortIDLength)
+	max := big.NewInt(int64(len(charset)))
+	for i := range out {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		out[i] = charset[n.Int64()]
+	}
+	return string(out), nil
+}
+
+func shareLinkSecret() []byte {
+	if config.Cfg.ShareLinkSecret != "" {
+		return []byte(config.Cfg.ShareLinkSecret)
+	}
+	return []byte(config.Cfg.SecretKey)
+}
+
+func signLinkPayload(payload string) string {
+	mac := hmac.New(sha256.New, shareLinkSecret())
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:linkSignSize])
+}
+
+// signLinkToken 生成带签名的短链接 token, 格式为 <short_id>.<过期时间>.<签名>, 过期时间为 0 表示不过期;
+// 修改过期时间后需要重新生成
+func signLinkToken(shortID string, expireAt time.Time) string {
+	var exp int64
+	if !expireAt.IsZero() {
+		exp = expireAt.Unix()
+	}
+	payload := shortID + "." + strconv.FormatInt(exp, 36)
+	return payload + "." + signLinkPayload(payload)
+}
+
+// parseLinkToken 校验短链接 token 的签名和过期时间, 返回短链接的随机 ID; 过期的 token 不需要再查询数据库
+func parseLinkToken(token string, now time.Time) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] == "" {
+		return "", errInvalidLinkToken
+	}
+
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(signLinkPayload(payload))) {
+		return "", errInvalidLinkToken
+	}
+
+	exp, err := strconv.ParseInt(parts[1], 36, 64)
+	if err != nil {
+		return "", errInvalidLinkToken
+	}
+	if exp > 0 && now.Unix() > exp {
+		return "", errLinkTokenExpired
+	}
+
+	return parts[0], nil
+}
+
+// shortLinkURL 分享链接对外的短链接
+func shortLinkURL(link *model.Link) string {
+	return shortLinkPrefix + signLinkToken(link.ShortID, link.ExpireAt)
+}
+
+// signedShortLink 返回分享链接带签名的短链接, 没有随机 ID 时先生成; 新格式的短链接在过期时间修改后重新保存,
+// 旧格式的 /link?cid=&ts= 短链接保留不变, 已经发出的旧链接仍然可以访问
+func signedShortLink(ctx context.Context, link *model.Link) (string, error) {
+	changed := false
+	if link.ShortID == "" {
+		shortID, err := newShortID()
+		if err != nil {
+			return "", err
+		}
+		link.ShortID = shortID
+		changed = true
+	}
+
+	shortLink := shortLinkURL(link)
+	if strings.HasPrefix(link.ShortLink, shortLinkPrefix) && link.ShortLink != shortLink {
+		link.ShortLink = shortLink
+		changed = true
+	}
+	if changed {
+		if err := dao.UpdateLinkShortLink(ctx, link); err != nil {
+			return "", err
+		}
+	}
+
+	return shortLink, nil
+}
+
+// linkExpired 分享链接是否已过期, 未设置过期时间的链接不过期
+func linkExpired(link *model.Link) bool {
+	return !link.ExpireAt.IsZero() && link.ExpireAt.Before(time.Now())
+}
+
+// redirectLongLink 跳转到分享页面并附带短链接 token, 使用 302 并禁止缓存, 链接撤销或过期后立即失效
+func redirectLongLink(c *gin.Context, link *model.Link) {
+	if link.Revoked {
+		c.JSON(http.StatusOK, respErrorCode(errors.ShareLinkRevoked, c))
+		return
+	}
+	if linkExpired(link) {
+		c.JSON(http.StatusOK, respErrorCode(errors.ShareLinkExpired, c))
+		return
+	}
+
+	// 解码 URL
+	decodedLink, err := url.QueryUnescape(link.LongLink)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode URL"})
+		return
+	}
+	u, err := url.Parse(decodedLink)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse URL"})
+		return
+	}
+	q := u.Query()
+	q.Set(shareTokenParam, signLinkToken(link.ShortID, link.ExpireAt))
+	u.RawQuery = q.Encode()
+
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, u.String())
+}
+
+// ShortLinkRedirectHandler 通过签名的短链接跳转到分享页面
+// @Summary 短链接跳转
+// @Tags storage
+// @Param token path string true "短链接 token"
+// @Success 302
+// @Router /link/s/{token} [get]
+func ShortLinkRedirectHandler(c *gin.Context) {
+	shortID, err := parseLinkToken(c.Param("token"), time.Now())
+	if err == errLinkTokenExpired {
+		c.JSON(http.StatusOK, respErrorCode(errors.ShareLinkExpired, c))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
+		return
+	}
+
+	link, err := dao.GetLinkByShortID(c.Request.Context(), shortID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
+		return
+	}
+	if err != nil {
+		log.Errorf("GetLinkByShortID error %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	redirectLongLink(c, link)
+}
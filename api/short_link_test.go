@@ -0,0 +1,52 @@
+package api
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gnasnik/titan-explorer/config"
+)
+
+func TestLinkToken(t *testing.T) {
+	config.Cfg.ShareLinkSecret = "test-secret"
+	defer func() { config.Cfg.ShareLinkSecret = "" }()
+
+	shortID, err := newShortID()
+	if err != nil || len(shortID) != shortIDLength {
+		t.Fatalf("newShortID: %q %v", shortID, err)
+	}
+
+	now := time.Now()
+	token := signLinkToken(shortID, now.Add(time.Hour))
+
+	got, err := parseLinkToken(token, now)
+	if err != nil || got != shortID {
+		t.Fatalf("parseLinkToken = %q, %v", got, err)
+	}
+
+	if _, err := parseLinkToken(token, now.Add(2*time.Hour)); err != errLinkTokenExpired {
+		t.Fatalf("expected errLinkTokenExpired, got %v", err)
+	}
+
+	// 修改过期时间或替换短链接 ID 后签名不匹配
+	sign := token[strings.LastIndex(token, ".")+1:]
+	if _, err := parseLinkToken(shortID+".zzzzzz."+sign, now); err != errInvalidLinkToken {
+		t.Fatalf("expected errInvalidLinkToken for forged expiry, got %v", err)
+	}
+	if _, err := parseLinkToken("forged"+token[len(shortID):], now); err != errInvalidLinkToken {
+		t.Fatalf("expected errInvalidLinkToken for forged id, got %v", err)
+	}
+	if _, err := parseLinkToken(shortID+"."+sign, now); err != errInvalidLinkToken {
+		t.Fatalf("expected errInvalidLinkToken without expiry, got %v", err)
+	}
+
+	if _, err := parseLinkToken(signLinkToken(shortID, time.Time{}), now.AddDate(10, 0, 0)); err != nil {
+		t.Fatalf("token without expiry should not expire: %v", err)
+	}
+
+	config.Cfg.ShareLinkSecret = "rotated"
+	if _, err := parseLinkToken(token, now); err != errInvalidLinkToken {
+		t.Fatalf("expected errInvalidLinkToken after secret rotation, got %v", err)
+	}
+}
@@ -21,11 +21,6 @@ import (
 	"github.com/rs/xid"
 )
 
-const (
-	maxTempAssetDownloadCount int64 = 20
-	maxTempAssetShareCount    int64 = 60
-)
-
 type (
 	// UploadTempFileReq 上传临时文件
 	UploadTempFileReq struct {
@@ -100,12 +95,18 @@ func UploadTempFile(c *gin.Context) {
 	}
 	// 判断文件是否已经存在
 	aids, _ := oprds.GetClient().GetUnloginAssetAreaIDs(c.Request.Context(), hash)
-	// 判断文件是否已经被上传分享60次了
+	tempPlan, err := getTempQuotaPlan(c.Request.Context())
+	if err != nil {
+		log.Errorf("getTempQuotaPlan error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+	// 判断文件的分享次数是否已经达到 temp 套餐的上限
 	taInfo, err := dao.GetTempAssetInfo(c.Request.Context(), hash)
 	switch err {
 	case sql.ErrNoRows:
 	case nil:
-		if taInfo.ShareCount >= maxTempAssetShareCount {
+		if quotaReached(taInfo.ShareCount, tempPlan.ShareCount) {
 			c.JSON(http.StatusOK, respErrorCode(errors.TempAssetUploadErr, c))
 			return
 		}
@@ -216,14 +217,20 @@ func ShareTempFile(c *gin.Context) {
 		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
 		return
 	}
-	// 判断文件是否已经被上传分享60次了
+	tempPlan, err := getTempQuotaPlan(c.Request.Context())
+	if err != nil {
+		log.Errorf("getTempQuotaPlan error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+	// 判断文件的分享次数是否已经达到 temp 套餐的上限
 	taInfo, err := dao.GetTempAssetInfo(c.Request.Context(), hash)
 	switch err {
 	case sql.ErrNoRows:
 		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
 		return
 	case nil:
-		if taInfo.ShareCount >= maxTempAssetShareCount {
+		if quotaReached(taInfo.ShareCount, tempPlan.ShareCount) {
 			c.JSON(http.StatusOK, respErrorCode(errors.TempAssetUploadErr, c))
 			return
 		}
@@ -308,7 +315,13 @@ func DownloadTempFile(c *gin.Context) {
 		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
 		return
 	}
-	// 判断文件是否已经被下载20次了
+	tempPlan, err := getTempQuotaPlan(c.Request.Context())
+	if err != nil {
+		log.Errorf("getTempQuotaPlan error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+	// 判断文件的下载次数是否已经达到 temp 套餐的上限
 	taInfo, err := dao.GetTempAssetInfo(c.Request.Context(), hash)
 	switch err {
 	case sql.ErrNoRows:
@@ -316,7 +329,7 @@ func DownloadTempFile(c *gin.Context) {
 		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
 		return
 	case nil:
-		if taInfo.DownloadCount >= maxTempAssetDownloadCount {
+		if quotaReached(taInfo.DownloadCount, tempPlan.DownloadCount) {
 			c.JSON(http.StatusOK, respErrorCode(errors.TempAssetDownErr, c))
 			return
 		}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"time"
@@ -11,6 +12,7 @@ import (
 	"github.com/gnasnik/titan-explorer/core/dao"
 	"github.com/gnasnik/titan-explorer/core/errors"
 	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/core/opasynq"
 )
 
 type SSOLoginReq struct {
@@ -66,7 +68,12 @@ func SSOLoginHandler(c *gin.Context) {
 		if err := dao.CreateUser(c.Request.Context(), user); err != nil {
 			log.Errorf("[TENANT][SSO] create user error: %s", err.Error())
 			c.JSON(200, respErrorCode(errors.InternalServer, c))
+			return
 		}
+
+		PublishTenantEvent(c.Request.Context(), tenantID, opasynq.WebhookEventUserCreated, "", WebhookUserData{
+			EntryUUID: user.Uuid, Username: user.Username, Email: user.UserEmail,
+		})
 	}
 
 	payloadProto := &model.User{TenantID: tenant.TenantID, Uuid: user.Uuid, Username: user.Username, Role: user.Role}
@@ -82,13 +89,239 @@ func SSOLoginHandler(c *gin.Context) {
 	}))
 }
 
+const maxSubUserSyncBatch = 100
+
+const (
+	SubUserSyncCreated = "created"
+	SubUserSyncUpdated = "updated"
+	SubUserSyncDeleted = "deleted"
+	SubUserSyncFailed  = "failed"
+)
+
+type SubUserSyncEntry struct {
+	SSOLoginReq
+	Deleted bool `json:"deleted"`
+}
+
+type SubUserSyncReq struct {
+	Users     []SubUserSyncEntry `json:"users"`
+	WithAsset bool               `json:"with_asset"` // 删除子账户时是否同时删除其文件
+}
+
+type SubUserSyncResult struct {
+	EntryUUID string `json:"entry_uuid"`
+	Username  string `json:"username"`
+	Action    string `json:"action"`
+	Error     string `json:"error,omitempty"`
+}
+
+// SubUserSyncHandler 批量同步租户子账户, 按 entry_uuid 新增或更新, deleted 为 true 时删除
 func SubUserSyncHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	tenantID, _ := claims[tenantID].(string)
+	tenantName, _ := claims[tenantName].(string)
 
+	if tenantID == "" {
+		c.JSON(401, respError(errors.InvalidAPPKey, fmt.Errorf("missing app_key in request")))
+		return
+	}
+
+	var req SubUserSyncReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(200, respError(errors.InvalidParams, fmt.Errorf("invalid sync user payload")))
+		return
+	}
+
+	if len(req.Users) == 0 || len(req.Users) > maxSubUserSyncBatch {
+		c.JSON(200, respError(errors.InvalidParams, fmt.Errorf("users size should be between 1 and %d", maxSubUserSyncBatch)))
+		return
+	}
+
+	tenant, err := dao.GetTenantByBuilder(c.Request.Context(), squirrel.Select("*").Where("tenant_id = ?", tenantID))
+	if err != nil {
+		log.Errorf("[TENANT][SYNC] query tenant error: %s", err.Error())
+		c.JSON(200, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	results := make([]*SubUserSyncResult, 0, len(req.Users))
+	for _, entry := range req.Users {
+		result := syncSubUser(c.Request.Context(), tenant, tenantName, entry, req.WithAsset)
+		results = append(results, result)
+	}
+
+	c.JSON(200, respJSON(JsonObject{
+		"list": results,
+	}))
 }
 
+func syncSubUser(ctx context.Context, tenant *model.Tenant, tenantName string, entry SubUserSyncEntry, withAsset bool) *SubUserSyncResult {
+	result := &SubUserSyncResult{EntryUUID: entry.EntryUUID}
+
+	fail := func(err error) *SubUserSyncResult {
+		result.Action = SubUserSyncFailed
+		result.Error = err.Error()
+		return result
+	}
+
+	if entry.EntryUUID == "" {
+		return fail(fmt.Errorf("invalid entry uuid"))
+	}
+
+	user, err := dao.GetUserByBuilder(ctx, squirrel.Select("*").Where(squirrel.Eq{"uuid": entry.EntryUUID, "tenant_id": tenant.TenantID}))
+	if err != nil && err != sql.ErrNoRows {
+		log.Errorf("[TENANT][SYNC] query user error: %s", err.Error())
+		return fail(fmt.Errorf("query user failed"))
+	}
+
+	switch {
+	case entry.Deleted:
+		if err == sql.ErrNoRows {
+			return fail(fmt.Errorf("user not found"))
+		}
+		if err := deleteSubUser(ctx, tenant, user, withAsset); err == errSubUserHasAssets {
+			return fail(fmt.Errorf("user still has assets, set with_asset to delete them"))
+		} else if err != nil {
+			log.Errorf("[TENANT][SYNC] delete user error: %s", err.Error())
+			return fail(fmt.Errorf("delete user failed"))
+		}
+		result.Action = SubUserSyncDeleted
+
+	case err == sql.ErrNoRows:
+		if entry.Username == "" {
+			return fail(fmt.Errorf("invalid entry username"))
+		}
+		user = &model.User{Uuid: entry.EntryUUID, TenantID: tenant.TenantID, Avatar: entry.Avatar, UserEmail: entry.Email, Username: fmt.Sprintf("%s/%s", tenantName, entry.Username), CreatedAt: time.Now()}
+		if err := dao.CreateUser(ctx, user); err != nil {
+			log.Errorf("[TENANT][SYNC] create user error: %s", err.Error())
+			return fail(fmt.Errorf("create user failed"))
+		}
+		PublishTenantEvent(ctx, tenant.TenantID, opasynq.WebhookEventUserCreated, "", WebhookUserData{
+			EntryUUID: user.Uuid, Username: user.Username, Email: user.UserEmail,
+		})
+		result.Action = SubUserSyncCreated
+
+	default:
+		user.Avatar = entry.Avatar
+		user.UserEmail = entry.Email
+		if err := dao.UpdateTenantUserProfile(ctx, user); err != nil {
+			log.Errorf("[TENANT][SYNC] update user error: %s", err.Error())
+			return fail(fmt.Errorf("update user failed"))
+		}
+		result.Action = SubUserSyncUpdated
+	}
+
+	result.Username = user.Username
+	return result
+}
+
+// SubUserDeleteHandler 删除租户子账户, with_asset 为 true 时同时删除其文件
 func SubUserDeleteHandler(c *gin.Context) {
-	// uuid := c.Query("entry_uuid")
-	// withAsset := c.Query("with_asset") == "true"
+	claims := jwt.ExtractClaims(c)
+	tenantID, _ := claims[tenantID].(string)
+
+	if tenantID == "" {
+		c.JSON(401, respError(errors.InvalidAPPKey, fmt.Errorf("missing app_key in request")))
+		return
+	}
+
+	uuid := c.Query("entry_uuid")
+	withAsset := c.Query("with_asset") == "true"
+
+	if uuid == "" {
+		c.JSON(200, respError(errors.InvalidParams, fmt.Errorf("invalid entry uuid")))
+		return
+	}
+
+	tenant, err := dao.GetTenantByBuilder(c.Request.Context(), squirrel.Select("*").Where("tenant_id = ?", tenantID))
+	if err != nil {
+		log.Errorf("[TENANT][DELETE] query tenant error: %s", err.Error())
+		c.JSON(200, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	user, err := dao.GetUserByBuilder(c.Request.Context(), squirrel.Select("*").Where(squirrel.Eq{"uuid": uuid, "tenant_id": tenantID}))
+	if err == sql.ErrNoRows {
+		c.JSON(200, respErrorCode(errors.UserNotFound, c))
+		return
+	}
+	if err != nil {
+		log.Errorf("[TENANT][DELETE] query user error: %s", err.Error())
+		c.JSON(200, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	err = deleteSubUser(c.Request.Context(), tenant, user, withAsset)
+	if err == errSubUserHasAssets {
+		c.JSON(200, respErrorCode(errors.SubUserHasAssets, c))
+		return
+	}
+	if err != nil {
+		log.Errorf("[TENANT][DELETE] delete user error: %s", err.Error())
+		c.JSON(200, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(200, respJSON(JsonObject{
+		"msg": "success",
+	}))
+}
+
+// errSubUserHasAssets 子账户还有文件但没有要求同时删除, 直接删除账户会留下没有所属用户的文件和内容引用
+var errSubUserHasAssets = fmt.Errorf("user still has assets")
+
+// deleteSubUser 删除子账户; withAsset 时删除其文件记录, 调度器上已没有引用的文件放入队列删除, 并按文件回调租户的删除通知;
+// 没有 withAsset 时子账户必须没有文件
+func deleteSubUser(ctx context.Context, tenant *model.Tenant, user *model.User, withAsset bool) error {
+	if !withAsset {
+		count, err := dao.CountUserAssets(ctx, user.Username)
+		if err != nil {
+			return fmt.Errorf("count user assets: %w", err)
+		}
+		if count > 0 {
+			return errSubUserHasAssets
+		}
+	} else {
+		assets, err := dao.ListUserAssetsByUser(ctx, user.Username)
+		if err != nil {
+			return fmt.Errorf("list user assets: %w", err)
+		}
+
+		released, err := dao.DeleteAllUserAssets(ctx, user.Username)
+		if err != nil {
+			return fmt.Errorf("delete user assets: %w", err)
+		}
+
+		// 区域中已经没有用户引用的内容从调度器中删除
+		removeReleasedContents(ctx, released)
+
+		if tenant.DeleteNotifyUrl != "" {
+			for _, asset := range assets {
+				if asset.ExtraID == "" {
+					continue
+				}
+				err := opasynq.DefaultCli.EnqueueAssetDeleteNotify(ctx, opasynq.AssetDeleteNotifyPayload{
+					ExtraID:  asset.ExtraID,
+					TenantID: tenant.TenantID,
+					UserID:   user.Username,
+					AssetCID: asset.Cid,
+				})
+				if err != nil {
+					log.Errorf("EnqueueAssetDeleteNotify error %+v", err)
+				}
+			}
+		}
+	}
+
+	if err := dao.DeleteUser(ctx, user.Username); err != nil {
+		return fmt.Errorf("delete user: %w", err)
+	}
+
+	PublishTenantEvent(ctx, tenant.TenantID, opasynq.WebhookEventUserDeleted, "", WebhookUserData{
+		EntryUUID: user.Uuid, Username: user.Username, Email: user.UserEmail,
+	})
+
+	return nil
 }
 
 func SubUserRefreshTokenHandler(c *gin.Context) {
@@ -0,0 +1,475 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/core/storage"
+	"github.com/go-redis/redis/v9"
+	"github.com/google/uuid"
+)
+
+const (
+	tenantTrafficCacheKeyPrefix = "TITAN::TENANT::TRAFFIC"
+	tenantTrafficCacheTTL       = 5 * time.Minute
+	tenantApiKeyCacheKeyPrefix  = "TITAN::TENANT::APIKEY"
+	tenantApiKeyCacheTTL        = time.Minute
+
+	defaultKeyGracePeriod = 24 * time.Hour
+	maxKeyGracePeriod     = 7 * 24 * time.Hour
+
+	defaultUsageReportDays = 30
+)
+
+// getTenant 获取租户信息
+func getTenant(ctx context.Context, tenantID string) (*model.Tenant, error) {
+	return dao.GetTenantByBuilder(ctx, squirrel.Select("*").Where("tenant_id = ?", tenantID))
+}
+
+// tenantApiKeys 缓存的租户有效 key, 只保存 key 的哈希
+type tenantApiKeys struct {
+	Key          string `json:"key"`
+	PrevKey      string `json:"prev_key"`
+	PrevExpireAt int64  `json:"prev_expire_at"`
+}
+
+func hashTenantApiKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadTenantApiKeys 从数据库加载租户当前有效的 key, 停用的租户没有有效的 key
+func loadTenantApiKeys(ctx context.Context, tenantID string) (*tenantApiKeys, error) {
+	tenant, err := getTenant(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := &tenantApiKeys{}
+	if tenant.State != dao.TenantStateActive {
+		return keys, nil
+	}
+
+	pair, err := storage.LoadTenantKeyPairFromBlob(tenant.ApiKey)
+	if err != nil {
+		return nil, err
+	}
+	keys.Key = hashTenantApiKey(pair.ApiKey)
+
+	if tenant.InKeyGracePeriod() {
+		prev, err := storage.LoadTenantKeyPairFromBlob(tenant.PrevApiKey)
+		if err != nil {
+			return nil, err
+		}
+		keys.PrevKey, keys.PrevExpireAt = hashTenantApiKey(prev.ApiKey), tenant.PrevKeyExpireAt.Unix()
+	}
+
+	return keys, nil
+}
+
+// checkTenantApiKey 校验租户的 api key 是否为当前有效的 key, 轮换后的宽限期内旧 key 仍然有效;
+// 有效的 key 缓存 tenantApiKeyCacheTTL, 轮换 key 时清除缓存
+func checkTenantApiKey(ctx context.Context, tenantID, apiKey string) (bool, error) {
+	cacheKey := fmt.Sprintf("%s::%s", tenantApiKeyCacheKeyPrefix, tenantID)
+
+	keys := &tenantApiKeys{}
+	data, err := dao.RedisCache.Get(ctx, cacheKey).Bytes()
+	if err == nil {
+		err = json.Unmarshal(data, keys)
+	}
+	if err != nil {
+		if err != redis.Nil {
+			log.Errorf("get tenant api key cache: %v", err)
+		}
+
+		keys, err = loadTenantApiKeys(ctx, tenantID)
+		if err != nil {
+			return false, err
+		}
+		if data, err := json.Marshal(keys); err == nil {
+			dao.RedisCache.Set(ctx, cacheKey, data, tenantApiKeyCacheTTL)
+		}
+	}
+
+	hashed := hashTenantApiKey(apiKey)
+	if keys.Key != "" && keys.Key == hashed {
+		return true, nil
+	}
+
+	return keys.PrevKey != "" && keys.PrevKey == hashed && time.Now().Unix() < keys.PrevExpireAt, nil
+}
+
+// invalidateTenantApiKey 清除租户 key 的缓存, 轮换 key 或停用租户后调用
+func invalidateTenantApiKey(ctx context.Context, tenantID string) {
+	if err := dao.RedisCache.Del(ctx, fmt.Sprintf("%s::%s", tenantApiKeyCacheKeyPrefix, tenantID)).Err(); err != nil {
+		log.Errorf("delete tenant api key cache: %v", err)
+	}
+}
+
+// rotateTenantKey 生成新的 key/secret, 旧的 key/secret 在 grace 时间内仍然有效
+func rotateTenantKey(ctx context.Context, tenant *model.Tenant, grace time.Duration) (string, string, error) {
+	buf, apiKey, apiSecret, err := storage.CreateTenantKey(tenant.TenantID, tenant.Name)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := dao.RotateTenantKey(ctx, tenant.TenantID, buf, tenant.ApiKey, time.Now().Add(grace)); err != nil {
+		return "", "", err
+	}
+	invalidateTenantApiKey(ctx, tenant.TenantID)
+
+	return apiKey, apiSecret, nil
+}
+
+// tenantQuotaLimit 租户的存储空间和流量上限, 分配了套餐时以套餐为准, 套餐存储空间为 0 时使用租户原有的存储空间
+func tenantQuotaLimit(ctx context.Context, tenant *model.Tenant) (int64, int64, error) {
+	plan, err := dao.GetAssignedQuotaPlan(ctx, dao.QuotaSubjectTenant, tenant.TenantID)
+	if err == sql.ErrNoRows {
+		return tenant.StorageQuota, tenant.TrafficQuota, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	storageQuota := tenant.StorageQuota
+	if plan.StorageSize > 0 {
+		storageQuota = plan.StorageSize
+	}
+	return storageQuota, plan.MonthlyTraffic, nil
+}
+
+// checkTenantTotalFlow 判断租户所有子账户本月的下载流量是否超过上限
+func checkTenantTotalFlow(ctx context.Context, tenantID string) (bool, error) {
+	tenant, err := getTenant(ctx, tenantID)
+	if err != nil {
+		return false, err
+	}
+
+	_, trafficQuota, err := tenantQuotaLimit(ctx, tenant)
+	if err != nil {
+		return false, err
+	}
+	if trafficQuota <= 0 {
+		return true, nil
+	}
+
+	start := quotaMonthStart(time.Now())
+	key := fmt.Sprintf("%s::%s::%s", tenantTrafficCacheKeyPrefix, tenantID, start.Format("200601"))
+	traffic, err := dao.RedisCache.Get(ctx, key).Int64()
+	if err != nil {
+		if err != redis.Nil {
+			log.Errorf("get tenant traffic cache: %v", err)
+		}
+
+		usage, err := dao.GetTenantUsage(ctx, tenantID, start, time.Now())
+		if err != nil {
+			return false, err
+		}
+		traffic = usage.TotalTraffic
+		dao.RedisCache.Set(ctx, key, traffic, tenantTrafficCacheTTL)
+	}
+
+	return traffic < trafficQuota, nil
+}
+
+// checkTenantStorageQuota 判断租户所有子账户的存储空间是否足够存放 size 大小的文件
+func checkTenantStorageQuota(ctx context.Context, tenantID string, size int64) (bool, error) {
+	tenant, err := getTenant(ctx, tenantID)
+	if err != nil {
+		return false, err
+	}
+
+	storageQuota, _, err := tenantQuotaLimit(ctx, tenant)
+	if err != nil {
+		return false, err
+	}
+	if storageQuota <= 0 {
+		return true, nil
+	}
+
+	used, err := dao.GetTenantUsedStorage(ctx, tenantID)
+	if err != nil {
+		return false, err
+	}
+
+	// 未结束的上传会话预占的空间
+	reserved, err := dao.GetTenantReservedUploadSize(ctx, tenantID)
+	if err != nil {
+		return false, err
+	}
+
+	return storageQuota-used-reserved >= size, nil
+}
+
+// parseKeyGracePeriod 解析宽限期(小时), 默认 24 小时, 最长 7 天
+func parseKeyGracePeriod(hours int64) (time.Duration, error) {
+	if hours == 0 {
+		return defaultKeyGracePeriod, nil
+	}
+
+	grace := time.Duration(hours) * time.Hour
+	if hours < 0 || grace > maxKeyGracePeriod {
+		return 0, fmt.Errorf("grace_hours should be between 0 and %d", int64(maxKeyGracePeriod/time.Hour))
+	}
+
+	return grace, nil
+}
+
+// respTenantUsage 返回租户的用量报告, 默认最近30天
+func respTenantUsage(c *gin.Context, tenant *model.Tenant) {
+	end := time.Now()
+	start := end.AddDate(0, 0, -defaultUsageReportDays)
+
+	if st, err := time.Parse("2006-01-02", c.Query("start_time")); err == nil {
+		start = st
+	}
+	if et, err := time.Parse("2006-01-02", c.Query("end_time")); err == nil {
+		end = et.AddDate(0, 0, 1)
+	}
+
+	if !start.Before(end) {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	usage, err := dao.GetTenantUsage(c.Request.Context(), tenant.TenantID, start, end)
+	if err != nil {
+		log.Errorf("[TENANT][USAGE] get usage error: %s", err.Error())
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	usage.StorageQuota, usage.TrafficQuota, err = tenantQuotaLimit(c.Request.Context(), tenant)
+	if err != nil {
+		log.Errorf("[TENANT][USAGE] get quota plan error: %s", err.Error())
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+	if usage.StorageQuota > 0 {
+		usage.RemainingStorage = usage.StorageQuota - usage.UsedStorageSize
+	}
+
+	daily, err := dao.GetTenantUsageDaily(c.Request.Context(), tenant.TenantID, start, end)
+	if err != nil {
+		log.Errorf("[TENANT][USAGE] get daily usage error: %s", err.Error())
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"usage": usage,
+		"daily": daily,
+	}))
+}
+
+type CreateTenantReq struct {
+	Name            string `json:"name" binding:"required"`
+	UploadNotifyUrl string `json:"upload_notify_url"`
+	DeleteNotifyUrl string `json:"delete_notify_url"`
+	StorageQuota    int64  `json:"storage_quota"`
+	TrafficQuota    int64  `json:"traffic_quota"`
+}
+
+// CreateTenantHandler 新增租户, api_secret 只在创建时返回一次
+func CreateTenantHandler(c *gin.Context) {
+	var req CreateTenantReq
+	if err := c.ShouldBindJSON(&req); err != nil || req.StorageQuota < 0 || req.TrafficQuota < 0 {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	tenant := &model.Tenant{
+		TenantID:        uuid.NewString(),
+		Name:            req.Name,
+		State:           dao.TenantStateActive,
+		UploadNotifyUrl: req.UploadNotifyUrl,
+		DeleteNotifyUrl: req.DeleteNotifyUrl,
+		StorageQuota:    req.StorageQuota,
+		TrafficQuota:    req.TrafficQuota,
+		CreatedAt:       time.Now(),
+	}
+
+	buf, apiKey, apiSecret, err := storage.CreateTenantKey(tenant.TenantID, tenant.Name)
+	if err != nil {
+		log.Errorf("[TENANT][CREATE] create tenant key error: %s", err.Error())
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+	tenant.ApiKey = buf
+
+	SetAuditTarget(c, "tenant", tenant.TenantID)
+
+	if err := dao.CreateTenant(c.Request.Context(), tenant); err != nil {
+		log.Errorf("[TENANT][CREATE] create tenant error: %s", err.Error())
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"tenant":     tenant,
+		"api_key":    apiKey,
+		"api_secret": apiSecret,
+	}))
+}
+
+// ListTenantsHandler 获取租户列表
+func ListTenantsHandler(c *gin.Context) {
+	page, _ := strconv.Atoi(c.Query("page"))
+	size, _ := strconv.Atoi(c.Query("size"))
+
+	list, total, err := dao.ListTenants(c.Request.Context(), dao.QueryOption{Page: page, PageSize: size})
+	if err != nil {
+		log.Errorf("[TENANT][LIST] list tenants error: %s", err.Error())
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list":  list,
+		"total": total,
+	}))
+}
+
+type RotateTenantKeyReq struct {
+	TenantID   string `json:"tenant_id"`
+	GraceHours int64  `json:"grace_hours"`
+}
+
+// RotateTenantKeyHandler 管理员轮换租户的 key/secret
+func RotateTenantKeyHandler(c *gin.Context) {
+	var req RotateTenantKeyReq
+	if err := c.ShouldBindJSON(&req); err != nil || req.TenantID == "" {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	rotateKey(c, req.TenantID, req.GraceHours)
+}
+
+// TenantRotateKeyHandler 租户轮换自己的 key/secret
+func TenantRotateKeyHandler(c *gin.Context) {
+	tid := getTenantID(c)
+	if tid == "" {
+		c.JSON(http.StatusUnauthorized, respError(errors.InvalidAPPKey, fmt.Errorf("missing app_key in request")))
+		return
+	}
+
+	var req RotateTenantKeyReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	rotateKey(c, tid, req.GraceHours)
+}
+
+func rotateKey(c *gin.Context, tenantID string, graceHours int64) {
+	SetAuditTarget(c, "tenant", tenantID)
+
+	grace, err := parseKeyGracePeriod(graceHours)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(errors.InvalidParams, err))
+		return
+	}
+
+	tenant, err := getTenant(c.Request.Context(), tenantID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
+		return
+	}
+	if err != nil {
+		log.Errorf("[TENANT][ROTATE] query tenant error: %s", err.Error())
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	apiKey, apiSecret, err := rotateTenantKey(c.Request.Context(), tenant, grace)
+	if err != nil {
+		log.Errorf("[TENANT][ROTATE] rotate key error: %s", err.Error())
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"api_key":            apiKey,
+		"api_secret":         apiSecret,
+		"prev_key_expire_at": time.Now().Add(grace).Unix(),
+	}))
+}
+
+type UpdateTenantQuotaReq struct {
+	TenantID     string `json:"tenant_id"`
+	StorageQuota int64  `json:"storage_quota"`
+	TrafficQuota int64  `json:"traffic_quota"`
+}
+
+// UpdateTenantQuotaHandler 设置租户所有子账户的存储空间和每月流量上限, 0 表示不限制
+func UpdateTenantQuotaHandler(c *gin.Context) {
+	var req UpdateTenantQuotaReq
+	if err := c.ShouldBindJSON(&req); err != nil || req.TenantID == "" || req.StorageQuota < 0 || req.TrafficQuota < 0 {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	SetAuditTarget(c, "tenant", req.TenantID)
+	if before, err := getTenant(c.Request.Context(), req.TenantID); err == nil {
+		SetAuditDiff(c, JsonObject{"storage_quota": before.StorageQuota, "traffic_quota": before.TrafficQuota},
+			JsonObject{"storage_quota": req.StorageQuota, "traffic_quota": req.TrafficQuota})
+	}
+
+	if err := dao.UpdateTenantQuota(c.Request.Context(), req.TenantID, req.StorageQuota, req.TrafficQuota); err != nil {
+		log.Errorf("[TENANT][QUOTA] update quota error: %s", err.Error())
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"msg": "success",
+	}))
+}
+
+// GetTenantUsageHandler 管理员获取租户的用量报告
+func GetTenantUsageHandler(c *gin.Context) {
+	tenant, err := getTenant(c.Request.Context(), c.Query("tenant_id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
+		return
+	}
+	if err != nil {
+		log.Errorf("[TENANT][USAGE] query tenant error: %s", err.Error())
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	respTenantUsage(c, tenant)
+}
+
+// TenantUsageHandler 租户获取自己的用量报告
+func TenantUsageHandler(c *gin.Context) {
+	tid := getTenantID(c)
+	if tid == "" {
+		c.JSON(http.StatusUnauthorized, respError(errors.InvalidAPPKey, fmt.Errorf("missing app_key in request")))
+		return
+	}
+
+	tenant, err := getTenant(c.Request.Context(), tid)
+	if err != nil {
+		log.Errorf("[TENANT][USAGE] query tenant error: %s", err.Error())
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	respTenantUsage(c, tenant)
+}
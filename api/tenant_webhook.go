@@ -0,0 +1,462 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/core/opasynq"
+	"github.com/gnasnik/titan-explorer/pkg/iptool"
+	"github.com/go-redis/redis/v9"
+)
+
+const storageQuotaNotifyKeyPrefix = "TITAN::WEBHOOK::QUOTA"
+
+// storageQuotaThresholds 存储空间使用率的通知阈值(百分比)
+var storageQuotaThresholds = []int64{80, 90, 100}
+
+// webhookEvents 可订阅的租户事件
+var webhookEvents = map[string]struct{}{
+	opasynq.WebhookEventAssetSynced:  {},
+	opasynq.WebhookEventShareCreated: {},
+	opasynq.WebhookEventShareExpired: {},
+	opasynq.WebhookEventGroupCreated: {},
+	opasynq.WebhookEventGroupRenamed: {},
+	opasynq.WebhookEventGroupDeleted: {},
+	opasynq.WebhookEventUserCreated:  {},
+	opasynq.WebhookEventUserDeleted:  {},
+	opasynq.WebhookEventStorageQuota: {},
+}
+
+// WebhookAssetData 文件事件的回调内容
+type WebhookAssetData struct {
+	UserID   string   `json:"user_id"`
+	ExtraID  string   `json:"extra_id"`
+	AssetCID string   `json:"asset_cid"`
+	AreaIDs  []string `json:"area_ids"`
+}
+
+// WebhookShareData 分享链接事件的回调内容
+type WebhookShareData struct {
+	UserID    string    `json:"user_id"`
+	Cid       string    `json:"cid"` // 分享文件组时为文件组ID
+	ShortLink string    `json:"short_link"`
+	ExpireAt  time.Time `json:"expire_at"`
+}
+
+// WebhookGroupData 文件夹事件的回调内容
+type WebhookGroupData struct {
+	UserID  string `json:"user_id"`
+	GroupID int64  `json:"group_id"`
+	Name    string `json:"name"`
+	Parent  int64  `json:"parent"`
+}
+
+// WebhookUserData 子账户事件的回调内容
+type WebhookUserData struct {
+	EntryUUID string `json:"entry_uuid"`
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+}
+
+// WebhookStorageQuotaData 存储空间阈值事件的回调内容
+type WebhookStorageQuotaData struct {
+	UserID    string `json:"user_id"`
+	Threshold int64  `json:"threshold"`
+	UsedSize  int64  `json:"used_size"`
+	TotalSize int64  `json:"total_size"`
+}
+
+// PublishTenantEvent 发布租户事件, eventID 不为空时同一事件只会投递一次
+func PublishTenantEvent(ctx context.Context, tenantID, event, eventID string, data interface{}) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		log.Errorf("[TENANT][WEBHOOK] marshal %s data error: %s", event, err.Error())
+		return
+	}
+
+	err = opasynq.DefaultCli.EnqueueTenantEvent(ctx, opasynq.TenantEventPayload{
+		EventID:  eventID,
+		TenantID: tenantID,
+		Event:    event,
+		Data:     raw,
+	})
+	if err != nil {
+		log.Errorf("[TENANT][WEBHOOK] publish %s of tenant %s error: %s", event, tenantID, err.Error())
+	}
+}
+
+// PublishTenantUserEvent 发布子账户的租户事件, 非租户用户直接忽略
+func PublishTenantUserEvent(ctx context.Context, username, event, eventID string, data interface{}) {
+	user, err := dao.GetUserByUsername(ctx, username)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Errorf("[TENANT][WEBHOOK] get user %s error: %s", username, err.Error())
+		}
+		return
+	}
+
+	if user.TenantID == "" {
+		return
+	}
+
+	PublishTenantEvent(ctx, user.TenantID, event, eventID, data)
+}
+
+// notifyStorageQuota 子账户存储空间使用率越过阈值时通知租户, 每个阈值只通知一次, 使用率回落后重新计算
+func notifyStorageQuota(ctx context.Context, user *model.User) {
+	if user.TenantID == "" {
+		return
+	}
+
+	// 分配了套餐时按套餐的存储空间计算
+	limit := user.TotalStorageSize
+	if plan, _, err := getUserQuotaPlan(ctx, user); err == nil {
+		limit = userStorageLimit(user, plan)
+	} else {
+		log.Errorf("[TENANT][WEBHOOK] get quota plan of %s error: %s", user.Username, err.Error())
+	}
+	if limit <= 0 {
+		return
+	}
+
+	var level int64
+	usage := user.UsedStorageSize * 100 / limit
+	for _, t := range storageQuotaThresholds {
+		if usage >= t {
+			level = t
+		}
+	}
+
+	key := fmt.Sprintf("%s::%s", storageQuotaNotifyKeyPrefix, user.Username)
+	last, err := dao.RedisCache.Get(ctx, key).Int64()
+	if err != nil && err != redis.Nil {
+		log.Errorf("[TENANT][WEBHOOK] get quota level of %s error: %s", user.Username, err.Error())
+		return
+	}
+
+	if level == last {
+		return
+	}
+
+	if err := dao.RedisCache.Set(ctx, key, level, 0).Err(); err != nil {
+		log.Errorf("[TENANT][WEBHOOK] set quota level of %s error: %s", user.Username, err.Error())
+		return
+	}
+
+	if level < last {
+		return
+	}
+
+	PublishTenantEvent(ctx, user.TenantID, opasynq.WebhookEventStorageQuota, "", WebhookStorageQuotaData{
+		UserID:    user.Username,
+		Threshold: level,
+		UsedSize:  user.UsedStorageSize,
+		TotalSize: limit,
+	})
+}
+
+// getTenantID 获取请求中租户的ID, 非租户请求返回空
+func getTenantID(c *gin.Context) string {
+	claims := jwt.ExtractClaims(c)
+	id, _ := claims[tenantID].(string)
+	return id
+}
+
+// ListWebhookDeliveriesHandler 获取租户的回调投递记录
+func ListWebhookDeliveriesHandler(c *gin.Context) {
+	tid := getTenantID(c)
+	if tid == "" {
+		c.JSON(http.StatusUnauthorized, respError(errors.InvalidAPPKey, fmt.Errorf("missing app_key in request")))
+		return
+	}
+
+	page, _ := strconv.ParseInt(c.Query("page"), 10, 64)
+	size, _ := strconv.ParseInt(c.Query("size"), 10, 64)
+	opt := dao.QueryOption{
+		Page:      int(page),
+		PageSize:  int(size),
+		StartTime: c.Query("start_time"),
+		EndTime:   c.Query("end_time"),
+	}
+
+	list, total, err := dao.ListWebhookDeliveries(c.Request.Context(), tid, c.Query("state"), c.Query("event"), opt)
+	if err != nil {
+		log.Errorf("[TENANT][WEBHOOK] list deliveries error: %s", err.Error())
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list":  list,
+		"total": total,
+	}))
+}
+
+// GetWebhookDeliveryHandler 获取回调投递记录及每次尝试的详情
+func GetWebhookDeliveryHandler(c *gin.Context) {
+	tid := getTenantID(c)
+	if tid == "" {
+		c.JSON(http.StatusUnauthorized, respError(errors.InvalidAPPKey, fmt.Errorf("missing app_key in request")))
+		return
+	}
+
+	delivery, err := dao.GetWebhookDelivery(c.Request.Context(), tid, c.Query("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
+		return
+	}
+	if err != nil {
+		log.Errorf("[TENANT][WEBHOOK] get delivery error: %s", err.Error())
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	attempts, err := dao.ListWebhookAttempts(c.Request.Context(), delivery.ID)
+	if err != nil {
+		log.Errorf("[TENANT][WEBHOOK] list attempts error: %s", err.Error())
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"delivery": delivery,
+		"attempts": attempts,
+	}))
+}
+
+type RedeliverWebhookReq struct {
+	ID string `json:"id"`
+}
+
+// RedeliverWebhookHandler 手动重新投递回调, 新的尝试会记录在原投递记录下
+func RedeliverWebhookHandler(c *gin.Context) {
+	tid := getTenantID(c)
+	if tid == "" {
+		c.JSON(http.StatusUnauthorized, respError(errors.InvalidAPPKey, fmt.Errorf("missing app_key in request")))
+		return
+	}
+
+	var req RedeliverWebhookReq
+	if err := c.ShouldBindJSON(&req); err != nil || req.ID == "" {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	ctx := c.Request.Context()
+	delivery, err := dao.GetWebhookDelivery(ctx, tid, req.ID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
+		return
+	}
+	if err != nil {
+		log.Errorf("[TENANT][WEBHOOK] get delivery error: %s", err.Error())
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	// 先重置状态再入队, 避免覆盖很快完成的投递结果
+	if err := dao.ResetWebhookDelivery(ctx, delivery.ID); err != nil {
+		log.Errorf("[TENANT][WEBHOOK] reset delivery error: %s", err.Error())
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	switch delivery.Event {
+	case opasynq.WebhookEventAssetUploaded:
+		var payload opasynq.AssetUploadNotifyPayload
+		if err = json.Unmarshal([]byte(delivery.Payload), &payload); err == nil {
+			payload.DeliveryID = delivery.ID
+			err = opasynq.DefaultCli.EnqueueAssetUploadNotify(ctx, payload)
+		}
+	case opasynq.WebhookEventAssetDeleted:
+		var payload opasynq.AssetDeleteNotifyPayload
+		if err = json.Unmarshal([]byte(delivery.Payload), &payload); err == nil {
+			payload.DeliveryID = delivery.ID
+			err = opasynq.DefaultCli.EnqueueAssetDeleteNotify(ctx, payload)
+		}
+	default:
+		var payload opasynq.TenantWebhookPayload
+		if err = json.Unmarshal([]byte(delivery.Payload), &payload); err == nil {
+			payload.DeliveryID = delivery.ID
+			err = opasynq.DefaultCli.EnqueueTenantWebhook(ctx, payload)
+		}
+	}
+
+	if err != nil {
+		log.Errorf("[TENANT][WEBHOOK] redeliver %s error: %s", delivery.ID, err.Error())
+		if rerr := dao.RestoreWebhookDelivery(ctx, delivery); rerr != nil {
+			log.Errorf("[TENANT][WEBHOOK] restore delivery error: %s", rerr.Error())
+		}
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"msg": "success",
+	}))
+}
+
+type WebhookSubscriptionReq struct {
+	ID      int64    `json:"id"`
+	Url     string   `json:"url"`
+	Events  []string `json:"events"`
+	Enabled *bool    `json:"enabled"`
+}
+
+// toSubscription 校验订阅参数, 回调地址只允许公网地址
+func (req WebhookSubscriptionReq) toSubscription(ctx context.Context, tenantID string) (*model.TenantWebhookSubscription, error) {
+	if err := iptool.CheckPublicURL(ctx, req.Url); err != nil {
+		return nil, err
+	}
+
+	if len(req.Events) == 0 {
+		return nil, fmt.Errorf("empty events")
+	}
+
+	for _, e := range req.Events {
+		if _, ok := webhookEvents[e]; !ok && e != "*" {
+			return nil, fmt.Errorf("unsupported event %s", e)
+		}
+	}
+
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	return &model.TenantWebhookSubscription{
+		ID:       req.ID,
+		TenantID: tenantID,
+		Url:      req.Url,
+		Events:   strings.Join(req.Events, ","),
+		Enabled:  enabled,
+	}, nil
+}
+
+// ListWebhookSubscriptionsHandler 获取租户的回调订阅
+func ListWebhookSubscriptionsHandler(c *gin.Context) {
+	tid := getTenantID(c)
+	if tid == "" {
+		c.JSON(http.StatusUnauthorized, respError(errors.InvalidAPPKey, fmt.Errorf("missing app_key in request")))
+		return
+	}
+
+	list, err := dao.ListWebhookSubscriptions(c.Request.Context(), tid)
+	if err != nil {
+		log.Errorf("[TENANT][WEBHOOK] list subscriptions error: %s", err.Error())
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list": list,
+	}))
+}
+
+// CreateWebhookSubscriptionHandler 新增回调订阅, 一个租户可以配置多个回调地址
+func CreateWebhookSubscriptionHandler(c *gin.Context) {
+	tid := getTenantID(c)
+	if tid == "" {
+		c.JSON(http.StatusUnauthorized, respError(errors.InvalidAPPKey, fmt.Errorf("missing app_key in request")))
+		return
+	}
+
+	var req WebhookSubscriptionReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	sub, err := req.toSubscription(c.Request.Context(), tid)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(errors.InvalidParams, err))
+		return
+	}
+
+	if err := dao.AddWebhookSubscription(c.Request.Context(), sub); err != nil {
+		log.Errorf("[TENANT][WEBHOOK] add subscription error: %s", err.Error())
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"subscription": sub,
+	}))
+}
+
+// UpdateWebhookSubscriptionHandler 更新回调订阅
+func UpdateWebhookSubscriptionHandler(c *gin.Context) {
+	tid := getTenantID(c)
+	if tid == "" {
+		c.JSON(http.StatusUnauthorized, respError(errors.InvalidAPPKey, fmt.Errorf("missing app_key in request")))
+		return
+	}
+
+	var req WebhookSubscriptionReq
+	if err := c.ShouldBindJSON(&req); err != nil || req.ID <= 0 {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	sub, err := req.toSubscription(c.Request.Context(), tid)
+	if err != nil {
+		c.JSON(http.StatusOK, respError(errors.InvalidParams, err))
+		return
+	}
+
+	if _, err := dao.GetWebhookSubscription(c.Request.Context(), tid, req.ID); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
+			return
+		}
+		log.Errorf("[TENANT][WEBHOOK] get subscription error: %s", err.Error())
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	if err := dao.UpdateWebhookSubscription(c.Request.Context(), sub); err != nil {
+		log.Errorf("[TENANT][WEBHOOK] update subscription error: %s", err.Error())
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"subscription": sub,
+	}))
+}
+
+// DeleteWebhookSubscriptionHandler 删除回调订阅
+func DeleteWebhookSubscriptionHandler(c *gin.Context) {
+	tid := getTenantID(c)
+	if tid == "" {
+		c.JSON(http.StatusUnauthorized, respError(errors.InvalidAPPKey, fmt.Errorf("missing app_key in request")))
+		return
+	}
+
+	var req WebhookSubscriptionReq
+	if err := c.ShouldBindJSON(&req); err != nil || req.ID <= 0 {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	if err := dao.DeleteWebhookSubscription(c.Request.Context(), tid, req.ID); err != nil {
+		log.Errorf("[TENANT][WEBHOOK] delete subscription error: %s", err.Error())
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"msg": "success",
+	}))
+}
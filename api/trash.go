@@ -0,0 +1,268 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/config"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/core/opasynq"
+)
+
+// defaultTrashRetention 文件在回收站中默认保留的时间
+const defaultTrashRetention = 30 * 24 * time.Hour
+
+type trashReq struct {
+	ID int64 `json:"id" binding:"required"`
+}
+
+// trashPurgeAt 放入回收站的文件彻底删除的时间
+func trashPurgeAt() time.Time {
+	retention := config.Cfg.Trash.Retention
+	if retention <= 0 {
+		retention = defaultTrashRetention
+	}
+	return time.Now().Add(retention)
+}
+
+// PurgeTrash 彻底删除回收站中的文件或文件组, 释放存储空间并从调度器中删除不再被引用的内容
+func PurgeTrash(ctx context.Context, item *model.UserTrash) error {
+	claimed, err := dao.ClaimUserTrash(ctx, item)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return nil
+	}
+
+	switch item.ItemType {
+	case dao.TrashItemAsset:
+		err = purgeTrashAsset(ctx, item)
+	case dao.TrashItemGroup:
+		err = purgeTrashGroup(ctx, item)
+	default:
+		err = fmt.Errorf("unknown trash item type %s", item.ItemType)
+	}
+	if err != nil {
+		if e := dao.UnclaimUserTrash(ctx, item); e != nil {
+			log.Errorf("UnclaimUserTrash error: %v", e)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func purgeTrashAsset(ctx context.Context, item *model.UserTrash) error {
+	asset, err := dao.GetTrashedUserAsset(ctx, item.Hash, item.UserID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	areaIds, _, err := dao.CheckUserAseetNeedDel(ctx, item.Hash, item.UserID, nil)
+	if err != nil {
+		return err
+	}
+
+	released, err := dao.DelAssetAndUpdateSize(ctx, item.Hash, item.UserID, areaIds, true)
+	if err != nil {
+		return err
+	}
+
+	removeReleasedContents(ctx, released)
+	notifyTenantAssetDeleted(ctx, item.UserID, asset)
+	return nil
+}
+
+func purgeTrashGroup(ctx context.Context, item *model.UserTrash) error {
+	err := dao.DeleteAssetGroupAndUpdateSize(ctx, item.UserID, int(item.GroupID))
+	if err != nil {
+		return err
+	}
+
+	// 将用户对应的文件组id塞到asynq中去处理
+	opasynq.DefaultCli.EnqueueAssetGroupID(ctx, opasynq.AssetGroupPayload{UserID: item.UserID, GroupID: []int64{item.GroupID}})
+
+	PublishTenantUserEvent(ctx, item.UserID, opasynq.WebhookEventGroupDeleted, "", WebhookGroupData{UserID: item.UserID, GroupID: item.GroupID})
+	return nil
+}
+
+// notifyTenantAssetDeleted 租户子账户的文件删除后回调租户
+func notifyTenantAssetDeleted(ctx context.Context, userID string, asset *model.UserAsset) {
+	if asset == nil || asset.ExtraID == "" {
+		return
+	}
+
+	userInfo, err := dao.GetUserByUsername(ctx, userID)
+	if err != nil || userInfo == nil || userInfo.TenantID == "" {
+		log.Errorf("GetUserByUsername() error: %+v or userInfo == nil or userInfo.TenantID is empty", err)
+		return
+	}
+
+	tenantInfo, err := dao.GetTenantByBuilder(ctx, squirrel.Select("*").Where("tenant_id=?", userInfo.TenantID))
+	if err != nil || tenantInfo == nil || tenantInfo.ApiKey == nil || tenantInfo.DeleteNotifyUrl == "" {
+		log.Errorf("GetTenantByBuilder() error: %+v or  tenantInfo != nil or tenantInfo.ApiKey == nil or tenantInfo.UploadNotifyUrl is empty", err)
+		return
+	}
+
+	opasynq.DefaultCli.EnqueueAssetDeleteNotify(ctx, opasynq.AssetDeleteNotifyPayload{
+		ExtraID:  asset.ExtraID,
+		TenantID: tenantInfo.TenantID,
+		UserID:   userID,
+
+		AssetCID: asset.Cid,
+	})
+}
+
+// GetTrashListHandler 获取回收站列表
+// @Summary 获取回收站列表
+// @Security ApiKeyAuth
+// @Tags storage
+// @Param page query int false "页码"
+// @Param page_size query int false "每页数量"
+// @Success 200 {object} JsonObject "{list:[],total:0}"
+// @Router /api/v1/storage/trash/list [get]
+func GetTrashListHandler(c *gin.Context) {
+	username := jwt.ExtractClaims(c)[identityKey].(string)
+	page, _ := strconv.Atoi(c.Query("page"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	total, list, err := dao.ListUserTrash(c.Request.Context(), username, pageSize, (page-1)*pageSize)
+	if err != nil {
+		log.Errorf("ListUserTrash error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list":  list,
+		"total": total,
+	}))
+}
+
+// RestoreTrashHandler 恢复回收站中的文件或文件组到原来的文件组
+// @Summary 恢复回收站中的文件
+// @Security ApiKeyAuth
+// @Tags storage
+// @Param req body trashReq true "请求参数"
+// @Success 200 {object} JsonObject "{group_id:0}"
+// @Router /api/v1/storage/trash/restore [post]
+func RestoreTrashHandler(c *gin.Context) {
+	item, ok := getTrashItem(c)
+	if !ok {
+		return
+	}
+
+	groupID, err := dao.RestoreUserTrash(c.Request.Context(), item)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusOK, respErrorCode(errors.TrashItemNotFound, c))
+		return
+	}
+	if err != nil {
+		log.Errorf("RestoreUserTrash error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"group_id": groupID,
+	}))
+}
+
+// PurgeTrashHandler 彻底删除回收站中的文件或文件组
+// @Summary 彻底删除回收站中的文件
+// @Security ApiKeyAuth
+// @Tags storage
+// @Param req body trashReq true "请求参数"
+// @Success 200 {object} JsonObject "{msg:"success"}"
+// @Router /api/v1/storage/trash/delete [post]
+func PurgeTrashHandler(c *gin.Context) {
+	item, ok := getTrashItem(c)
+	if !ok {
+		return
+	}
+
+	if err := PurgeTrash(c.Request.Context(), item); err != nil {
+		log.Errorf("PurgeTrash error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"msg": "success",
+	}))
+}
+
+// EmptyTrashHandler 清空回收站
+// @Summary 清空回收站
+// @Security ApiKeyAuth
+// @Tags storage
+// @Success 200 {object} JsonObject "{msg:"success"}"
+// @Router /api/v1/storage/trash/empty [post]
+func EmptyTrashHandler(c *gin.Context) {
+	username := jwt.ExtractClaims(c)[identityKey].(string)
+
+	items, err := dao.ListAllUserTrash(c.Request.Context(), username)
+	if err != nil {
+		log.Errorf("ListAllUserTrash error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	SetAuditTarget(c, "trash", username)
+
+	for _, item := range items {
+		if err := PurgeTrash(c.Request.Context(), item); err != nil {
+			log.Errorf("PurgeTrash %d error: %v", item.ID, err)
+			c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"msg": "success",
+	}))
+}
+
+func getTrashItem(c *gin.Context) (*model.UserTrash, bool) {
+	username := jwt.ExtractClaims(c)[identityKey].(string)
+
+	var req trashReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return nil, false
+	}
+
+	item, err := dao.GetUserTrash(c.Request.Context(), username, req.ID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusOK, respErrorCode(errors.TrashItemNotFound, c))
+		return nil, false
+	}
+	if err != nil {
+		log.Errorf("GetUserTrash error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return nil, false
+	}
+
+	SetAuditTarget(c, "trash", item.ID)
+	SetAuditDiff(c, item, nil)
+	return item, true
+}
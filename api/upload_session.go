@@ -0,0 +1,673 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Filecoin-Titan/titan/api"
+	"github.com/Filecoin-Titan/titan/api/types"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/core/oprds"
+	"github.com/gnasnik/titan-explorer/core/storage"
+	"github.com/gnasnik/titan-explorer/pkg/iptool"
+	"github.com/google/uuid"
+)
+
+const (
+	// uploadSessionTTL 上传会话没有进展时的过期时间, 过期后释放预占的存储空间
+	uploadSessionTTL = 24 * time.Hour
+
+	defaultUploadPartSize = 16 << 20
+	maxUploadParts        = 10000
+)
+
+// uploadPendingStates 调度器中文件还未上传完成的状态
+var uploadPendingStates = []string{"SeedSelect", "SeedPulling", "SeedUploading", "SeedFailed", "UploadFailed"}
+
+type createUploadSessionReq struct {
+	AssetName string   `json:"asset_name" binding:"required"`
+	AssetCID  string   `json:"asset_cid" binding:"required"`
+	AssetType string   `json:"asset_type" binding:"required"`
+	AssetSize int64    `json:"asset_size" binding:"required"`
+	MD5       string   `json:"md5"`
+	GroupID   int64    `json:"group_id"`
+	AreaID    []string `json:"area_id"`
+	NodeID    string   `json:"node_id"`
+	ExtraID   string   `json:"extra_id"`
+	PartSize  int64    `json:"part_size"`
+	Encrypted bool     `json:"encrypted"`
+	NeedTrace bool     `json:"need_trace"`
+}
+
+type uploadSessionReq struct {
+	SessionID string `json:"session_id" binding:"required"`
+}
+
+type uploadPartReq struct {
+	SessionID  string `json:"session_id" binding:"required"`
+	PartNumber int64  `json:"part_number" binding:"required"`
+	Size       int64  `json:"size" binding:"required"`
+	MD5        string `json:"md5"`
+	AreaID     string `json:"area_id"`
+	NodeID     string `json:"node_id"`
+}
+
+// CreateUploadSessionHandler 创建可续传的上传会话
+// @Summary 创建上传会话
+// @Description 创建上传会话并预占存储空间, 返回上传地址; 调度器确认文件后需调用 commit 才会写入用户文件
+// @Security ApiKeyAuth
+// @Tags storage
+// @Param req body createUploadSessionReq true "请求参数"
+// @Success 200 {object} JsonObject "{session:{},uploads:[]}"
+// @Router /api/v1/storage/upload_session/create [post]
+func CreateUploadSessionHandler(c *gin.Context) {
+	var (
+		claims   = jwt.ExtractClaims(c)
+		username = claims[identityKey].(string)
+		req      createUploadSessionReq
+		password string
+	)
+
+	if err := c.ShouldBindJSON(&req); err != nil || req.AssetSize <= 0 || req.PartSize < 0 {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	partSize := req.PartSize
+	if partSize == 0 {
+		partSize = defaultUploadPartSize
+	}
+	partCount := (req.AssetSize + partSize - 1) / partSize
+	if partCount > maxUploadParts {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	areaIds := getAreaIDsByArea(c, req.AreaID)
+	if len(areaIds) == 0 {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	user, err := dao.GetUserByUsername(c.Request.Context(), username)
+	switch err {
+	case sql.ErrNoRows:
+		c.JSON(http.StatusOK, respErrorCode(errors.UserNotFound, c))
+		return
+	case nil:
+	default:
+		log.Errorf("CreateUploadSessionHandler GetUserByUsername error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	hash, err := storage.CIDToHash(req.AssetCID)
+	if err != nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	notExistsAids, err := dao.GetUserAssetNotAreaIDs(c.Request.Context(), hash, username, areaIds)
+	if err != nil {
+		log.Errorf("CreateUploadSessionHandler GetUserAssetNotAreaIDs error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+	if len(notExistsAids) == 0 {
+		c.JSON(http.StatusOK, respErrorCode(errors.FileExists, c))
+		return
+	}
+
+	code, err := checkUserUploadQuota(c.Request.Context(), user, req.AssetSize)
+	if err != nil {
+		log.Errorf("CreateUploadSessionHandler checkUserUploadQuota error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+	if code != 0 {
+		c.JSON(http.StatusOK, respErrorCode(code, c))
+		return
+	}
+
+	if req.Encrypted {
+		passKey := fmt.Sprintf(FileUploadPassKey, username)
+		password = dao.RedisCache.Get(c.Request.Context(), passKey).Val()
+		if password == "" {
+			log.Error("CreateUploadSessionHandler randomPassNonce not found")
+			c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+			return
+		}
+		dao.RedisCache.Del(c.Request.Context(), passKey)
+	}
+
+	var traceID string
+	if req.NeedTrace {
+		traceID, err = dao.NewLogTrace(c.Request.Context(), username, dao.AssetTransferTypeUpload, areaIds[0])
+		if err != nil {
+			log.Errorf("CreateUploadSessionHandler NewLogTrace error: %v", err)
+			c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+			return
+		}
+	}
+
+	now := time.Now()
+	session := &model.UploadSession{
+		ID:        uuid.NewString(),
+		UserID:    username,
+		TenantID:  user.TenantID,
+		AssetCID:  req.AssetCID,
+		Hash:      hash,
+		AssetName: req.AssetName,
+		AssetType: req.AssetType,
+		AssetSize: req.AssetSize,
+		MD5:       req.MD5,
+		GroupID:   req.GroupID,
+		ExtraID:   req.ExtraID,
+		Password:  password,
+		AreaIDs:   strings.Join(areaIds, ","),
+		NodeID:    req.NodeID,
+		TraceID:   traceID,
+		ClientIP:  iptool.GetClientIP(c.Request),
+		PartSize:  partSize,
+		PartCount: partCount,
+		State:     dao.UploadSessionStateUploading,
+		ExpireAt:  now.Add(uploadSessionTTL),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	uploads, err := requestUploadAddresses(c.Request.Context(), session)
+	if err != nil {
+		log.Errorf("CreateUploadSessionHandler requestUploadAddresses error: %v", err)
+		respUploadSchedulerError(c, err)
+		return
+	}
+
+	code, err = reserveUploadSession(c.Request.Context(), session)
+	if err != nil {
+		log.Errorf("CreateUploadSessionHandler reserveUploadSession error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+	if code != 0 {
+		c.JSON(http.StatusOK, respErrorCode(code, c))
+		return
+	}
+
+	SetAuditTarget(c, "upload_session", session.ID)
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"session": session,
+		"uploads": uploads,
+	}))
+}
+
+// reserveUploadSession 锁定用户后重新检查套餐并新建上传会话, 存储空间在会话创建时预占, 空间不足时返回错误码
+func reserveUploadSession(ctx context.Context, session *model.UploadSession) (int, error) {
+	return dao.CreateUploadSessionWithLock(ctx, session, func() (int, error) {
+		// 已用空间可能被其他请求修改, 加锁后重新读取
+		user, err := dao.GetUserByUsername(ctx, session.UserID)
+		if err != nil {
+			return 0, err
+		}
+		return checkUserUploadQuota(ctx, user, session.AssetSize)
+	})
+}
+
+// GetUploadSessionHandler 获取上传会话的进度
+// @Summary 获取上传会话
+// @Security ApiKeyAuth
+// @Tags storage
+// @Param session_id query string true "上传会话ID"
+// @Success 200 {object} JsonObject "{session:{},parts:[],missing_parts:[],progress:0}"
+// @Router /api/v1/storage/upload_session/info [get]
+func GetUploadSessionHandler(c *gin.Context) {
+	username := jwt.ExtractClaims(c)[identityKey].(string)
+
+	session, ok := getUploadSession(c, username, c.Query("session_id"))
+	if !ok {
+		return
+	}
+
+	respUploadSession(c, session, nil)
+}
+
+// ListUploadSessionsHandler 获取用户未结束的上传会话
+// @Summary 获取未结束的上传会话
+// @Security ApiKeyAuth
+// @Tags storage
+// @Success 200 {object} JsonObject "{list:[]}"
+// @Router /api/v1/storage/upload_session/list [get]
+func ListUploadSessionsHandler(c *gin.Context) {
+	username := jwt.ExtractClaims(c)[identityKey].(string)
+
+	list, err := dao.ListActiveUploadSessions(c.Request.Context(), username)
+	if err != nil {
+		log.Errorf("ListActiveUploadSessions error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list": list,
+	}))
+}
+
+// ResumeUploadSessionHandler 恢复上传, 重新获取上传地址并延长会话的过期时间
+// @Summary 恢复上传会话
+// @Security ApiKeyAuth
+// @Tags storage
+// @Param req body uploadSessionReq true "请求参数"
+// @Success 200 {object} JsonObject "{session:{},parts:[],missing_parts:[],progress:0,uploads:[]}"
+// @Router /api/v1/storage/upload_session/resume [post]
+func ResumeUploadSessionHandler(c *gin.Context) {
+	username := jwt.ExtractClaims(c)[identityKey].(string)
+
+	var req uploadSessionReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	SetAuditTarget(c, "upload_session", req.SessionID)
+
+	session, ok := getActiveUploadSession(c, username, req.SessionID)
+	if !ok {
+		return
+	}
+
+	uploads, err := requestUploadAddresses(c.Request.Context(), session)
+	if err != nil {
+		log.Errorf("ResumeUploadSessionHandler requestUploadAddresses error: %v", err)
+		respUploadSchedulerError(c, err)
+		return
+	}
+
+	session.ExpireAt = time.Now().Add(uploadSessionTTL)
+	if err := dao.TouchUploadSession(c.Request.Context(), session.ID, session.ExpireAt); err != nil {
+		log.Errorf("TouchUploadSession error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	respUploadSession(c, session, uploads)
+}
+
+// ReportUploadPartHandler 上报已上传的分片及接收的区域和节点
+// @Summary 上报上传分片
+// @Security ApiKeyAuth
+// @Tags storage
+// @Param req body uploadPartReq true "请求参数"
+// @Success 200 {object} JsonObject "{session:{},parts:[],missing_parts:[],progress:0}"
+// @Router /api/v1/storage/upload_session/part [post]
+func ReportUploadPartHandler(c *gin.Context) {
+	username := jwt.ExtractClaims(c)[identityKey].(string)
+
+	var req uploadPartReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	SetAuditTarget(c, "upload_session", req.SessionID)
+
+	session, ok := getActiveUploadSession(c, username, req.SessionID)
+	if !ok {
+		return
+	}
+
+	if req.PartNumber < 1 || req.PartNumber > session.PartCount || req.Size <= 0 || req.Size > session.PartSize {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	areaID := req.AreaID
+	if areaID == "" {
+		areaID = session.Areas()[0]
+	}
+
+	err := dao.AddUploadSessionPart(c.Request.Context(), &model.UploadSessionPart{
+		SessionID:  session.ID,
+		PartNumber: req.PartNumber,
+		Size:       req.Size,
+		MD5:        req.MD5,
+		AreaID:     areaID,
+		NodeID:     req.NodeID,
+		CreatedAt:  time.Now(),
+	}, time.Now().Add(uploadSessionTTL))
+	if err != nil {
+		log.Errorf("AddUploadSessionPart error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	session, ok = getUploadSession(c, username, session.ID)
+	if !ok {
+		return
+	}
+
+	respUploadSession(c, session, nil)
+}
+
+// CommitUploadSessionHandler 调度器确认文件上传完成后, 把上传会话写入用户文件
+// @Summary 提交上传会话
+// @Security ApiKeyAuth
+// @Tags storage
+// @Param req body uploadSessionReq true "请求参数"
+// @Success 200 {object} JsonObject "{session:{}}"
+// @Router /api/v1/storage/upload_session/commit [post]
+func CommitUploadSessionHandler(c *gin.Context) {
+	username := jwt.ExtractClaims(c)[identityKey].(string)
+
+	var req uploadSessionReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	SetAuditTarget(c, "upload_session", req.SessionID)
+
+	session, ok := getActiveUploadSession(c, username, req.SessionID)
+	if !ok {
+		return
+	}
+
+	areaIds := session.Areas()
+	confirmed, err := confirmUploadedAsset(c.Request.Context(), areaIds[0], session.AssetCID)
+	if err != nil {
+		log.Errorf("CommitUploadSessionHandler confirmUploadedAsset error: %v", err)
+		respUploadSchedulerError(c, err)
+		return
+	}
+	if !confirmed {
+		c.JSON(http.StatusOK, respErrorCode(errors.UploadNotConfirmed, c))
+		return
+	}
+
+	added, err := commitUploadSession(c.Request.Context(), username, session)
+	if err == errUploadSessionFinished {
+		// 并发提交时另一个请求已经写入了文件
+		if current, ok := getUploadSession(c, username, session.ID); ok {
+			if current.State != dao.UploadSessionStateCommitted {
+				c.JSON(http.StatusOK, respErrorCode(errors.UploadSessionExpired, c))
+				return
+			}
+			c.JSON(http.StatusOK, respJSON(JsonObject{
+				"session": current,
+			}))
+		}
+		return
+	}
+	if err != nil {
+		log.Errorf("CommitUploadSessionHandler commitUploadSession error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	if added {
+		err = oprds.GetClient().PushSchedulerInfo(c.Request.Context(), &oprds.Payload{UserID: username, CID: session.AssetCID, Hash: session.Hash, AreaID: areaIds[0], Owner: username})
+		if err != nil {
+			log.Errorf("PushSchedulerInfo error: %v", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"session": session,
+	}))
+}
+
+// errUploadSessionFinished 会话已被并发提交, 取消或过期
+var errUploadSessionFinished = fmt.Errorf("upload session is finished")
+
+// commitUploadSession 先把会话修改为已提交再写入用户文件, 并发提交时只有一个请求会写入文件并计入已使用空间;
+// 写入失败时恢复会话以便重试. 返回是否写入了新的文件
+func commitUploadSession(ctx context.Context, username string, session *model.UploadSession) (bool, error) {
+	areaIds := session.Areas()
+	notExistsAids, err := dao.GetUserAssetNotAreaIDs(ctx, session.Hash, username, areaIds)
+	if err != nil {
+		return false, err
+	}
+
+	finished, err := dao.FinishUploadSession(ctx, session.ID, dao.UploadSessionStateCommitted)
+	if err != nil {
+		return false, err
+	}
+	if !finished {
+		return false, errUploadSessionFinished
+	}
+	session.State = dao.UploadSessionStateCommitted
+
+	if len(notExistsAids) == 0 {
+		return false, nil
+	}
+
+	err = dao.AddAssetAndUpdateSize(ctx, &model.UserAsset{
+		UserID:      username,
+		Hash:        session.Hash,
+		Cid:         session.AssetCID,
+		AssetName:   session.AssetName,
+		AssetType:   session.AssetType,
+		CreatedTime: time.Now(),
+		TotalSize:   session.AssetSize,
+		Password:    session.Password,
+		GroupID:     session.GroupID,
+		MD5:         session.MD5,
+		ExtraID:     session.ExtraID,
+		ClientIP:    session.ClientIP,
+	}, notExistsAids, areaIds[0])
+	if err != nil {
+		if rerr := dao.ReopenUploadSession(ctx, session.ID); rerr != nil {
+			log.Errorf("ReopenUploadSession %s error: %v", session.ID, rerr)
+		}
+		session.State = dao.UploadSessionStateUploading
+		return false, err
+	}
+
+	return true, nil
+}
+
+// AbortUploadSessionHandler 取消上传会话并释放预占的存储空间
+// @Summary 取消上传会话
+// @Security ApiKeyAuth
+// @Tags storage
+// @Param req body uploadSessionReq true "请求参数"
+// @Success 200 {object} JsonObject "{}"
+// @Router /api/v1/storage/upload_session/abort [post]
+func AbortUploadSessionHandler(c *gin.Context) {
+	username := jwt.ExtractClaims(c)[identityKey].(string)
+
+	var req uploadSessionReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	SetAuditTarget(c, "upload_session", req.SessionID)
+
+	session, ok := getActiveUploadSession(c, username, req.SessionID)
+	if !ok {
+		return
+	}
+
+	finished, err := dao.FinishUploadSession(c.Request.Context(), session.ID, dao.UploadSessionStateAborted)
+	if err != nil {
+		log.Errorf("FinishUploadSession error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+	if !finished {
+		c.JSON(http.StatusOK, respErrorCode(errors.UploadSessionExpired, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(nil))
+}
+
+func getUploadSession(c *gin.Context, username, sessionID string) (*model.UploadSession, bool) {
+	if sessionID == "" {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return nil, false
+	}
+
+	session, err := dao.GetUploadSession(c.Request.Context(), sessionID, username)
+	switch err {
+	case sql.ErrNoRows:
+		c.JSON(http.StatusOK, respErrorCode(errors.UploadSessionNotFound, c))
+		return nil, false
+	case nil:
+		return session, true
+	default:
+		log.Errorf("GetUploadSession error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return nil, false
+	}
+}
+
+// getActiveUploadSession 获取上传中的会话, 会话已结束或已过期时返回错误
+func getActiveUploadSession(c *gin.Context, username, sessionID string) (*model.UploadSession, bool) {
+	session, ok := getUploadSession(c, username, sessionID)
+	if !ok {
+		return nil, false
+	}
+
+	if session.State != dao.UploadSessionStateUploading || !time.Now().Before(session.ExpireAt) {
+		c.JSON(http.StatusOK, respErrorCode(errors.UploadSessionExpired, c))
+		return nil, false
+	}
+
+	return session, true
+}
+
+// respUploadSession 返回上传会话, 已上传的分片和缺少的分片
+func respUploadSession(c *gin.Context, session *model.UploadSession, uploads []JsonObject) {
+	parts, err := dao.GetUploadSessionParts(c.Request.Context(), session.ID)
+	if err != nil {
+		log.Errorf("GetUploadSessionParts error: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	uploaded := make(map[int64]bool, len(parts))
+	for _, p := range parts {
+		uploaded[p.PartNumber] = true
+	}
+
+	missing := make([]int64, 0)
+	for i := int64(1); i <= session.PartCount; i++ {
+		if !uploaded[i] {
+			missing = append(missing, i)
+		}
+	}
+
+	var progress float64
+	if session.AssetSize > 0 {
+		progress = float64(session.UploadedSize) / float64(session.AssetSize)
+	}
+	if progress > 1 {
+		progress = 1
+	}
+
+	resp := JsonObject{
+		"session":       session,
+		"parts":         parts,
+		"missing_parts": missing,
+		"progress":      progress,
+	}
+	if uploads != nil {
+		resp["uploads"] = uploads
+	}
+
+	c.JSON(http.StatusOK, respJSON(resp))
+}
+
+// requestUploadAddresses 向调度器申请上传地址, 文件已存在于调度器时返回空列表
+func requestUploadAddresses(ctx context.Context, session *model.UploadSession) ([]JsonObject, error) {
+	areaID := session.Areas()[0]
+	uploads := make([]JsonObject, 0)
+
+	if dao.ContentAvailable(ctx, session.Hash, areaID) {
+		return uploads, nil
+	}
+
+	schedulerClient, err := getSchedulerClient(ctx, areaID)
+	if err != nil {
+		return nil, err
+	}
+
+	rsp, err := schedulerClient.CreateAsset(ctx, &types.CreateAssetReq{
+		UserID:        session.UserID,
+		AssetCID:      session.AssetCID,
+		AssetSize:     session.AssetSize,
+		NodeID:        session.NodeID,
+		Owner:         session.UserID,
+		TraceID:       session.TraceID,
+		ExpirationDay: 4 * 365,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if rsp.AlreadyExists {
+		return uploads, nil
+	}
+
+	for _, v := range rsp.List {
+		uploads = append(uploads, JsonObject{"CandidateAddr": v.UploadURL, "Token": v.Token, "TraceID": session.TraceID, "AreaID": areaID})
+	}
+
+	return uploads, nil
+}
+
+// confirmUploadedAsset 调度器中存在文件记录, 且已经过了上传阶段时视为上传完成
+func confirmUploadedAsset(ctx context.Context, areaID, cid string) (bool, error) {
+	schedulerClient, err := getSchedulerClient(ctx, areaID)
+	if err != nil {
+		return false, err
+	}
+
+	record, err := schedulerClient.GetAssetRecord(ctx, cid)
+	if err != nil {
+		return false, fmt.Errorf("get asset record %s from %s: %w", cid, areaID, err)
+	}
+
+	for _, state := range uploadPendingStates {
+		if strings.EqualFold(record.State, state) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func respUploadSchedulerError(c *gin.Context, err error) {
+	if webErr, ok := err.(*api.ErrWeb); ok {
+		c.JSON(http.StatusOK, respErrorCode(webErr.Code, c))
+		return
+	}
+	c.JSON(http.StatusOK, respErrorCode(errors.NoSchedulerFound, c))
+}
+
+// checkUserStorageQuota 判断用户剩余的存储空间是否足够, 未结束的上传会话预占的空间也计入已使用; 租户子账户按租户的上限判断, 单独分配了套餐的子账户还要按自己的套餐判断
+func checkUserStorageQuota(ctx context.Context, user *model.User, plan *model.QuotaPlan, source string, size int64) (bool, error) {
+	if user.TenantID != "" {
+		enough, err := checkTenantStorageQuota(ctx, user.TenantID, size)
+		if err != nil || !enough || !quotaPerUser(user, source) {
+			return enough, err
+		}
+	}
+
+	reserved, err := dao.GetUserReservedUploadSize(ctx, user.Username)
+	if err != nil {
+		return false, err
+	}
+
+	return userStorageLimit(user, plan)-user.UsedStorageSize-reserved >= size, nil
+}
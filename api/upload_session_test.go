@@ -0,0 +1,199 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Filecoin-Titan/titan/api/types"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/dao/daotest"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/core/scheduler"
+	"github.com/gnasnik/titan-explorer/core/scheduler/schedulertest"
+)
+
+const testUploadCID = "bafybeic6sx6kvnndanrzlddltcpw7nerjfkahfxzj536die4nmojwlnmqi"
+
+func TestConfirmUploadedAsset(t *testing.T) {
+	ctx := context.Background()
+
+	fake := schedulertest.New(scheduler.DefaultAreaId)
+	restore := schedulertest.Install(fake)
+	defer restore()
+
+	fake.AddAsset(&types.AssetRecord{CID: testUploadCID, State: "SeedUploading"})
+	if ok, err := confirmUploadedAsset(ctx, scheduler.DefaultAreaId, testUploadCID); err != nil || ok {
+		t.Fatalf("uploading asset should not be confirmed, got %v %v", ok, err)
+	}
+
+	fake.AddAsset(&types.AssetRecord{CID: testUploadCID, State: "Servicing"})
+	// 没有配置调度器的区域回退到默认区域的离线调度器
+	if ok, err := confirmUploadedAsset(ctx, "Europe-Germany", testUploadCID); err != nil || !ok {
+		t.Fatalf("uploaded asset should be confirmed, got %v %v", ok, err)
+	}
+
+	if fake.Calls("GetAssetRecord") != 2 {
+		t.Fatalf("expected 2 calls to the fake scheduler, got %d", fake.Calls("GetAssetRecord"))
+	}
+}
+
+func TestConfirmUploadedAssetError(t *testing.T) {
+	fake := schedulertest.New(scheduler.DefaultAreaId)
+	restore := schedulertest.Install(fake)
+	defer restore()
+
+	fake.FailOn("GetAssetRecord", errors.New("scheduler offline"))
+	if ok, err := confirmUploadedAsset(context.Background(), scheduler.DefaultAreaId, testUploadCID); err == nil || ok {
+		t.Fatalf("scheduler error should be returned, got %v %v", ok, err)
+	}
+}
+
+func TestCommitUploadSessionConcurrently(t *testing.T) {
+	db := daotest.Open(t)
+	ctx := context.Background()
+
+	const (
+		username  = "upload_session_test_user"
+		hash      = "upload_session_test_hash"
+		sessionID = "upload_session_test_id"
+		size      = 1024
+	)
+	cleanup := func() {
+		daotest.Exec(t, db, `DELETE FROM users WHERE username = ?`, username)
+		daotest.Exec(t, db, `DELETE FROM upload_session WHERE id = ?`, sessionID)
+		daotest.Exec(t, db, `DELETE FROM user_asset WHERE user_id = ?`, username)
+		daotest.Exec(t, db, `DELETE FROM user_asset_area WHERE user_id = ?`, username)
+		daotest.Exec(t, db, `DELETE FROM user_asset_map WHERE user_id = ?`, username)
+		daotest.Exec(t, db, `DELETE FROM content WHERE hash = ?`, hash)
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+
+	daotest.Exec(t, db, `INSERT INTO users (username, used_storage_size) VALUES (?, 0)`, username)
+	now := time.Now()
+	err := dao.CreateUploadSession(ctx, &model.UploadSession{
+		ID: sessionID, UserID: username, AssetCID: testUploadCID, Hash: hash, AssetName: "a.txt", AssetSize: size,
+		AreaIDs: scheduler.DefaultAreaId, State: dao.UploadSessionStateUploading, ExpireAt: now.Add(time.Hour), CreatedAt: now, UpdatedAt: now,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		added int
+	)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			session, err := dao.GetUploadSession(ctx, sessionID, username)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			ok, err := commitUploadSession(ctx, username, session)
+			if err != nil && err != errUploadSessionFinished {
+				t.Error(err)
+				return
+			}
+			if ok {
+				mu.Lock()
+				added++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if added != 1 {
+		t.Fatalf("expect the asset to be added once, got %d", added)
+	}
+
+	var assets, used int64
+	if err := db.Get(&assets, `SELECT COUNT(*) FROM user_asset WHERE user_id = ?`, username); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Get(&used, `SELECT used_storage_size FROM users WHERE username = ?`, username); err != nil {
+		t.Fatal(err)
+	}
+	if assets != 1 || used != size {
+		t.Fatalf("expect 1 asset and %d bytes used, got %d and %d", size, assets, used)
+	}
+
+	session, err := dao.GetUploadSession(ctx, sessionID, username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.State != dao.UploadSessionStateCommitted {
+		t.Fatalf("expect session committed, got %s", session.State)
+	}
+}
+
+func TestReserveUploadSessionConcurrently(t *testing.T) {
+	db := daotest.Open(t)
+	ctx := context.Background()
+
+	const (
+		username = "upload_reserve_test_user"
+		size     = 1000
+	)
+	cleanup := func() {
+		daotest.Exec(t, db, `DELETE FROM users WHERE username = ?`, username)
+		daotest.Exec(t, db, `DELETE FROM upload_session WHERE user_id = ?`, username)
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+
+	// 存储空间只够一个会话预占
+	daotest.Exec(t, db, `INSERT INTO users (username, used_storage_size, total_storage_size) VALUES (?, 0, ?)`, username, size*3/2)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		created  int
+		rejected int
+	)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			now := time.Now()
+			code, err := reserveUploadSession(ctx, &model.UploadSession{
+				ID: fmt.Sprintf("upload_reserve_test_%d", i), UserID: username, AssetCID: testUploadCID, Hash: fmt.Sprintf("upload_reserve_test_hash_%d", i),
+				AssetName: "a.txt", AssetSize: size, AreaIDs: scheduler.DefaultAreaId, State: dao.UploadSessionStateUploading,
+				ExpireAt: now.Add(time.Hour), CreatedAt: now, UpdatedAt: now,
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if code == 0 {
+				created++
+			} else {
+				rejected++
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if created != 1 || rejected != 3 {
+		t.Fatalf("expect 1 session created and 3 rejected, got %d and %d", created, rejected)
+	}
+
+	reserved, err := dao.GetUserReservedUploadSize(ctx, username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reserved != size {
+		t.Fatalf("expect %d bytes reserved, got %d", size, reserved)
+	}
+}
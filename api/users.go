@@ -1464,6 +1464,8 @@ func BatchDelHandler(c *gin.Context) {
 
 	}
 
+	SetAuditTarget(c, "batch_edge", mac)
+
 	_, err := dao.RedisCache.ZRem(c.Request.Context(), BatchUrlZsetKey, mac).Result()
 	if err != nil {
 		log.Errorf("Failed to remove %s: %v", mac, err)
@@ -1498,6 +1500,9 @@ func BatchAddressSetHandler(c *gin.Context) {
 	}
 
 	address.AddTime = time.Now()
+	SetAuditTarget(c, "batch_address", address.Url)
+	SetAuditDiff(c, nil, address)
+
 	data, err := json.Marshal(address)
 	if err != nil {
 		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
@@ -1553,6 +1558,7 @@ func BatchAddressDelHandler(c *gin.Context) {
 		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
 		return
 	}
+	SetAuditTarget(c, "batch_address", url)
 
 	// 开始事务删除
 	_, err := dao.RedisCache.TxPipelined(c.Request.Context(), func(pipe redis.Pipeliner) error {
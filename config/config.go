@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 var Cfg Config
 
 type Config struct {
@@ -15,6 +17,11 @@ type Config struct {
 	EligibleOnlineMinutes    int
 	ResourcePath             string
 	Statistic                StatisticsConfig
+	SchedulerRegistry        SchedulerRegistryConfig
+	Trash                    TrashConfig
+	GroupPublish             GroupPublishConfig
+	NodeAlert                NodeAlertConfig
+	RewardReconcile          RewardReconcileConfig
 	Emails                   []EmailConfig
 	IpDataCloud              IpDataCloudConfig
 	Epoch                    EpochConfig
@@ -23,6 +30,8 @@ type Config struct {
 	Oss                      OssConfig
 	Locators                 []string
 	BaseURL                  string
+	// ShareLinkSecret 分享短链接的签名密钥, 为空时使用 SecretKey
+	ShareLinkSecret string
 
 	KubesphereAPI KubesphereAPIConfig
 	ChainAPI      ChainAPIConfig
@@ -40,6 +49,50 @@ type EmailConfig struct {
 type StatisticsConfig struct {
 	Disable bool
 	Crontab string
+	// Fetchers 按名称覆盖各个数据拉取任务的默认参数, 如 node, asset
+	Fetchers map[string]FetcherConfig
+}
+
+// FetcherConfig holds the schedule settings of a single statistics fetcher.
+type FetcherConfig struct {
+	Disable     bool
+	Crontab     string
+	Timeout     time.Duration
+	Concurrency int
+}
+
+// SchedulerRegistryConfig holds the health check settings of scheduler clients.
+type SchedulerRegistryConfig struct {
+	ProbeInterval time.Duration
+	ProbeTimeout  time.Duration
+	MaxFailures   int
+}
+
+// TrashConfig holds the settings of the user trash bin.
+type TrashConfig struct {
+	// Retention 文件在回收站中保留的时间, 到期后彻底删除, 默认 30 天
+	Retention time.Duration
+}
+
+// GroupPublishConfig holds the settings of publishing asset groups.
+type GroupPublishConfig struct {
+	// MaxSize 发布文件组的总大小上限, 单位字节, 发布时需要生成同样大小的临时 CAR 文件, 默认 10GB
+	MaxSize int64
+}
+
+// NodeAlertConfig holds the settings of node offline alerting.
+type NodeAlertConfig struct {
+	Disable bool
+	// OfflineWindow 新建告警规则时默认的长时间离线告警时长, 默认 30 分钟
+	OfflineWindow time.Duration
+	// DedupWindow 新建告警规则时默认的同类告警最短间隔, 默认 1 小时
+	DedupWindow time.Duration
+}
+
+// RewardReconcileConfig holds the settings of reconciling node earnings with schedulers.
+type RewardReconcileConfig struct {
+	// Tolerance 调度器的累计收益与每日收益之和的差值超过该值时记录为差异, 默认 0.01
+	Tolerance float64
 }
 
 type AdminSchedulerConfig struct {
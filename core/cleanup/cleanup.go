@@ -12,6 +12,8 @@ var log = logging.Logger("cleanup")
 
 var (
 	cleanupInterval = time.Minute * 60
+	// maxRetainForUptime 节点可用性统计落后时最多保留 device_info_hour 的时间
+	maxRetainForUptime = time.Hour * 24 * 7
 )
 
 func Run(ctx context.Context) {
@@ -29,7 +31,7 @@ func Run(ctx context.Context) {
 
 			isRunning = true
 
-			deleteFrom := carbon.Now().SubDays(2).StdTime()
+			deleteFrom := uptimeSafeDeleteFrom(ctx, carbon.Now().SubDays(2).StdTime())
 			if err := cleanUpDeviceInfoHour(ctx, deleteFrom); err != nil {
 				log.Errorf("cleanUpDeviceInfoHour: %v", err)
 			}
@@ -41,6 +43,22 @@ func Run(ctx context.Context) {
 	}
 }
 
+// uptimeSafeDeleteFrom 节点可用性还没有统计的数据暂不清理, 最多保留 maxRetainForUptime
+func uptimeSafeDeleteFrom(ctx context.Context, deleteFrom time.Time) time.Time {
+	rolledTo, err := dao.GetNodeUptimeRolledTo(ctx)
+	if err != nil {
+		log.Errorf("GetNodeUptimeRolledTo: %v", err)
+		return deleteFrom
+	}
+
+	// 保留统计时用作起点的前一条数据
+	keepFrom := rolledTo.Add(-time.Hour)
+	if keepFrom.Before(deleteFrom) && time.Since(keepFrom) < maxRetainForUptime {
+		return keepFrom
+	}
+	return deleteFrom
+}
+
 func cleanUpDeviceInfoHour(ctx context.Context, before time.Time) error {
 	query := "select ifnull(max(id),0) from device_info_hour where created_at < ?"
 
@@ -0,0 +1,167 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+)
+
+const (
+	tableNameAssetBatchJob  = "asset_batch_job"
+	tableNameAssetBatchItem = "asset_batch_item"
+)
+
+const (
+	AssetBatchStatePending = "pending"
+	AssetBatchStateRunning = "running"
+	AssetBatchStateDone    = "done"
+	AssetBatchStateSuccess = "success"
+	AssetBatchStateFailed  = "failed"
+
+	AssetBatchItemAsset = "asset"
+	AssetBatchItemGroup = "group"
+)
+
+// CreateAssetBatchJob 新建批量任务及其中的每一项
+func CreateAssetBatchJob(ctx context.Context, job *model.AssetBatchJob, items []*model.AssetBatchItem) error {
+	tx, err := DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.NamedExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (id, user_id, operation, params, state, total, created_at, updated_at)
+		VALUES (:id, :user_id, :operation, :params, :state, :total, :created_at, :updated_at)`, tableNameAssetBatchJob,
+	), job)
+	if err != nil {
+		return err
+	}
+
+	ib := squirrel.Insert(tableNameAssetBatchItem).Columns("job_id", "item_type", "target", "state", "updated_at")
+	for _, item := range items {
+		ib = ib.Values(job.ID, item.ItemType, item.Target, AssetBatchStatePending, job.CreatedAt)
+	}
+	query, args, err := ib.ToSql()
+	if err != nil {
+		return fmt.Errorf("generate insert batch items sql error:%w", err)
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetAssetBatchJob 获取批量任务, userID 为空时不校验所属用户
+func GetAssetBatchJob(ctx context.Context, id, userID string) (*model.AssetBatchJob, error) {
+	sb := squirrel.Select("*").From(tableNameAssetBatchJob).Where("id = ?", id)
+	if userID != "" {
+		sb = sb.Where("user_id = ?", userID)
+	}
+	query, args, err := sb.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("generate get batch job sql error:%w", err)
+	}
+
+	var out model.AssetBatchJob
+	if err := DB.GetContext(ctx, &out, query, args...); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListAssetBatchJobs 获取用户的批量任务, 按创建时间倒序
+func ListAssetBatchJobs(ctx context.Context, userID string, limit, offset int) (int64, []*model.AssetBatchJob, error) {
+	var total int64
+	if err := DB.GetContext(ctx, &total, fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE user_id = ?`, tableNameAssetBatchJob), userID); err != nil {
+		return 0, nil, err
+	}
+
+	var out []*model.AssetBatchJob
+	err := DB.SelectContext(ctx, &out, fmt.Sprintf(
+		`SELECT * FROM %s WHERE user_id = ? ORDER BY created_at DESC LIMIT ? OFFSET ?`, tableNameAssetBatchJob,
+	), userID, limit, offset)
+	return total, out, err
+}
+
+// ListAssetBatchItems 获取批量任务中的项, state 为空时返回所有状态
+func ListAssetBatchItems(ctx context.Context, jobID, state string, limit, offset int) (int64, []*model.AssetBatchItem, error) {
+	sb := squirrel.Select().From(tableNameAssetBatchItem).Where("job_id = ?", jobID)
+	if state != "" {
+		sb = sb.Where("state = ?", state)
+	}
+
+	var total int64
+	query, args, err := sb.Columns("COUNT(*)").ToSql()
+	if err != nil {
+		return 0, nil, fmt.Errorf("generate count batch items sql error:%w", err)
+	}
+	if err := DB.GetContext(ctx, &total, query, args...); err != nil {
+		return 0, nil, err
+	}
+
+	var out []*model.AssetBatchItem
+	query, args, err = sb.Columns("*").OrderBy("id").Limit(uint64(limit)).Offset(uint64(offset)).ToSql()
+	if err != nil {
+		return 0, nil, fmt.Errorf("generate list batch items sql error:%w", err)
+	}
+	if err := DB.SelectContext(ctx, &out, query, args...); err != nil {
+		return 0, nil, err
+	}
+
+	return total, out, nil
+}
+
+// ListPendingAssetBatchItems 获取批量任务中还未处理的项, 任务重试时跳过已处理的项
+func ListPendingAssetBatchItems(ctx context.Context, jobID string) ([]*model.AssetBatchItem, error) {
+	var out []*model.AssetBatchItem
+	err := DB.SelectContext(ctx, &out, fmt.Sprintf(
+		`SELECT * FROM %s WHERE job_id = ? AND state = ? ORDER BY id`, tableNameAssetBatchItem,
+	), jobID, AssetBatchStatePending)
+	return out, err
+}
+
+// FinishAssetBatchItem 记录一项的处理结果并更新任务的进度, 已处理过的项不重复计数
+func FinishAssetBatchItem(ctx context.Context, item *model.AssetBatchItem, state, errMsg string) error {
+	tx, err := DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	res, err := tx.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET state = ?, error = ?, updated_at = ? WHERE id = ? AND state = ?`, tableNameAssetBatchItem,
+	), state, errMsg, now, item.ID, AssetBatchStatePending)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+
+	counter := "succeeded"
+	if state == AssetBatchStateFailed {
+		counter = "failed"
+	}
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET %s = %s + 1, updated_at = ? WHERE id = ?`, tableNameAssetBatchJob, counter, counter,
+	), now, item.JobID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateAssetBatchJobState 修改批量任务的状态
+func UpdateAssetBatchJobState(ctx context.Context, id, state string) error {
+	_, err := DB.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET state = ?, updated_at = ? WHERE id = ?`, tableNameAssetBatchJob,
+	), state, time.Now(), id)
+	return err
+}
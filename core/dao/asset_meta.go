@@ -0,0 +1,312 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	tableUserAssetTag  = "user_asset_tag"
+	tableUserAssetMeta = "user_asset_meta"
+)
+
+// assetSortColumns 文件搜索支持的排序字段
+var assetSortColumns = map[string]string{
+	"created_time": "ua.created_time",
+	"name":         "ua.asset_name",
+	"size":         "ua.total_size",
+}
+
+// AssetSearchOption 文件搜索条件, 零值表示不过滤
+type AssetSearchOption struct {
+	Name        string
+	AssetType   string
+	Tags        []string
+	MinSize     int64
+	MaxSize     int64
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	ShareStatus *int64
+	AreaID      string
+	GroupID     *int64
+	SortBy      string
+	Desc        bool
+	Limit       int
+	Offset      int
+}
+
+// AssetTagCount 标签及使用该标签的文件数量
+type AssetTagCount struct {
+	Tag   string `db:"tag" json:"tag"`
+	Count int64  `db:"count" json:"count"`
+}
+
+// escapeLike 转义 LIKE 中的通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// SearchAssets 按条件搜索用户的文件, 回收站中的文件和回收站中文件组下的文件不参与搜索
+func SearchAssets(ctx context.Context, uid string, opt *AssetSearchOption) (int64, []*UserAssetDetail, error) {
+	sb := squirrel.Select().From(fmt.Sprintf("%s AS ua", tableUserAsset)).Where("ua.user_id = ? AND ua.trashed_at IS NULL", uid)
+
+	trashed, err := getTrashedGroupIDs(ctx, uid)
+	if err != nil {
+		return 0, nil, fmt.Errorf("get trashed groups error:%w", err)
+	}
+	if len(trashed) > 0 {
+		sb = sb.Where(squirrel.NotEq{"ua.group_id": trashed})
+	}
+
+	if opt.Name != "" {
+		sb = sb.Where("ua.asset_name LIKE ?", "%"+escapeLike(opt.Name)+"%")
+	}
+	if opt.AssetType != "" {
+		sb = sb.Where("ua.asset_type = ?", opt.AssetType)
+	}
+	if opt.MinSize > 0 {
+		sb = sb.Where("ua.total_size >= ?", opt.MinSize)
+	}
+	if opt.MaxSize > 0 {
+		sb = sb.Where("ua.total_size <= ?", opt.MaxSize)
+	}
+	if !opt.CreatedFrom.IsZero() {
+		sb = sb.Where("ua.created_time >= ?", opt.CreatedFrom)
+	}
+	if !opt.CreatedTo.IsZero() {
+		sb = sb.Where("ua.created_time < ?", opt.CreatedTo)
+	}
+	if opt.ShareStatus != nil {
+		sb = sb.Where("ua.share_status = ?", *opt.ShareStatus)
+	}
+	if opt.GroupID != nil {
+		sb = sb.Where("ua.group_id = ?", *opt.GroupID)
+	}
+	if opt.AreaID != "" {
+		sb = sb.Where(fmt.Sprintf("EXISTS (SELECT 1 FROM %s AS uaa WHERE uaa.user_id = ua.user_id AND uaa.hash = ua.hash AND uaa.area_id = ?)", tableUserAssetArea), opt.AreaID)
+	}
+	// 需要同时包含所有的标签
+	if len(opt.Tags) > 0 {
+		sub, subArgs, err := squirrel.Select("hash").From(tableUserAssetTag).Where(squirrel.Eq{"user_id": uid, "tag": opt.Tags}).
+			GroupBy("hash").Having("COUNT(*) = ?", len(opt.Tags)).ToSql()
+		if err != nil {
+			return 0, nil, fmt.Errorf("generate sql of tags error:%w", err)
+		}
+		sb = sb.Where(fmt.Sprintf("ua.hash IN (%s)", sub), subArgs...)
+	}
+
+	var total int64
+	query, args, err := sb.Columns("COUNT(*)").ToSql()
+	if err != nil {
+		return 0, nil, fmt.Errorf("generate count asset sql error:%w", err)
+	}
+	if err := DB.GetContext(ctx, &total, query, args...); err != nil {
+		return 0, nil, fmt.Errorf("count asset error:%w", err)
+	}
+
+	sortBy, ok := assetSortColumns[opt.SortBy]
+	if !ok {
+		sortBy = assetSortColumns["created_time"]
+	}
+	if opt.Desc {
+		sortBy += " DESC"
+	}
+
+	var infos []*UserAssetDetail
+	query, args, err = sb.Columns("ua.user_id,ua.hash,ua.cid,ua.asset_name,ua.asset_type,ua.share_status,ua.expiration,ua.created_time,ua.total_size,ua.password,ua.group_id,IFNULL(uav.count,0) AS visit_count").
+		LeftJoin(fmt.Sprintf("%s AS uav ON ua.hash=uav.hash and ua.user_id = uav.user_id", tableUserAssetVisit)).
+		OrderBy(sortBy, "ua.hash").Limit(uint64(opt.Limit)).Offset(uint64(opt.Offset)).ToSql()
+	if err != nil {
+		return 0, nil, fmt.Errorf("generate search asset sql error:%w", err)
+	}
+	if err := DB.SelectContext(ctx, &infos, query, args...); err != nil {
+		return 0, nil, fmt.Errorf("search asset error:%w", err)
+	}
+
+	return total, infos, nil
+}
+
+// GetAssetsTagsAndMeta 获取文件的标签和元数据
+func GetAssetsTagsAndMeta(ctx context.Context, uid string, hashes []string) (map[string][]string, map[string]map[string]string, error) {
+	tags := make(map[string][]string)
+	metas := make(map[string]map[string]string)
+	if len(hashes) == 0 {
+		return tags, metas, nil
+	}
+
+	var tagList []*model.UserAssetTag
+	query, args, err := squirrel.Select("*").From(tableUserAssetTag).Where(squirrel.Eq{"user_id": uid, "hash": hashes}).OrderBy("tag").ToSql()
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate get tags sql error:%w", err)
+	}
+	if err := DB.SelectContext(ctx, &tagList, query, args...); err != nil {
+		return nil, nil, fmt.Errorf("get tags error:%w", err)
+	}
+	for _, t := range tagList {
+		tags[t.Hash] = append(tags[t.Hash], t.Tag)
+	}
+
+	var metaList []*model.UserAssetMeta
+	query, args, err = squirrel.Select("*").From(tableUserAssetMeta).Where(squirrel.Eq{"user_id": uid, "hash": hashes}).ToSql()
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate get meta sql error:%w", err)
+	}
+	if err := DB.SelectContext(ctx, &metaList, query, args...); err != nil {
+		return nil, nil, fmt.Errorf("get meta error:%w", err)
+	}
+	for _, m := range metaList {
+		if metas[m.Hash] == nil {
+			metas[m.Hash] = make(map[string]string)
+		}
+		metas[m.Hash][m.MetaKey] = m.MetaValue
+	}
+
+	return tags, metas, nil
+}
+
+// ListUserAssetTags 获取用户所有的标签及使用该标签的文件数量, 回收站中的文件和回收站中文件组下的文件不计入
+func ListUserAssetTags(ctx context.Context, uid string) ([]*AssetTagCount, error) {
+	sb := squirrel.Select("t.tag", "COUNT(*) AS count").From(fmt.Sprintf("%s AS t", tableUserAssetTag)).
+		InnerJoin(fmt.Sprintf("%s AS ua ON ua.user_id = t.user_id AND ua.hash = t.hash", tableUserAsset)).
+		Where("t.user_id = ? AND ua.trashed_at IS NULL", uid)
+
+	trashed, err := getTrashedGroupIDs(ctx, uid)
+	if err != nil {
+		return nil, fmt.Errorf("get trashed groups error:%w", err)
+	}
+	if len(trashed) > 0 {
+		sb = sb.Where(squirrel.NotEq{"ua.group_id": trashed})
+	}
+
+	query, args, err := sb.GroupBy("t.tag").OrderBy("t.tag").ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("generate list tags sql error:%w", err)
+	}
+
+	var out []*AssetTagCount
+	err = DB.SelectContext(ctx, &out, query, args...)
+	return out, err
+}
+
+// UpdateAssetTagsAndMeta 替换文件的标签和元数据, 参数为 nil 时不修改, 为空时清空
+func UpdateAssetTagsAndMeta(ctx context.Context, uid, hash string, tags []string, meta map[string]string) error {
+	tx, err := DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if tags != nil {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE user_id = ? AND hash = ?`, tableUserAssetTag), uid, hash)
+		if err != nil {
+			return err
+		}
+		if err := addAssetTags(ctx, tx, uid, []string{hash}, tags); err != nil {
+			return err
+		}
+	}
+
+	if meta != nil {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE user_id = ? AND hash = ?`, tableUserAssetMeta), uid, hash)
+		if err != nil {
+			return err
+		}
+		for k, v := range meta {
+			_, err = tx.ExecContext(ctx, fmt.Sprintf(
+				`INSERT INTO %s (user_id, hash, meta_key, meta_value) VALUES (?, ?, ?, ?)`, tableUserAssetMeta,
+			), uid, hash, k, v)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// BulkUpdateAssets 批量给文件添加、删除标签并移动到指定的文件组, groupID 为 nil 时不移动;
+// 只处理用户自己可用的文件, 回收站中文件组下的文件也不处理, 目标文件组不存在或在回收站中时返回 sql.ErrNoRows, 返回移动的文件数量
+func BulkUpdateAssets(ctx context.Context, uid string, hashes, addTags, removeTags []string, groupID *int64) (int64, error) {
+	hashes, err := filterAvailableAssets(ctx, uid, hashes)
+	if err != nil {
+		return 0, err
+	}
+
+	if groupID != nil {
+		available, err := AssetGroupAvailable(ctx, uid, *groupID)
+		if err != nil {
+			return 0, err
+		}
+		if !available {
+			return 0, sql.ErrNoRows
+		}
+	}
+	if len(hashes) == 0 {
+		return 0, nil
+	}
+
+	tx, err := DB.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := addAssetTags(ctx, tx, uid, hashes, addTags); err != nil {
+		return 0, err
+	}
+
+	if len(removeTags) > 0 {
+		query, args, err := squirrel.Delete(tableUserAssetTag).Where(squirrel.Eq{"user_id": uid, "hash": hashes, "tag": removeTags}).ToSql()
+		if err != nil {
+			return 0, fmt.Errorf("generate delete tags sql error:%w", err)
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return 0, err
+		}
+	}
+
+	var moved int64
+	if groupID != nil {
+		query, args, err := squirrel.Update(tableUserAsset).Set("group_id", *groupID).
+			Where(squirrel.Eq{"user_id": uid, "hash": hashes, "trashed_at": nil}).ToSql()
+		if err != nil {
+			return 0, fmt.Errorf("generate move asset sql error:%w", err)
+		}
+		res, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return 0, err
+		}
+		moved, _ = res.RowsAffected()
+	}
+
+	return moved, tx.Commit()
+}
+
+// addAssetTags 给用户自己不在回收站中的文件添加标签, 已有的标签忽略
+func addAssetTags(ctx context.Context, tx *sqlx.Tx, uid string, hashes, tags []string) error {
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	for _, tag := range tags {
+		sub, args, err := squirrel.Select("user_id", "hash").Column("?", tag).Column("?", now).From(tableUserAsset).
+			Where(squirrel.Eq{"user_id": uid, "hash": hashes, "trashed_at": nil}).ToSql()
+		if err != nil {
+			return fmt.Errorf("generate add tag sql error:%w", err)
+		}
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`INSERT IGNORE INTO %s (user_id, hash, tag, created_at) %s`, tableUserAssetTag, sub), args...)
+		if err != nil {
+			return fmt.Errorf("add tag error:%w", err)
+		}
+	}
+
+	return nil
+}
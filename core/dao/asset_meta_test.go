@@ -0,0 +1,153 @@
+package dao_test
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/dao/daotest"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+)
+
+const testMetaUser = "asset_meta_test_user"
+
+var testMetaHashes = []string{"asset_meta_test_hash_a", "asset_meta_test_hash_b", "asset_meta_test_hash_c"}
+
+func setupAssetMetaTest(t *testing.T) {
+	db := daotest.Open(t)
+
+	cleanup := func() {
+		for _, table := range []string{"user_asset", "user_asset_area", "user_asset_map", "user_asset_group", "user_asset_tag", "user_asset_meta", "user_trash"} {
+			daotest.Exec(t, db, `DELETE FROM `+table+` WHERE user_id = ?`, testMetaUser)
+		}
+		daotest.Exec(t, db, `DELETE FROM users WHERE username = ?`, testMetaUser)
+		for _, hash := range testMetaHashes {
+			daotest.Exec(t, db, `DELETE FROM content WHERE hash = ?`, hash)
+		}
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+
+	daotest.Exec(t, db, `INSERT INTO users (username, used_storage_size) VALUES (?, 0)`, testMetaUser)
+}
+
+func addAssetMetaTestAsset(t *testing.T, hash, name string, size, groupID int64, tags ...string) {
+	t.Helper()
+
+	ctx := context.Background()
+	err := dao.AddAssetAndUpdateSize(ctx, &model.UserAsset{
+		UserID:      testMetaUser,
+		Hash:        hash,
+		Cid:         hash,
+		AssetName:   name,
+		TotalSize:   size,
+		GroupID:     groupID,
+		CreatedTime: time.Now(),
+	}, []string{testTrashArea}, testTrashArea)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dao.UpdateAssetTagsAndMeta(ctx, testMetaUser, hash, tags, map[string]string{"owner": "test"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func searchAssetMetaTest(t *testing.T, opt *dao.AssetSearchOption) []string {
+	t.Helper()
+
+	opt.Limit = 10
+	_, infos, err := dao.SearchAssets(context.Background(), testMetaUser, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes := make([]string, 0, len(infos))
+	for _, info := range infos {
+		hashes = append(hashes, info.Hash)
+	}
+	sort.Strings(hashes)
+	return hashes
+}
+
+func assetTagCounts(t *testing.T) map[string]int64 {
+	t.Helper()
+
+	list, err := dao.ListUserAssetTags(context.Background(), testMetaUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make(map[string]int64)
+	for _, tc := range list {
+		out[tc.Tag] = tc.Count
+	}
+	return out
+}
+
+func TestSearchAssetsAndTags(t *testing.T) {
+	setupAssetMetaTest(t)
+	ctx := context.Background()
+
+	docs, err := dao.CreateAssetGroup(ctx, testMetaUser, "docs", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := dao.CreateAssetGroup(ctx, testMetaUser, "archive", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, b, c := testMetaHashes[0], testMetaHashes[1], testMetaHashes[2]
+	addAssetMetaTestAsset(t, a, "report.pdf", 100, 0, "work")
+	addAssetMetaTestAsset(t, b, "photo.jpg", 2000, docs.ID, "work", "photo")
+	addAssetMetaTestAsset(t, c, "report-2024.pdf", 50, archive.ID, "work")
+
+	if got := searchAssetMetaTest(t, &dao.AssetSearchOption{Name: "report"}); !reflect.DeepEqual(got, []string{a, c}) {
+		t.Errorf("search by name = %v", got)
+	}
+	// 需要同时包含所有的标签
+	if got := searchAssetMetaTest(t, &dao.AssetSearchOption{Tags: []string{"work", "photo"}}); !reflect.DeepEqual(got, []string{b}) {
+		t.Errorf("search by tags = %v", got)
+	}
+	if got := searchAssetMetaTest(t, &dao.AssetSearchOption{MinSize: 60, MaxSize: 1000}); !reflect.DeepEqual(got, []string{a}) {
+		t.Errorf("search by size = %v", got)
+	}
+	if got := assetTagCounts(t); !reflect.DeepEqual(got, map[string]int64{"work": 3, "photo": 1}) {
+		t.Errorf("tag counts = %v", got)
+	}
+
+	// 回收站中文件组下的文件不参与搜索, 也不计入标签的文件数量
+	if _, err := dao.TrashAssetGroup(ctx, testMetaUser, int(archive.ID), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := searchAssetMetaTest(t, &dao.AssetSearchOption{Name: "report"}); !reflect.DeepEqual(got, []string{a}) {
+		t.Errorf("search should skip assets in trashed group, got %v", got)
+	}
+	if got := assetTagCounts(t); !reflect.DeepEqual(got, map[string]int64{"work": 2, "photo": 1}) {
+		t.Errorf("tag counts should skip assets in trashed group, got %v", got)
+	}
+
+	// 批量操作不处理回收站中文件组下的文件
+	moved, err := dao.BulkUpdateAssets(ctx, testMetaUser, []string{a, c}, []string{"old"}, []string{"work"}, &docs.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != 1 {
+		t.Errorf("expect 1 asset moved, got %d", moved)
+	}
+	if got := searchAssetMetaTest(t, &dao.AssetSearchOption{GroupID: &docs.ID}); !reflect.DeepEqual(got, []string{a, b}) {
+		t.Errorf("search by group after move = %v", got)
+	}
+	if got := assetTagCounts(t); !reflect.DeepEqual(got, map[string]int64{"work": 1, "photo": 1, "old": 1}) {
+		t.Errorf("tag counts after bulk update = %v", got)
+	}
+
+	// 回收站中的文件不计入标签的文件数量
+	if _, err := dao.TrashUserAsset(ctx, a, testMetaUser, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := assetTagCounts(t); !reflect.DeepEqual(got, map[string]int64{"work": 1, "photo": 1}) {
+		t.Errorf("tag counts should skip trashed asset, got %v", got)
+	}
+}
@@ -47,8 +47,8 @@ func InsertOrUpdateAssetTransferLog(ctx context.Context, record *model.AssetTran
 		}
 	}()
 
-	recordStatement := `INSERT INTO asset_transfer_log(trace_id, user_id, cid, hash, node_id, rate, cost_ms, total_size, state, transfer_type, log, area, created_at, ip, first_byte_time, available_bandwidth)
-	VALUES(:trace_id, :user_id, :cid, :hash, :node_id, :rate, :cost_ms, :total_size, :state, :transfer_type, :log, :area, :created_at, :ip, :first_byte_time, :available_bandwidth)
+	recordStatement := `INSERT INTO asset_transfer_log(trace_id, user_id, cid, hash, node_id, rate, cost_ms, total_size, state, transfer_type, log, area, created_at, ip, first_byte_time, available_bandwidth, link_id, country)
+	VALUES(:trace_id, :user_id, :cid, :hash, :node_id, :rate, :cost_ms, :total_size, :state, :transfer_type, :log, :area, :created_at, :ip, :first_byte_time, :available_bandwidth, :link_id, :country)
 	ON DUPLICATE KEY UPDATE 
 	user_id=VALUES(user_id), cid=VALUES(cid), hash=VALUES(hash), node_id=VALUES(node_id), rate=VALUES(rate), cost_ms=VALUES(cost_ms), 
 	total_size=VALUES(total_size), state=VALUES(state), transfer_type=VALUES(transfer_type), log=VALUES(log), area=VALUES(area), ip=VALUES(ip), 
@@ -87,6 +87,60 @@ func NewLogTrace(ctx context.Context, uid string, transferType string, area stri
 	return log.TraceId, nil
 }
 
+// NewLinkLogTrace 通过分享链接下载时创建传输记录, 用于统计链接的访问情况
+func NewLinkLogTrace(ctx context.Context, uid string, area string, linkID int64, country string) (string, error) {
+	log := &model.AssetTransferLog{
+		TraceId:      uuid.New().String(),
+		UserId:       uid,
+		CreatedAt:    time.Now(),
+		TransferType: AssetTransferTypeDownload,
+		Area:         area,
+		LinkID:       linkID,
+		Country:      country,
+	}
+	if err := InsertOrUpdateAssetTransferLog(ctx, log, nil); err != nil {
+		return "", err
+	}
+	return log.TraceId, nil
+}
+
+// LinkAccessDaily 分享链接每天的下载情况
+type LinkAccessDaily struct {
+	Date      string `db:"date" json:"date"`
+	Downloads int64  `db:"downloads" json:"downloads"`
+	Success   int64  `db:"success" json:"success"`
+	Size      int64  `db:"size" json:"size"`
+}
+
+// LinkAccessCountry 分享链接按国家统计的下载次数
+type LinkAccessCountry struct {
+	Country   string `db:"country" json:"country"`
+	Downloads int64  `db:"downloads" json:"downloads"`
+}
+
+// GetLinkAccessStats 统计分享链接在时间段内每天的下载情况和下载者所在的国家
+func GetLinkAccessStats(ctx context.Context, linkID int64, start, end time.Time) ([]*LinkAccessDaily, []*LinkAccessCountry, error) {
+	var (
+		daily     []*LinkAccessDaily
+		countries []*LinkAccessCountry
+	)
+
+	err := DB.SelectContext(ctx, &daily, `SELECT DATE_FORMAT(created_at, '%Y-%m-%d') AS date, COUNT(*) AS downloads,
+		COALESCE(SUM(CASE WHEN state = 1 THEN 1 ELSE 0 END), 0) AS success, COALESCE(SUM(total_size), 0) AS size
+		FROM asset_transfer_log WHERE link_id = ? AND created_at >= ? AND created_at < ? GROUP BY date ORDER BY date`, linkID, start, end)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = DB.SelectContext(ctx, &countries, `SELECT country, COUNT(*) AS downloads FROM asset_transfer_log
+		WHERE link_id = ? AND created_at >= ? AND created_at < ? GROUP BY country ORDER BY downloads DESC`, linkID, start, end)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return daily, countries, nil
+}
+
 type ComprehensiveStats struct {
 	TotalDownloads   int     `db:"total_downloads" json:"total_downloads"`
 	TotalUploads     int     `db:"total_uploads" json:"total_uploads"`
@@ -11,22 +11,16 @@ import (
 
 // AssetGroup user asset group
 type AssetGroup struct {
-	ID          int64     `db:"id"`
-	UserID      string    `db:"user_id"`
-	Name        string    `db:"name"`
-	Parent      int64     `db:"parent"`
-	AssetCount  int64     `db:"asset_count"`
-	AssetSize   int64     `db:"asset_size"`
-	CreatedTime time.Time `db:"created_time"`
-	ShareStatus int64     `db:"share_status"`
-	VistitCount int64     `db:"visit_count"`
-}
-
-// OnlyUserGroupAsset 唯一存在的用户组文件
-type OnlyUserGroupAsset struct {
-	CID    string `db:"cid"`
-	Num    int64  `db:"num"`
-	AreaID string `db:"area_id"`
+	ID          int64      `db:"id"`
+	UserID      string     `db:"user_id"`
+	Name        string     `db:"name"`
+	Parent      int64      `db:"parent"`
+	AssetCount  int64      `db:"asset_count"`
+	AssetSize   int64      `db:"asset_size"`
+	CreatedTime time.Time  `db:"created_time"`
+	ShareStatus int64      `db:"share_status"`
+	VistitCount int64      `db:"visit_count"`
+	TrashedAt   *time.Time `db:"trashed_at" json:"-"`
 }
 
 // ListAssetGroupRsp list  asset group records
@@ -38,7 +32,7 @@ type ListAssetGroupRsp struct {
 // GetUserAssetCountByGroupID Get count by group id
 func getUserAssetCountByGroupID(ctx context.Context, uid string, groupID int) (int64, error) {
 	var total int64
-	query, args, err := squirrel.Select("COUNT(hash)").From(tableUserAsset).Where("user_id = ? AND group_id = ?", uid, groupID).ToSql()
+	query, args, err := squirrel.Select("COUNT(hash)").From(tableUserAsset).Where("user_id = ? AND group_id = ? AND trashed_at IS NULL", uid, groupID).ToSql()
 	if err != nil {
 		return 0, fmt.Errorf("generate get asset sql error:%w", err)
 	}
@@ -64,7 +58,8 @@ func deleteAssetGroup(ctx context.Context, userID string, gid int) error {
 		}
 	}()
 
-	query := fmt.Sprintf(`DELETE FROM %s WHERE user_id=? AND parent=?`, tableNameAssetGroup)
+	// 回收站中的子文件组保留, 恢复时放回根目录
+	query := fmt.Sprintf(`DELETE FROM %s WHERE user_id=? AND parent=? AND trashed_at IS NULL`, tableNameAssetGroup)
 	_, err = tx.ExecContext(ctx, query, userID, gid)
 	if err != nil {
 		return err
@@ -82,7 +77,7 @@ func deleteAssetGroup(ctx context.Context, userID string, gid int) error {
 // assetGroupExists is group exists
 func assetGroupExists(ctx context.Context, uid string, gid int) (bool, error) {
 	var id int64
-	query, args, err := squirrel.Select("id").From(tableNameAssetGroup).Where("user_id = ? AND id = ?", uid, gid).ToSql()
+	query, args, err := squirrel.Select("id").From(tableNameAssetGroup).Where("user_id = ? AND id = ? AND trashed_at IS NULL", uid, gid).ToSql()
 	if err != nil {
 		return false, fmt.Errorf("generate get asset's group sql error:%w", err)
 	}
@@ -19,26 +19,40 @@ var (
 
 func CreateLink(ctx context.Context, link *model.Link) error {
 	_, err := DB.NamedExecContext(ctx, fmt.Sprintf(
-		`INSERT INTO %s (username, cid, short_link, long_link, short_pass,created_at, updated_at, expire_at)
-			VALUES (:username, :cid, :short_link, :long_link, :short_pass, :created_at, :updated_at, :expire_at);`, tableNameLink,
+		`INSERT INTO %s (username, cid, short_id, short_link, long_link, short_pass,created_at, updated_at, expire_at, max_downloads, allowed_countries, allowed_referers, disable_preview)
+			VALUES (:username, :cid, :short_id, :short_link, :long_link, :short_pass, :created_at, :updated_at, :expire_at, :max_downloads, :allowed_countries, :allowed_referers, :disable_preview);`, tableNameLink,
 	), link)
 	return err
 }
 
-func GetShortLink(ctx context.Context, link string) string {
-	var areaID string
-	_ = DB.GetContext(ctx, &areaID, fmt.Sprintf(
-		`SELECT short_link FROM %s where long_link = '%s' order by id desc limit 1`, tableNameLink, link,
-	))
-	return areaID
+// GetLinkByLongLink 通过分享页面的地址获取分享链接
+func GetLinkByLongLink(ctx context.Context, longLink string) (*model.Link, error) {
+	var link model.Link
+	err := DB.GetContext(ctx, &link, fmt.Sprintf(`SELECT * FROM %s WHERE long_link = ? ORDER BY id DESC LIMIT 1`, tableNameLink), longLink)
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
 }
 
-func GetLongLink(ctx context.Context, cid string) string {
-	var areaID string
-	_ = DB.GetContext(ctx, &areaID, fmt.Sprintf(
-		`SELECT long_link FROM %s where cid = '%s' order by id desc limit 1`, tableNameLink, cid,
-	))
-	return areaID
+// GetLinkByShortID 通过短链接的随机 ID 获取分享链接
+func GetLinkByShortID(ctx context.Context, shortID string) (*model.Link, error) {
+	var link model.Link
+	err := DB.GetContext(ctx, &link, fmt.Sprintf(`SELECT * FROM %s WHERE short_id = ?`, tableNameLink), shortID)
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// GetLinkByShortLink 通过完整的短链接获取分享链接, 用于兼容旧格式的短链接
+func GetLinkByShortLink(ctx context.Context, shortLink string) (*model.Link, error) {
+	var link model.Link
+	err := DB.GetContext(ctx, &link, fmt.Sprintf(`SELECT * FROM %s WHERE short_link = ? ORDER BY id DESC LIMIT 1`, tableNameLink), shortLink)
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
 }
 
 func GetLink(ctx context.Context, sb squirrel.SelectBuilder) (*model.Link, error) {
@@ -54,13 +68,72 @@ func GetLink(ctx context.Context, sb squirrel.SelectBuilder) (*model.Link, error
 	return &link, err
 }
 
-func UpdateLinkPassAndExpiration(ctx context.Context, link *model.Link) error {
+// UpdateLinkPolicy 修改分享链接的密码、过期时间和访问策略
+func UpdateLinkPolicy(ctx context.Context, link *model.Link) error {
 	_, err := DB.NamedExecContext(ctx, fmt.Sprintf(
-		`UPDATE %s SET short_pass = :short_pass, updated_at = :updated_at, expire_at = :expire_at WHERE id = :id`, tableNameLink,
+		`UPDATE %s SET short_link = :short_link, short_pass = :short_pass, updated_at = :updated_at, expire_at = :expire_at, max_downloads = :max_downloads,
+		allowed_countries = :allowed_countries, allowed_referers = :allowed_referers, disable_preview = :disable_preview WHERE id = :id`, tableNameLink,
 	), link)
 	return err
 }
 
+// UpdateLinkShortLink 修改分享链接的随机 ID 和短链接
+func UpdateLinkShortLink(ctx context.Context, link *model.Link) error {
+	_, err := DB.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET short_id = ?, short_link = ? WHERE id = ?`, tableNameLink,
+	), link.ShortID, link.ShortLink, link.ID)
+	return err
+}
+
+// RevokeLink 撤销分享链接, 撤销后立即不能访问
+func RevokeLink(ctx context.Context, id int64, username string) error {
+	_, err := DB.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET revoked = 1, revoked_at = ? WHERE id = ? AND username = ?`, tableNameLink,
+	), time.Now(), id, username)
+	return err
+}
+
+// CountUserLinks 用户未撤销且未过期的分享链接数量, 不过期的链接 expire_at 为零值
+func CountUserLinks(ctx context.Context, username string) (int64, error) {
+	var count int64
+	err := DB.GetContext(ctx, &count, fmt.Sprintf(
+		`SELECT COUNT(*) FROM %s WHERE username = ? AND revoked = 0 AND (expire_at IS NULL OR YEAR(expire_at) <= 1 OR expire_at > ?)`, tableNameLink,
+	), username, time.Now())
+	return count, err
+}
+
+// IncrLinkDownloadCount 分享链接下载次数加一, 已达到最大下载次数时返回 false
+func IncrLinkDownloadCount(ctx context.Context, id int64) (bool, error) {
+	res, err := DB.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET download_count = download_count + 1 WHERE id = ? AND (max_downloads = 0 OR download_count < max_downloads)`, tableNameLink,
+	), id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+// TenantLink 租户子账户的分享链接
+type TenantLink struct {
+	model.Link
+	TenantID string `db:"tenant_id" json:"tenant_id"`
+}
+
+// GetTenantExpiredLinks 获取在 (start, end] 时间段内过期的租户子账户分享链接
+func GetTenantExpiredLinks(ctx context.Context, start, end time.Time) ([]*TenantLink, error) {
+	var out []*TenantLink
+	err := DB.SelectContext(ctx, &out, fmt.Sprintf(
+		`SELECT l.*, u.tenant_id FROM %s l INNER JOIN %s u ON l.username = u.username WHERE u.tenant_id <> '' AND l.expire_at > ? AND l.expire_at <= ?`,
+		tableNameLink, tableNameUser,
+	), start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
 func QueryCacheHour(deviceID, startTime, endTime string) []*CacheStatistics {
 	option := QueryOption{
 		StartTime: startTime,
@@ -0,0 +1,209 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/jmoiron/sqlx"
+)
+
+const tableNameContent = "content"
+
+// contentRef 用户文件在某个区域引用的内容
+type contentRef struct {
+	Hash   string `db:"hash"`
+	AreaID string `db:"area_id"`
+	Cid    string `db:"cid"`
+	Size   int64  `db:"total_size"`
+	MD5    string `db:"md5"`
+}
+
+// ContentDedupReport 内容去重节省的存储空间
+type ContentDedupReport struct {
+	AreaID       string `json:"area_id,omitempty" db:"area_id"`
+	Contents     int64  `json:"contents" db:"contents"`
+	References   int64  `json:"references" db:"refs"`
+	LogicalSize  int64  `json:"logical_size" db:"logical_size"`
+	PhysicalSize int64  `json:"physical_size" db:"physical_size"`
+	SavedSize    int64  `json:"saved_size" db:"saved_size"`
+}
+
+// GetContent 获取区域中的内容
+func GetContent(ctx context.Context, hash, areaID string) (*model.Content, error) {
+	var out model.Content
+	err := DB.GetContext(ctx, &out, fmt.Sprintf(
+		`SELECT * FROM %s WHERE hash = ? AND area_id = ?`, tableNameContent,
+	), hash, areaID)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ContentAvailable 区域中已经存在同步完成的内容, 用户上传相同的文件时可以直接引用, 不需要再上传
+func ContentAvailable(ctx context.Context, hash, areaID string) bool {
+	var count int64
+	err := DB.GetContext(ctx, &count, fmt.Sprintf(
+		`SELECT COUNT(*) FROM %s c WHERE c.hash = ? AND c.area_id = ? AND c.ref_count > 0
+		AND EXISTS (SELECT 1 FROM %s uaa WHERE uaa.hash = c.hash AND uaa.area_id = c.area_id AND uaa.is_sync = 1)`,
+		tableNameContent, tableUserAssetArea,
+	), hash, areaID)
+	if err != nil {
+		log.Errorf("check content available: %v", err)
+		return false
+	}
+	return count > 0
+}
+
+// GetAvailableContentByMD5 通过 md5 获取区域中已经同步完成的内容
+func GetAvailableContentByMD5(ctx context.Context, md5, areaID string) (*model.Content, error) {
+	var out model.Content
+	err := DB.GetContext(ctx, &out, fmt.Sprintf(
+		`SELECT c.* FROM %s c WHERE c.md5 = ? AND c.area_id = ? AND c.ref_count > 0
+		AND EXISTS (SELECT 1 FROM %s uaa WHERE uaa.hash = c.hash AND uaa.area_id = c.area_id AND uaa.is_sync = 1) LIMIT 1`,
+		tableNameContent, tableUserAssetArea,
+	), md5, areaID)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetContentDedupReport 统计内容去重节省的存储空间, 返回总计和每个区域的数据
+func GetContentDedupReport(ctx context.Context) (*ContentDedupReport, []*ContentDedupReport, error) {
+	var (
+		total ContentDedupReport
+		areas []*ContentDedupReport
+	)
+
+	columns := `COUNT(*) AS contents, IFNULL(SUM(ref_count),0) AS refs, IFNULL(SUM(size * ref_count),0) AS logical_size,
+		IFNULL(SUM(size),0) AS physical_size, IFNULL(SUM(size * (ref_count - 1)),0) AS saved_size`
+
+	err := DB.GetContext(ctx, &total, fmt.Sprintf(`SELECT %s FROM %s WHERE ref_count > 0`, columns, tableNameContent))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = DB.SelectContext(ctx, &areas, fmt.Sprintf(
+		`SELECT area_id, %s FROM %s WHERE ref_count > 0 GROUP BY area_id ORDER BY saved_size DESC`, columns, tableNameContent,
+	))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &total, areas, nil
+}
+
+// ListTopDedupContents 获取引用最多, 节省空间最大的内容
+func ListTopDedupContents(ctx context.Context, limit int) ([]*model.Content, error) {
+	var out []*model.Content
+	err := DB.SelectContext(ctx, &out, fmt.Sprintf(
+		`SELECT * FROM %s WHERE ref_count > 1 ORDER BY size * (ref_count - 1) DESC LIMIT ?`, tableNameContent,
+	), limit)
+	return out, err
+}
+
+// getContentRefs 获取用户文件引用的内容, 需要在删除用户文件之前调用
+func getContentRefs(ctx context.Context, tx *sqlx.Tx, where squirrel.Sqlizer) ([]*contentRef, error) {
+	query, args, err := squirrel.Select("DISTINCT uaa.hash, uaa.area_id, ua.cid, ua.total_size, ua.md5").
+		From(fmt.Sprintf("%s AS uaa", tableUserAssetArea)).
+		InnerJoin(fmt.Sprintf("%s AS ua ON ua.hash = uaa.hash AND ua.user_id = uaa.user_id", tableUserAsset)).
+		Where(where).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("generate sql of get content refs error:%w", err)
+	}
+
+	var refs []*contentRef
+	if err := tx.SelectContext(ctx, &refs, query, args...); err != nil {
+		return nil, err
+	}
+
+	return refs, nil
+}
+
+// lockContents 锁定内容记录, 修改 user_asset_area 之前调用, 保证并发增减引用时计数正确; 按主键顺序加锁避免死锁.
+// 内容不存在时先插入引用数为 0 的占位记录再加行锁, 避免锁定读不存在的记录时加间隙锁, 两个事务在插入时相互等待;
+// 记录已存在时 ON DUPLICATE KEY 直接加排他锁, 不会出现共享锁升级为排他锁的死锁. 占位记录在 syncContentRefs 中更新或删除
+func lockContents(ctx context.Context, tx *sqlx.Tx, refs []*contentRef) error {
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Hash != refs[j].Hash {
+			return refs[i].Hash < refs[j].Hash
+		}
+		return refs[i].AreaID < refs[j].AreaID
+	})
+
+	for _, ref := range refs {
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(
+			`INSERT INTO %s (hash, area_id, cid, size, md5, ref_count) VALUES (?, ?, ?, ?, ?, 0) ON DUPLICATE KEY UPDATE ref_count = ref_count`,
+			tableNameContent,
+		), ref.Hash, ref.AreaID, ref.Cid, ref.Size, ref.MD5)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// syncContentRefs 重新计算内容在区域中的引用数, 返回引用数变为 0 的内容, 调用方需要在事务提交后删除调度器中的文件
+func syncContentRefs(ctx context.Context, tx *sqlx.Tx, refs []*contentRef) ([]*model.Content, error) {
+	var released []*model.Content
+
+	for _, ref := range refs {
+		// 使用锁定读, 读取其他事务已提交的引用
+		var count int64
+		err := tx.GetContext(ctx, &count, fmt.Sprintf(
+			`SELECT COUNT(*) FROM %s WHERE hash = ? AND area_id = ? LOCK IN SHARE MODE`, tableUserAssetArea,
+		), ref.Hash, ref.AreaID)
+		if err != nil {
+			return nil, err
+		}
+
+		if count > 0 {
+			_, err = tx.ExecContext(ctx, fmt.Sprintf(
+				`INSERT INTO %s (hash, area_id, cid, size, md5, ref_count) VALUES (?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE ref_count = VALUES(ref_count)`,
+				tableNameContent,
+			), ref.Hash, ref.AreaID, ref.Cid, ref.Size, ref.MD5, count)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE hash = ? AND area_id = ?`, tableNameContent), ref.Hash, ref.AreaID)
+		if err != nil {
+			return nil, err
+		}
+
+		released = append(released, &model.Content{
+			Hash:      ref.Hash,
+			AreaID:    ref.AreaID,
+			Cid:       ref.Cid,
+			Size:      ref.Size,
+			MD5:       ref.MD5,
+			UpdatedAt: time.Now(),
+		})
+	}
+
+	return released, nil
+}
+
+// newContentRefs 新增用户文件时引用的内容
+func newContentRefs(asset *model.UserAsset, areaIDs ...string) []*contentRef {
+	refs := make([]*contentRef, 0, len(areaIDs))
+	seen := make(map[string]bool, len(areaIDs))
+	for _, areaID := range areaIDs {
+		areaID = strings.TrimSpace(areaID)
+		if areaID == "" || seen[areaID] {
+			continue
+		}
+		seen[areaID] = true
+		refs = append(refs, &contentRef{Hash: asset.Hash, AreaID: areaID, Cid: asset.Cid, Size: asset.TotalSize, MD5: asset.MD5})
+	}
+	return refs
+}
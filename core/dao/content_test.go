@@ -0,0 +1,123 @@
+package dao_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/dao/daotest"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+)
+
+const (
+	testContentHash = "content_test_hash"
+	testContentArea = "Asia-China-Guangdong-Shenzhen"
+)
+
+func setupContentTest(t *testing.T, users ...string) {
+	db := daotest.Open(t)
+
+	cleanup := func() {
+		for _, user := range users {
+			daotest.Exec(t, db, `DELETE FROM users WHERE username = ?`, user)
+			daotest.Exec(t, db, `DELETE FROM user_asset WHERE user_id = ?`, user)
+			daotest.Exec(t, db, `DELETE FROM user_asset_area WHERE user_id = ?`, user)
+			daotest.Exec(t, db, `DELETE FROM user_asset_map WHERE user_id = ?`, user)
+		}
+		daotest.Exec(t, db, `DELETE FROM content WHERE hash = ?`, testContentHash)
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+
+	for _, user := range users {
+		daotest.Exec(t, db, `INSERT INTO users (username, used_storage_size) VALUES (?, 0)`, user)
+	}
+}
+
+func addTestAsset(ctx context.Context, user string) error {
+	return dao.AddAssetAndUpdateSize(ctx, &model.UserAsset{
+		UserID:      user,
+		Hash:        testContentHash,
+		Cid:         "content_test_cid",
+		AssetName:   "content.txt",
+		TotalSize:   100,
+		CreatedTime: time.Now(),
+	}, []string{testContentArea}, testContentArea)
+}
+
+func contentRefCount(t *testing.T) int64 {
+	t.Helper()
+
+	content, err := dao.GetContent(context.Background(), testContentHash, testContentArea)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content.RefCount
+}
+
+func TestContentRefsIncrement(t *testing.T) {
+	users := []string{"content_test_u1", "content_test_u2", "content_test_u3", "content_test_u4"}
+	setupContentTest(t, users...)
+	ctx := context.Background()
+
+	// 内容不存在时并发新增引用, 不能因为间隙锁死锁
+	var wg sync.WaitGroup
+	for _, user := range users {
+		wg.Add(1)
+		go func(user string) {
+			defer wg.Done()
+			if err := addTestAsset(ctx, user); err != nil {
+				t.Errorf("add asset of %s: %v", user, err)
+			}
+		}(user)
+	}
+	wg.Wait()
+
+	if count := contentRefCount(t); count != int64(len(users)) {
+		t.Fatalf("expect ref count %d, got %d", len(users), count)
+	}
+
+	// 重复添加不增加引用数
+	if err := addTestAsset(ctx, users[0]); err != nil {
+		t.Fatal(err)
+	}
+	if count := contentRefCount(t); count != int64(len(users)) {
+		t.Fatalf("expect ref count %d after re-adding, got %d", len(users), count)
+	}
+}
+
+func TestContentRefsDecrement(t *testing.T) {
+	users := []string{"content_test_u1", "content_test_u2"}
+	setupContentTest(t, users...)
+	ctx := context.Background()
+
+	for _, user := range users {
+		if err := addTestAsset(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	released, err := dao.DelAssetAndUpdateSize(ctx, testContentHash, users[0], []string{testContentArea}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(released) != 0 {
+		t.Fatalf("content is still referenced, expect nothing released, got %d", len(released))
+	}
+	if count := contentRefCount(t); count != 1 {
+		t.Fatalf("expect ref count 1, got %d", count)
+	}
+
+	released, err = dao.DelAssetAndUpdateSize(ctx, testContentHash, users[1], []string{testContentArea}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(released) != 1 || released[0].AreaID != testContentArea {
+		t.Fatalf("expect the content to be released, got %+v", released)
+	}
+	if _, err := dao.GetContent(ctx, testContentHash, testContentArea); err == nil {
+		t.Fatal("released content should be deleted")
+	}
+}
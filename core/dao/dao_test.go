@@ -47,7 +47,7 @@ func TestDeleteUserGroupAsset(t *testing.T) {
 	userID := "0x5e48ee53a85343b7b57014a1eb20e21fff92d4a4"
 	gids := []int64{}
 
-	err := DeleteUserGroupAsset(ctx, userID, gids)
+	_, err := DeleteUserGroupAsset(ctx, userID, gids)
 	if err != nil {
 		t.Fatal(err)
 	}
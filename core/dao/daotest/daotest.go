@@ -0,0 +1,50 @@
+// Package daotest 连接测试用的 MySQL, 用于需要真实数据库的集成测试.
+//
+// 通过环境变量 TITAN_EXPLORER_TEST_DSN 指定数据库, 如 root:abcd1234@tcp(localhost:3306)/titan_explorer_test?parseTime=true&loc=Local,
+// 没有设置时跳过测试; 数据库需要已执行 scripts 中的建表语句, 测试会写入数据, 不要使用线上数据库.
+package daotest
+
+import (
+	"os"
+	"testing"
+
+	"github.com/gnasnik/titan-explorer/core/dao"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+// EnvDSN 测试数据库的连接地址
+const EnvDSN = "TITAN_EXPLORER_TEST_DSN"
+
+// Open 连接测试数据库并替换 dao.DB, 测试结束后恢复
+func Open(t testing.TB) *sqlx.DB {
+	t.Helper()
+
+	dsn := os.Getenv(EnvDSN)
+	if dsn == "" {
+		t.Skipf("%s is not set, skip database test", EnvDSN)
+	}
+
+	db, err := sqlx.Connect("mysql", dsn)
+	if err != nil {
+		t.Fatalf("connect test database: %v", err)
+	}
+
+	prev := dao.DB
+	dao.DB = db
+	t.Cleanup(func() {
+		dao.DB = prev
+		db.Close()
+	})
+
+	return db
+}
+
+// Exec 执行准备或清理数据的语句, 失败时结束测试
+func Exec(t testing.TB, db *sqlx.DB, query string, args ...interface{}) {
+	t.Helper()
+
+	if _, err := db.Exec(query, args...); err != nil {
+		t.Fatalf("exec %s: %v", query, err)
+	}
+}
@@ -0,0 +1,234 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	tableNameDeviceLabel       = "device_label"
+	tableNameDeviceGroup       = "device_group"
+	tableNameDeviceGroupMember = "device_group_member"
+)
+
+// FleetFilter 节点列表的过滤条件, 为空的条件不过滤
+type FleetFilter struct {
+	DeviceIDs []string
+	Status    string
+	AreaID    string
+	NATType   string
+	Version   string
+	MinProfit *float64
+	MaxProfit *float64
+	Label     string
+	GroupID   int64
+}
+
+// DeviceLabelCount 标签和使用该标签的节点数量
+type DeviceLabelCount struct {
+	Label     string `json:"label" db:"label"`
+	NodeCount int64  `json:"node_count" db:"node_count"`
+}
+
+// ListFleetDevices 按条件获取用户的节点
+func ListFleetDevices(ctx context.Context, userID string, f *FleetFilter, limit, offset int) (int64, []*model.DeviceInfo, error) {
+	sb := squirrel.Select().From(tableNameDeviceInfo).Where("user_id = ?", userID)
+	if len(f.DeviceIDs) > 0 {
+		sb = sb.Where(squirrel.Eq{"device_id": f.DeviceIDs})
+	}
+	if f.Status != "" {
+		sb = sb.Where("device_status = ?", f.Status)
+	}
+	if f.AreaID != "" {
+		sb = sb.Where("area_id = ?", f.AreaID)
+	}
+	if f.NATType != "" {
+		sb = sb.Where("nat_type = ?", f.NATType)
+	}
+	if f.Version != "" {
+		sb = sb.Where("system_version = ?", f.Version)
+	}
+	if f.MinProfit != nil {
+		sb = sb.Where("cumulative_profit >= ?", *f.MinProfit)
+	}
+	if f.MaxProfit != nil {
+		sb = sb.Where("cumulative_profit <= ?", *f.MaxProfit)
+	}
+	if f.Label != "" {
+		sb = sb.Where(fmt.Sprintf("device_id IN (SELECT device_id FROM %s WHERE user_id = ? AND label = ?)", tableNameDeviceLabel), userID, f.Label)
+	}
+	if f.GroupID > 0 {
+		sb = sb.Where(fmt.Sprintf(
+			"device_id IN (SELECT m.device_id FROM %s m JOIN %s g ON g.id = m.group_id WHERE g.user_id = ? AND g.id = ?)",
+			tableNameDeviceGroupMember, tableNameDeviceGroup), userID, f.GroupID)
+	}
+
+	var total int64
+	query, args, err := sb.Columns("COUNT(*)").ToSql()
+	if err != nil {
+		return 0, nil, fmt.Errorf("generate count fleet devices sql error:%w", err)
+	}
+	if err := DB.GetContext(ctx, &total, query, args...); err != nil {
+		return 0, nil, err
+	}
+
+	query, args, err = sb.Columns("*").OrderBy("device_id").Limit(uint64(limit)).Offset(uint64(offset)).ToSql()
+	if err != nil {
+		return 0, nil, fmt.Errorf("generate list fleet devices sql error:%w", err)
+	}
+
+	var out []*model.DeviceInfo
+	err = DB.SelectContext(ctx, &out, query, args...)
+	return total, out, err
+}
+
+// GetDeviceLabels 批量获取节点的标签
+func GetDeviceLabels(ctx context.Context, deviceIDs []string) (map[string][]string, error) {
+	out := make(map[string][]string)
+	if len(deviceIDs) == 0 {
+		return out, nil
+	}
+
+	query, args, err := sqlx.In(fmt.Sprintf(
+		`SELECT * FROM %s WHERE device_id IN (?) ORDER BY label`, tableNameDeviceLabel), deviceIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var labels []*model.DeviceLabel
+	if err := DB.SelectContext(ctx, &labels, DB.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+	for _, l := range labels {
+		out[l.DeviceID] = append(out[l.DeviceID], l.Label)
+	}
+	return out, nil
+}
+
+// ListUserDeviceLabels 获取用户使用过的所有标签
+func ListUserDeviceLabels(ctx context.Context, userID string) ([]*DeviceLabelCount, error) {
+	var out []*DeviceLabelCount
+	err := DB.SelectContext(ctx, &out, fmt.Sprintf(
+		`SELECT label, COUNT(*) AS node_count FROM %s WHERE user_id = ? GROUP BY label ORDER BY label`, tableNameDeviceLabel,
+	), userID)
+	return out, err
+}
+
+// AddDeviceLabels 给节点添加标签, 已有的标签忽略
+func AddDeviceLabels(ctx context.Context, userID, deviceID string, labels []string) error {
+	for _, label := range labels {
+		_, err := DB.ExecContext(ctx, fmt.Sprintf(
+			`INSERT IGNORE INTO %s (device_id, label, user_id, created_at) VALUES (?, ?, ?, now())`, tableNameDeviceLabel,
+		), deviceID, label, userID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveDeviceLabels 删除节点的标签
+func RemoveDeviceLabels(ctx context.Context, deviceID string, labels []string) error {
+	if len(labels) == 0 {
+		return nil
+	}
+
+	query, args, err := sqlx.In(fmt.Sprintf(
+		`DELETE FROM %s WHERE device_id = ? AND label IN (?)`, tableNameDeviceLabel), deviceID, labels)
+	if err != nil {
+		return err
+	}
+	_, err = DB.ExecContext(ctx, DB.Rebind(query), args...)
+	return err
+}
+
+// CreateDeviceGroup 新建节点分组
+func CreateDeviceGroup(ctx context.Context, g *model.DeviceGroup) error {
+	res, err := DB.NamedExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (user_id, name, created_at, updated_at) VALUES (:user_id, :name, :created_at, :updated_at)`, tableNameDeviceGroup,
+	), g)
+	if err != nil {
+		return err
+	}
+	g.ID, err = res.LastInsertId()
+	return err
+}
+
+// GetDeviceGroup 获取用户的节点分组
+func GetDeviceGroup(ctx context.Context, userID string, id int64) (*model.DeviceGroup, error) {
+	var out model.DeviceGroup
+	err := DB.GetContext(ctx, &out, fmt.Sprintf(`SELECT * FROM %s WHERE user_id = ? AND id = ?`, tableNameDeviceGroup), userID, id)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeviceGroupNameExists 用户是否已经有同名的分组
+func DeviceGroupNameExists(ctx context.Context, userID, name string) (bool, error) {
+	var count int64
+	err := DB.GetContext(ctx, &count, fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE user_id = ? AND name = ?`, tableNameDeviceGroup), userID, name)
+	return count > 0, err
+}
+
+// ListDeviceGroups 获取用户所有的节点分组及分组中的节点数量
+func ListDeviceGroups(ctx context.Context, userID string) ([]*model.DeviceGroup, error) {
+	var out []*model.DeviceGroup
+	err := DB.SelectContext(ctx, &out, fmt.Sprintf(
+		`SELECT g.*, COUNT(m.device_id) AS node_count FROM %s g LEFT JOIN %s m ON m.group_id = g.id WHERE g.user_id = ? GROUP BY g.id ORDER BY g.id`,
+		tableNameDeviceGroup, tableNameDeviceGroupMember,
+	), userID)
+	return out, err
+}
+
+// DeleteDeviceGroup 删除节点分组, 不影响分组中的节点
+func DeleteDeviceGroup(ctx context.Context, userID string, id int64) error {
+	tx, err := DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE user_id = ? AND id = ?`, tableNameDeviceGroup), userID, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE group_id = ?`, tableNameDeviceGroupMember), id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AddDeviceGroupMember 添加节点到分组, 已在分组中时忽略
+func AddDeviceGroupMember(ctx context.Context, groupID int64, deviceID string) error {
+	_, err := DB.ExecContext(ctx, fmt.Sprintf(
+		`INSERT IGNORE INTO %s (group_id, device_id, created_at) VALUES (?, ?, now())`, tableNameDeviceGroupMember,
+	), groupID, deviceID)
+	return err
+}
+
+// RemoveDeviceGroupMember 从分组中移除节点
+func RemoveDeviceGroupMember(ctx context.Context, groupID int64, deviceID string) error {
+	_, err := DB.ExecContext(ctx, fmt.Sprintf(
+		`DELETE FROM %s WHERE group_id = ? AND device_id = ?`, tableNameDeviceGroupMember,
+	), groupID, deviceID)
+	return err
+}
+
+// ClearDeviceFleetInfo 节点解绑后删除节点的标签和分组信息
+func ClearDeviceFleetInfo(ctx context.Context, deviceID string) error {
+	if _, err := DB.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE device_id = ?`, tableNameDeviceLabel), deviceID); err != nil {
+		return err
+	}
+	_, err := DB.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE device_id = ?`, tableNameDeviceGroupMember), deviceID)
+	return err
+}
@@ -0,0 +1,224 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/go-redis/redis/v9"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	tableNameDeviceUptimeDaily = "device_uptime_daily"
+	tableNameDeviceOutage      = "device_outage"
+)
+
+// nodeUptimeRolledToKey 节点可用性已统计到的时间, device_info_hour 在此之后的数据不能清理
+const nodeUptimeRolledToKey = "TITAN::NODE_UPTIME_ROLLED_TO"
+
+// UptimeSample 计算节点可用性用到的 device_info_hour 字段
+type UptimeSample struct {
+	DeviceID   string    `db:"device_id"`
+	Time       time.Time `db:"time"`
+	OnlineTime float64   `db:"online_time"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+// DeviceUptimeSummary 节点在一段时间内的可用性汇总
+type DeviceUptimeSummary struct {
+	DeviceID        string `json:"device_id" db:"device_id"`
+	DeviceName      string `json:"device_name" db:"device_name"`
+	ObservedSeconds int64  `json:"observed_seconds" db:"observed_seconds"`
+	DownSeconds     int64  `json:"down_seconds" db:"down_seconds"`
+}
+
+// GetNodeUptimeRolledTo 获取节点可用性已统计到的时间, 没有统计过时返回零值
+func GetNodeUptimeRolledTo(ctx context.Context) (time.Time, error) {
+	ts, err := RedisCache.Get(ctx, nodeUptimeRolledToKey).Int64()
+	if err == redis.Nil {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(ts, 0), nil
+}
+
+// SetNodeUptimeRolledTo 记录节点可用性已统计到的时间
+func SetNodeUptimeRolledTo(ctx context.Context, t time.Time) error {
+	return RedisCache.Set(ctx, nodeUptimeRolledToKey, t.Unix(), 0).Err()
+}
+
+// ListDeviceOwners 按 device_id 顺序分页获取节点及其所属用户
+func ListDeviceOwners(ctx context.Context, afterDeviceID string, limit int) ([]*model.DeviceInfo, error) {
+	var out []*model.DeviceInfo
+	err := DB.SelectContext(ctx, &out, fmt.Sprintf(
+		`SELECT device_id, user_id FROM %s WHERE device_id > ? ORDER BY device_id LIMIT ?`, tableNameDeviceInfo,
+	), afterDeviceID, limit)
+	return out, err
+}
+
+// GetUptimeSamples 获取节点在 [start, end) 时间段内的 device_info_hour 数据, 按时间排序
+func GetUptimeSamples(ctx context.Context, deviceIDs []string, start, end time.Time) (map[string][]*UptimeSample, error) {
+	out := make(map[string][]*UptimeSample)
+	if len(deviceIDs) == 0 {
+		return out, nil
+	}
+
+	query, args, err := sqlx.In(fmt.Sprintf(
+		`SELECT device_id, time, online_time, created_at FROM %s WHERE device_id IN (?) AND time >= ? AND time < ? ORDER BY device_id, time`,
+		tableNameDeviceInfoHour), deviceIDs, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	var samples []*UptimeSample
+	if err := DB.SelectContext(ctx, &samples, DB.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+	for _, s := range samples {
+		out[s.DeviceID] = append(out[s.DeviceID], s)
+	}
+	return out, nil
+}
+
+// GetDeviceUptimeRolledTo 批量获取节点已统计到的 device_info_hour 时间, since 之前的记录不查询
+func GetDeviceUptimeRolledTo(ctx context.Context, deviceIDs []string, since time.Time) (map[string]time.Time, error) {
+	out := make(map[string]time.Time)
+	if len(deviceIDs) == 0 {
+		return out, nil
+	}
+
+	query, args, err := sqlx.In(fmt.Sprintf(
+		`SELECT device_id, MAX(rolled_to) AS rolled_to FROM %s WHERE device_id IN (?) AND date >= ? GROUP BY device_id`,
+		tableNameDeviceUptimeDaily), deviceIDs, since.Format(time.DateOnly))
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []*model.DeviceUptimeDaily
+	if err := DB.SelectContext(ctx, &rows, DB.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		out[row.DeviceID] = row.RolledTo
+	}
+	return out, nil
+}
+
+// GetOngoingDeviceOutages 批量获取节点最后一次统计时仍未结束的离线区间
+func GetOngoingDeviceOutages(ctx context.Context, deviceIDs []string) (map[string]*model.DeviceOutage, error) {
+	out := make(map[string]*model.DeviceOutage)
+	if len(deviceIDs) == 0 {
+		return out, nil
+	}
+
+	query, args, err := sqlx.In(fmt.Sprintf(
+		`SELECT * FROM %s WHERE ongoing = 1 AND device_id IN (?)`, tableNameDeviceOutage), deviceIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var outages []*model.DeviceOutage
+	if err := DB.SelectContext(ctx, &outages, DB.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+	for _, o := range outages {
+		out[o.DeviceID] = o
+	}
+	return out, nil
+}
+
+// CloseStaleDeviceOutages 结束 before 之后没有再延长的离线区间, 如已经不再拉取到数据或已解绑的节点, 返回结束的数量
+func CloseStaleDeviceOutages(ctx context.Context, before, now time.Time) (int64, error) {
+	res, err := DB.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET ongoing = 0, updated_at = ? WHERE ongoing = 1 AND end_time < ?`, tableNameDeviceOutage,
+	), now, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// SaveDeviceUptime 累加节点每日的可用性数据, 并写入离线区间; ID 不为 0 的离线区间为更新
+func SaveDeviceUptime(ctx context.Context, daily []*model.DeviceUptimeDaily, outages []*model.DeviceOutage) error {
+	tx, err := DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if len(daily) > 0 {
+		_, err = tx.NamedExecContext(ctx, fmt.Sprintf(
+			`INSERT INTO %s (device_id, date, user_id, observed_seconds, down_seconds, rolled_to, updated_at)
+			VALUES (:device_id, :date, :user_id, :observed_seconds, :down_seconds, :rolled_to, :updated_at)
+			ON DUPLICATE KEY UPDATE user_id = VALUES(user_id), observed_seconds = observed_seconds + VALUES(observed_seconds),
+			down_seconds = down_seconds + VALUES(down_seconds), rolled_to = GREATEST(rolled_to, VALUES(rolled_to)), updated_at = VALUES(updated_at)`,
+			tableNameDeviceUptimeDaily), daily)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, o := range outages {
+		if o.ID > 0 {
+			_, err = tx.NamedExecContext(ctx, fmt.Sprintf(
+				`UPDATE %s SET end_time = :end_time, duration = :duration, ongoing = :ongoing, updated_at = :updated_at WHERE id = :id`,
+				tableNameDeviceOutage), o)
+		} else {
+			_, err = tx.NamedExecContext(ctx, fmt.Sprintf(
+				`INSERT INTO %s (device_id, user_id, start_time, end_time, duration, ongoing, created_at, updated_at)
+				VALUES (:device_id, :user_id, :start_time, :end_time, :duration, :ongoing, :created_at, :updated_at)`,
+				tableNameDeviceOutage), o)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// SumDeviceUptime 按节点汇总用户在 [start, end) 日期内的可用性, deviceID 为空时返回用户所有的节点
+func SumDeviceUptime(ctx context.Context, userID, deviceID string, start, end time.Time) ([]*DeviceUptimeSummary, error) {
+	sb := squirrel.Select("u.device_id", "IFNULL(MAX(d.device_name), '') AS device_name",
+		"SUM(u.observed_seconds) AS observed_seconds", "SUM(u.down_seconds) AS down_seconds").
+		From(tableNameDeviceUptimeDaily+" u").
+		LeftJoin(tableNameDeviceInfo+" d ON d.device_id = u.device_id").
+		Where("u.user_id = ? AND u.date >= ? AND u.date < ?", userID, start.Format(time.DateOnly), end.Format(time.DateOnly)).
+		GroupBy("u.device_id").OrderBy("u.device_id")
+	if deviceID != "" {
+		sb = sb.Where("u.device_id = ?", deviceID)
+	}
+
+	query, args, err := sb.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("generate sum device uptime sql error:%w", err)
+	}
+
+	var out []*DeviceUptimeSummary
+	err = DB.SelectContext(ctx, &out, query, args...)
+	return out, err
+}
+
+// ListDeviceOutages 获取用户的节点在 [start, end) 时间段内的离线区间, deviceID 为空时返回用户所有的节点
+func ListDeviceOutages(ctx context.Context, userID, deviceID string, start, end time.Time) ([]*model.DeviceOutage, error) {
+	sb := squirrel.Select("*").From(tableNameDeviceOutage).
+		Where("user_id = ? AND start_time < ? AND end_time > ?", userID, end, start).
+		OrderBy("device_id", "start_time")
+	if deviceID != "" {
+		sb = sb.Where("device_id = ?", deviceID)
+	}
+
+	query, args, err := sb.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("generate list device outages sql error:%w", err)
+	}
+
+	var out []*model.DeviceOutage
+	err = DB.SelectContext(ctx, &out, query, args...)
+	return out, err
+}
@@ -0,0 +1,52 @@
+package dao_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/dao/daotest"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+)
+
+func TestCloseStaleDeviceOutages(t *testing.T) {
+	db := daotest.Open(t)
+	ctx := context.Background()
+
+	const userID = "device_uptime_test_user"
+	cleanup := func() {
+		daotest.Exec(t, db, `DELETE FROM device_outage WHERE user_id = ?`, userID)
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+
+	now := time.Now().Truncate(time.Second)
+	outages := []*model.DeviceOutage{
+		{DeviceID: "device_uptime_test_stale", UserID: userID, StartTime: now.Add(-2 * time.Hour), EndTime: now.Add(-time.Hour), Ongoing: true},
+		{DeviceID: "device_uptime_test_recent", UserID: userID, StartTime: now.Add(-time.Hour), EndTime: now.Add(-5 * time.Minute), Ongoing: true},
+	}
+	for _, o := range outages {
+		o.Duration = int64(o.EndTime.Sub(o.StartTime) / time.Second)
+		o.CreatedAt, o.UpdatedAt = now, now
+	}
+	if err := dao.SaveDeviceUptime(ctx, nil, outages); err != nil {
+		t.Fatal(err)
+	}
+
+	closed, err := dao.CloseStaleDeviceOutages(ctx, now.Add(-30*time.Minute), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if closed < 1 {
+		t.Fatalf("expect the stale outage to be closed, got %d", closed)
+	}
+
+	ongoing, err := dao.GetOngoingDeviceOutages(ctx, []string{"device_uptime_test_stale", "device_uptime_test_recent"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ongoing) != 1 || ongoing["device_uptime_test_recent"] == nil {
+		t.Fatalf("expect only the recent outage to stay ongoing, got %v", ongoing)
+	}
+}
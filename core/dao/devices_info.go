@@ -555,6 +555,12 @@ func SetDeviceUserIdToCache(ctx context.Context, deviceId, userId, areaId string
 	return err
 }
 
+func DelDeviceUserIdFromCache(ctx context.Context, deviceId, areaId string) error {
+	key := fmt.Sprintf("TITAN::DEVICEUSERS::%s", areaId)
+	_, err := RedisCache.HDel(ctx, key, deviceId).Result()
+	return err
+}
+
 func GetAllDeviceUserIdFromCache(ctx context.Context, areaId string) (map[string]string, error) {
 	key := fmt.Sprintf("TITAN::DEVICEUSERS::%s", areaId)
 	return RedisCache.HGetAll(ctx, key).Result()
@@ -712,8 +718,14 @@ func GetOnlineIPCountsFromCache(ctx context.Context, ip string) (int64, error) {
 
 func GetNodesInfo(ctx context.Context, option QueryOption) (int64, []model.NodesInfo, error) {
 	where := `WHERE device_id <> '' AND active_status = 1`
-	if option.Order != "" && option.OrderField != "" {
-		where += fmt.Sprintf(` ORDER BY %s %s`, option.OrderField, option.Order)
+	// 只能按统计的字段排序, 与内存中的 NodesInfoByUser 一致
+	orderBy := "node_count DESC"
+	switch option.OrderField {
+	case "node_count", "disk_space", "bandwidth_up":
+		orderBy = option.OrderField + " DESC"
+		if strings.EqualFold(option.Order, "asc") {
+			orderBy = option.OrderField + " ASC"
+		}
 	}
 
 	limit := option.PageSize
@@ -732,8 +744,8 @@ func GetNodesInfo(ctx context.Context, option QueryOption) (int64, []model.Nodes
 		return 0, nil, err
 	}
 	var nodeInfo []model.NodesInfo
-	query := fmt.Sprintf("SELECT node_type,user_id,COUNT(device_id) AS node_count,ROUND(sum(disk_space) ,2) as disk_space,ROUND(SUM(bandwidth_up),2) as bandwidth_up FROM %s %s GROUP BY user_id ORDER BY node_count DESC LIMIT %d OFFSET %d",
-		tableNameDeviceInfo, where, limit, offset)
+	query := fmt.Sprintf("SELECT node_type,user_id,COUNT(device_id) AS node_count,ROUND(sum(disk_space) ,2) as disk_space,ROUND(SUM(bandwidth_up),2) as bandwidth_up FROM %s %s GROUP BY user_id ORDER BY %s, user_id LIMIT %d OFFSET %d",
+		tableNameDeviceInfo, where, orderBy, limit, offset)
 	err = DB.SelectContext(ctx, &nodeInfo, query)
 	if err != nil {
 		log.Errorf("GetNodesInfo %v", err)
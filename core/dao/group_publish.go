@@ -0,0 +1,99 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+)
+
+const tableNameAssetGroupPublish = "asset_group_publish"
+
+// groupPublishStaleAfter 超过该时间仍未完成的发布视为已中断, 允许重新发布
+const groupPublishStaleAfter = 2 * time.Hour
+
+// ErrGroupPublishing 文件组有未完成的发布
+var ErrGroupPublishing = fmt.Errorf("group is being published")
+
+const (
+	GroupPublishStatePending   = "pending"
+	GroupPublishStatePublished = "published"
+	GroupPublishStateFailed    = "failed"
+)
+
+// CreateGroupPublish 新建文件组的发布记录, 版本号在上一次的基础上递增; 文件组有未完成的发布时返回 ErrGroupPublishing
+func CreateGroupPublish(ctx context.Context, p *model.AssetGroupPublish) error {
+	tx, err := DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var last struct {
+		Version   int64     `db:"version"`
+		State     string    `db:"state"`
+		UpdatedAt time.Time `db:"updated_at"`
+	}
+	err = tx.GetContext(ctx, &last, fmt.Sprintf(
+		`SELECT version, state, updated_at FROM %s WHERE user_id = ? AND group_id = ? ORDER BY version DESC LIMIT 1 FOR UPDATE`, tableNameAssetGroupPublish,
+	), p.UserID, p.GroupID)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if last.State == GroupPublishStatePending && time.Since(last.UpdatedAt) < groupPublishStaleAfter {
+		return ErrGroupPublishing
+	}
+
+	p.Version = last.Version + 1
+	res, err := tx.NamedExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (user_id, group_id, version, area_id, state, created_at, updated_at)
+		VALUES (:user_id, :group_id, :version, :area_id, :state, :created_at, :updated_at)`, tableNameAssetGroupPublish,
+	), p)
+	if err != nil {
+		return err
+	}
+	if p.ID, err = res.LastInsertId(); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetGroupPublish 获取发布记录
+func GetGroupPublish(ctx context.Context, id int64) (*model.AssetGroupPublish, error) {
+	var out model.AssetGroupPublish
+	err := DB.GetContext(ctx, &out, fmt.Sprintf(`SELECT * FROM %s WHERE id = ?`, tableNameAssetGroupPublish), id)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListGroupPublishes 获取文件组所有的发布记录, 按版本倒序
+func ListGroupPublishes(ctx context.Context, userID string, groupID int64) ([]*model.AssetGroupPublish, error) {
+	var out []*model.AssetGroupPublish
+	err := DB.SelectContext(ctx, &out, fmt.Sprintf(
+		`SELECT * FROM %s WHERE user_id = ? AND group_id = ? ORDER BY version DESC`, tableNameAssetGroupPublish,
+	), userID, groupID)
+	return out, err
+}
+
+// FinishGroupPublish 记录发布结果
+func FinishGroupPublish(ctx context.Context, p *model.AssetGroupPublish) error {
+	p.UpdatedAt = time.Now()
+	_, err := DB.NamedExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET root_cid = :root_cid, size = :size, asset_count = :asset_count, state = :state, error = :error, updated_at = :updated_at WHERE id = :id`,
+		tableNameAssetGroupPublish,
+	), p)
+	return err
+}
+
+// FailGroupPublish 将未完成的发布记录标记为失败
+func FailGroupPublish(ctx context.Context, id int64, reason string) error {
+	_, err := DB.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET state = ?, error = ?, updated_at = ? WHERE id = ? AND state = ?`, tableNameAssetGroupPublish,
+	), GroupPublishStateFailed, reason, time.Now(), id, GroupPublishStatePending)
+	return err
+}
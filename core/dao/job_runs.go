@@ -0,0 +1,105 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+)
+
+const tableNameJobRuns = "job_runs"
+
+const (
+	JobRunStatusRunning = "running"
+	JobRunStatusSuccess = "success"
+	JobRunStatusFailed  = "failed"
+)
+
+// AddJobRun 记录一次定时任务的开始
+func AddJobRun(ctx context.Context, run *model.JobRun) error {
+	res, err := DB.NamedExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (job_name, instance, status, started_at) VALUES (:job_name, :instance, :status, :started_at)`, tableNameJobRuns,
+	), run)
+	if err != nil {
+		return err
+	}
+
+	run.ID, err = res.LastInsertId()
+	return err
+}
+
+// FinishJobRun 更新定时任务的执行结果
+func FinishJobRun(ctx context.Context, run *model.JobRun) error {
+	_, err := DB.NamedExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET status = :status, error = :error, finished_at = :finished_at, duration_ms = :duration_ms WHERE id = :id`, tableNameJobRuns,
+	), run)
+	return err
+}
+
+// GetLatestJobRuns 获取每个定时任务最近一次的执行记录
+func GetLatestJobRuns(ctx context.Context) ([]*model.JobRun, error) {
+	var out []*model.JobRun
+
+	err := DB.SelectContext(ctx, &out, fmt.Sprintf(
+		`SELECT r.* FROM %s r INNER JOIN (SELECT job_name, max(id) AS id FROM %s GROUP BY job_name) l ON r.id = l.id ORDER BY r.job_name`,
+		tableNameJobRuns, tableNameJobRuns,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// ListJobRuns 分页获取定时任务的执行记录
+func ListJobRuns(ctx context.Context, jobName, status string, option QueryOption) ([]*model.JobRun, int64, error) {
+	var (
+		total int64
+		out   []*model.JobRun
+	)
+
+	limit := option.PageSize
+	if limit <= 0 {
+		limit = 50
+	}
+	offset := 0
+	if option.Page > 0 {
+		offset = limit * (option.Page - 1)
+	}
+
+	sb := squirrel.Select().From(tableNameJobRuns)
+	if jobName != "" {
+		sb = sb.Where("job_name = ?", jobName)
+	}
+	if status != "" {
+		sb = sb.Where("status = ?", status)
+	}
+
+	query, args, err := sb.Column("count(*)").ToSql()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := DB.GetContext(ctx, &total, query, args...); err != nil {
+		return nil, 0, err
+	}
+
+	query, args, err = sb.Column("*").OrderBy("id DESC").Limit(uint64(limit)).Offset(uint64(offset)).ToSql()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := DB.SelectContext(ctx, &out, query, args...); err != nil {
+		return nil, 0, err
+	}
+
+	return out, total, nil
+}
+
+// DeleteJobRunsBefore 清理过期的执行记录
+func DeleteJobRunsBefore(ctx context.Context, before time.Time) error {
+	_, err := DB.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE started_at < ?`, tableNameJobRuns), before)
+	return err
+}
@@ -3,6 +3,8 @@ package dao
 import (
 	"context"
 	"fmt"
+	"time"
+
 	"github.com/gnasnik/titan-explorer/core/generated/model"
 )
 
@@ -21,10 +23,26 @@ func GetLoginLocation(ctx context.Context, userId string) string {
 }
 
 func AddLoginLog(ctx context.Context, log *model.LoginLog) error {
+	return AddLoginLogs(ctx, []*model.LoginLog{log})
+}
+
+// AddLoginLogs 批量写入登录日志
+func AddLoginLogs(ctx context.Context, logs []*model.LoginLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	for _, l := range logs {
+		if l.CreatedAt.IsZero() {
+			l.CreatedAt = now
+		}
+	}
+
 	_, err := DB.NamedExecContext(ctx, fmt.Sprintf(
 		`INSERT INTO %s (login_username, ip_address, login_location, browser, os, status, msg, created_at) VALUES 
-		(:login_username, :ip_address, :login_location, :browser, :os, :status, :msg, now());`, tableNameloginLog,
-	), log)
+		(:login_username, :ip_address, :login_location, :browser, :os, :status, :msg, :created_at)`, tableNameloginLog,
+	), logs)
 	return err
 }
 
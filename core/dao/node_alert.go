@@ -0,0 +1,204 @@
+package dao
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	tableNameNodeAlertRule = "node_alert_rule"
+	tableNameNodeAlert     = "node_alert"
+)
+
+// nodeAlertSnapshotKey 节点上一次拉取时的告警相关状态, 用于判断状态变化
+const nodeAlertSnapshotKey = "TITAN::NODE_ALERT_SNAPSHOT"
+
+const (
+	NodeAlertTypeOffline     = "offline"
+	NodeAlertTypeOfflineLong = "offline_long"
+	NodeAlertTypeNATDegraded = "nat_degraded"
+	NodeAlertTypeDiskUsage   = "disk_usage"
+)
+
+const (
+	NodeAlertStatePending = "pending"
+	NodeAlertStateSent    = "sent"
+	NodeAlertStateFailed  = "failed"
+	NodeAlertStateSkipped = "skipped"
+)
+
+// NodeAlertSnapshot 节点上一次拉取时的状态
+type NodeAlertSnapshot struct {
+	Status         string    `json:"status"`
+	NATType        string    `json:"nat_type"`
+	OfflineSince   time.Time `json:"offline_since"`
+	OfflineAlerted bool      `json:"offline_alerted"`
+	DiskAlerted    bool      `json:"disk_alerted"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// GetNodeAlertRule 获取用户的告警规则
+func GetNodeAlertRule(ctx context.Context, userID string) (*model.NodeAlertRule, error) {
+	var out model.NodeAlertRule
+	err := DB.GetContext(ctx, &out, fmt.Sprintf(`SELECT * FROM %s WHERE user_id = ?`, tableNameNodeAlertRule), userID)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetEnabledNodeAlertRules 批量获取已开启的告警规则, 按用户返回
+func GetEnabledNodeAlertRules(ctx context.Context, userIDs []string) (map[string]*model.NodeAlertRule, error) {
+	out := make(map[string]*model.NodeAlertRule)
+	if len(userIDs) == 0 {
+		return out, nil
+	}
+
+	query, args, err := sqlx.In(fmt.Sprintf(
+		`SELECT * FROM %s WHERE user_id IN (?) AND enabled = 1`, tableNameNodeAlertRule), userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []*model.NodeAlertRule
+	if err := DB.SelectContext(ctx, &rules, DB.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		out[rule.UserID] = rule
+	}
+	return out, nil
+}
+
+// UpsertNodeAlertRule 新增或更新用户的告警规则
+func UpsertNodeAlertRule(ctx context.Context, rule *model.NodeAlertRule) error {
+	_, err := DB.NamedExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (user_id, enabled, notify_email, webhook_url, offline_minutes, nat_degrade, disk_threshold, quiet_start, quiet_end, timezone, dedup_minutes, created_at, updated_at)
+		VALUES (:user_id, :enabled, :notify_email, :webhook_url, :offline_minutes, :nat_degrade, :disk_threshold, :quiet_start, :quiet_end, :timezone, :dedup_minutes, :created_at, :updated_at)
+		ON DUPLICATE KEY UPDATE enabled = VALUES(enabled), notify_email = VALUES(notify_email), webhook_url = VALUES(webhook_url), offline_minutes = VALUES(offline_minutes),
+		nat_degrade = VALUES(nat_degrade), disk_threshold = VALUES(disk_threshold), quiet_start = VALUES(quiet_start), quiet_end = VALUES(quiet_end),
+		timezone = VALUES(timezone), dedup_minutes = VALUES(dedup_minutes), updated_at = VALUES(updated_at)`, tableNameNodeAlertRule,
+	), rule)
+	return err
+}
+
+// AddNodeAlert 新增告警记录
+func AddNodeAlert(ctx context.Context, alert *model.NodeAlert) error {
+	res, err := DB.NamedExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (user_id, device_id, alert_type, message, state, notify_at, created_at, updated_at)
+		VALUES (:user_id, :device_id, :alert_type, :message, :state, :notify_at, :created_at, :updated_at)`, tableNameNodeAlert,
+	), alert)
+	if err != nil {
+		return err
+	}
+	alert.ID, err = res.LastInsertId()
+	return err
+}
+
+// NodeAlertExists 节点在 since 之后是否已经有同类告警, 用于去重
+func NodeAlertExists(ctx context.Context, deviceID, alertType string, since time.Time) (bool, error) {
+	var count int64
+	err := DB.GetContext(ctx, &count, fmt.Sprintf(
+		`SELECT COUNT(*) FROM %s WHERE device_id = ? AND alert_type = ? AND created_at >= ?`, tableNameNodeAlert,
+	), deviceID, alertType, since)
+	return count > 0, err
+}
+
+// GetNodeAlert 获取告警记录
+func GetNodeAlert(ctx context.Context, id int64) (*model.NodeAlert, error) {
+	var out model.NodeAlert
+	err := DB.GetContext(ctx, &out, fmt.Sprintf(`SELECT * FROM %s WHERE id = ?`, tableNameNodeAlert), id)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateNodeAlert 更新告警的发送状态
+func UpdateNodeAlert(ctx context.Context, alert *model.NodeAlert) error {
+	alert.UpdatedAt = time.Now()
+	_, err := DB.NamedExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET state = :state, channels = :channels, error = :error, updated_at = :updated_at WHERE id = :id`, tableNameNodeAlert,
+	), alert)
+	return err
+}
+
+// ListNodeAlerts 获取用户的告警记录, deviceID 和 alertType 为空时不过滤
+func ListNodeAlerts(ctx context.Context, userID, deviceID, alertType string, limit, offset int) (int64, []*model.NodeAlert, error) {
+	sb := squirrel.Select().From(tableNameNodeAlert).Where("user_id = ?", userID)
+	if deviceID != "" {
+		sb = sb.Where("device_id = ?", deviceID)
+	}
+	if alertType != "" {
+		sb = sb.Where("alert_type = ?", alertType)
+	}
+
+	var total int64
+	query, args, err := sb.Columns("COUNT(*)").ToSql()
+	if err != nil {
+		return 0, nil, fmt.Errorf("generate count node alerts sql error:%w", err)
+	}
+	if err := DB.GetContext(ctx, &total, query, args...); err != nil {
+		return 0, nil, err
+	}
+
+	query, args, err = sb.Columns("*").OrderBy("created_at DESC").Limit(uint64(limit)).Offset(uint64(offset)).ToSql()
+	if err != nil {
+		return 0, nil, fmt.Errorf("generate list node alerts sql error:%w", err)
+	}
+
+	var out []*model.NodeAlert
+	err = DB.SelectContext(ctx, &out, query, args...)
+	return total, out, err
+}
+
+// GetNodeAlertSnapshots 批量获取节点上一次的状态, 没有记录的节点不在返回结果中
+func GetNodeAlertSnapshots(ctx context.Context, deviceIDs []string) (map[string]*NodeAlertSnapshot, error) {
+	out := make(map[string]*NodeAlertSnapshot)
+	if len(deviceIDs) == 0 {
+		return out, nil
+	}
+
+	values, err := RedisCache.HMGet(ctx, nodeAlertSnapshotKey, deviceIDs...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, val := range values {
+		s, ok := val.(string)
+		if !ok {
+			continue
+		}
+		var snapshot NodeAlertSnapshot
+		if err := json.Unmarshal([]byte(s), &snapshot); err != nil {
+			continue
+		}
+		out[deviceIDs[i]] = &snapshot
+	}
+	return out, nil
+}
+
+// SetNodeAlertSnapshots 保存节点本次的状态
+func SetNodeAlertSnapshots(ctx context.Context, snapshots map[string]*NodeAlertSnapshot) error {
+	if len(snapshots) == 0 {
+		return nil
+	}
+
+	values := make(map[string]interface{}, len(snapshots))
+	for id, snapshot := range snapshots {
+		data, err := json.Marshal(snapshot)
+		if err != nil {
+			return err
+		}
+		values[id] = data
+	}
+
+	_, err := RedisCache.HSet(ctx, nodeAlertSnapshotKey, values).Result()
+	return err
+}
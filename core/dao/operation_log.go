@@ -3,28 +3,76 @@ package dao
 import (
 	"context"
 	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
 	"github.com/gnasnik/titan-explorer/core/generated/model"
 )
 
 var tableNameOperationLog = "operation_log"
 
+// OperationLogFilter 操作日志的查询条件
+type OperationLogFilter struct {
+	Username   string
+	Action     string
+	TargetType string
+	TargetID   string
+	Start      time.Time
+	End        time.Time
+}
+
 func AddOperationLog(ctx context.Context, log *model.OperationLog) error {
-	_, err := DB.NamedExecContext(ctx, fmt.Sprintf(
-		`INSERT INTO %s (title, business_type, method, request_method, operator_type, operator_username,
-				operator_url, operator_ip, operator_location, operator_param, json_result, status, error_msg, created_at, updated_at)
-			VALUES (:title, :business_type, :method, :request_method, :operator_type, :operator_username, :operator_url, 
-			    :operator_ip, :operator_location, :operator_param, :json_result, :status, :error_msg, now(), now());`, tableNameOperationLog,
-	), log)
-	return err
+	return AddOperationLogs(ctx, []*model.OperationLog{log})
 }
 
-func ListOperationLog(ctx context.Context, option QueryOption) ([]*model.OperationLog, int64, error) {
-	var args []interface{}
+const insertOperationLogSQL = `INSERT INTO %s (title, business_type, method, request_method, operator_type, operator_username,
+		operator_url, operator_ip, operator_location, operator_param, json_result, status, error_msg,
+		action, actor, target_type, target_id, before_value, after_value, user_agent, created_at, updated_at)
+	VALUES (:title, :business_type, :method, :request_method, :operator_type, :operator_username, :operator_url,
+		:operator_ip, :operator_location, :operator_param, :json_result, :status, :error_msg,
+		:action, :actor, :target_type, :target_id, :before_value, :after_value, :user_agent, :created_at, :updated_at)`
+
+// AddOperationLogs 批量写入操作日志, 批量写入失败时逐条写入, 避免一条错误的记录导致整批丢失;
+// 只有全部写入失败时才返回错误, 避免重试时重复写入已成功的记录
+func AddOperationLogs(ctx context.Context, logs []*model.OperationLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	for _, l := range logs {
+		if l.CreatedAt.IsZero() {
+			l.CreatedAt = now
+		}
+		l.UpdatedAt = now
+	}
+
+	query := fmt.Sprintf(insertOperationLogSQL, tableNameOperationLog)
+	_, err := DB.NamedExecContext(ctx, query, logs)
+	if err == nil || len(logs) == 1 {
+		return err
+	}
+
+	var written int
+	for _, l := range logs {
+		if _, ierr := DB.NamedExecContext(ctx, query, l); ierr != nil {
+			log.Errorf("add operation log %s of %s: %v", l.Action, l.OperatorUsername, ierr)
+			continue
+		}
+		written++
+	}
+	if written == 0 {
+		return err
+	}
+	return nil
+}
+
+func ListOperationLog(ctx context.Context, filter OperationLogFilter, option QueryOption) ([]*model.OperationLog, int64, error) {
 	var total int64
 	var out []*model.OperationLog
 
 	limit := option.PageSize
-	offset := option.Page
+	offset := 0
 	if option.PageSize <= 0 {
 		limit = 50
 	}
@@ -32,16 +80,43 @@ func ListOperationLog(ctx context.Context, option QueryOption) ([]*model.Operati
 		offset = limit * (option.Page - 1)
 	}
 
-	err := DB.GetContext(ctx, &total, fmt.Sprintf(
-		`SELECT count(*) FROM %s`, tableNameOperationLog,
-	), args)
+	where := squirrel.And{}
+	if filter.Username != "" {
+		where = append(where, squirrel.Eq{"operator_username": filter.Username})
+	}
+	if filter.Action != "" {
+		where = append(where, squirrel.Eq{"action": filter.Action})
+	}
+	if filter.TargetType != "" {
+		where = append(where, squirrel.Eq{"target_type": filter.TargetType})
+	}
+	if filter.TargetID != "" {
+		where = append(where, squirrel.Eq{"target_id": filter.TargetID})
+	}
+	if !filter.Start.IsZero() {
+		where = append(where, squirrel.GtOrEq{"created_at": filter.Start})
+	}
+	if !filter.End.IsZero() {
+		where = append(where, squirrel.Lt{"created_at": filter.End})
+	}
+
+	query, args, err := squirrel.Select("count(*)").From(tableNameOperationLog).Where(where).ToSql()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = DB.GetContext(ctx, &total, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query, args, err = squirrel.Select("*").From(tableNameOperationLog).Where(where).
+		OrderBy("id DESC").Limit(uint64(limit)).Offset(uint64(offset)).ToSql()
 	if err != nil {
 		return nil, 0, err
 	}
 
-	err = DB.SelectContext(ctx, &out, fmt.Sprintf(
-		`SELECT * FROM %s LIMIT %d OFFSET %d`, tableNameOperationLog, limit, offset,
-	), args...)
+	err = DB.SelectContext(ctx, &out, query, args...)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -0,0 +1,142 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+)
+
+const (
+	tableNameQuotaPlan       = "quota_plan"
+	tableNameQuotaPlanAssign = "quota_plan_assign"
+)
+
+const (
+	QuotaSubjectUser   = "user"
+	QuotaSubjectTenant = "tenant"
+)
+
+// ListQuotaPlans 获取所有套餐
+func ListQuotaPlans(ctx context.Context) ([]*model.QuotaPlan, error) {
+	var out []*model.QuotaPlan
+	err := DB.SelectContext(ctx, &out, fmt.Sprintf(`SELECT * FROM %s ORDER BY id`, tableNameQuotaPlan))
+	return out, err
+}
+
+// GetQuotaPlan 获取套餐
+func GetQuotaPlan(ctx context.Context, id int64) (*model.QuotaPlan, error) {
+	var out model.QuotaPlan
+	err := DB.GetContext(ctx, &out, fmt.Sprintf(`SELECT * FROM %s WHERE id = ?`, tableNameQuotaPlan), id)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetQuotaPlanByName 按名称获取套餐
+func GetQuotaPlanByName(ctx context.Context, name string) (*model.QuotaPlan, error) {
+	var out model.QuotaPlan
+	err := DB.GetContext(ctx, &out, fmt.Sprintf(`SELECT * FROM %s WHERE name = ?`, tableNameQuotaPlan), name)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetDefaultQuotaPlan 获取默认套餐
+func GetDefaultQuotaPlan(ctx context.Context) (*model.QuotaPlan, error) {
+	var out model.QuotaPlan
+	err := DB.GetContext(ctx, &out, fmt.Sprintf(`SELECT * FROM %s WHERE is_default = 1 ORDER BY id LIMIT 1`, tableNameQuotaPlan))
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetAssignedQuotaPlan 获取分配给用户或租户的套餐, 未分配时返回 sql.ErrNoRows
+func GetAssignedQuotaPlan(ctx context.Context, subjectType, subjectID string) (*model.QuotaPlan, error) {
+	var out model.QuotaPlan
+	err := DB.GetContext(ctx, &out, fmt.Sprintf(
+		`SELECT p.* FROM %s p INNER JOIN %s a ON a.plan_id = p.id WHERE a.subject_type = ? AND a.subject_id = ?`,
+		tableNameQuotaPlan, tableNameQuotaPlanAssign,
+	), subjectType, subjectID)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SaveQuotaPlan 新增或修改套餐
+func SaveQuotaPlan(ctx context.Context, plan *model.QuotaPlan) error {
+	tx, err := DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	plan.UpdatedAt = time.Now()
+	if plan.ID == 0 {
+		plan.CreatedAt = plan.UpdatedAt
+		res, err := tx.NamedExecContext(ctx, fmt.Sprintf(
+			`INSERT INTO %s (name, storage_size, monthly_traffic, peak_bandwidth, file_count, max_file_size, api_key_count, share_count, download_count, is_default, created_at, updated_at)
+			VALUES (:name, :storage_size, :monthly_traffic, :peak_bandwidth, :file_count, :max_file_size, :api_key_count, :share_count, :download_count, :is_default, :created_at, :updated_at)`, tableNameQuotaPlan,
+		), plan)
+		if err != nil {
+			return err
+		}
+		if plan.ID, err = res.LastInsertId(); err != nil {
+			return err
+		}
+	} else {
+		_, err = tx.NamedExecContext(ctx, fmt.Sprintf(
+			`UPDATE %s SET name = :name, storage_size = :storage_size, monthly_traffic = :monthly_traffic, peak_bandwidth = :peak_bandwidth,
+			file_count = :file_count, max_file_size = :max_file_size, api_key_count = :api_key_count,
+			share_count = :share_count, download_count = :download_count, is_default = :is_default, updated_at = :updated_at WHERE id = :id`, tableNameQuotaPlan,
+		), plan)
+		if err != nil {
+			return err
+		}
+	}
+
+	// 只能有一个默认套餐
+	if plan.IsDefault {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET is_default = 0 WHERE id <> ?`, tableNameQuotaPlan), plan.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteQuotaPlan 删除套餐, 默认套餐和已分配给用户或租户的套餐不能删除, 未删除时返回 false
+func DeleteQuotaPlan(ctx context.Context, id int64) (bool, error) {
+	res, err := DB.ExecContext(ctx, fmt.Sprintf(
+		`DELETE FROM %s WHERE id = ? AND is_default = 0 AND NOT EXISTS (SELECT 1 FROM %s WHERE plan_id = ?)`,
+		tableNameQuotaPlan, tableNameQuotaPlanAssign,
+	), id, id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+// AssignQuotaPlan 给用户或租户分配套餐, planID 为 0 时取消分配, 恢复使用默认套餐;
+// 套餐的上限在判断时读取, 不修改用户和租户原有的存储空间和流量上限
+func AssignQuotaPlan(ctx context.Context, subjectType, subjectID string, planID int64) error {
+	if planID == 0 {
+		_, err := DB.ExecContext(ctx, fmt.Sprintf(
+			`DELETE FROM %s WHERE subject_type = ? AND subject_id = ?`, tableNameQuotaPlanAssign,
+		), subjectType, subjectID)
+		return err
+	}
+
+	_, err := DB.ExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (subject_type, subject_id, plan_id, updated_at) VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE plan_id = VALUES(plan_id), updated_at = VALUES(updated_at)`, tableNameQuotaPlanAssign,
+	), subjectType, subjectID, planID, time.Now())
+	return err
+}
@@ -0,0 +1,319 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/pkg/formatter"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	tableNameRewardReconcileRun  = "reward_reconcile_run"
+	tableNameRewardReconcileItem = "reward_reconcile_item"
+)
+
+const (
+	RewardReconcileRunStateRunning = "running"
+	RewardReconcileRunStateDone    = "done"
+	RewardReconcileRunStateFailed  = "failed"
+)
+
+const (
+	RewardReconcileItemStateFlagged  = "flagged"
+	RewardReconcileItemStateApproved = "approved"
+	RewardReconcileItemStateRepaired = "repaired"
+	RewardReconcileItemStateFailed   = "failed"
+)
+
+// DeviceIncomeSum 节点在 device_info_daily 中的收益之和
+type DeviceIncomeSum struct {
+	DeviceID string  `db:"device_id"`
+	UserID   string  `db:"user_id"`
+	Income   float64 `db:"income"`
+}
+
+// SumDeviceDailyIncome 批量获取节点所有每日收益之和
+func SumDeviceDailyIncome(ctx context.Context, deviceIDs []string) (map[string]*DeviceIncomeSum, error) {
+	out := make(map[string]*DeviceIncomeSum)
+	if len(deviceIDs) == 0 {
+		return out, nil
+	}
+
+	query, args, err := sqlx.In(fmt.Sprintf(
+		`SELECT device_id, MAX(user_id) AS user_id, IFNULL(SUM(income), 0) AS income FROM %s WHERE device_id IN (?) GROUP BY device_id`,
+		tableNameDeviceInfoDaily), deviceIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var sums []*DeviceIncomeSum
+	if err := DB.SelectContext(ctx, &sums, DB.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+	for _, s := range sums {
+		out[s.DeviceID] = s
+	}
+	return out, nil
+}
+
+// AddRewardReconcileRun 新建对账记录
+func AddRewardReconcileRun(ctx context.Context, run *model.RewardReconcileRun) error {
+	res, err := DB.NamedExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (area_id, state, tolerance, started_at) VALUES (:area_id, :state, :tolerance, :started_at)`, tableNameRewardReconcileRun,
+	), run)
+	if err != nil {
+		return err
+	}
+	run.ID, err = res.LastInsertId()
+	return err
+}
+
+// UpdateRewardReconcileRun 更新对账的状态和统计
+func UpdateRewardReconcileRun(ctx context.Context, run *model.RewardReconcileRun) error {
+	_, err := DB.NamedExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET state = :state, node_count = :node_count, discrepancy_count = :discrepancy_count, total_diff = :total_diff,
+			error = :error, finished_at = :finished_at WHERE id = :id`, tableNameRewardReconcileRun,
+	), run)
+	return err
+}
+
+// AddRewardReconcileItems 批量写入对账差异
+func AddRewardReconcileItems(ctx context.Context, items []*model.RewardReconcileItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	_, err := DB.NamedExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (run_id, device_id, user_id, area_id, scheduler_profit, daily_sum, diff, state, created_at, updated_at)
+			VALUES (:run_id, :device_id, :user_id, :area_id, :scheduler_profit, :daily_sum, :diff, :state, :created_at, :updated_at)`,
+		tableNameRewardReconcileItem), items)
+	return err
+}
+
+// GetRewardReconcileRun 获取对账记录
+func GetRewardReconcileRun(ctx context.Context, id int64) (*model.RewardReconcileRun, error) {
+	var out model.RewardReconcileRun
+	err := DB.GetContext(ctx, &out, fmt.Sprintf(`SELECT * FROM %s WHERE id = ?`, tableNameRewardReconcileRun), id)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListRewardReconcileRuns 分页获取对账记录, 按开始时间倒序, areaID 为空时返回所有区域
+func ListRewardReconcileRuns(ctx context.Context, areaID string, limit, offset int) (int64, []*model.RewardReconcileRun, error) {
+	sb := squirrel.Select().From(tableNameRewardReconcileRun)
+	if areaID != "" {
+		sb = sb.Where("area_id = ?", areaID)
+	}
+
+	var total int64
+	query, args, err := sb.Columns("COUNT(*)").ToSql()
+	if err != nil {
+		return 0, nil, fmt.Errorf("generate count reward reconcile runs sql error:%w", err)
+	}
+	if err := DB.GetContext(ctx, &total, query, args...); err != nil {
+		return 0, nil, err
+	}
+
+	query, args, err = sb.Columns("*").OrderBy("id DESC").Limit(uint64(limit)).Offset(uint64(offset)).ToSql()
+	if err != nil {
+		return 0, nil, fmt.Errorf("generate list reward reconcile runs sql error:%w", err)
+	}
+
+	var out []*model.RewardReconcileRun
+	err = DB.SelectContext(ctx, &out, query, args...)
+	return total, out, err
+}
+
+// ListRewardReconcileItems 分页获取对账的差异, 按差异绝对值从大到小排序, state 为空时返回所有状态
+func ListRewardReconcileItems(ctx context.Context, runID int64, state string, limit, offset int) (int64, []*model.RewardReconcileItem, error) {
+	sb := squirrel.Select().From(tableNameRewardReconcileItem).Where("run_id = ?", runID)
+	if state != "" {
+		sb = sb.Where("state = ?", state)
+	}
+
+	var total int64
+	query, args, err := sb.Columns("COUNT(*)").ToSql()
+	if err != nil {
+		return 0, nil, fmt.Errorf("generate count reward reconcile items sql error:%w", err)
+	}
+	if err := DB.GetContext(ctx, &total, query, args...); err != nil {
+		return 0, nil, err
+	}
+
+	query, args, err = sb.Columns("*").OrderBy("ABS(diff) DESC", "id").Limit(uint64(limit)).Offset(uint64(offset)).ToSql()
+	if err != nil {
+		return 0, nil, fmt.Errorf("generate list reward reconcile items sql error:%w", err)
+	}
+
+	var out []*model.RewardReconcileItem
+	err = DB.SelectContext(ctx, &out, query, args...)
+	return total, out, err
+}
+
+// ApproveRewardReconcileItems 批准修复对账差异, ids 为空时批准该次对账所有待处理的差异; 修复失败的可以重新批准
+func ApproveRewardReconcileItems(ctx context.Context, runID int64, ids []int64, approvedBy string) (int64, error) {
+	sb := squirrel.Update(tableNameRewardReconcileItem).
+		Set("state", RewardReconcileItemStateApproved).
+		Set("approved_by", approvedBy).
+		Set("error", "").
+		Set("updated_at", time.Now()).
+		Where("run_id = ?", runID).
+		Where(squirrel.Eq{"state": []string{RewardReconcileItemStateFlagged, RewardReconcileItemStateFailed}})
+	if len(ids) > 0 {
+		sb = sb.Where(squirrel.Eq{"id": ids})
+	}
+
+	query, args, err := sb.ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("generate approve reward reconcile items sql error:%w", err)
+	}
+
+	res, err := DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// RevertRewardReconcileItems 批准后未能开始修复时恢复为待处理, ids 为空时恢复该次对账中 approvedBy 批准的所有待修复差异
+func RevertRewardReconcileItems(ctx context.Context, runID int64, ids []int64, approvedBy string) (int64, error) {
+	sb := squirrel.Update(tableNameRewardReconcileItem).
+		Set("state", RewardReconcileItemStateFlagged).
+		Set("approved_by", "").
+		Set("updated_at", time.Now()).
+		Where("run_id = ? AND state = ? AND approved_by = ?", runID, RewardReconcileItemStateApproved, approvedBy)
+	if len(ids) > 0 {
+		sb = sb.Where(squirrel.Eq{"id": ids})
+	}
+
+	query, args, err := sb.ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("generate revert reward reconcile items sql error:%w", err)
+	}
+
+	res, err := DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// GetApprovedRewardReconcileItems 获取对账中已批准待修复的差异
+func GetApprovedRewardReconcileItems(ctx context.Context, runID int64) ([]*model.RewardReconcileItem, error) {
+	var out []*model.RewardReconcileItem
+	err := DB.SelectContext(ctx, &out, fmt.Sprintf(
+		`SELECT * FROM %s WHERE run_id = ? AND state = ? ORDER BY id`, tableNameRewardReconcileItem,
+	), runID, RewardReconcileItemStateApproved)
+	return out, err
+}
+
+// UpdateRewardReconcileItem 更新差异的修复结果
+func UpdateRewardReconcileItem(ctx context.Context, item *model.RewardReconcileItem) error {
+	_, err := DB.NamedExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET state = :state, adjustment = :adjustment, error = :error, updated_at = :updated_at WHERE id = :id`,
+		tableNameRewardReconcileItem), item)
+	return err
+}
+
+// deviceDayIncome 节点某一天 device_info_hour 中最大的累计收益
+type deviceDayIncome struct {
+	Day    string  `db:"day"`
+	Income float64 `db:"income"`
+}
+
+// RepairDeviceDailyIncome 按 device_info_hour 重新计算节点每天的收益并逐天修复 device_info_daily:
+// 当天的收益为当天最大的累计收益减去之前最大的累计收益, 与 tools/fix_days_rewards 的算法一致.
+// 同一天有多条记录时只保留最后写入的一条; 没有之前整点数据的第一天和整点数据已清理的日期无法计算, 保持不变.
+// 返回修复前后收益之和的差值
+func RepairDeviceDailyIncome(ctx context.Context, deviceID, userID string) (float64, error) {
+	tx, err := DB.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var before float64
+	err = tx.GetContext(ctx, &before, fmt.Sprintf(
+		`SELECT IFNULL(SUM(income), 0) FROM %s WHERE device_id = ? FOR UPDATE`, tableNameDeviceInfoDaily), deviceID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(
+		`DELETE d FROM %s d INNER JOIN (
+			SELECT DATE(time) AS day, MAX(id) AS keep_id FROM %s WHERE device_id = ? GROUP BY DATE(time) HAVING COUNT(*) > 1
+		) k ON DATE(d.time) = k.day AND d.id <> k.keep_id WHERE d.device_id = ?`,
+		tableNameDeviceInfoDaily, tableNameDeviceInfoDaily), deviceID, deviceID)
+	if err != nil {
+		return 0, err
+	}
+
+	var days []*deviceDayIncome
+	err = tx.SelectContext(ctx, &days, fmt.Sprintf(
+		`SELECT DATE_FORMAT(time, '%%Y-%%m-%%d') AS day, MAX(hour_income) AS income FROM %s WHERE device_id = ? GROUP BY day ORDER BY day`,
+		tableNameDeviceInfoHour), deviceID)
+	if err != nil {
+		return 0, err
+	}
+	if len(days) < 2 {
+		return 0, fmt.Errorf("not enough hourly income of %s to recompute daily income", deviceID)
+	}
+
+	prev := days[0].Income
+	for _, day := range days[1:] {
+		income := day.Income - prev
+		if day.Income > prev {
+			prev = day.Income
+		}
+
+		res, err := tx.ExecContext(ctx, fmt.Sprintf(
+			`UPDATE %s SET income = ?, updated_at = now() WHERE device_id = ? AND DATE(time) = ?`, tableNameDeviceInfoDaily),
+			income, deviceID, day.Day)
+		if err != nil {
+			return 0, err
+		}
+
+		// income 未变化时 RowsAffected 也为 0, 需要确认当天是否有记录
+		if rows, _ := res.RowsAffected(); rows > 0 {
+			continue
+		}
+		var count int64
+		err = tx.GetContext(ctx, &count, fmt.Sprintf(
+			`SELECT COUNT(*) FROM %s WHERE device_id = ? AND DATE(time) = ?`, tableNameDeviceInfoDaily), deviceID, day.Day)
+		if err != nil {
+			return 0, err
+		}
+		if count > 0 {
+			continue
+		}
+
+		dayTime, err := time.ParseInLocation(formatter.TimeFormatDateOnly, day.Day, time.Local)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(
+			`INSERT INTO %s (created_at, updated_at, user_id, device_id, time, income) VALUES (now(), now(), ?, ?, ?, ?)`, tableNameDeviceInfoDaily),
+			userID, deviceID, dayTime, income)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var after float64
+	err = tx.GetContext(ctx, &after, fmt.Sprintf(
+		`SELECT IFNULL(SUM(income), 0) FROM %s WHERE device_id = ?`, tableNameDeviceInfoDaily), deviceID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return after - before, nil
+}
@@ -31,6 +31,49 @@ func BulkUpsertDeviceInfoHours(ctx context.Context, hourInfos []*model.DeviceInf
 	return err
 }
 
+// GetDeviceInfoHourSlots 获取区域在 [start, end) 时间段内已有节点数据的整点
+func GetDeviceInfoHourSlots(ctx context.Context, areaID string, start, end time.Time) (map[time.Time]bool, error) {
+	var slots []string
+	err := DB.SelectContext(ctx, &slots, fmt.Sprintf(
+		`SELECT DISTINCT DATE_FORMAT(h.time, '%%Y-%%m-%%d %%H:00:00') FROM %s h INNER JOIN %s d ON h.device_id = d.device_id
+			WHERE d.area_id = ? AND h.time >= ? AND h.time < ?`, tableNameDeviceInfoHour, tableNameDeviceInfo,
+	), areaID, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[time.Time]bool)
+	for _, slot := range slots {
+		t, err := time.ParseInLocation(formatter.TimeFormatDatetime, slot, time.Local)
+		if err != nil {
+			continue
+		}
+		out[t] = true
+	}
+
+	return out, nil
+}
+
+// CarryForwardDeviceInfoHours 把区域内节点在 slot 之前 lookback 时间内最近一条数据复制到 slot, 已有数据的不会被覆盖
+func CarryForwardDeviceInfoHours(ctx context.Context, areaID string, slot time.Time, lookback time.Duration) (int64, error) {
+	res, err := DB.ExecContext(ctx, fmt.Sprintf(
+		`INSERT IGNORE INTO %s (created_at, updated_at, hour_income, user_id, device_id, online_time, pkg_loss_ratio, latency, nat_ratio,
+				disk_usage, disk_space, bandwidth_up, bandwidth_down, upstream_traffic, downstream_traffic, retrieval_count, block_count, time)
+			SELECT now(), now(), h.hour_income, h.user_id, h.device_id, h.online_time, h.pkg_loss_ratio, h.latency, h.nat_ratio,
+				h.disk_usage, h.disk_space, h.bandwidth_up, h.bandwidth_down, h.upstream_traffic, h.downstream_traffic, h.retrieval_count, h.block_count, ?
+			FROM %s h INNER JOIN (
+				SELECT i.device_id, MAX(i.time) AS time FROM %s i INNER JOIN %s d ON i.device_id = d.device_id
+				WHERE d.area_id = ? AND i.time < ? AND i.time >= ? GROUP BY i.device_id
+			) l ON h.device_id = l.device_id AND h.time = l.time`,
+		tableNameDeviceInfoHour, tableNameDeviceInfoHour, tableNameDeviceInfoHour, tableNameDeviceInfo,
+	), slot, areaID, slot, slot.Add(-lookback))
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
 func BulkUpsertDeviceInfoDaily(ctx context.Context, dailyInfos []*model.DeviceInfoDaily) error {
 	upsertStatement := fmt.Sprintf(`INSERT INTO %s (created_at, updated_at, income, user_id, device_id,
 				online_time, pkg_loss_ratio, latency, nat_ratio, disk_usage, disk_space,bandwidth_up,bandwidth_down, upstream_traffic, downstream_traffic, retrieval_count, block_count, time, external_ip,penalty_profit)
@@ -2,6 +2,9 @@ package dao
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
+	"time"
 
 	"github.com/Masterminds/squirrel"
 	"github.com/gnasnik/titan-explorer/core/generated/model"
@@ -25,6 +28,148 @@ func GetTenantByBuilder(ctx context.Context, sb squirrel.SelectBuilder) (*model.
 	return &tenant, err
 }
 
+// TenantUsage 租户所有子账户的用量汇总
+type TenantUsage struct {
+	UserCount        int64 `db:"user_count" json:"user_count"`
+	UsedStorageSize  int64 `db:"used_storage_size" json:"used_storage_size"`
+	TotalTraffic     int64 `db:"total_traffic" json:"total_traffic"`
+	PeakBandwidth    int64 `db:"peak_bandwidth" json:"peak_bandwidth"`
+	DownloadCount    int64 `db:"download_count" json:"download_count"`
+	StorageQuota     int64 `db:"-" json:"storage_quota"`
+	TrafficQuota     int64 `db:"-" json:"traffic_quota"`
+	RemainingStorage int64 `db:"-" json:"remaining_storage"`
+}
+
+// TenantUsageDaily 租户每日的流量统计
+type TenantUsageDaily struct {
+	Date          string `db:"date" json:"date"`
+	TotalTraffic  int64  `db:"total_traffic" json:"total_traffic"`
+	PeakBandwidth int64  `db:"peak_bandwidth" json:"peak_bandwidth"`
+	DownloadCount int64  `db:"download_count" json:"download_count"`
+}
+
+// CreateTenant 新增租户
+func CreateTenant(ctx context.Context, tenant *model.Tenant) error {
+	_, err := DB.NamedExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (tenant_id, name, api_key, state, upload_notify_url, delete_notify_url, storage_quota, traffic_quota, created_at)
+			VALUES (:tenant_id, :name, :api_key, :state, :upload_notify_url, :delete_notify_url, :storage_quota, :traffic_quota, :created_at)`,
+		tableNameTenants,
+	), tenant)
+	return err
+}
+
+// ListTenants 分页获取租户列表
+func ListTenants(ctx context.Context, option QueryOption) ([]*model.Tenant, int64, error) {
+	var (
+		total int64
+		out   []*model.Tenant
+	)
+
+	limit := option.PageSize
+	if limit <= 0 {
+		limit = 50
+	}
+	offset := 0
+	if option.Page > 0 {
+		offset = limit * (option.Page - 1)
+	}
+
+	err := DB.GetContext(ctx, &total, fmt.Sprintf(`SELECT count(*) FROM %s`, tableNameTenants))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = DB.SelectContext(ctx, &out, fmt.Sprintf(
+		`SELECT * FROM %s ORDER BY created_at DESC LIMIT %d OFFSET %d`, tableNameTenants, limit, offset,
+	))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return out, total, nil
+}
+
+// RotateTenantKey 轮换租户的 key/secret, 旧的 key/secret 在 prevExpireAt 之前仍然有效
+func RotateTenantKey(ctx context.Context, tenantID string, apiKey, prevApiKey []byte, prevExpireAt time.Time) error {
+	_, err := DB.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET api_key = ?, prev_api_key = ?, prev_key_expire_at = ? WHERE tenant_id = ?`, tableNameTenants,
+	), apiKey, prevApiKey, prevExpireAt, tenantID)
+	return err
+}
+
+// UpdateTenantQuota 更新租户的存储空间和流量上限
+func UpdateTenantQuota(ctx context.Context, tenantID string, storageQuota, trafficQuota int64) error {
+	_, err := DB.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET storage_quota = ?, traffic_quota = ? WHERE tenant_id = ?`, tableNameTenants,
+	), storageQuota, trafficQuota, tenantID)
+	return err
+}
+
+// UpdateTenantState 启用或停用租户
+func UpdateTenantState(ctx context.Context, tenantID, state string) error {
+	_, err := DB.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET state = ? WHERE tenant_id = ?`, tableNameTenants,
+	), state, tenantID)
+	return err
+}
+
+// GetTenantUsedStorage 获取租户所有子账户已使用的存储空间
+func GetTenantUsedStorage(ctx context.Context, tenantID string) (int64, error) {
+	var used int64
+	err := DB.GetContext(ctx, &used, fmt.Sprintf(
+		`SELECT IFNULL(SUM(used_storage_size),0) FROM %s WHERE tenant_id = ?`, tableNameUser,
+	), tenantID)
+	return used, err
+}
+
+// GetTenantUsage 获取租户在时间段内的用量汇总, 流量数据来自 asset_storage_hour
+func GetTenantUsage(ctx context.Context, tenantID string, start, end time.Time) (*TenantUsage, error) {
+	var usage TenantUsage
+
+	err := DB.GetContext(ctx, &usage, fmt.Sprintf(
+		`SELECT count(*) AS user_count, IFNULL(SUM(used_storage_size),0) AS used_storage_size FROM %s WHERE tenant_id = ?`, tableNameUser,
+	), tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	var flow struct {
+		TotalTraffic  int64 `db:"total_traffic"`
+		PeakBandwidth int64 `db:"peak_bandwidth"`
+		DownloadCount int64 `db:"download_count"`
+	}
+	err = DB.GetContext(ctx, &flow, fmt.Sprintf(
+		`SELECT IFNULL(SUM(h.total_traffic),0) AS total_traffic, IFNULL(MAX(h.peak_bandwidth),0) AS peak_bandwidth, IFNULL(SUM(h.download_count),0) AS download_count
+			FROM %s h INNER JOIN %s u ON h.user_id = u.username WHERE u.tenant_id = ? AND h.timestamp >= ? AND h.timestamp < ?`,
+		tableAssetStorageHour, tableNameUser,
+	), tenantID, start.Unix(), end.Unix())
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	usage.TotalTraffic = flow.TotalTraffic
+	usage.PeakBandwidth = flow.PeakBandwidth
+	usage.DownloadCount = flow.DownloadCount
+
+	return &usage, nil
+}
+
+// GetTenantUsageDaily 按天统计租户的流量
+func GetTenantUsageDaily(ctx context.Context, tenantID string, start, end time.Time) ([]*TenantUsageDaily, error) {
+	var out []*TenantUsageDaily
+
+	err := DB.SelectContext(ctx, &out, fmt.Sprintf(
+		`SELECT FROM_UNIXTIME(h.timestamp, '%%Y-%%m-%%d') AS date, IFNULL(SUM(h.total_traffic),0) AS total_traffic, IFNULL(MAX(h.peak_bandwidth),0) AS peak_bandwidth, IFNULL(SUM(h.download_count),0) AS download_count
+			FROM %s h INNER JOIN %s u ON h.user_id = u.username WHERE u.tenant_id = ? AND h.timestamp >= ? AND h.timestamp < ? GROUP BY date ORDER BY date`,
+		tableAssetStorageHour, tableNameUser,
+	), tenantID, start.Unix(), end.Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
 // func LoadTenantApiKeyPair(ctx context.Context, tenantID string) (*model.Tenant, string, string, error) {
 // 	var tenant model.Tenant
 // 	query, args, err := squirrel.Select("*").From(tableNameTenants).Where("tenant_id = ?", tenantID).Limit(1).ToSql()
@@ -0,0 +1,210 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+)
+
+const (
+	tableNameTenantWebhookDeliveries = "tenant_webhook_deliveries"
+	tableNameTenantWebhookAttempts   = "tenant_webhook_attempts"
+	tableNameTenantWebhookSubs       = "tenant_webhook_subscriptions"
+)
+
+var (
+	WebhookDeliveryStatePending = "pending"
+	WebhookDeliveryStateSuccess = "success"
+	WebhookDeliveryStateFailed  = "failed"
+	WebhookDeliveryStateDead    = "dead"
+)
+
+// AddWebhookDelivery 新增投递记录, 已存在时忽略
+func AddWebhookDelivery(ctx context.Context, d *model.TenantWebhookDelivery) error {
+	_, err := DB.NamedExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (id, tenant_id, event, url, payload, state, created_at, updated_at)
+			VALUES (:id, :tenant_id, :event, :url, :payload, :state, now(), now()) ON DUPLICATE KEY UPDATE url = VALUES(url)`,
+		tableNameTenantWebhookDeliveries,
+	), d)
+	return err
+}
+
+// AddWebhookAttempt 记录一次投递尝试, 并更新投递记录的状态
+func AddWebhookAttempt(ctx context.Context, attempt *model.TenantWebhookAttempt, state string) error {
+	tx, err := DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.NamedExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (delivery_id, attempt, request_url, request_headers, request_body, response_code, response_body, error, latency_ms, created_at)
+			VALUES (:delivery_id, :attempt, :request_url, :request_headers, :request_body, :response_code, :response_body, :error, :latency_ms, now())`,
+		tableNameTenantWebhookAttempts,
+	), attempt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET state = ?, attempts = attempts + 1, last_status_code = ?, last_error = ? WHERE id = ?`, tableNameTenantWebhookDeliveries,
+	), state, attempt.ResponseCode, attempt.Error, attempt.DeliveryID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetWebhookDelivery 获取租户的投递记录
+func GetWebhookDelivery(ctx context.Context, tenantID, id string) (*model.TenantWebhookDelivery, error) {
+	var out model.TenantWebhookDelivery
+	err := DB.GetContext(ctx, &out, fmt.Sprintf(
+		`SELECT * FROM %s WHERE tenant_id = ? AND id = ?`, tableNameTenantWebhookDeliveries,
+	), tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
+
+// ListWebhookDeliveries 分页获取租户的投递记录
+func ListWebhookDeliveries(ctx context.Context, tenantID, state, event string, option QueryOption) ([]*model.TenantWebhookDelivery, int64, error) {
+	var (
+		total int64
+		out   []*model.TenantWebhookDelivery
+	)
+
+	limit := option.PageSize
+	if limit <= 0 {
+		limit = 50
+	}
+	offset := 0
+	if option.Page > 0 {
+		offset = limit * (option.Page - 1)
+	}
+
+	sb := squirrel.Select().From(tableNameTenantWebhookDeliveries).Where("tenant_id = ?", tenantID)
+	if state != "" {
+		sb = sb.Where("state = ?", state)
+	}
+	if event != "" {
+		sb = sb.Where("event = ?", event)
+	}
+	if option.StartTime != "" {
+		sb = sb.Where("created_at >= ?", option.StartTime)
+	}
+	if option.EndTime != "" {
+		sb = sb.Where("created_at <= ?", option.EndTime)
+	}
+
+	query, args, err := sb.Column("count(*)").ToSql()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := DB.GetContext(ctx, &total, query, args...); err != nil {
+		return nil, 0, err
+	}
+
+	query, args, err = sb.Column("*").OrderBy("created_at DESC").Limit(uint64(limit)).Offset(uint64(offset)).ToSql()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := DB.SelectContext(ctx, &out, query, args...); err != nil {
+		return nil, 0, err
+	}
+
+	return out, total, nil
+}
+
+// ListWebhookAttempts 获取投递记录的所有尝试
+func ListWebhookAttempts(ctx context.Context, deliveryID string) ([]*model.TenantWebhookAttempt, error) {
+	var out []*model.TenantWebhookAttempt
+	err := DB.SelectContext(ctx, &out, fmt.Sprintf(
+		`SELECT * FROM %s WHERE delivery_id = ? ORDER BY id`, tableNameTenantWebhookAttempts,
+	), deliveryID)
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// ResetWebhookDelivery 重新投递前把投递记录重置为 pending, 清空上次的错误和尝试次数
+func ResetWebhookDelivery(ctx context.Context, id string) error {
+	_, err := DB.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET state = ?, attempts = 0, last_status_code = 0, last_error = '' WHERE id = ?`, tableNameTenantWebhookDeliveries,
+	), WebhookDeliveryStatePending, id)
+	return err
+}
+
+// RestoreWebhookDelivery 重新投递入队失败时恢复投递记录原来的状态
+func RestoreWebhookDelivery(ctx context.Context, d *model.TenantWebhookDelivery) error {
+	_, err := DB.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET state = ?, attempts = ?, last_status_code = ?, last_error = ? WHERE id = ? AND state = ? AND attempts = 0`,
+		tableNameTenantWebhookDeliveries,
+	), d.State, d.Attempts, d.LastStatusCode, d.LastError, d.ID, WebhookDeliveryStatePending)
+	return err
+}
+
+// AddWebhookSubscription 新增回调订阅
+func AddWebhookSubscription(ctx context.Context, sub *model.TenantWebhookSubscription) error {
+	res, err := DB.NamedExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (tenant_id, url, events, enabled, created_at, updated_at) VALUES (:tenant_id, :url, :events, :enabled, now(), now())`,
+		tableNameTenantWebhookSubs,
+	), sub)
+	if err != nil {
+		return err
+	}
+
+	sub.ID, err = res.LastInsertId()
+	return err
+}
+
+// UpdateWebhookSubscription 更新回调订阅的地址、事件和开关
+func UpdateWebhookSubscription(ctx context.Context, sub *model.TenantWebhookSubscription) error {
+	_, err := DB.NamedExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET url = :url, events = :events, enabled = :enabled WHERE id = :id AND tenant_id = :tenant_id`,
+		tableNameTenantWebhookSubs,
+	), sub)
+	return err
+}
+
+// DeleteWebhookSubscription 删除回调订阅
+func DeleteWebhookSubscription(ctx context.Context, tenantID string, id int64) error {
+	_, err := DB.ExecContext(ctx, fmt.Sprintf(
+		`DELETE FROM %s WHERE tenant_id = ? AND id = ?`, tableNameTenantWebhookSubs,
+	), tenantID, id)
+	return err
+}
+
+// GetWebhookSubscription 获取租户的回调订阅
+func GetWebhookSubscription(ctx context.Context, tenantID string, id int64) (*model.TenantWebhookSubscription, error) {
+	var out model.TenantWebhookSubscription
+	err := DB.GetContext(ctx, &out, fmt.Sprintf(
+		`SELECT * FROM %s WHERE tenant_id = ? AND id = ?`, tableNameTenantWebhookSubs,
+	), tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
+
+// ListWebhookSubscriptions 获取租户的所有回调订阅
+func ListWebhookSubscriptions(ctx context.Context, tenantID string) ([]*model.TenantWebhookSubscription, error) {
+	var out []*model.TenantWebhookSubscription
+	err := DB.SelectContext(ctx, &out, fmt.Sprintf(
+		`SELECT * FROM %s WHERE tenant_id = ? ORDER BY id`, tableNameTenantWebhookSubs,
+	), tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
@@ -0,0 +1,378 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/jmoiron/sqlx"
+)
+
+const tableNameUserTrash = "user_trash"
+
+const (
+	TrashItemAsset = "asset"
+	TrashItemGroup = "group"
+)
+
+// maxGroupDepth 查找上级文件组的最大层数, 避免数据异常时死循环
+const maxGroupDepth = 64
+
+// TrashUserAsset 把用户文件放入回收站, 文件保留原来的文件组并记录放入回收站的时间, 仍然计入已使用的存储空间;
+// 文件已在回收站中时返回 sql.ErrNoRows
+func TrashUserAsset(ctx context.Context, hash, userID string, purgeAt time.Time) (*model.UserTrash, error) {
+	tx, err := DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var asset model.UserAsset
+	err = tx.GetContext(ctx, &asset, fmt.Sprintf(
+		`SELECT * FROM %s WHERE hash = ? AND user_id = ? AND trashed_at IS NULL FOR UPDATE`, tableUserAsset,
+	), hash, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	item := &model.UserTrash{
+		UserID:        userID,
+		ItemType:      TrashItemAsset,
+		Hash:          hash,
+		Cid:           asset.Cid,
+		Name:          asset.AssetName,
+		Size:          asset.TotalSize,
+		OriginGroupID: asset.GroupID,
+		DeletedAt:     time.Now(),
+		PurgeAt:       purgeAt,
+	}
+	if err := addUserTrash(ctx, tx, item); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET trashed_at = ? WHERE hash = ? AND user_id = ?`, tableUserAsset), item.DeletedAt, hash, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return item, tx.Commit()
+}
+
+// TrashAssetGroup 把文件组放入回收站, 子文件组和文件保持原来的层级, 文件组已在回收站中时返回 sql.ErrNoRows
+func TrashAssetGroup(ctx context.Context, userID string, gid int, purgeAt time.Time) (*model.UserTrash, error) {
+	size, err := getAssetGroupSize(ctx, userID, gid)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var group AssetGroup
+	err = tx.GetContext(ctx, &group, fmt.Sprintf(
+		`SELECT id, user_id, name, parent, created_time FROM %s WHERE id = ? AND user_id = ? AND trashed_at IS NULL FOR UPDATE`, tableNameAssetGroup,
+	), gid, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	item := &model.UserTrash{
+		UserID:        userID,
+		ItemType:      TrashItemGroup,
+		GroupID:       group.ID,
+		Name:          group.Name,
+		Size:          size,
+		OriginGroupID: group.Parent,
+		DeletedAt:     time.Now(),
+		PurgeAt:       purgeAt,
+	}
+	if err := addUserTrash(ctx, tx, item); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET trashed_at = ? WHERE id = ? AND user_id = ?`, tableNameAssetGroup), item.DeletedAt, gid, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return item, tx.Commit()
+}
+
+func addUserTrash(ctx context.Context, tx *sqlx.Tx, item *model.UserTrash) error {
+	res, err := tx.NamedExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (user_id, item_type, hash, cid, group_id, name, size, origin_group_id, deleted_at, purge_at)
+		VALUES (:user_id, :item_type, :hash, :cid, :group_id, :name, :size, :origin_group_id, :deleted_at, :purge_at)`, tableNameUserTrash,
+	), item)
+	if err != nil {
+		return err
+	}
+	item.ID, err = res.LastInsertId()
+	return err
+}
+
+// reviveTrashedAsset 重新上传回收站中的文件时, 删除回收站记录并把文件恢复到上传时指定的文件组;
+// 回收站记录已经被清理任务领取时返回错误, 清理完成后可以重新上传
+func reviveTrashedAsset(ctx context.Context, tx *sqlx.Tx, asset *model.UserAsset) error {
+	res, err := tx.ExecContext(ctx, fmt.Sprintf(
+		`DELETE FROM %s WHERE user_id = ? AND item_type = ? AND hash = ?`, tableNameUserTrash,
+	), asset.UserID, TrashItemAsset, asset.Hash)
+	if err != nil {
+		return err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return fmt.Errorf("asset %s is being purged from trash", asset.Hash)
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET trashed_at = NULL, group_id = ?, asset_name = ? WHERE hash = ? AND user_id = ?`, tableUserAsset,
+	), asset.GroupID, asset.AssetName, asset.Hash, asset.UserID)
+	return err
+}
+
+// ListUserTrash 获取用户回收站中的文件和文件组
+func ListUserTrash(ctx context.Context, userID string, limit, offset int) (int64, []*model.UserTrash, error) {
+	var (
+		total int64
+		out   []*model.UserTrash
+	)
+
+	err := DB.GetContext(ctx, &total, fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE user_id = ?`, tableNameUserTrash), userID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	err = DB.SelectContext(ctx, &out, fmt.Sprintf(
+		`SELECT * FROM %s WHERE user_id = ? ORDER BY deleted_at DESC LIMIT ? OFFSET ?`, tableNameUserTrash,
+	), userID, limit, offset)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return total, out, nil
+}
+
+// ListAllUserTrash 获取用户回收站中的所有记录
+func ListAllUserTrash(ctx context.Context, userID string) ([]*model.UserTrash, error) {
+	var out []*model.UserTrash
+	err := DB.SelectContext(ctx, &out, fmt.Sprintf(`SELECT * FROM %s WHERE user_id = ?`, tableNameUserTrash), userID)
+	return out, err
+}
+
+// GetUserTrash 获取用户回收站中的记录
+func GetUserTrash(ctx context.Context, userID string, id int64) (*model.UserTrash, error) {
+	var out model.UserTrash
+	err := DB.GetContext(ctx, &out, fmt.Sprintf(`SELECT * FROM %s WHERE id = ? AND user_id = ?`, tableNameUserTrash), id, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListExpiredTrash 获取已经到期需要彻底删除的记录
+func ListExpiredTrash(ctx context.Context, before time.Time, limit int) ([]*model.UserTrash, error) {
+	var out []*model.UserTrash
+	err := DB.SelectContext(ctx, &out, fmt.Sprintf(
+		`SELECT * FROM %s WHERE purge_at <= ? ORDER BY purge_at LIMIT ?`, tableNameUserTrash,
+	), before, limit)
+	return out, err
+}
+
+// RestoreUserTrash 把回收站中的记录恢复到原来的文件组, 原文件组已删除或也在回收站中时恢复到根目录, 返回恢复到的文件组
+func RestoreUserTrash(ctx context.Context, item *model.UserTrash) (int64, error) {
+	target := item.OriginGroupID
+	available, err := AssetGroupAvailable(ctx, item.UserID, target)
+	if err != nil {
+		return 0, err
+	}
+	if !available {
+		target = 0
+	}
+
+	tx, err := DB.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE id = ? AND user_id = ?`, tableNameUserTrash), item.ID, item.UserID)
+	if err != nil {
+		return 0, err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return 0, sql.ErrNoRows
+	}
+
+	switch item.ItemType {
+	case TrashItemAsset:
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(
+			`UPDATE %s SET group_id = ?, trashed_at = NULL WHERE hash = ? AND user_id = ? AND trashed_at IS NOT NULL`, tableUserAsset,
+		), target, item.Hash, item.UserID)
+	case TrashItemGroup:
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(
+			`UPDATE %s SET parent = ?, trashed_at = NULL WHERE id = ? AND user_id = ? AND trashed_at IS NOT NULL`, tableNameAssetGroup,
+		), target, item.GroupID, item.UserID)
+	default:
+		err = fmt.Errorf("unknown trash item type %s", item.ItemType)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return target, tx.Commit()
+}
+
+// ClaimUserTrash 彻底删除之前先删除回收站记录, 避免与恢复操作同时执行; 记录已不存在时返回 false
+func ClaimUserTrash(ctx context.Context, item *model.UserTrash) (bool, error) {
+	res, err := DB.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE id = ? AND user_id = ?`, tableNameUserTrash), item.ID, item.UserID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+// UnclaimUserTrash 彻底删除失败时放回回收站记录, 等待下次清理
+func UnclaimUserTrash(ctx context.Context, item *model.UserTrash) error {
+	_, err := DB.NamedExecContext(ctx, fmt.Sprintf(
+		`INSERT IGNORE INTO %s (id, user_id, item_type, hash, cid, group_id, name, size, origin_group_id, deleted_at, purge_at)
+		VALUES (:id, :user_id, :item_type, :hash, :cid, :group_id, :name, :size, :origin_group_id, :deleted_at, :purge_at)`, tableNameUserTrash,
+	), item)
+	return err
+}
+
+// AssetGroupAvailable 文件组是否存在, 并且文件组和上级文件组都不在回收站中
+func AssetGroupAvailable(ctx context.Context, userID string, gid int64) (bool, error) {
+	for i := 0; gid > 0 && i < maxGroupDepth; i++ {
+		var group AssetGroup
+		err := DB.GetContext(ctx, &group, fmt.Sprintf(`SELECT parent, trashed_at FROM %s WHERE id = ? AND user_id = ?`, tableNameAssetGroup), gid, userID)
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if group.TrashedAt != nil {
+			return false, nil
+		}
+		gid = group.Parent
+	}
+
+	return gid == 0, nil
+}
+
+// AssetAvailable 用户文件是否存在, 并且文件和所在的文件组都不在回收站中
+func AssetAvailable(ctx context.Context, userID, hash string) (bool, error) {
+	var gid int64
+	err := DB.GetContext(ctx, &gid, fmt.Sprintf(`SELECT group_id FROM %s WHERE hash = ? AND user_id = ? AND trashed_at IS NULL`, tableUserAsset), hash, userID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return AssetGroupAvailable(ctx, userID, gid)
+}
+
+// filterAvailableAssets 从 hashes 中过滤出用户可用的文件, 与 AssetAvailable 一致, 不存在、在回收站中或所在文件组在回收站中的文件会被过滤掉
+func filterAvailableAssets(ctx context.Context, userID string, hashes []string) ([]string, error) {
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+
+	sb := squirrel.Select("hash").From(tableUserAsset).Where(squirrel.Eq{"user_id": userID, "hash": hashes, "trashed_at": nil})
+	trashed, err := getTrashedGroupIDs(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("get trashed groups error:%w", err)
+	}
+	if len(trashed) > 0 {
+		sb = sb.Where(squirrel.NotEq{"group_id": trashed})
+	}
+
+	query, args, err := sb.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("generate filter assets sql error:%w", err)
+	}
+
+	var out []string
+	err = DB.SelectContext(ctx, &out, query, args...)
+	return out, err
+}
+
+// getTrashedGroupIDs 获取回收站中的文件组及其所有子文件组的 id
+func getTrashedGroupIDs(ctx context.Context, userID string) ([]int64, error) {
+	var parents []int64
+	err := DB.SelectContext(ctx, &parents, fmt.Sprintf(`SELECT id FROM %s WHERE user_id = ? AND trashed_at IS NOT NULL`, tableNameAssetGroup), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	gids := parents
+	for i := 0; len(parents) > 0 && i < maxGroupDepth; i++ {
+		query, args, err := squirrel.Select("id").From(tableNameAssetGroup).Where(squirrel.Eq{
+			"user_id": userID,
+			"parent":  parents,
+		}).ToSql()
+		if err != nil {
+			return nil, fmt.Errorf("generate get trashed groups sql error:%w", err)
+		}
+		// SelectContext 会追加到原有的切片中
+		parents = nil
+		if err := DB.SelectContext(ctx, &parents, query, args...); err != nil {
+			return nil, err
+		}
+		gids = append(gids, parents...)
+	}
+
+	return gids, nil
+}
+
+// getAssetGroupSize 获取文件组及其所有子文件组中文件的大小
+func getAssetGroupSize(ctx context.Context, userID string, gid int) (int64, error) {
+	var (
+		gids  = []int{gid}
+		ids   = []int{gid}
+		tsize int64
+	)
+
+	// 递归获取所有的文件组id
+	for {
+		if len(ids) == 0 {
+			break
+		}
+		query, args, err := squirrel.Select("id").From(tableNameAssetGroup).Where(squirrel.Eq{
+			"user_id": userID,
+			"parent":  ids,
+		}).ToSql()
+		if err != nil {
+			return 0, fmt.Errorf("generate get ids error:%w", err)
+		}
+		// SelectContext 会追加到原有的切片中
+		ids = nil
+		err = DB.SelectContext(ctx, &ids, query, args...)
+		if err != nil {
+			return 0, fmt.Errorf("get ids error:%w", err)
+		}
+		gids = append(gids, ids...)
+	}
+
+	query, args, err := squirrel.Select("IFNULL(SUM(total_size),0)").From(tableUserAsset).Where(squirrel.Eq{
+		"user_id":  userID,
+		"group_id": gids,
+	}).ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("generate get total_size of asset error:%w", err)
+	}
+	err = DB.GetContext(ctx, &tsize, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("get total_size of asset error:%w", err)
+	}
+
+	return tsize, nil
+}
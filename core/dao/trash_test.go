@@ -0,0 +1,286 @@
+package dao_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/dao/daotest"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+)
+
+const (
+	testTrashUser = "trash_test_user"
+	testTrashHash = "trash_test_hash"
+	testTrashArea = "Asia-China-Guangdong-Shenzhen"
+)
+
+func setupTrashTest(t *testing.T) {
+	db := daotest.Open(t)
+
+	cleanup := func() {
+		for _, table := range []string{"user_asset", "user_asset_area", "user_asset_map", "user_asset_group", "user_trash"} {
+			daotest.Exec(t, db, `DELETE FROM `+table+` WHERE user_id = ?`, testTrashUser)
+		}
+		daotest.Exec(t, db, `DELETE FROM users WHERE username = ?`, testTrashUser)
+		daotest.Exec(t, db, `DELETE FROM content WHERE hash = ?`, testTrashHash)
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+
+	daotest.Exec(t, db, `INSERT INTO users (username, used_storage_size) VALUES (?, 0)`, testTrashUser)
+}
+
+func addTrashTestAsset(ctx context.Context, name string, groupID int64) error {
+	return dao.AddAssetAndUpdateSize(ctx, &model.UserAsset{
+		UserID:      testTrashUser,
+		Hash:        testTrashHash,
+		Cid:         "trash_test_cid",
+		AssetName:   name,
+		TotalSize:   100,
+		GroupID:     groupID,
+		CreatedTime: time.Now(),
+	}, []string{testTrashArea}, testTrashArea)
+}
+
+func trashTestUsedSize(t *testing.T) int64 {
+	t.Helper()
+
+	user, err := dao.GetUserByUsername(context.Background(), testTrashUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user.UsedStorageSize
+}
+
+func createTrashTestGroup(t *testing.T, name string, parent int64) int64 {
+	t.Helper()
+
+	group, err := dao.CreateAssetGroup(context.Background(), testTrashUser, name, int(parent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return group.ID
+}
+
+func TestTrashAndRestoreAsset(t *testing.T) {
+	setupTrashTest(t)
+	ctx := context.Background()
+
+	gid := createTrashTestGroup(t, "docs", 0)
+	if err := addTrashTestAsset(ctx, "a.txt", gid); err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := dao.TrashUserAsset(ctx, testTrashHash, testTrashUser, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.OriginGroupID != gid {
+		t.Fatalf("expect origin group %d, got %d", gid, item.OriginGroupID)
+	}
+
+	// 回收站中的文件不出现在文件列表中, 仍然计入已使用的存储空间
+	if _, err := dao.GetUserAsset(ctx, testTrashHash, testTrashUser); err != sql.ErrNoRows {
+		t.Fatalf("trashed asset should not be found, got %v", err)
+	}
+	if total, _, err := dao.ListAssets(ctx, testTrashUser, 10, 0, int(gid)); err != nil || total != 0 {
+		t.Fatalf("trashed asset should not be listed, total %d err %v", total, err)
+	}
+	if ok, err := dao.AssetAvailable(ctx, testTrashUser, testTrashHash); err != nil || ok {
+		t.Fatalf("trashed asset should not be available, got %v %v", ok, err)
+	}
+	if size := trashTestUsedSize(t); size != 100 {
+		t.Fatalf("expect used size 100, got %d", size)
+	}
+	if _, err := dao.TrashUserAsset(ctx, testTrashHash, testTrashUser, time.Now()); err != sql.ErrNoRows {
+		t.Fatalf("trash twice should return ErrNoRows, got %v", err)
+	}
+
+	target, err := dao.RestoreUserTrash(ctx, item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != gid {
+		t.Fatalf("expect restore to group %d, got %d", gid, target)
+	}
+	asset, err := dao.GetUserAsset(ctx, testTrashHash, testTrashUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asset.GroupID != gid || asset.TrashedAt != nil {
+		t.Fatalf("unexpected restored asset %+v", asset)
+	}
+	if list, err := dao.ListAllUserTrash(ctx, testTrashUser); err != nil || len(list) != 0 {
+		t.Fatalf("trash should be empty after restore, got %d %v", len(list), err)
+	}
+}
+
+func TestTrashAndRestoreGroup(t *testing.T) {
+	setupTrashTest(t)
+	ctx := context.Background()
+
+	parent := createTrashTestGroup(t, "parent", 0)
+	child := createTrashTestGroup(t, "child", parent)
+	if err := addTrashTestAsset(ctx, "a.txt", child); err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := dao.TrashAssetGroup(ctx, testTrashUser, int(parent), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Size != 100 {
+		t.Fatalf("expect trashed group size 100, got %d", item.Size)
+	}
+
+	// 子文件组和文件保持原来的层级, 但是都不可用
+	rsp, err := dao.ListAssetGroupForUser(ctx, testTrashUser, 0, 10, 0)
+	if err != nil || rsp.Total != 0 {
+		t.Fatalf("trashed group should not be listed, total %d err %v", rsp.Total, err)
+	}
+	if ok, err := dao.AssetGroupAvailable(ctx, testTrashUser, child); err != nil || ok {
+		t.Fatalf("child of trashed group should not be available, got %v %v", ok, err)
+	}
+	if ok, err := dao.AssetAvailable(ctx, testTrashUser, testTrashHash); err != nil || ok {
+		t.Fatalf("asset in trashed group should not be available, got %v %v", ok, err)
+	}
+
+	if _, err := dao.RestoreUserTrash(ctx, item); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := dao.AssetAvailable(ctx, testTrashUser, testTrashHash); err != nil || !ok {
+		t.Fatalf("asset should be available after restore, got %v %v", ok, err)
+	}
+}
+
+func TestRestoreAssetToRoot(t *testing.T) {
+	setupTrashTest(t)
+	ctx := context.Background()
+
+	gid := createTrashTestGroup(t, "docs", 0)
+	if err := addTrashTestAsset(ctx, "a.txt", gid); err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := dao.TrashUserAsset(ctx, testTrashHash, testTrashUser, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dao.TrashAssetGroup(ctx, testTrashUser, int(gid), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 原文件组也在回收站中时恢复到根目录
+	target, err := dao.RestoreUserTrash(ctx, item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != 0 {
+		t.Fatalf("expect restore to root, got %d", target)
+	}
+	if ok, err := dao.AssetAvailable(ctx, testTrashUser, testTrashHash); err != nil || !ok {
+		t.Fatalf("asset should be available after restore, got %v %v", ok, err)
+	}
+}
+
+func TestReuploadTrashedAsset(t *testing.T) {
+	setupTrashTest(t)
+	ctx := context.Background()
+
+	if err := addTrashTestAsset(ctx, "a.txt", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dao.TrashUserAsset(ctx, testTrashHash, testTrashUser, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 回收站中的文件按不存在处理, 可以重新上传
+	notExists, err := dao.GetUserAssetNotAreaIDs(ctx, testTrashHash, testTrashUser, []string{testTrashArea})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notExists) != 1 {
+		t.Fatalf("trashed asset should be treated as not exists, got %v", notExists)
+	}
+
+	gid := createTrashTestGroup(t, "docs", 0)
+	if err := addTrashTestAsset(ctx, "b.txt", gid); err != nil {
+		t.Fatal(err)
+	}
+
+	asset, err := dao.GetUserAsset(ctx, testTrashHash, testTrashUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asset.GroupID != gid || asset.AssetName != "b.txt" || asset.TrashedAt != nil {
+		t.Fatalf("unexpected reuploaded asset %+v", asset)
+	}
+	if list, err := dao.ListAllUserTrash(ctx, testTrashUser); err != nil || len(list) != 0 {
+		t.Fatalf("trash record should be removed after reupload, got %d %v", len(list), err)
+	}
+	// 文件在回收站中时已经计入存储空间, 重新上传不重复计算
+	if size := trashTestUsedSize(t); size != 100 {
+		t.Fatalf("expect used size 100, got %d", size)
+	}
+}
+
+func TestPurgeTrashedAsset(t *testing.T) {
+	setupTrashTest(t)
+	ctx := context.Background()
+
+	if err := addTrashTestAsset(ctx, "a.txt", 0); err != nil {
+		t.Fatal(err)
+	}
+	item, err := dao.TrashUserAsset(ctx, testTrashHash, testTrashUser, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired, err := dao.ListExpiredTrash(ctx, time.Now().Add(time.Second), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, e := range expired {
+		found = found || e.ID == item.ID
+	}
+	if !found {
+		t.Fatalf("trash item %d should be expired", item.ID)
+	}
+
+	claimed, err := dao.ClaimUserTrash(ctx, item)
+	if err != nil || !claimed {
+		t.Fatalf("claim trash: %v %v", claimed, err)
+	}
+	// 清理任务领取记录后, 清理完成之前不能通过重新上传恢复
+	if err := addTrashTestAsset(ctx, "b.txt", 0); err == nil {
+		t.Fatalf("reupload should fail while the asset is being purged")
+	}
+	if _, err := dao.RestoreUserTrash(ctx, item); err != sql.ErrNoRows {
+		t.Fatalf("restore claimed item should return ErrNoRows, got %v", err)
+	}
+
+	if _, err := dao.GetTrashedUserAsset(ctx, testTrashHash, testTrashUser); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dao.DelAssetAndUpdateSize(ctx, testTrashHash, testTrashUser, []string{testTrashArea}, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dao.GetTrashedUserAsset(ctx, testTrashHash, testTrashUser); err != sql.ErrNoRows {
+		t.Fatalf("purged asset should be deleted, got %v", err)
+	}
+	if size := trashTestUsedSize(t); size != 0 {
+		t.Fatalf("expect used size 0 after purge, got %d", size)
+	}
+
+	// 彻底删除后重新上传为新文件
+	if err := addTrashTestAsset(ctx, "b.txt", 0); err != nil {
+		t.Fatal(err)
+	}
+	if size := trashTestUsedSize(t); size != 100 {
+		t.Fatalf("expect used size 100 after reupload, got %d", size)
+	}
+}
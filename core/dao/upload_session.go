@@ -0,0 +1,219 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+)
+
+const (
+	tableNameUploadSession     = "upload_session"
+	tableNameUploadSessionPart = "upload_session_part"
+)
+
+const (
+	UploadSessionStateUploading = "uploading"
+	UploadSessionStateCommitted = "committed"
+	UploadSessionStateExpired   = "expired"
+	UploadSessionStateAborted   = "aborted"
+)
+
+// CreateUploadSession 新建上传会话
+func CreateUploadSession(ctx context.Context, session *model.UploadSession) error {
+	_, err := DB.NamedExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (id, user_id, tenant_id, asset_cid, hash, asset_name, asset_type, asset_size, md5, group_id, extra_id, password, area_ids, node_id, trace_id, client_ip, part_size, part_count, state, expire_at, created_at, updated_at)
+		VALUES (:id, :user_id, :tenant_id, :asset_cid, :hash, :asset_name, :asset_type, :asset_size, :md5, :group_id, :extra_id, :password, :area_ids, :node_id, :trace_id, :client_ip, :part_size, :part_count, :state, :expire_at, :created_at, :updated_at)`,
+		tableNameUploadSession,
+	), session)
+	return err
+}
+
+// CreateUploadSessionWithLock 锁定用户和所属租户后执行 check, check 通过时新建上传会话并返回 0, 否则返回 check 的错误码;
+// 同一用户或租户并发创建的会话依次检查存储空间, 各自预占的空间不会一起超出上限
+func CreateUploadSessionWithLock(ctx context.Context, session *model.UploadSession, check func() (int, error)) (int, error) {
+	tx, err := DB.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// 先锁租户再锁用户, 与同一租户下其他子账户的加锁顺序一致
+	var id string
+	if session.TenantID != "" {
+		err = tx.GetContext(ctx, &id, fmt.Sprintf(`SELECT tenant_id FROM %s WHERE tenant_id = ? FOR UPDATE`, tableNameTenants), session.TenantID)
+		if err != nil && err != sql.ErrNoRows {
+			return 0, err
+		}
+	}
+
+	err = tx.GetContext(ctx, &id, fmt.Sprintf(`SELECT username FROM %s WHERE username = ? FOR UPDATE`, tableNameUser), session.UserID)
+	if err != nil {
+		return 0, err
+	}
+
+	code, err := check()
+	if err != nil || code != 0 {
+		return code, err
+	}
+
+	_, err = tx.NamedExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (id, user_id, tenant_id, asset_cid, hash, asset_name, asset_type, asset_size, md5, group_id, extra_id, password, area_ids, node_id, trace_id, client_ip, part_size, part_count, state, expire_at, created_at, updated_at)
+		VALUES (:id, :user_id, :tenant_id, :asset_cid, :hash, :asset_name, :asset_type, :asset_size, :md5, :group_id, :extra_id, :password, :area_ids, :node_id, :trace_id, :client_ip, :part_size, :part_count, :state, :expire_at, :created_at, :updated_at)`,
+		tableNameUploadSession,
+	), session)
+	if err != nil {
+		return 0, err
+	}
+
+	return 0, tx.Commit()
+}
+
+// GetUploadSession 获取用户的上传会话
+func GetUploadSession(ctx context.Context, id, userID string) (*model.UploadSession, error) {
+	var out model.UploadSession
+	err := DB.GetContext(ctx, &out, fmt.Sprintf(
+		`SELECT * FROM %s WHERE id = ? AND user_id = ?`, tableNameUploadSession,
+	), id, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListActiveUploadSessions 获取用户未结束的上传会话, 用于客户端断开后恢复上传
+func ListActiveUploadSessions(ctx context.Context, userID string) ([]*model.UploadSession, error) {
+	var out []*model.UploadSession
+	err := DB.SelectContext(ctx, &out, fmt.Sprintf(
+		`SELECT * FROM %s WHERE user_id = ? AND state = ? AND expire_at > ? ORDER BY created_at DESC`, tableNameUploadSession,
+	), userID, UploadSessionStateUploading, time.Now())
+	return out, err
+}
+
+// GetUploadSessionParts 获取上传会话已上传的分片
+func GetUploadSessionParts(ctx context.Context, sessionID string) ([]*model.UploadSessionPart, error) {
+	var out []*model.UploadSessionPart
+	err := DB.SelectContext(ctx, &out, fmt.Sprintf(
+		`SELECT * FROM %s WHERE session_id = ? ORDER BY part_number`, tableNameUploadSessionPart,
+	), sessionID)
+	return out, err
+}
+
+// AddUploadSessionPart 记录一个已上传的分片, 重复上报时覆盖, 同时更新已上传大小并延长会话的过期时间
+func AddUploadSessionPart(ctx context.Context, part *model.UploadSessionPart, expireAt time.Time) error {
+	tx, err := DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.NamedExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (session_id, part_number, size, md5, area_id, node_id, created_at) VALUES (:session_id, :part_number, :size, :md5, :area_id, :node_id, :created_at)
+		ON DUPLICATE KEY UPDATE size = VALUES(size), md5 = VALUES(md5), area_id = VALUES(area_id), node_id = VALUES(node_id), created_at = VALUES(created_at)`,
+		tableNameUploadSessionPart,
+	), part)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET uploaded_size = (SELECT IFNULL(SUM(size),0) FROM %s WHERE session_id = ?), expire_at = ? WHERE id = ? AND state = ?`,
+		tableNameUploadSession, tableNameUploadSessionPart,
+	), part.SessionID, expireAt, part.SessionID, UploadSessionStateUploading)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// TouchUploadSession 延长上传会话的过期时间
+func TouchUploadSession(ctx context.Context, id string, expireAt time.Time) error {
+	_, err := DB.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET expire_at = ? WHERE id = ? AND state = ?`, tableNameUploadSession,
+	), expireAt, id, UploadSessionStateUploading)
+	return err
+}
+
+// FinishUploadSession 把上传中的会话修改为已提交或已取消, 会话已结束时返回 false; 只有提交时记录提交时间
+func FinishUploadSession(ctx context.Context, id, state string) (bool, error) {
+	query, args := fmt.Sprintf(`UPDATE %s SET state = ? WHERE id = ? AND state = ?`, tableNameUploadSession),
+		[]interface{}{state, id, UploadSessionStateUploading}
+	if state == UploadSessionStateCommitted {
+		query, args = fmt.Sprintf(`UPDATE %s SET state = ?, committed_at = ? WHERE id = ? AND state = ?`, tableNameUploadSession),
+			[]interface{}{state, time.Now(), id, UploadSessionStateUploading}
+	}
+
+	res, err := DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+// ReopenUploadSession 提交后写入文件失败时把会话恢复为上传中, 以便客户端重试提交
+func ReopenUploadSession(ctx context.Context, id string) error {
+	_, err := DB.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET state = ?, committed_at = '1970-01-01 00:00:00.000' WHERE id = ? AND state = ?`, tableNameUploadSession,
+	), UploadSessionStateUploading, id, UploadSessionStateCommitted)
+	return err
+}
+
+// GetUserReservedUploadSize 获取用户未结束的上传会话预占的存储空间
+func GetUserReservedUploadSize(ctx context.Context, userID string) (int64, error) {
+	var size int64
+	err := DB.GetContext(ctx, &size, fmt.Sprintf(
+		`SELECT IFNULL(SUM(asset_size),0) FROM %s WHERE user_id = ? AND state = ? AND expire_at > ?`, tableNameUploadSession,
+	), userID, UploadSessionStateUploading, time.Now())
+	return size, err
+}
+
+// GetTenantReservedUploadSize 获取租户所有子账户未结束的上传会话预占的存储空间
+func GetTenantReservedUploadSize(ctx context.Context, tenantID string) (int64, error) {
+	var size int64
+	err := DB.GetContext(ctx, &size, fmt.Sprintf(
+		`SELECT IFNULL(SUM(asset_size),0) FROM %s WHERE tenant_id = ? AND state = ? AND expire_at > ?`, tableNameUploadSession,
+	), tenantID, UploadSessionStateUploading, time.Now())
+	return size, err
+}
+
+// ExpireUploadSessions 把已过期的上传会话标记为过期, 释放预占的存储空间
+func ExpireUploadSessions(ctx context.Context, now time.Time) (int64, error) {
+	res, err := DB.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET state = ? WHERE state = ? AND expire_at <= ?`, tableNameUploadSession,
+	), UploadSessionStateExpired, UploadSessionStateUploading, now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// DeleteUploadSessionsBefore 清理已结束的上传会话和分片记录
+func DeleteUploadSessionsBefore(ctx context.Context, before time.Time) error {
+	tx, err := DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(
+		`DELETE p FROM %s p INNER JOIN %s s ON p.session_id = s.id WHERE s.state <> ? AND s.updated_at < ?`,
+		tableNameUploadSessionPart, tableNameUploadSession,
+	), UploadSessionStateUploading, before)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(
+		`DELETE FROM %s WHERE state <> ? AND updated_at < ?`, tableNameUploadSession,
+	), UploadSessionStateUploading, before)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/Filecoin-Titan/titan/api/terrors"
 	"github.com/Masterminds/squirrel"
 	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/jmoiron/sqlx"
 )
 
 const (
@@ -69,11 +70,6 @@ type (
 		TotalTraffic  int64 `db:"total_traffic"`
 		PeakBandwidth int64 `db:"peak_bandwidth"`
 	}
-	// AssetCIDInfo 文件cid信息
-	AssetCIDInfo struct {
-		CID  string `db:"cid"`
-		Hash string `db:"hash"`
-	}
 )
 
 // AddAssetAndUpdateSize 添加文件信息并修改使用的storage存储空间
@@ -89,11 +85,23 @@ func AddAssetAndUpdateSize(ctx context.Context, asset *model.UserAsset, areaIDs
 		return errors.New("area id can not be empty")
 	}
 
-	// 查询文件记录是否存在
-	ua, err := GetUserAsset(ctx, asset.Hash, asset.UserID)
+	refs := newContentRefs(asset, append([]string{syncArea}, areaIDs...)...)
+	if err := lockContents(ctx, tx, refs); err != nil {
+		return fmt.Errorf("lock contents error:%w", err)
+	}
+
+	// 查询文件记录是否存在, 包括回收站中的文件
+	ua := new(model.UserAsset)
+	err = tx.GetContext(ctx, ua, fmt.Sprintf(`SELECT * FROM %s WHERE hash = ? AND user_id = ? FOR UPDATE`, tableUserAsset), asset.Hash, asset.UserID)
 	if err != nil && err != sql.ErrNoRows {
 		log.Error(err)
-		return fmt.Errorf("generate insert asset sql error:%w", err)
+		return fmt.Errorf("get user asset error:%w", err)
+	}
+	if err == nil && ua.TrashedAt != nil {
+		// 回收站中的文件重新上传时从回收站中恢复到新的文件组, 文件在回收站中仍然计入已使用的存储空间
+		if err := reviveTrashedAsset(ctx, tx, asset); err != nil {
+			return fmt.Errorf("revive trashed asset error:%w", err)
+		}
 	}
 	if err == sql.ErrNoRows {
 		// 添加文件记录，判断文件是否存在，不存在则新增
@@ -147,7 +155,7 @@ func AddAssetAndUpdateSize(ctx context.Context, asset *model.UserAsset, areaIDs
 		return fmt.Errorf("insert user_asset_map error:%w", err)
 	}
 	// 修改用户storage已使用记录
-	if ua == nil || ua.UserID == "" {
+	if ua.UserID == "" {
 		query, args, err = squirrel.Update(tableNameUser).Set("used_storage_size", squirrel.Expr("used_storage_size + ?", asset.TotalSize)).Where("username = ?", asset.UserID).ToSql()
 		if err != nil {
 			log.Error(err)
@@ -160,16 +168,30 @@ func AddAssetAndUpdateSize(ctx context.Context, asset *model.UserAsset, areaIDs
 		}
 	}
 
+	// 更新内容的引用数
+	if _, err := syncContentRefs(ctx, tx, refs); err != nil {
+		return fmt.Errorf("sync content refs error:%w", err)
+	}
+
 	return tx.Commit()
 }
 
-// DelAssetAndUpdateSize 删除文件信息并修改使用的storage存储空间
-func DelAssetAndUpdateSize(ctx context.Context, hash, userID string, areaID []string, isNeedDel bool) error {
+// DelAssetAndUpdateSize 删除文件信息并修改使用的storage存储空间, 返回引用数变为 0 的内容, 需要从对应区域的调度器中删除
+func DelAssetAndUpdateSize(ctx context.Context, hash, userID string, areaID []string, isNeedDel bool) ([]*model.Content, error) {
 	tx, err := DB.Beginx()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer tx.Rollback()
+
+	refs, err := getContentRefs(ctx, tx, squirrel.Eq{"uaa.area_id": areaID, "uaa.user_id": userID, "uaa.hash": hash})
+	if err != nil {
+		return nil, fmt.Errorf("get content refs error:%w", err)
+	}
+	if err := lockContents(ctx, tx, refs); err != nil {
+		return nil, fmt.Errorf("lock contents error:%w", err)
+	}
+
 	// 删除文件记录
 	query, args, err := squirrel.Delete(tableUserAssetArea).Where(squirrel.Eq{
 		"area_id": areaID,
@@ -177,19 +199,32 @@ func DelAssetAndUpdateSize(ctx context.Context, hash, userID string, areaID []st
 		"hash":    hash,
 	}).ToSql()
 	if err != nil {
-		return fmt.Errorf("generate sql error:%w", err)
+		return nil, fmt.Errorf("generate sql error:%w", err)
 	}
 	_, err = tx.ExecContext(ctx, query, args...)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	// 判断是否需要删除文件记录
-	if !isNeedDel {
-		return tx.Commit()
+	if isNeedDel {
+		if err := delUserAsset(ctx, tx, hash, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	released, err := syncContentRefs(ctx, tx, refs)
+	if err != nil {
+		return nil, fmt.Errorf("sync content refs error:%w", err)
 	}
+
+	return released, tx.Commit()
+}
+
+// delUserAsset 删除用户文件及其分享、下载次数记录、标签和元数据, 并修改使用的storage存储空间
+func delUserAsset(ctx context.Context, tx *sqlx.Tx, hash, userID string) error {
 	// 获取文件尺寸大小
 	var sa SubAssetDetail
-	query, args, err = squirrel.Select("total_size,cid").From(tableUserAsset).Where("hash = ? AND user_id = ?", hash, userID).ToSql()
+	query, args, err := squirrel.Select("total_size,cid").From(tableUserAsset).Where("hash = ? AND user_id = ?", hash, userID).ToSql()
 	if err != nil {
 		return fmt.Errorf("generate sql error:%w", err)
 	}
@@ -234,13 +269,19 @@ func DelAssetAndUpdateSize(ctx context.Context, hash, userID string, areaID []st
 	if err != nil {
 		return err
 	}
-
-	return tx.Commit()
+	// 删除文件的标签和元数据
+	for _, table := range []string{tableUserAssetTag, tableUserAssetMeta} {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE user_id = ? AND hash = ?`, table), userID, hash)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// UpdateAssetShareStatus 修改文件分享状态
+// UpdateAssetShareStatus 修改文件分享状态, 不修改回收站中的文件
 func UpdateAssetShareStatus(ctx context.Context, hash, userID string) error {
-	query, args, err := squirrel.Update(tableUserAsset).Set("share_status", 1).Where("hash = ? AND user_id = ?", hash, userID).ToSql()
+	query, args, err := squirrel.Update(tableUserAsset).Set("share_status", 1).Where("hash = ? AND user_id = ? AND trashed_at IS NULL", hash, userID).ToSql()
 	if err != nil {
 		return fmt.Errorf("generate update asset sql error:%w", err)
 	}
@@ -252,9 +293,9 @@ func UpdateAssetShareStatus(ctx context.Context, hash, userID string) error {
 	return nil
 }
 
-// UpdateGroupShareStatus 修改文件组分享状态
+// UpdateGroupShareStatus 修改文件组分享状态, 不修改回收站中的文件组
 func UpdateGroupShareStatus(ctx context.Context, userID string, groupID int64) error {
-	query, args, err := squirrel.Update(tableNameAssetGroup).Set("share_status", 1).Where("user_id = ? AND id = ?", userID, groupID).ToSql()
+	query, args, err := squirrel.Update(tableNameAssetGroup).Set("share_status", 1).Where("user_id = ? AND id = ? AND trashed_at IS NULL", userID, groupID).ToSql()
 	if err != nil {
 		return fmt.Errorf("generate update user_asset_group sql error:%w", err)
 	}
@@ -266,6 +307,18 @@ func UpdateGroupShareStatus(ctx context.Context, userID string, groupID int64) e
 	return nil
 }
 
+// CancelAssetShareStatus 取消文件分享状态
+func CancelAssetShareStatus(ctx context.Context, hash, userID string) error {
+	_, err := DB.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET share_status = 0 WHERE hash = ? AND user_id = ?`, tableUserAsset), hash, userID)
+	return err
+}
+
+// CancelGroupShareStatus 取消文件组分享状态
+func CancelGroupShareStatus(ctx context.Context, userID string, groupID int64) error {
+	_, err := DB.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET share_status = 0 WHERE user_id = ? AND id = ?`, tableNameAssetGroup), userID, groupID)
+	return err
+}
+
 // ListAssets 获取对应文件夹的文件列表
 func ListAssets(ctx context.Context, uid string, limit, offset, groupID int) (int64, []*UserAssetDetail, error) {
 	var (
@@ -280,7 +333,7 @@ func ListAssets(ctx context.Context, uid string, limit, offset, groupID int) (in
 
 	query, args, err := squirrel.Select("ua.user_id,ua.hash,ua.cid,ua.asset_name,ua.asset_type,ua.share_status,ua.expiration,ua.created_time,ua.total_size,ua.password,ua.group_id,IFNULL(uav.count,0) AS visit_count").
 		From(fmt.Sprintf("%s AS ua", tableUserAsset)).LeftJoin(fmt.Sprintf("%s AS uav ON ua.hash=uav.hash and ua.user_id = uav.user_id", tableUserAssetVisit)).
-		Where("ua.user_id = ? AND ua.group_id = ?", uid, groupID).OrderBy("ua.created_time desc").
+		Where("ua.user_id = ? AND ua.group_id = ? AND ua.trashed_at IS NULL", uid, groupID).OrderBy("ua.created_time desc").
 		Limit(uint64(limit)).Offset(uint64(offset)).ToSql()
 	if err != nil {
 		return 0, nil, fmt.Errorf("generate get asset sql error:%w", err)
@@ -352,7 +405,7 @@ func ListAssetGroupForUser(ctx context.Context, uid string, parent, limit, offse
 	resp := new(ListAssetGroupRsp)
 	resp.AssetGroups = make([]*AssetGroup, 0)
 
-	query, args, err := squirrel.Select("count(id)").From(tableNameAssetGroup).Where("user_id=? AND parent=?", uid, parent).ToSql()
+	query, args, err := squirrel.Select("count(id)").From(tableNameAssetGroup).Where("user_id=? AND parent=? AND trashed_at IS NULL", uid, parent).ToSql()
 	if err != nil {
 		return nil, fmt.Errorf("generate get asset's group sql error:%w", err)
 	}
@@ -362,8 +415,8 @@ func ListAssetGroupForUser(ctx context.Context, uid string, parent, limit, offse
 	}
 
 	query, args, err = squirrel.Select("ag.*,COUNT(a.user_id) AS asset_count,COALESCE(SUM(a.total_size), 0) AS asset_size").From(fmt.Sprintf("%s as ag", tableNameAssetGroup)).
-		LeftJoin(fmt.Sprintf("%s as a ON ag.user_id=a.user_id AND ag.id=a.group_id", tableUserAsset)).
-		Where("ag.user_id=? AND ag.parent=?", uid, parent).GroupBy("ag.id").OrderBy("ag.created_time DESC").Limit(uint64(limit)).Offset(uint64(offset)).ToSql()
+		LeftJoin(fmt.Sprintf("%s as a ON ag.user_id=a.user_id AND ag.id=a.group_id AND a.trashed_at IS NULL", tableUserAsset)).
+		Where("ag.user_id=? AND ag.parent=? AND ag.trashed_at IS NULL", uid, parent).GroupBy("ag.id").OrderBy("ag.created_time DESC").Limit(uint64(limit)).Offset(uint64(offset)).ToSql()
 	if err != nil {
 		return nil, fmt.Errorf("generate get asset's group sql error:%w", err)
 	}
@@ -379,8 +432,8 @@ func ListAssetGroupForUser(ctx context.Context, uid string, parent, limit, offse
 func GetUserAssetGroupInfo(ctx context.Context, uid string, gid int) (*AssetGroup, error) {
 	var group AssetGroup
 	query, args, err := squirrel.Select("ag.*,COUNT(a.user_id) AS asset_count,COALESCE(SUM(a.total_size), 0) AS asset_size").From(fmt.Sprintf("%s as ag", tableNameAssetGroup)).
-		LeftJoin(fmt.Sprintf("%s as a ON ag.user_id=a.user_id AND ag.id=a.group_id", tableUserAsset)).
-		Where("ag.user_id=? AND ag.id=?", uid, gid).Limit(1).ToSql()
+		LeftJoin(fmt.Sprintf("%s as a ON ag.user_id=a.user_id AND ag.id=a.group_id AND a.trashed_at IS NULL", tableUserAsset)).
+		Where("ag.user_id=? AND ag.id=? AND ag.trashed_at IS NULL", uid, gid).Limit(1).ToSql()
 	if err != nil {
 		return nil, fmt.Errorf("generate get asset's group sql error:%w", err)
 	}
@@ -416,7 +469,7 @@ func DeleteAssetGroup(ctx context.Context, uid string, gid int) error {
 
 // UpdateAssetGroupName update user asset group name
 func UpdateAssetGroupName(ctx context.Context, uid, rename string, groupID int) error {
-	query, args, err := squirrel.Update(tableNameAssetGroup).Set("name", rename).Where("user_id = ? AND id = ?", uid, groupID).ToSql()
+	query, args, err := squirrel.Update(tableNameAssetGroup).Set("name", rename).Where("user_id = ? AND id = ? AND trashed_at IS NULL", uid, groupID).ToSql()
 	if err != nil {
 		return fmt.Errorf("generate update asset's group sql error:%w", err)
 	}
@@ -427,7 +480,7 @@ func UpdateAssetGroupName(ctx context.Context, uid, rename string, groupID int)
 
 // UpdateAssetName 更新用户文件名
 func UpdateAssetName(ctx context.Context, newName, uid, hash string) error {
-	query, args, err := squirrel.Update(tableUserAsset).Set("asset_name", newName).Where("user_id = ? AND hash = ?", uid, hash).ToSql()
+	query, args, err := squirrel.Update(tableUserAsset).Set("asset_name", newName).Where("user_id = ? AND hash = ? AND trashed_at IS NULL", uid, hash).ToSql()
 	if err != nil {
 		return fmt.Errorf("generate update asset's sql error:%w", err)
 	}
@@ -473,7 +526,7 @@ func MoveAssetGroup(ctx context.Context, userID string, groupID, targetGroupID i
 		}
 	}
 
-	query, args, err := squirrel.Update(tableNameAssetGroup).Set("parent", targetGroupID).Where("user_id=? AND id=?", userID, groupID).ToSql()
+	query, args, err := squirrel.Update(tableNameAssetGroup).Set("parent", targetGroupID).Where("user_id=? AND id=? AND trashed_at IS NULL", userID, groupID).ToSql()
 	if err != nil {
 		return fmt.Errorf("generate update asset's group sql error:%w", err)
 	}
@@ -482,9 +535,9 @@ func MoveAssetGroup(ctx context.Context, userID string, groupID, targetGroupID i
 	return err
 }
 
-// UpdateAssetGroup update user asset group
+// UpdateAssetGroup update user asset group, 回收站中的文件需要先还原
 func UpdateAssetGroup(ctx context.Context, userID, hash string, groupID int) error {
-	query, args, err := squirrel.Update(tableUserAsset).Set("group_id", groupID).Where("user_id=? AND hash=?", userID, hash).ToSql()
+	query, args, err := squirrel.Update(tableUserAsset).Set("group_id", groupID).Where("user_id=? AND hash=? AND trashed_at IS NULL", userID, hash).ToSql()
 	if err != nil {
 		return fmt.Errorf("generate update asset sql error:%w", err)
 	}
@@ -499,7 +552,7 @@ func GetUserAssetDetail(ctx context.Context, hash, uid string) (*UserAssetDetail
 
 	query, args, err := squirrel.Select("ua.user_id,ua.hash,ua.asset_name,ua.asset_type,ua.share_status,ua.expiration,ua.created_time,ua.total_size,ua.password,ua.group_id,IFNULL(uav.count,0) AS visit_count").
 		From(fmt.Sprintf("%s AS ua", tableUserAsset)).LeftJoin(fmt.Sprintf("%s AS uav ON ua.hash=uav.hash and ua.user_id = uav.user_id", tableUserAssetVisit)).
-		Where("ua.user_id = ? AND ua.hash = ?", uid, hash).ToSql()
+		Where("ua.user_id = ? AND ua.hash = ? AND ua.trashed_at IS NULL", uid, hash).ToSql()
 	if err != nil {
 		return nil, fmt.Errorf("generate get asset sql error:%w", err)
 	}
@@ -510,10 +563,18 @@ func GetUserAssetDetail(ctx context.Context, hash, uid string) (*UserAssetDetail
 	return &asset, err
 }
 
-// GetUserAsset 获取用户文件信息
+// GetUserAsset 获取用户文件信息, 回收站中的文件返回 sql.ErrNoRows
 func GetUserAsset(ctx context.Context, hash, uid string) (*model.UserAsset, error) {
 	var out model.UserAsset
-	query := "SELECT * FROM user_asset where hash = ? and user_id = ?"
+	query := "SELECT * FROM user_asset where hash = ? and user_id = ? and trashed_at is null"
+	err := DB.GetContext(ctx, &out, query, hash, uid)
+	return &out, err
+}
+
+// GetTrashedUserAsset 获取回收站中的用户文件信息
+func GetTrashedUserAsset(ctx context.Context, hash, uid string) (*model.UserAsset, error) {
+	var out model.UserAsset
+	query := "SELECT * FROM user_asset where hash = ? and user_id = ? and trashed_at is not null"
 	err := DB.GetContext(ctx, &out, query, hash, uid)
 	return &out, err
 }
@@ -548,17 +609,19 @@ func UpdateUserAsset(ctx context.Context, asset *model.UserAsset) error {
 	return err
 }
 
-// GetUserAssetNotAreaIDs 返回不存在的area_id
+// GetUserAssetNotAreaIDs 返回不存在的area_id, 回收站中的文件按不存在处理
 func GetUserAssetNotAreaIDs(ctx context.Context, hash, uid string, areaID []string) ([]string, error) {
 	var (
 		aids, notExistAids []string
 	)
 
-	query, args, err := squirrel.Select("area_id").From(tableUserAssetArea).Where(squirrel.Eq{
-		"area_id": areaID,
-		"user_id": uid,
-		"hash":    hash,
-	}).ToSql()
+	query, args, err := squirrel.Select("uaa.area_id").From(fmt.Sprintf("%s AS uaa", tableUserAssetArea)).
+		InnerJoin(fmt.Sprintf("%s AS ua ON ua.hash = uaa.hash AND ua.user_id = uaa.user_id", tableUserAsset)).
+		Where(squirrel.Eq{
+			"uaa.area_id": areaID,
+			"uaa.user_id": uid,
+			"uaa.hash":    hash,
+		}).Where("ua.trashed_at IS NULL").ToSql()
 	if err != nil {
 		return nil, fmt.Errorf("generate get asset sql error:%w", err)
 	}
@@ -685,6 +748,27 @@ func CheckAssetHashIsExist(ctx context.Context, hash string) bool {
 	return count > 0
 }
 
+// GetUnSyncAssetAreas 获取区域中还未标记同步完成的用户文件
+func GetUnSyncAssetAreas(ctx context.Context, areaID string, hashs []string) ([]*model.UserAssetArea, error) {
+	var out []*model.UserAssetArea
+
+	query, args, err := squirrel.Select("*").From(tableUserAssetArea).Where(squirrel.Eq{
+		"area_id": areaID,
+		"hash":    hashs,
+		"is_sync": 0,
+	}).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("generate get asset sql error:%w", err)
+	}
+
+	err = DB.SelectContext(ctx, &out, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
 func UpdateSyncAssetAreas(ctx context.Context, areaID string, hashs []string) error {
 	query, args, err := squirrel.Update(tableUserAssetArea).Set("is_sync", true).Where(squirrel.Eq{
 		"area_id": areaID,
@@ -776,20 +860,30 @@ func GetUserAssetAreaIDs(ctx context.Context, hash, uid string) ([]string, error
 	return aids, nil
 }
 
-// CheckUserAssetIsOnly 判断用户文件是否为唯一存在的
-func CheckUserAssetIsOnly(ctx context.Context, hash, areaID string) (bool, error) {
-	var num int64
+// GetUserAssetsAreaIDs 批量获取用户文件已同步的区域, 键为文件 hash
+func GetUserAssetsAreaIDs(ctx context.Context, uid string, hashes []string) (map[string][]string, error) {
+	out := make(map[string][]string)
+	if len(hashes) == 0 {
+		return out, nil
+	}
 
-	query, args, err := squirrel.Select("COUNT(hash)").From(tableUserAssetArea).Where("hash = ? AND area_id = ?", hash, areaID).ToSql()
-	if err != nil {
-		return false, fmt.Errorf("generate get asset sql error:%w", err)
+	var list []struct {
+		Hash   string `db:"hash"`
+		AreaID string `db:"area_id"`
 	}
-	err = DB.GetContext(ctx, &num, query, args...)
+	query, args, err := squirrel.Select("hash", "area_id").From(tableUserAssetArea).
+		Where(squirrel.Eq{"user_id": uid, "hash": hashes, "is_sync": 1}).ToSql()
 	if err != nil {
-		return false, err
+		return nil, fmt.Errorf("generate get assets area sql error:%w", err)
+	}
+	if err := DB.SelectContext(ctx, &list, query, args...); err != nil {
+		return nil, err
 	}
 
-	return num <= 1, nil
+	for _, v := range list {
+		out[v.Hash] = append(out[v.Hash], v.AreaID)
+	}
+	return out, nil
 }
 
 // CheckUserAssetIsInAreaID 判断用户文件是否存在于指定区域
@@ -1015,43 +1109,37 @@ func GetUserStorageFlowInfo(ctx context.Context, uid string) (*UserStorageFlowIn
 	return info, nil
 }
 
-// DeleteAssetGroupAndUpdateSize 删除文件组并更新用户已使用空间大小
-func DeleteAssetGroupAndUpdateSize(ctx context.Context, userID string, gid int) error {
-	var (
-		gids  = []int{gid}
-		ids   = []int{gid}
-		tsize int64
-	)
+// GetUserStorageFlowInfoSince 获取用户从 start 开始的下载流量和峰值带宽
+func GetUserStorageFlowInfoSince(ctx context.Context, uid string, start time.Time) (*UserStorageFlowInfo, error) {
+	var info = new(UserStorageFlowInfo)
 
-	// 递归获取所有的文件组id
-	for {
-		if len(ids) == 0 {
-			break
-		}
-		query, args, err := squirrel.Select("id").From(tableNameAssetGroup).Where(squirrel.Eq{
-			"user_id": userID,
-			"parent":  ids,
-		}).ToSql()
-		if err != nil {
-			return fmt.Errorf("generate get ids error:%w", err)
-		}
-		err = DB.SelectContext(ctx, &ids, query, args...)
-		if err != nil {
-			return fmt.Errorf("get ids error:%w", err)
-		}
-		gids = append(gids, ids...)
-	}
-	// 获取要删除的所有文件大小
-	query, args, err := squirrel.Select("IFNULL(SUM(total_size),0)").From(tableUserAsset).Where(squirrel.Eq{
-		"user_id":  userID,
-		"group_id": gids,
-	}).ToSql()
+	query, args, err := squirrel.Select("IFNULL(SUM(total_traffic),0) AS total_traffic,IFNULL(MAX(peak_bandwidth),0) AS peak_bandwidth").From(tableAssetStorageHour).
+		Where("user_id = ? AND timestamp >= ?", uid, start.Unix()).ToSql()
 	if err != nil {
-		return fmt.Errorf("generate get total_size of asset error:%w", err)
+		return nil, fmt.Errorf("generate sql of get storage flow error:%w", err)
+	}
+
+	err = DB.GetContext(ctx, info, query, args...)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("get storage flow error:%w", err)
 	}
-	err = DB.GetContext(ctx, &tsize, query, args...)
+
+	return info, nil
+}
+
+// CountUserAssets 获取用户的文件数量, 回收站中的文件也计算在内
+func CountUserAssets(ctx context.Context, userID string) (int64, error) {
+	var count int64
+	err := DB.GetContext(ctx, &count, fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE user_id = ?`, tableUserAsset), userID)
+	return count, err
+}
+
+// DeleteAssetGroupAndUpdateSize 删除文件组并更新用户已使用空间大小
+func DeleteAssetGroupAndUpdateSize(ctx context.Context, userID string, gid int) error {
+	// 获取要删除的所有文件大小
+	tsize, err := getAssetGroupSize(ctx, userID, gid)
 	if err != nil {
-		return fmt.Errorf("get total_size of asset error:%w", err)
+		return err
 	}
 
 	tx, err := DB.Beginx()
@@ -1061,7 +1149,7 @@ func DeleteAssetGroupAndUpdateSize(ctx context.Context, userID string, gid int)
 
 	defer tx.Rollback()
 
-	query = fmt.Sprintf(`DELETE FROM %s WHERE user_id = ? AND id = ?`, tableNameAssetGroup)
+	query := fmt.Sprintf(`DELETE FROM %s WHERE user_id = ? AND id = ?`, tableNameAssetGroup)
 	_, err = tx.ExecContext(ctx, query, userID, gid)
 	if err != nil {
 		return fmt.Errorf("delete asset group error:%w", err)
@@ -1092,44 +1180,22 @@ func DeleteOuterAssetGroup(ctx context.Context, userID string, gids []int64) err
 	return nil
 }
 
-// GetOnlyAssetsByUIDAndGroupID 获取用户文件组中唯一存在的文件区域映射
-func GetOnlyAssetsByUIDAndGroupID(ctx context.Context, userID string, gids []int64) (map[string][]string, error) {
-	var (
-		as     []OnlyUserGroupAsset
-		aaMaps = make(map[string][]string)
-	)
-
-	sb, sa, _ := squirrel.Select("`hash`").From(tableUserAsset).Where(squirrel.Eq{
-		"user_id":  userID,
-		"group_id": gids,
-	}).ToSql()
-	query, args, err := squirrel.Select("ua.cid,COUNT(ua.cid) AS num,uaa.area_id").From(fmt.Sprintf("%s AS uaa", tableUserAssetArea)).
-		LeftJoin(fmt.Sprintf("%s AS ua ON uaa.`hash` = ua.`hash` AND ua.user_id = uaa.user_id", tableUserAsset)).
-		Where(fmt.Sprintf("uaa.`hash` IN (%s)", sb), sa...).
-		Where("ua.cid <> ''").GroupBy("ua.cid").Having("num = 1").ToSql()
-	if err != nil {
-		return nil, fmt.Errorf("generate sql of get user_asset info error:%w", err)
-	}
-	err = DB.SelectContext(ctx, &as, query, args...)
+// DeleteUserGroupAsset 删除用户文件组中的文件, 返回引用数变为 0 的内容, 需要从对应区域的调度器中删除
+func DeleteUserGroupAsset(ctx context.Context, userID string, gids []int64) ([]*model.Content, error) {
+	tx, err := DB.Beginx()
 	if err != nil {
-		return nil, fmt.Errorf("get user_asset info error:%w", err)
-	}
-
-	for _, v := range as {
-		aaMaps[v.AreaID] = append(aaMaps[v.AreaID], v.CID)
+		return nil, err
 	}
 
-	return aaMaps, nil
-}
+	defer tx.Rollback()
 
-// DeleteUserGroupAsset 删除用户文件组中的文件
-func DeleteUserGroupAsset(ctx context.Context, userID string, gids []int64) error {
-	tx, err := DB.Beginx()
+	refs, err := getContentRefs(ctx, tx, squirrel.Eq{"uaa.user_id": userID, "ua.group_id": gids})
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("get content refs error:%w", err)
+	}
+	if err := lockContents(ctx, tx, refs); err != nil {
+		return nil, fmt.Errorf("lock contents error:%w", err)
 	}
-
-	defer tx.Rollback()
 
 	// 先通过user_asset的hash删除user_asset_area的数据
 	sb, sa, _ := squirrel.Select("`hash`").From(tableUserAsset).Where(squirrel.Eq{
@@ -1139,11 +1205,23 @@ func DeleteUserGroupAsset(ctx context.Context, userID string, gids []int64) erro
 	query, args, err := squirrel.Delete(tableUserAssetArea).Where(fmt.Sprintf("`hash` IN (%s)", sb), sa...).
 		Where("user_id = ?", userID).ToSql()
 	if err != nil {
-		return fmt.Errorf("generate sql of delete user_assest_area error:%w", err)
+		return nil, fmt.Errorf("generate sql of delete user_assest_area error:%w", err)
 	}
 	_, err = tx.ExecContext(ctx, query, args...)
 	if err != nil {
-		return fmt.Errorf("delete user_assest_area error:%w", err)
+		return nil, fmt.Errorf("delete user_assest_area error:%w", err)
+	}
+	// 删除文件的标签和元数据
+	for _, table := range []string{tableUserAssetTag, tableUserAssetMeta} {
+		query, args, err = squirrel.Delete(table).Where(fmt.Sprintf("`hash` IN (%s)", sb), sa...).
+			Where("user_id = ?", userID).ToSql()
+		if err != nil {
+			return nil, fmt.Errorf("generate sql of delete %s error:%w", table, err)
+		}
+		_, err = tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("delete %s error:%w", table, err)
+		}
 	}
 	// 删除user_asset的数据
 	query, args, err = squirrel.Delete(tableUserAsset).Where(squirrel.Eq{
@@ -1151,11 +1229,11 @@ func DeleteUserGroupAsset(ctx context.Context, userID string, gids []int64) erro
 		"group_id": gids,
 	}).ToSql()
 	if err != nil {
-		return fmt.Errorf("generate sql of delete user_assest error:%w", err)
+		return nil, fmt.Errorf("generate sql of delete user_assest error:%w", err)
 	}
 	_, err = tx.ExecContext(ctx, query, args...)
 	if err != nil {
-		return fmt.Errorf("delete user_assest error:%w", err)
+		return nil, fmt.Errorf("delete user_assest error:%w", err)
 	}
 	// 删除当前文件组
 	query, args, err = squirrel.Delete(tableNameAssetGroup).Where(squirrel.Eq{
@@ -1163,14 +1241,19 @@ func DeleteUserGroupAsset(ctx context.Context, userID string, gids []int64) erro
 		"id":      gids,
 	}).ToSql()
 	if err != nil {
-		return fmt.Errorf("generate sql of delete user_assest_group error:%w", err)
+		return nil, fmt.Errorf("generate sql of delete user_assest_group error:%w", err)
 	}
 	_, err = tx.ExecContext(ctx, query, args...)
 	if err != nil {
-		return fmt.Errorf("delete user_assest_group error:%w", err)
+		return nil, fmt.Errorf("delete user_assest_group error:%w", err)
 	}
 
-	return tx.Commit()
+	released, err := syncContentRefs(ctx, tx, refs)
+	if err != nil {
+		return nil, fmt.Errorf("sync content refs error:%w", err)
+	}
+
+	return released, tx.Commit()
 }
 
 // GetUserGroupByParent 通过父级id获取其第一层的子级id
@@ -1192,6 +1275,99 @@ func GetUserGroupByParent(ctx context.Context, userID string, pids []int64) ([]i
 	return ids, nil
 }
 
+// ListSubAssetGroups 获取文件组下所有层级的子文件组, 回收站中的文件组不会作为子文件组返回
+func ListSubAssetGroups(ctx context.Context, userID string, gid int64) ([]*AssetGroup, error) {
+	var (
+		out  []*AssetGroup
+		pids = []int64{gid}
+	)
+
+	for i := 0; len(pids) > 0 && i < maxGroupDepth; i++ {
+		query, args, err := squirrel.Select("id", "user_id", "name", "parent", "created_time", "share_status").From(tableNameAssetGroup).
+			Where(squirrel.Eq{"user_id": userID, "parent": pids, "trashed_at": nil}).OrderBy("id").ToSql()
+		if err != nil {
+			return nil, fmt.Errorf("generate sql of list sub groups error:%w", err)
+		}
+
+		var groups []*AssetGroup
+		if err := DB.SelectContext(ctx, &groups, query, args...); err != nil {
+			return nil, fmt.Errorf("list sub groups error:%w", err)
+		}
+
+		pids = pids[:0]
+		for _, g := range groups {
+			pids = append(pids, g.ID)
+		}
+		out = append(out, groups...)
+	}
+
+	return out, nil
+}
+
+// ListAssetsByGroups 获取多个文件组中的文件, 最多返回 limit 个
+func ListAssetsByGroups(ctx context.Context, userID string, gids []int64, limit int) ([]*model.UserAsset, error) {
+	query, args, err := squirrel.Select("*").From(tableUserAsset).Where(squirrel.Eq{"user_id": userID, "group_id": gids, "trashed_at": nil}).
+		OrderBy("group_id", "created_time").Limit(uint64(limit)).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("generate sql of list group assets error:%w", err)
+	}
+
+	var out []*model.UserAsset
+	err = DB.SelectContext(ctx, &out, query, args...)
+	return out, err
+}
+
+// AssetGroupShared 文件组或其上级文件组是否已经分享, 回收站中的文件组返回 false
+func AssetGroupShared(ctx context.Context, userID string, gid int64) (bool, error) {
+	shared := false
+	for i := 0; gid > 0 && i < maxGroupDepth; i++ {
+		var group AssetGroup
+		err := DB.GetContext(ctx, &group, fmt.Sprintf(`SELECT parent, share_status FROM %s WHERE id = ? AND user_id = ? AND trashed_at IS NULL`, tableNameAssetGroup), gid, userID)
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		shared = shared || group.ShareStatus == 1
+		gid = group.Parent
+	}
+
+	return shared && gid == 0, nil
+}
+
+// AssetInGroup 文件是否在文件组或其子文件组中
+func AssetInGroup(ctx context.Context, userID, hash string, gid int64) (bool, error) {
+	var parent int64
+	err := DB.GetContext(ctx, &parent, fmt.Sprintf(`SELECT group_id FROM %s WHERE hash = ? AND user_id = ? AND trashed_at IS NULL`, tableUserAsset), hash, userID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return GroupInGroup(ctx, userID, parent, gid)
+}
+
+// GroupInGroup 文件组 gid 是否为 ancestor 或其子文件组
+func GroupInGroup(ctx context.Context, userID string, gid, ancestor int64) (bool, error) {
+	for i := 0; gid > 0 && i < maxGroupDepth; i++ {
+		if gid == ancestor {
+			return true, nil
+		}
+		err := DB.GetContext(ctx, &gid, fmt.Sprintf(`SELECT parent FROM %s WHERE id = ? AND user_id = ?`, tableNameAssetGroup), gid, userID)
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
 // AddUserAssetMap 增加用户文件映射表
 func AddUserAssetMap(ctx context.Context, userID, hash string) error {
 	query, args, err := squirrel.Insert(tableUserAssetMap).Columns("user_id", "asset_hash").Values(userID, hash).Options("IGNORE").ToSql()
@@ -1222,37 +1398,18 @@ func AddAssetGroupVisitCount(ctx context.Context, userID string, id int) error {
 	return nil
 }
 
-// CheckAssetByMd5AndAreaExists 判断文件是否已经存在
+// CheckAssetByMd5AndAreaExists 判断区域中是否已经存在 md5 相同的内容
 func CheckAssetByMd5AndAreaExists(ctx context.Context, md5, areaID string) (string, bool, error) {
-	var (
-		cidInfo AssetCIDInfo
-		hash    string
-	)
-
 	if strings.TrimSpace(md5) == "" {
 		return "", false, nil
 	}
 
-	// 通过md5或者hash
-	query, args, err := squirrel.Select("cid,hash").From(tableUserAsset).Where("md5 = ?", md5).Limit(1).ToSql()
-	if err != nil {
-		return "", false, fmt.Errorf("generate select hash from user_asset error:%w", err)
-	}
-	err = DB.GetContext(ctx, &cidInfo, query, args...)
-	if err != nil {
-		return "", false, fmt.Errorf("get hash from user_asset error:%w", err)
-	}
-
-	query, args, err = squirrel.Select("hash").From(tableUserAssetArea).Where("hash = ? AND area_id = ? AND is_sync = 1", cidInfo.Hash, areaID).Limit(1).ToSql()
+	content, err := GetAvailableContentByMD5(ctx, md5, areaID)
 	if err != nil {
-		return "", false, fmt.Errorf("generate select hash from user_asset_area error:%w", err)
-	}
-	err = DB.GetContext(ctx, &hash, query, args...)
-	if err != nil {
-		return "", false, fmt.Errorf("get hash from user_asset_area error:%w", err)
+		return "", false, fmt.Errorf("get content by md5 error:%w", err)
 	}
 
-	return cidInfo.CID, true, nil
+	return content.Cid, true, nil
 }
 
 // GetNoExistCIDs 获取用户不存在的cid信息
@@ -1287,3 +1444,69 @@ func GetUserAssetCount(ctx context.Context, hash string) (int64, error) {
 	err := DB.GetContext(ctx, &count, query, hash)
 	return count, err
 }
+
+// ListUserAssetsByUser 获取用户的所有文件
+func ListUserAssetsByUser(ctx context.Context, uid string) ([]*model.UserAsset, error) {
+	var out []*model.UserAsset
+
+	query, args, err := squirrel.Select("*").From(tableUserAsset).Where("user_id = ?", uid).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("generate sql of get user assets error:%w", err)
+	}
+
+	err = DB.SelectContext(ctx, &out, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// DeleteAllUserAssets 删除用户的所有文件、文件夹、分享记录, 并清空已使用的存储空间; 返回引用数变为 0 的内容, 需要从对应区域的调度器中删除
+func DeleteAllUserAssets(ctx context.Context, uid string) ([]*model.Content, error) {
+	tx, err := DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	refs, err := getContentRefs(ctx, tx, squirrel.Eq{"uaa.user_id": uid})
+	if err != nil {
+		return nil, fmt.Errorf("get content refs error:%w", err)
+	}
+	if err := lockContents(ctx, tx, refs); err != nil {
+		return nil, fmt.Errorf("lock contents error:%w", err)
+	}
+
+	deletes := []squirrel.DeleteBuilder{
+		squirrel.Delete(tableUserAssetArea).Where("user_id = ?", uid),
+		squirrel.Delete(tableUserAsset).Where("user_id = ?", uid),
+		squirrel.Delete(tableUserAssetVisit).Where("user_id = ?", uid),
+		squirrel.Delete(tableNameAssetGroup).Where("user_id = ?", uid),
+		squirrel.Delete(tableNameLink).Where("username = ?", uid),
+		squirrel.Delete(tableNameUserTrash).Where("user_id = ?", uid),
+		squirrel.Delete(tableUserAssetTag).Where("user_id = ?", uid),
+		squirrel.Delete(tableUserAssetMeta).Where("user_id = ?", uid),
+	}
+	for _, d := range deletes {
+		query, args, err := d.ToSql()
+		if err != nil {
+			return nil, fmt.Errorf("generate delete sql error:%w", err)
+		}
+		if _, err = tx.ExecContext(ctx, query, args...); err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET used_storage_size = 0 WHERE username = ?`, tableNameUser), uid)
+	if err != nil {
+		return nil, err
+	}
+
+	released, err := syncContentRefs(ctx, tx, refs)
+	if err != nil {
+		return nil, fmt.Errorf("sync content refs error:%w", err)
+	}
+
+	return released, tx.Commit()
+}
@@ -13,7 +13,10 @@ import (
 	"github.com/jmoiron/sqlx"
 )
 
-const tableNameUser = "users"
+const (
+	tableNameUser         = "users"
+	tableNameReferralCode = "referral_code"
+)
 
 func CreateUser(ctx context.Context, user *model.User) error {
 	tx, err := DB.Beginx()
@@ -366,3 +369,39 @@ func GetTotalUserStats(ctx context.Context) (*model.TotalUserStats, error) {
 
 	return &out, nil
 }
+
+// UpdateTenantUserProfile 更新租户子账户的头像和邮箱
+func UpdateTenantUserProfile(ctx context.Context, user *model.User) error {
+	query, args, err := squirrel.Update(tableNameUser).SetMap(map[string]interface{}{
+		"avatar":     user.Avatar,
+		"user_email": user.UserEmail,
+		"updated_at": squirrel.Expr("now()"),
+	}).Where("username = ? AND tenant_id = ?", user.Username, user.TenantID).ToSql()
+	if err != nil {
+		return fmt.Errorf("generate update user sql error:%w", err)
+	}
+
+	_, err = DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// DeleteUser 删除用户及其邀请码
+func DeleteUser(ctx context.Context, username string) error {
+	tx, err := DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE username = ?`, tableNameUser), username)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE user_id = ?`, tableNameReferralCode), username)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -87,6 +87,32 @@ const (
 	OrderStatus
 	NeedBindKeplr
 
+	UploadSessionNotFound
+	UploadSessionExpired
+	UploadNotConfirmed
+	TrashItemNotFound
+	ShareLinkRevoked
+	ShareLinkDownloadLimit
+	ShareLinkRegionDenied
+	ShareLinkRefererDenied
+	ShareLinkPreviewDisabled
+	QuotaPlanNotFound
+	QuotaPlanInUse
+	QuotaFileSizeExceeded
+	QuotaFileCountExceeded
+	QuotaApiKeyExceeded
+	AssetBatchJobNotFound
+	GroupArchiveTooLarge
+	GroupPublishInProgress
+	DeviceGroupNotFound
+	DeviceGroupNameExists
+	ReconcileRunNotFound
+	SubUserHasAssets
+	QuotaPeakBandwidthExceeded
+	QuotaShareCountExceeded
+	NodeCannotDeactivate
+	NodeNotDeactivated
+
 	Unknown     = -1
 	Success     = 0
 	GenericCode = 1
@@ -185,6 +211,31 @@ var ErrMap = map[int]string{
 	OutTotalFlow:                             "out total flow:总流量超过使用限制",
 	OrderStatus:                              "Status does not match: 状态不匹配",
 	NeedBindKeplr:                            "need bind keplr:需要绑定keplr钱包地址",
+	UploadSessionNotFound:                    "upload session not found:上传会话不存在",
+	UploadSessionExpired:                     "upload session expired:上传会话已结束",
+	UploadNotConfirmed:                       "upload not confirmed by scheduler:调度器尚未确认文件上传完成",
+	TrashItemNotFound:                        "trash item not found:回收站中不存在该文件",
+	ShareLinkRevoked:                         "share link was revoked:分享链接已撤销",
+	ShareLinkDownloadLimit:                   "share link download limit reached:分享链接下载次数已达上限",
+	ShareLinkRegionDenied:                    "share link is not available in your region:分享链接不允许在当前地区访问",
+	ShareLinkRefererDenied:                   "share link referer not allowed:分享链接不允许从该来源访问",
+	ShareLinkPreviewDisabled:                 "share link preview disabled:分享链接禁止在线预览",
+	QuotaPlanNotFound:                        "quota plan not found:套餐不存在",
+	QuotaPlanInUse:                           "quota plan is default or in use:默认套餐或已分配的套餐不能删除",
+	QuotaFileSizeExceeded:                    "file size exceeds the plan limit:文件大小超过套餐限制",
+	QuotaFileCountExceeded:                   "file count exceeds the plan limit:文件数量超过套餐限制",
+	QuotaApiKeyExceeded:                      "api key count exceeds the plan limit:API key 数量超过套餐限制",
+	AssetBatchJobNotFound:                    "batch job not found:批量任务不存在",
+	GroupArchiveTooLarge:                     "too many files in the group:文件夹中的文件数量过多",
+	GroupPublishInProgress:                   "group is being published:文件夹正在发布中",
+	DeviceGroupNotFound:                      "node group not found:节点分组不存在",
+	DeviceGroupNameExists:                    "node group name already exists:节点分组名称已存在",
+	ReconcileRunNotFound:                     "reconcile run not found:对账记录不存在",
+	SubUserHasAssets:                         "user still has assets, set with_asset to delete them:用户还有文件, 需要同时删除文件",
+	QuotaPeakBandwidthExceeded:               "peak bandwidth exceeds the plan limit:峰值带宽超过套餐限制",
+	QuotaShareCountExceeded:                  "share link count exceeds the plan limit:分享链接数量超过套餐限制",
+	NodeCannotDeactivate:                     "node can not be deactivated in the current status:节点当前状态不能停用",
+	NodeNotDeactivated:                       "node is not deactivated:节点未停用",
 }
 
 type GenericError struct {
@@ -342,6 +342,8 @@ type AssetTransferLog struct {
 	Ip                 string    `json:"ip" db:"ip"`
 	FirstByteTime      int64     `json:"first_byte_time" db:"first_byte_time"`
 	AvailableBandwidth int64     `json:"available_bandwidth" db:"available_bandwidth"`
+	LinkID             int64     `json:"link_id" db:"link_id"`
+	Country            string    `json:"country" db:"country"`
 	CreatedAt          time.Time `json:"created_at" db:"created_at"`
 }
 
@@ -398,9 +400,297 @@ type IPNodeCount struct {
 type Tenant struct {
 	TenantID        string    `json:"tenant_id" db:"tenant_id"`
 	Name            string    `json:"name" db:"name"`
-	ApiKey          []byte    `json:"api_key" db:"api_key"`
+	ApiKey          []byte    `json:"-" db:"api_key"`
 	State           string    `json:"state" db:"state"`
 	UploadNotifyUrl string    `json:"upload_notify_url" db:"upload_notify_url"`
 	DeleteNotifyUrl string    `json:"delete_notify_url" db:"delete_notify_url"`
+	PrevApiKey      []byte    `json:"-" db:"prev_api_key"`
+	PrevKeyExpireAt time.Time `json:"prev_key_expire_at" db:"prev_key_expire_at"`
+	StorageQuota    int64     `json:"storage_quota" db:"storage_quota"`
+	TrafficQuota    int64     `json:"traffic_quota" db:"traffic_quota"`
 	CreatedAt       time.Time `json:"created_at" db:"created_at"`
 }
+
+type JobRun struct {
+	ID         int64     `json:"id" db:"id"`
+	JobName    string    `json:"job_name" db:"job_name"`
+	Instance   string    `json:"instance" db:"instance"`
+	Status     string    `json:"status" db:"status"`
+	Error      string    `json:"error" db:"error"`
+	StartedAt  time.Time `json:"started_at" db:"started_at"`
+	FinishedAt time.Time `json:"finished_at" db:"finished_at"`
+	DurationMs int64     `json:"duration_ms" db:"duration_ms"`
+}
+
+type TenantWebhookDelivery struct {
+	ID             string    `json:"id" db:"id"`
+	TenantID       string    `json:"tenant_id" db:"tenant_id"`
+	Event          string    `json:"event" db:"event"`
+	Url            string    `json:"url" db:"url"`
+	Payload        string    `json:"-" db:"payload"`
+	State          string    `json:"state" db:"state"`
+	Attempts       int64     `json:"attempts" db:"attempts"`
+	LastStatusCode int64     `json:"last_status_code" db:"last_status_code"`
+	LastError      string    `json:"last_error" db:"last_error"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type TenantWebhookAttempt struct {
+	ID             int64     `json:"id" db:"id"`
+	DeliveryID     string    `json:"delivery_id" db:"delivery_id"`
+	Attempt        int64     `json:"attempt" db:"attempt"`
+	RequestUrl     string    `json:"request_url" db:"request_url"`
+	RequestHeaders string    `json:"request_headers" db:"request_headers"`
+	RequestBody    string    `json:"request_body" db:"request_body"`
+	ResponseCode   int64     `json:"response_code" db:"response_code"`
+	ResponseBody   string    `json:"response_body" db:"response_body"`
+	Error          string    `json:"error" db:"error"`
+	LatencyMs      int64     `json:"latency_ms" db:"latency_ms"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
+type TenantWebhookSubscription struct {
+	ID        int64     `json:"id" db:"id"`
+	TenantID  string    `json:"tenant_id" db:"tenant_id"`
+	Url       string    `json:"url" db:"url"`
+	Events    string    `json:"events" db:"events"`
+	Enabled   bool      `json:"enabled" db:"enabled"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type UploadSession struct {
+	ID           string    `json:"id" db:"id"`
+	UserID       string    `json:"user_id" db:"user_id"`
+	TenantID     string    `json:"tenant_id" db:"tenant_id"`
+	AssetCID     string    `json:"asset_cid" db:"asset_cid"`
+	Hash         string    `json:"hash" db:"hash"`
+	AssetName    string    `json:"asset_name" db:"asset_name"`
+	AssetType    string    `json:"asset_type" db:"asset_type"`
+	AssetSize    int64     `json:"asset_size" db:"asset_size"`
+	MD5          string    `json:"md5" db:"md5"`
+	GroupID      int64     `json:"group_id" db:"group_id"`
+	ExtraID      string    `json:"extra_id" db:"extra_id"`
+	Password     string    `json:"-" db:"password"`
+	AreaIDs      string    `json:"area_ids" db:"area_ids"`
+	NodeID       string    `json:"node_id" db:"node_id"`
+	TraceID      string    `json:"trace_id" db:"trace_id"`
+	ClientIP     string    `json:"-" db:"client_ip"`
+	PartSize     int64     `json:"part_size" db:"part_size"`
+	PartCount    int64     `json:"part_count" db:"part_count"`
+	UploadedSize int64     `json:"uploaded_size" db:"uploaded_size"`
+	State        string    `json:"state" db:"state"`
+	ExpireAt     time.Time `json:"expire_at" db:"expire_at"`
+	CommittedAt  time.Time `json:"committed_at" db:"committed_at"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type UploadSessionPart struct {
+	SessionID  string    `json:"session_id" db:"session_id"`
+	PartNumber int64     `json:"part_number" db:"part_number"`
+	Size       int64     `json:"size" db:"size"`
+	MD5        string    `json:"md5" db:"md5"`
+	AreaID     string    `json:"area_id" db:"area_id"`
+	NodeID     string    `json:"node_id" db:"node_id"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+type Content struct {
+	Hash      string    `json:"hash" db:"hash"`
+	AreaID    string    `json:"area_id" db:"area_id"`
+	Cid       string    `json:"cid" db:"cid"`
+	Size      int64     `json:"size" db:"size"`
+	MD5       string    `json:"md5" db:"md5"`
+	RefCount  int64     `json:"ref_count" db:"ref_count"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type UserTrash struct {
+	ID            int64     `json:"id" db:"id"`
+	UserID        string    `json:"user_id" db:"user_id"`
+	ItemType      string    `json:"item_type" db:"item_type"`
+	Hash          string    `json:"hash" db:"hash"`
+	Cid           string    `json:"cid" db:"cid"`
+	GroupID       int64     `json:"group_id" db:"group_id"`
+	Name          string    `json:"name" db:"name"`
+	Size          int64     `json:"size" db:"size"`
+	OriginGroupID int64     `json:"origin_group_id" db:"origin_group_id"`
+	DeletedAt     time.Time `json:"deleted_at" db:"deleted_at"`
+	PurgeAt       time.Time `json:"purge_at" db:"purge_at"`
+}
+
+type QuotaPlan struct {
+	ID             int64     `json:"id" db:"id"`
+	Name           string    `json:"name" db:"name"`
+	StorageSize    int64     `json:"storage_size" db:"storage_size"`
+	MonthlyTraffic int64     `json:"monthly_traffic" db:"monthly_traffic"`
+	PeakBandwidth  int64     `json:"peak_bandwidth" db:"peak_bandwidth"`
+	FileCount      int64     `json:"file_count" db:"file_count"`
+	MaxFileSize    int64     `json:"max_file_size" db:"max_file_size"`
+	ApiKeyCount    int64     `json:"api_key_count" db:"api_key_count"`
+	ShareCount     int64     `json:"share_count" db:"share_count"`
+	DownloadCount  int64     `json:"download_count" db:"download_count"`
+	IsDefault      bool      `json:"is_default" db:"is_default"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type QuotaPlanAssign struct {
+	SubjectType string    `json:"subject_type" db:"subject_type"`
+	SubjectID   string    `json:"subject_id" db:"subject_id"`
+	PlanID      int64     `json:"plan_id" db:"plan_id"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type UserAssetTag struct {
+	UserID    string    `json:"user_id" db:"user_id"`
+	Hash      string    `json:"hash" db:"hash"`
+	Tag       string    `json:"tag" db:"tag"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type UserAssetMeta struct {
+	UserID    string `json:"user_id" db:"user_id"`
+	Hash      string `json:"hash" db:"hash"`
+	MetaKey   string `json:"meta_key" db:"meta_key"`
+	MetaValue string `json:"meta_value" db:"meta_value"`
+}
+
+type AssetBatchJob struct {
+	ID        string    `json:"id" db:"id"`
+	UserID    string    `json:"user_id" db:"user_id"`
+	Operation string    `json:"operation" db:"operation"`
+	Params    string    `json:"params" db:"params"`
+	State     string    `json:"state" db:"state"`
+	Total     int64     `json:"total" db:"total"`
+	Succeeded int64     `json:"succeeded" db:"succeeded"`
+	Failed    int64     `json:"failed" db:"failed"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type AssetBatchItem struct {
+	ID        int64     `json:"id" db:"id"`
+	JobID     string    `json:"job_id" db:"job_id"`
+	ItemType  string    `json:"item_type" db:"item_type"`
+	Target    string    `json:"target" db:"target"`
+	State     string    `json:"state" db:"state"`
+	Error     string    `json:"error" db:"error"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type AssetGroupPublish struct {
+	ID         int64     `json:"id" db:"id"`
+	UserID     string    `json:"user_id" db:"user_id"`
+	GroupID    int64     `json:"group_id" db:"group_id"`
+	Version    int64     `json:"version" db:"version"`
+	AreaID     string    `json:"area_id" db:"area_id"`
+	RootCID    string    `json:"root_cid" db:"root_cid"`
+	Size       int64     `json:"size" db:"size"`
+	AssetCount int64     `json:"asset_count" db:"asset_count"`
+	State      string    `json:"state" db:"state"`
+	Error      string    `json:"error" db:"error"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type NodeAlertRule struct {
+	UserID         string    `json:"-" db:"user_id"`
+	Enabled        bool      `json:"enabled" db:"enabled"`
+	NotifyEmail    bool      `json:"notify_email" db:"notify_email"`
+	WebhookURL     string    `json:"webhook_url" db:"webhook_url"`
+	OfflineMinutes int64     `json:"offline_minutes" db:"offline_minutes"`
+	NATDegrade     bool      `json:"nat_degrade" db:"nat_degrade"`
+	DiskThreshold  float64   `json:"disk_threshold" db:"disk_threshold"`
+	QuietStart     string    `json:"quiet_start" db:"quiet_start"`
+	QuietEnd       string    `json:"quiet_end" db:"quiet_end"`
+	Timezone       string    `json:"timezone" db:"timezone"`
+	DedupMinutes   int64     `json:"dedup_minutes" db:"dedup_minutes"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type NodeAlert struct {
+	ID        int64     `json:"id" db:"id"`
+	UserID    string    `json:"-" db:"user_id"`
+	DeviceID  string    `json:"device_id" db:"device_id"`
+	AlertType string    `json:"alert_type" db:"alert_type"`
+	Message   string    `json:"message" db:"message"`
+	State     string    `json:"state" db:"state"`
+	Channels  string    `json:"channels" db:"channels"`
+	Error     string    `json:"error" db:"error"`
+	NotifyAt  time.Time `json:"notify_at" db:"notify_at"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type DeviceLabel struct {
+	DeviceID  string    `json:"device_id" db:"device_id"`
+	Label     string    `json:"label" db:"label"`
+	UserID    string    `json:"-" db:"user_id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type DeviceGroup struct {
+	ID        int64     `json:"id" db:"id"`
+	UserID    string    `json:"-" db:"user_id"`
+	Name      string    `json:"name" db:"name"`
+	NodeCount int64     `json:"node_count" db:"node_count"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type DeviceUptimeDaily struct {
+	DeviceID        string    `json:"device_id" db:"device_id"`
+	Date            time.Time `json:"date" db:"date"`
+	UserID          string    `json:"-" db:"user_id"`
+	ObservedSeconds int64     `json:"observed_seconds" db:"observed_seconds"`
+	DownSeconds     int64     `json:"down_seconds" db:"down_seconds"`
+	RolledTo        time.Time `json:"rolled_to" db:"rolled_to"`
+	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type DeviceOutage struct {
+	ID        int64     `json:"id" db:"id"`
+	DeviceID  string    `json:"device_id" db:"device_id"`
+	UserID    string    `json:"-" db:"user_id"`
+	StartTime time.Time `json:"start_time" db:"start_time"`
+	EndTime   time.Time `json:"end_time" db:"end_time"`
+	Duration  int64     `json:"duration" db:"duration"`
+	Ongoing   bool      `json:"ongoing" db:"ongoing"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type RewardReconcileRun struct {
+	ID               int64     `json:"id" db:"id"`
+	AreaID           string    `json:"area_id" db:"area_id"`
+	State            string    `json:"state" db:"state"`
+	Tolerance        float64   `json:"tolerance" db:"tolerance"`
+	NodeCount        int64     `json:"node_count" db:"node_count"`
+	DiscrepancyCount int64     `json:"discrepancy_count" db:"discrepancy_count"`
+	TotalDiff        float64   `json:"total_diff" db:"total_diff"`
+	Error            string    `json:"error" db:"error"`
+	StartedAt        time.Time `json:"started_at" db:"started_at"`
+	FinishedAt       time.Time `json:"finished_at" db:"finished_at"`
+}
+
+type RewardReconcileItem struct {
+	ID              int64     `json:"id" db:"id"`
+	RunID           int64     `json:"run_id" db:"run_id"`
+	DeviceID        string    `json:"device_id" db:"device_id"`
+	UserID          string    `json:"user_id" db:"user_id"`
+	AreaID          string    `json:"area_id" db:"area_id"`
+	SchedulerProfit float64   `json:"scheduler_profit" db:"scheduler_profit"`
+	DailySum        float64   `json:"daily_sum" db:"daily_sum"`
+	Diff            float64   `json:"diff" db:"diff"`
+	State           string    `json:"state" db:"state"`
+	ApprovedBy      string    `json:"approved_by" db:"approved_by"`
+	Adjustment      float64   `json:"adjustment" db:"adjustment"`
+	Error           string    `json:"error" db:"error"`
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
+}
@@ -282,6 +282,13 @@ type OperationLog struct {
 	JsonResult       string    `db:"json_result" json:"json_result"`
 	Status           int32     `db:"status" json:"status"`
 	ErrorMsg         string    `db:"error_msg" json:"error_msg"`
+	Action           string    `db:"action" json:"action"`
+	Actor            string    `db:"actor" json:"actor"`
+	TargetType       string    `db:"target_type" json:"target_type"`
+	TargetID         string    `db:"target_id" json:"target_id"`
+	BeforeValue      string    `db:"before_value" json:"before_value"`
+	AfterValue       string    `db:"after_value" json:"after_value"`
+	UserAgent        string    `db:"user_agent" json:"user_agent"`
 	CreatedAt        time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt        time.Time `db:"updated_at" json:"updated_at"`
 }
@@ -372,6 +379,15 @@ type Link struct {
 	DeletedAt time.Time `db:"deleted_at" json:"deleted_at"`
 	ShortPass string    `db:"short_pass" json:"short_pass"`
 	ExpireAt  time.Time `db:"expire_at" json:"expire_at"`
+
+	MaxDownloads     int64     `db:"max_downloads" json:"max_downloads"`
+	DownloadCount    int64     `db:"download_count" json:"download_count"`
+	AllowedCountries string    `db:"allowed_countries" json:"allowed_countries"`
+	AllowedReferers  string    `db:"allowed_referers" json:"allowed_referers"`
+	DisablePreview   bool      `db:"disable_preview" json:"disable_preview"`
+	Revoked          bool      `db:"revoked" json:"revoked"`
+	RevokedAt        time.Time `db:"revoked_at" json:"revoked_at"`
+	ShortID          string    `db:"short_id" json:"short_id"`
 }
 
 type ValidationEvent struct {
@@ -662,16 +678,19 @@ type UserAsset struct {
 	MD5     string `db:"md5"`
 	ExtraID string `db:"extra_id"`
 	ClientIP string `db:"client_ip"`
+	// TrashedAt 放入回收站的时间, 为空时不在回收站中
+	TrashedAt *time.Time `db:"trashed_at"`
 }
 
 type AssetGroup struct {
-	ID          int64     `db:"id"`
-	UserID      string    `db:"user_id"`
-	Name        string    `db:"name"`
-	Parent      int64     `db:"parent"`
-	CreatedTime time.Time `db:"created_time"`
-	ShareStatus int64     `db:"share_status"`
-	VistitCount int64     `db:"visit_count"`
+	ID          int64      `db:"id"`
+	UserID      string     `db:"user_id"`
+	Name        string     `db:"name"`
+	Parent      int64      `db:"parent"`
+	CreatedTime time.Time  `db:"created_time"`
+	ShareStatus int64      `db:"share_status"`
+	VistitCount int64      `db:"visit_count"`
+	TrashedAt   *time.Time `db:"trashed_at"`
 }
 
 type UserAssetVisitCount struct {
@@ -1,11 +1,62 @@
 package model
 
-import "time"
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
 
 func (u User) IsCorpUser() bool {
 	return u.TenantID != ""
 }
 
+// InKeyGracePeriod 轮换前的 key/secret 是否仍在宽限期内
+func (t Tenant) InKeyGracePeriod() bool {
+	return len(t.PrevApiKey) > 0 && time.Now().Before(t.PrevKeyExpireAt)
+}
+
+// Subscribed 订阅是否包含该事件
+func (s TenantWebhookSubscription) Subscribed(event string) bool {
+	if !s.Enabled {
+		return false
+	}
+	for _, e := range strings.Split(s.Events, ",") {
+		e = strings.TrimSpace(e)
+		if e == "*" || e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Areas 上传会话的区域, 第一个为实际上传的区域
+func (s UploadSession) Areas() []string {
+	if s.AreaIDs == "" {
+		return nil
+	}
+	return strings.Split(s.AreaIDs, ",")
+}
+
+// Countries 分享链接允许访问的国家
+func (l Link) Countries() []string {
+	return splitList(l.AllowedCountries)
+}
+
+// Referers 分享链接允许的来源域名
+func (l Link) Referers() []string {
+	return splitList(l.AllowedReferers)
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
 type AssetTrasnferDetails []*AssetTrasnferDetail
 
 func (atds AssetTrasnferDetails) GroupByNodeAndState() *AssetTrasnferDetail {
@@ -40,3 +91,17 @@ func (atds AssetTrasnferDetails) GroupByNodeAndState() *AssetTrasnferDetail {
 
 	return ret
 }
+
+// SetDiff 记录操作前后的数据
+func (l *OperationLog) SetDiff(before, after interface{}) {
+	if before != nil {
+		if b, err := json.Marshal(before); err == nil {
+			l.BeforeValue = string(b)
+		}
+	}
+	if after != nil {
+		if b, err := json.Marshal(after); err == nil {
+			l.AfterValue = string(b)
+		}
+	}
+}
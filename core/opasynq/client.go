@@ -3,10 +3,13 @@ package opasynq
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/gnasnik/titan-explorer/config"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/google/uuid"
 	"github.com/hibiken/asynq"
 )
 
@@ -89,6 +92,74 @@ func (c *Client) EnqueueAssetDeleteNotify(ctx context.Context, p AssetDeleteNoti
 	return nil
 }
 
+// EnqueueTenantEvent 塞入租户事件, EventID 不为空时同一事件只会入队一次
+func (c *Client) EnqueueTenantEvent(ctx context.Context, p TenantEventPayload) error {
+	if p.CreatedTime.IsZero() {
+		p.CreatedTime = time.Now()
+	}
+
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("json unmarshal payload of TenantEvent error:%w", err)
+	}
+
+	opts := []asynq.Option{
+		asynq.Queue(TaskQueueTenant),
+		asynq.MaxRetry(3),
+		asynq.Retention(24 * time.Hour),
+	}
+	if p.EventID != "" {
+		opts = append(opts, asynq.TaskID(p.EventID))
+	}
+
+	task := asynq.NewTask(TaskTypeTenantEvent, payload, opts...)
+
+	_, err = c.cli.EnqueueContext(ctx, task)
+	if errors.Is(err, asynq.ErrTaskIDConflict) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not enqueue task of TenantEvent error:%w", err)
+	}
+
+	return nil
+}
+
+// EnqueueTenantWebhook 塞入单个订阅地址的回调任务
+func (c *Client) EnqueueTenantWebhook(ctx context.Context, p TenantWebhookPayload) error {
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("json unmarshal payload of TenantWebhook error:%w", err)
+	}
+
+	opts := []asynq.Option{
+		asynq.MaxRetry(8),               //
+		asynq.Retention(24 * time.Hour), // 任务保留一天
+		asynq.Timeout(1 * time.Minute),  // 1分钟时间超时
+	}
+	// 分发事件时同一事件和订阅只入队一次, 分发任务重试时不会重复投递; 手动重新投递复用原投递记录, 不限制
+	if p.DeliveryID == "" && p.EventID != "" {
+		opts = append(opts, asynq.TaskID(TenantWebhookTaskID(p.EventID, p.SubscriptionID)))
+	}
+
+	task := asynq.NewTask(TaskTypeTenantWebhook, payload, opts...)
+
+	_, err = c.cli.EnqueueContext(ctx, task, asynq.Queue(TaskQueueTenant))
+	if errors.Is(err, asynq.ErrTaskIDConflict) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not enqueue task of TenantWebhook error:%w", err)
+	}
+
+	return nil
+}
+
+// TenantWebhookTaskID 事件投递到订阅地址的任务ID, 也是投递记录的ID
+func TenantWebhookTaskID(eventID string, subscriptionID int64) string {
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(fmt.Sprintf("%s/%d", eventID, subscriptionID))).String()
+}
+
 // EnqueueDeleteAssetOperation 塞入需要删除的调度器文件
 func (c *Client) EnqueueDeleteAssetOperation(ctx context.Context, tp DeleteAssetPayload) error {
 	payload, err := json.Marshal(tp)
@@ -106,6 +177,97 @@ func (c *Client) EnqueueDeleteAssetOperation(ctx context.Context, tp DeleteAsset
 	return nil
 }
 
+// EnqueueAssetBatch 塞入文件批量操作任务, 同一任务只会入队一次
+func (c *Client) EnqueueAssetBatch(ctx context.Context, p AssetBatchPayload) error {
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("json unmarshal payload of AssetBatch error:%w", err)
+	}
+
+	task := asynq.NewTask(TypeAssetBatch, payload, []asynq.Option{
+		asynq.MaxRetry(3),
+		asynq.TaskID(p.JobID),
+		asynq.Retention(24 * time.Hour), // 任务保留一天
+		asynq.Timeout(30 * time.Minute), // 30分钟时间超时, 重试时跳过已处理的项
+	}...)
+
+	_, err = c.cli.EnqueueContext(ctx, task, asynq.Queue(TaskQueueExplorer))
+	if err != nil {
+		return fmt.Errorf("could not enqueue task of AssetBatch error:%w", err)
+	}
+
+	return nil
+}
+
+// EnqueueGroupPublish 塞入文件组发布任务, 同一次发布只会入队一次
+func (c *Client) EnqueueGroupPublish(ctx context.Context, p GroupPublishPayload) error {
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("json unmarshal payload of GroupPublish error:%w", err)
+	}
+
+	task := asynq.NewTask(TypeGroupPublish, payload, []asynq.Option{
+		asynq.MaxRetry(3),
+		asynq.TaskID(fmt.Sprintf("group-publish-%d", p.ID)),
+		asynq.Retention(24 * time.Hour), // 任务保留一天
+		asynq.Timeout(time.Hour),        // 需要下载所有文件生成 CAR, 1小时超时
+	}...)
+
+	_, err = c.cli.EnqueueContext(ctx, task, asynq.Queue(TaskQueueExplorer))
+	if err != nil {
+		return fmt.Errorf("could not enqueue task of GroupPublish error:%w", err)
+	}
+
+	return nil
+}
+
+// EnqueueNodeAlert 塞入节点告警通知, 在 processAt 之后发送, 免打扰时段内的告警会延后
+func (c *Client) EnqueueNodeAlert(ctx context.Context, p NodeAlertPayload, processAt time.Time) error {
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("json unmarshal payload of NodeAlert error:%w", err)
+	}
+
+	task := asynq.NewTask(TaskTypeNodeAlert, payload, []asynq.Option{
+		asynq.MaxRetry(5),
+		asynq.TaskID(fmt.Sprintf("node-alert-%d", p.ID)),
+		asynq.ProcessAt(processAt),
+		asynq.Retention(24 * time.Hour),
+	}...)
+
+	_, err = c.cli.EnqueueContext(ctx, task, asynq.Queue(TaskQueueExplorer))
+	if err != nil {
+		return fmt.Errorf("could not enqueue task of NodeAlert error:%w", err)
+	}
+
+	return nil
+}
+
+// EnqueueRewardRepair 塞入收益修复任务, 同一次对账正在修复时不重复入队
+func (c *Client) EnqueueRewardRepair(ctx context.Context, p RewardRepairPayload) error {
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("json unmarshal payload of RewardRepair error:%w", err)
+	}
+
+	// 同一次对账只有一个修复任务, 任务会一直处理到没有已批准的差异, 所以任务 ID 重复时不需要再入队;
+	// 完成的任务不保留, 之后批准的差异可以重新入队
+	task := asynq.NewTask(TaskTypeRewardRepair, payload, []asynq.Option{
+		asynq.MaxRetry(3),
+		asynq.TaskID(fmt.Sprintf("reward-repair-%d", p.RunID)),
+	}...)
+
+	_, err = c.cli.EnqueueContext(ctx, task, asynq.Queue(TaskQueueExplorer))
+	if errors.Is(err, asynq.ErrTaskIDConflict) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not enqueue task of RewardRepair error:%w", err)
+	}
+
+	return nil
+}
+
 // EnqueueIPFSRecord 塞入ipfs同步文件
 func (c *Client) EnqueueIPFSRecord(ctx context.Context, irp IPFSRecordPayload) error {
 	payload, err := json.Marshal(irp)
@@ -122,3 +284,29 @@ func (c *Client) EnqueueIPFSRecord(ctx context.Context, irp IPFSRecordPayload) e
 
 	return nil
 }
+
+// EnqueueLoginLog 塞入登录日志, 同组的任务由服务端聚合后批量写入
+func (c *Client) EnqueueLoginLog(ctx context.Context, l *model.LoginLog) error {
+	return c.enqueueOplog(ctx, TaskTypeLoginLog, l)
+}
+
+// EnqueueOperationLog 塞入操作日志, 同组的任务由服务端聚合后批量写入
+func (c *Client) EnqueueOperationLog(ctx context.Context, l *model.OperationLog) error {
+	return c.enqueueOplog(ctx, TaskTypeOperationLog, l)
+}
+
+func (c *Client) enqueueOplog(ctx context.Context, typename string, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("json unmarshal payload of %s error:%w", typename, err)
+	}
+
+	task := asynq.NewTask(typename, payload, asynq.Queue(TaskQueueOplog), asynq.Group(typename), asynq.MaxRetry(10))
+
+	_, err = c.cli.EnqueueContext(ctx, task)
+	if err != nil {
+		return fmt.Errorf("could not enqueue task of %s error:%w", typename, err)
+	}
+
+	return nil
+}
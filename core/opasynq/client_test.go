@@ -0,0 +1,19 @@
+package opasynq
+
+import "testing"
+
+func TestTenantWebhookTaskID(t *testing.T) {
+	id := TenantWebhookTaskID("event-1", 1)
+	// 投递记录ID是 char(36)
+	if len(id) != 36 {
+		t.Fatalf("expected a 36 characters id, got %q", id)
+	}
+
+	if TenantWebhookTaskID("event-1", 1) != id {
+		t.Fatalf("task id should be stable for the same event and subscription")
+	}
+
+	if TenantWebhookTaskID("event-1", 2) == id || TenantWebhookTaskID("event-2", 1) == id {
+		t.Fatalf("task id should differ between events and subscriptions")
+	}
+}
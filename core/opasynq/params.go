@@ -1,6 +1,7 @@
 package opasynq
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/gnasnik/titan-explorer/core/generated/model"
@@ -16,17 +17,84 @@ const (
 	//
 	TaskTypeAssetDeleteNotify = "task:asset:delete:notify"
 
+	// TaskTypeTenantEvent 租户事件, 按订阅分发到各个回调地址
+	TaskTypeTenantEvent = "task:tenant:event"
+
+	// TaskTypeTenantWebhook 投递租户事件到单个订阅地址
+	TaskTypeTenantWebhook = "task:tenant:webhook"
+
 	// TypeDeleteAssetOperation 从调度器删除文件操作
 	TypeDeleteAssetOperation = "operation:delete:asset"
 
+	// TypeAssetBatch 文件批量操作
+	TypeAssetBatch = "operation:asset:batch"
+
+	// TypeGroupPublish 文件组发布为 UnixFS 目录
+	TypeGroupPublish = "operation:group:publish"
+
+	// TaskTypeNodeAlert 发送节点告警通知
+	TaskTypeNodeAlert = "task:node:alert"
+
+	// TaskTypeRewardRepair 修复对账中已批准的收益差异
+	TaskTypeRewardRepair = "task:reward:repair"
+
 	// TypeSyncIPFSRecord 同步ipfs文件记录
 	TypeSyncIPFSRecord = "sync:ipfs"
+
+	// TaskTypeLoginLog 登录日志, 按组聚合后批量写入
+	TaskTypeLoginLog = "oplog:login"
+
+	// TaskTypeOperationLog 操作日志, 按组聚合后批量写入
+	TaskTypeOperationLog = "oplog:operation"
+
+	// TaskTypeLoginLogBatch 聚合后的登录日志
+	TaskTypeLoginLogBatch = "oplog:login:batch"
+
+	// TaskTypeOperationLogBatch 聚合后的操作日志
+	TaskTypeOperationLogBatch = "oplog:operation:batch"
+)
+
+const (
+	// WebhookEventAssetUploaded 租户回调事件: 文件上传完成
+	WebhookEventAssetUploaded = "asset.uploaded"
+
+	// WebhookEventAssetDeleted 租户回调事件: 文件已删除
+	WebhookEventAssetDeleted = "asset.deleted"
+
+	// WebhookEventAssetSynced 租户回调事件: 文件已同步到所有区域
+	WebhookEventAssetSynced = "asset.synced"
+
+	// WebhookEventShareCreated 租户回调事件: 创建分享链接
+	WebhookEventShareCreated = "share.created"
+
+	// WebhookEventShareExpired 租户回调事件: 分享链接已过期
+	WebhookEventShareExpired = "share.expired"
+
+	// WebhookEventGroupCreated 租户回调事件: 创建文件夹
+	WebhookEventGroupCreated = "group.created"
+
+	// WebhookEventGroupRenamed 租户回调事件: 文件夹重命名
+	WebhookEventGroupRenamed = "group.renamed"
+
+	// WebhookEventGroupDeleted 租户回调事件: 删除文件夹
+	WebhookEventGroupDeleted = "group.deleted"
+
+	// WebhookEventUserCreated 租户回调事件: 子账户通过 SSO 创建
+	WebhookEventUserCreated = "user.created"
+
+	// WebhookEventUserDeleted 租户回调事件: 子账户已删除
+	WebhookEventUserDeleted = "user.deleted"
+
+	// WebhookEventStorageQuota 租户回调事件: 存储空间使用量达到阈值
+	WebhookEventStorageQuota = "storage.quota"
 )
 
 const (
 	TaskQueueExplorer = "explorer"
 
 	TaskQueueTenant = "tenant"
+
+	TaskQueueOplog = "oplog"
 )
 
 type (
@@ -53,6 +121,7 @@ type (
 
 		NotifyUrl  string
 		RetryCount int
+		DeliveryID string // 投递记录ID, 手动重新投递时复用原记录
 	}
 
 	AssetDeleteNotifyPayload struct {
@@ -61,6 +130,25 @@ type (
 		UserID   string // 上传者ID
 
 		AssetCID string
+
+		DeliveryID string // 投递记录ID, 手动重新投递时复用原记录
+	}
+
+	// TenantEventPayload 租户事件
+	TenantEventPayload struct {
+		EventID     string          `json:"event_id"` // 事件ID, 相同ID的事件只会分发一次
+		TenantID    string          `json:"tenant_id"`
+		Event       string          `json:"event"`
+		Data        json.RawMessage `json:"data"`
+		CreatedTime time.Time       `json:"created_time"`
+	}
+
+	// TenantWebhookPayload 投递到单个订阅地址的租户事件
+	TenantWebhookPayload struct {
+		TenantEventPayload
+		SubscriptionID int64  `json:"subscription_id"`
+		Url            string `json:"url"`
+		DeliveryID     string `json:"delivery_id"` // 投递记录ID, 手动重新投递时复用原记录
 	}
 
 	// DeleteAssetPayload 删除
@@ -69,6 +157,26 @@ type (
 		AreaID string `json:"area_id"`
 	}
 
+	// AssetBatchPayload 文件批量操作, 操作内容保存在 asset_batch_job 表中
+	AssetBatchPayload struct {
+		JobID string `json:"job_id"`
+	}
+
+	// GroupPublishPayload 文件组发布, 发布内容保存在 asset_group_publish 表中
+	GroupPublishPayload struct {
+		ID int64 `json:"id"`
+	}
+
+	// NodeAlertPayload 节点告警, 告警内容保存在 node_alert 表中
+	NodeAlertPayload struct {
+		ID int64 `json:"id"`
+	}
+
+	// RewardRepairPayload 修复一次对账中已批准的差异
+	RewardRepairPayload struct {
+		RunID int64 `json:"run_id"`
+	}
+
 	// IPFSRecordPayload ipfs文件记录
 	IPFSRecordPayload struct {
 		AreaID string          `json:"area_id"`
@@ -2,70 +2,59 @@ package oplog
 
 import (
 	"context"
-	"github.com/filecoin-project/pubsub"
+	"time"
+
 	"github.com/gnasnik/titan-explorer/core/dao"
 	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/core/opasynq"
 	logging "github.com/ipfs/go-log/v2"
 )
 
 var log = logging.Logger("oplog")
 
-const (
-	loggerLoginTopic     string = "login"
-	loggerOperationTopic        = "operation"
-)
+const enqueueTimeout = 3 * time.Second
 
-var o *oplog
+// AddLoginLog 记录登录日志, 通过 asynq 队列持久化后批量写入
+func AddLoginLog(l *model.LoginLog) {
+	ctx, cancel := context.WithTimeout(context.Background(), enqueueTimeout)
+	defer cancel()
 
-func init() {
-	o = &oplog{
-		logger: pubsub.New(50),
+	if l.CreatedAt.IsZero() {
+		l.CreatedAt = time.Now()
 	}
-	o.sub(context.Background())
-}
 
-type oplog struct {
-	logger *pubsub.PubSub
-}
+	if opasynq.DefaultCli != nil {
+		err := opasynq.DefaultCli.EnqueueLoginLog(ctx, l)
+		if err == nil {
+			return
+		}
+		log.Errorf("enqueue login log: %v", err)
+	}
 
-func (l *oplog) pub(topic string, v interface{}) {
-	l.logger.Pub(v, topic)
+	// 队列不可用时直接写入, 避免丢失日志
+	if err := dao.AddLoginLog(ctx, l); err != nil {
+		log.Errorf("add login log: %v", err)
+	}
 }
 
-func (l *oplog) sub(ctx context.Context) {
-	login := l.logger.Sub(loggerLoginTopic)
-	operator := l.logger.Sub(loggerOperationTopic)
-	go func() {
-		defer l.logger.Unsub(login)
-		defer l.logger.Unsub(operator)
-
-		for {
-			select {
-			case msg := <-login:
-				err := dao.AddLoginLog(ctx, msg.(*model.LoginLog))
-				if err != nil {
-					log.Errorf("add login log: %v", err)
-				}
-			case msg := <-operator:
-				err := dao.AddOperationLog(ctx, msg.(*model.OperationLog))
-				if err != nil {
-					log.Errorf("add operation log: %v", err)
-				}
-			case <-ctx.Done():
-				return
-			}
-		}
-	}()
-}
+// AddOperationLog 记录操作日志, 通过 asynq 队列持久化后批量写入
+func AddOperationLog(l *model.OperationLog) {
+	ctx, cancel := context.WithTimeout(context.Background(), enqueueTimeout)
+	defer cancel()
 
-func AddLoginLog(v interface{}) {
-	o.pub(loggerLoginTopic, v)
-}
+	if l.CreatedAt.IsZero() {
+		l.CreatedAt = time.Now()
+	}
 
-func AddOperationLog(v interface{}) {
-	o.pub(loggerOperationTopic, v)
-}
+	if opasynq.DefaultCli != nil {
+		err := opasynq.DefaultCli.EnqueueOperationLog(ctx, l)
+		if err == nil {
+			return
+		}
+		log.Errorf("enqueue operation log: %v", err)
+	}
 
-func Subscribe(ctx context.Context) {
-	o.sub(ctx)
+	if err := dao.AddOperationLog(ctx, l); err != nil {
+		log.Errorf("add operation log: %v", err)
+	}
 }
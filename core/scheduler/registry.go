@@ -0,0 +1,457 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Filecoin-Titan/titan/api"
+	"github.com/Filecoin-Titan/titan/api/client"
+	"github.com/Filecoin-Titan/titan/api/types"
+	"github.com/gnasnik/titan-explorer/config"
+	"github.com/gnasnik/titan-explorer/core/statistics"
+	"github.com/go-redis/redis/v9"
+	logging "github.com/ipfs/go-log/v2"
+)
+
+var log = logging.Logger("scheduler")
+
+var (
+	DefaultAreaId = "Asia-China-Guangdong-Shenzhen"
+
+	defaultProbeInterval = 30 * time.Second
+	defaultProbeTimeout  = 5 * time.Second
+	defaultMaxFailures   = 3
+)
+
+var ErrNoScheduler = errors.New("no scheduler found")
+
+// ConfigLoader 加载某个区域下的所有调度器配置
+type ConfigLoader func(ctx context.Context, areaID string) ([]*types.SchedulerCfg, error)
+
+// Dialer 根据调度器配置创建 rpc 客户端
+type Dialer func(ctx context.Context, cfg *types.SchedulerCfg) (api.Scheduler, func(), error)
+
+// Prober 探测调度器是否可用
+type Prober func(ctx context.Context, cli api.Scheduler) error
+
+// Status 调度器的健康状态
+type Status struct {
+	AreaID      string    `json:"area_id"`
+	URL         string    `json:"url"`
+	Healthy     bool      `json:"healthy"`
+	Connected   bool      `json:"connected"`
+	Failures    int       `json:"failures"`
+	LastError   string    `json:"last_error"`
+	LastCheck   time.Time `json:"last_check"`
+	LastHealthy time.Time `json:"last_healthy"`
+	LatencyMs   int64     `json:"latency_ms"`
+}
+
+type entry struct {
+	areaID      string
+	cfg         *types.SchedulerCfg
+	client      api.Scheduler
+	closer      func()
+	healthy     bool
+	failures    int
+	lastErr     string
+	lastCheck   time.Time
+	lastHealthy time.Time
+	latency     time.Duration
+}
+
+func (e *entry) key() string {
+	return e.cfg.SchedulerURL + "|" + e.cfg.AccessToken
+}
+
+func (e *entry) close() {
+	if e.closer != nil {
+		e.closer()
+	}
+	e.client = nil
+	e.closer = nil
+}
+
+// Registry 维护每个区域下所有调度器的 rpc 客户端.
+// 后台定期探活, 连续失败的客户端会被关闭, 下次使用时重建; 获取客户端时按配置顺序返回第一个健康的调度器, 以此实现故障转移.
+type Registry struct {
+	mu     sync.RWMutex
+	areas  map[string][]*entry
+	loader ConfigLoader
+	dialer Dialer
+	prober Prober
+	cfg    config.SchedulerRegistryConfig
+}
+
+// NewRegistry 新建调度器注册表
+func NewRegistry(cfg config.SchedulerRegistryConfig, loader ConfigLoader, dialer Dialer, prober Prober) *Registry {
+	if cfg.ProbeInterval <= 0 {
+		cfg.ProbeInterval = defaultProbeInterval
+	}
+	if cfg.ProbeTimeout <= 0 {
+		cfg.ProbeTimeout = defaultProbeTimeout
+	}
+	if cfg.MaxFailures <= 0 {
+		cfg.MaxFailures = defaultMaxFailures
+	}
+
+	return &Registry{
+		areas:  make(map[string][]*entry),
+		loader: loader,
+		dialer: dialer,
+		prober: prober,
+		cfg:    cfg,
+	}
+}
+
+// Get 获取区域下一个可用的调度器客户端, 区域没有配置调度器时使用默认区域
+func (r *Registry) Get(ctx context.Context, areaID string) (api.Scheduler, error) {
+	entries, err := r.resolve(ctx, areaID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		cli, err := r.connect(e)
+		if err != nil {
+			log.Errorf("create scheduler rpc client %s: %v", e.cfg.SchedulerURL, err)
+			r.recordFailure(e, err)
+			continue
+		}
+		return cli, nil
+	}
+
+	return nil, fmt.Errorf("%w in area %s", ErrNoScheduler, areaID)
+}
+
+// URL 返回区域下首选调度器的地址, 选择顺序与 Get 一致
+func (r *Registry) URL(ctx context.Context, areaID string) (string, error) {
+	entries, err := r.resolve(ctx, areaID)
+	if err != nil {
+		return "", err
+	}
+
+	if len(entries) == 0 {
+		return "", fmt.Errorf("%w in area %s", ErrNoScheduler, areaID)
+	}
+	return entries[0].cfg.SchedulerURL, nil
+}
+
+// resolve 返回区域下按优先级排序的调度器, 区域没有配置调度器时使用默认区域
+func (r *Registry) resolve(ctx context.Context, areaID string) ([]*entry, error) {
+	entries, err := r.load(ctx, areaID)
+	if errors.Is(err, redis.Nil) && areaID != DefaultAreaId {
+		log.Warnf("no scheduler configured for area %s, fallback to %s", areaID, DefaultAreaId)
+		return r.resolve(ctx, DefaultAreaId)
+	}
+
+	if err != nil {
+		log.Errorf("load scheduler configs of %s: %v", areaID, err)
+		return nil, ErrNoScheduler
+	}
+
+	return r.candidates(entries), nil
+}
+
+// Areas 返回已加载的区域
+func (r *Registry) Areas() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	out := make([]string, 0, len(r.areas))
+	for areaID := range r.areas {
+		out = append(out, areaID)
+	}
+	sort.Strings(out)
+
+	return out
+}
+
+// Health 返回所有调度器的健康状态
+func (r *Registry) Health() []*Status {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var out []*Status
+	for _, entries := range r.areas {
+		for _, e := range entries {
+			out = append(out, &Status{
+				AreaID:      e.areaID,
+				URL:         e.cfg.SchedulerURL,
+				Healthy:     e.healthy,
+				Connected:   e.client != nil,
+				Failures:    e.failures,
+				LastError:   e.lastErr,
+				LastCheck:   e.lastCheck,
+				LastHealthy: e.lastHealthy,
+				LatencyMs:   e.latency.Milliseconds(),
+			})
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].AreaID != out[j].AreaID {
+			return out[i].AreaID < out[j].AreaID
+		}
+		return out[i].URL < out[j].URL
+	})
+
+	return out
+}
+
+// Run 定期刷新调度器配置并探活, 直到 ctx 结束
+func (r *Registry) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.ProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.refresh(ctx)
+			r.probeAll(ctx)
+		case <-ctx.Done():
+			r.closeAll()
+			return
+		}
+	}
+}
+
+// load 返回区域下的调度器, 第一次访问时从配置加载
+func (r *Registry) load(ctx context.Context, areaID string) ([]*entry, error) {
+	r.mu.RLock()
+	entries, ok := r.areas[areaID]
+	r.mu.RUnlock()
+	if ok {
+		return entries, nil
+	}
+
+	cfgs, err := r.loader(ctx, areaID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cfgs) == 0 {
+		return nil, redis.Nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if entries, ok := r.areas[areaID]; ok {
+		return entries, nil
+	}
+
+	entries = r.merge(areaID, nil, cfgs)
+	r.areas[areaID] = entries
+
+	return entries, nil
+}
+
+// candidates 健康的调度器按配置顺序排在前面, 不健康的放在最后作为兜底
+func (r *Registry) candidates(entries []*entry) []*entry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var healthy, unhealthy []*entry
+	for _, e := range entries {
+		if e.healthy {
+			healthy = append(healthy, e)
+			continue
+		}
+		unhealthy = append(unhealthy, e)
+	}
+
+	return append(healthy, unhealthy...)
+}
+
+// connect 返回调度器的客户端, 客户端不存在时重建
+func (r *Registry) connect(e *entry) (api.Scheduler, error) {
+	r.mu.RLock()
+	cli := e.client
+	r.mu.RUnlock()
+	if cli != nil {
+		return cli, nil
+	}
+
+	// 客户端会被长期缓存, 不使用请求的 ctx
+	cli, closer, err := r.dialer(context.Background(), e.cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e.client != nil {
+		if closer != nil {
+			closer()
+		}
+		return e.client, nil
+	}
+
+	e.client = cli
+	e.closer = closer
+
+	return cli, nil
+}
+
+// refresh 重新加载已知区域的调度器配置, 新增的调度器加入注册表, 已移除的关闭客户端
+func (r *Registry) refresh(ctx context.Context) {
+	for _, areaID := range r.Areas() {
+		cfgs, err := r.loader(ctx, areaID)
+		if err != nil && !errors.Is(err, redis.Nil) {
+			log.Errorf("reload scheduler configs of %s: %v", areaID, err)
+			continue
+		}
+
+		r.mu.Lock()
+		if len(cfgs) == 0 {
+			for _, e := range r.areas[areaID] {
+				e.close()
+			}
+			delete(r.areas, areaID)
+		} else {
+			r.areas[areaID] = r.merge(areaID, r.areas[areaID], cfgs)
+		}
+		r.mu.Unlock()
+	}
+}
+
+// merge 根据最新的配置生成区域的调度器列表, 保留配置未变化的调度器, 调用方需持有写锁
+func (r *Registry) merge(areaID string, current []*entry, cfgs []*types.SchedulerCfg) []*entry {
+	existing := make(map[string]*entry, len(current))
+	for _, e := range current {
+		existing[e.key()] = e
+	}
+
+	out := make([]*entry, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		if cfg == nil {
+			continue
+		}
+
+		e := &entry{areaID: areaID, cfg: cfg, healthy: true}
+		if old, ok := existing[e.key()]; ok {
+			e = old
+			delete(existing, e.key())
+		}
+		out = append(out, e)
+	}
+
+	for _, e := range existing {
+		log.Infof("scheduler %s removed from area %s", e.cfg.SchedulerURL, areaID)
+		e.close()
+	}
+
+	return out
+}
+
+func (r *Registry) probeAll(ctx context.Context) {
+	r.mu.RLock()
+	var entries []*entry
+	for _, es := range r.areas {
+		entries = append(entries, es...)
+	}
+	r.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, e := range entries {
+		wg.Add(1)
+		go func(e *entry) {
+			defer wg.Done()
+			r.probe(ctx, e)
+		}(e)
+	}
+	wg.Wait()
+}
+
+func (r *Registry) probe(ctx context.Context, e *entry) {
+	cli, err := r.connect(e)
+	if err != nil {
+		r.recordFailure(e, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.cfg.ProbeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	if err := r.prober(ctx, cli); err != nil {
+		log.Warnf("probe scheduler %s of %s: %v", e.cfg.SchedulerURL, e.areaID, err)
+		r.recordFailure(e, err)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !e.healthy {
+		log.Infof("scheduler %s of %s recovered", e.cfg.SchedulerURL, e.areaID)
+	}
+
+	e.healthy = true
+	e.failures = 0
+	e.lastErr = ""
+	e.lastCheck = time.Now()
+	e.lastHealthy = e.lastCheck
+	e.latency = time.Since(start)
+}
+
+// recordFailure 记录一次失败, 连续失败达到上限后标记为不健康并关闭客户端, 下次使用时重建
+func (r *Registry) recordFailure(e *entry, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e.failures++
+	e.lastErr = err.Error()
+	e.lastCheck = time.Now()
+
+	if e.failures >= r.cfg.MaxFailures {
+		if e.healthy {
+			log.Errorf("scheduler %s of %s marked unhealthy after %d failures", e.cfg.SchedulerURL, e.areaID, e.failures)
+		}
+		e.healthy = false
+		e.close()
+	}
+}
+
+func (r *Registry) closeAll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, entries := range r.areas {
+		for _, e := range entries {
+			e.close()
+		}
+	}
+}
+
+// loadConfigsFromCache 从 redis 读取调度器配置, 配置由 statistics 从 Etcd 同步写入
+func loadConfigsFromCache(ctx context.Context, areaID string) ([]*types.SchedulerCfg, error) {
+	return statistics.GetSchedulerConfigs(ctx, fmt.Sprintf("%s::%s", statistics.SchedulerConfigKeyPrefix, areaID))
+}
+
+func dialScheduler(ctx context.Context, cfg *types.SchedulerCfg) (api.Scheduler, func(), error) {
+	// https protocol still in test, we use http for now.
+	schedulerURL := strings.Replace(cfg.SchedulerURL, "https", "http", 1)
+	headers := http.Header{}
+	headers.Add("Authorization", "Bearer "+cfg.AccessToken)
+
+	cli, closer, err := client.NewScheduler(ctx, schedulerURL, headers)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cli, closer, nil
+}
+
+func probeScheduler(ctx context.Context, cli api.Scheduler) error {
+	_, err := cli.GetNodeList(ctx, 0, 1)
+	return err
+}
@@ -0,0 +1,179 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/Filecoin-Titan/titan/api"
+	"github.com/Filecoin-Titan/titan/api/types"
+	"github.com/gnasnik/titan-explorer/config"
+	"github.com/go-redis/redis/v9"
+)
+
+type fakeScheduler struct {
+	api.Scheduler
+	url string
+}
+
+type fakeCluster struct {
+	mu     sync.Mutex
+	areas  map[string][]*types.SchedulerCfg
+	down   map[string]bool
+	dials  map[string]int
+	closed map[string]int
+}
+
+func newFakeCluster() *fakeCluster {
+	return &fakeCluster{
+		areas: map[string][]*types.SchedulerCfg{
+			DefaultAreaId: {{AreaID: DefaultAreaId, SchedulerURL: "http://default"}},
+			"area-1": {
+				{AreaID: "area-1", SchedulerURL: "http://a"},
+				{AreaID: "area-1", SchedulerURL: "http://b"},
+			},
+		},
+		down:   make(map[string]bool),
+		dials:  make(map[string]int),
+		closed: make(map[string]int),
+	}
+}
+
+func (f *fakeCluster) registry() *Registry {
+	loader := func(ctx context.Context, areaID string) ([]*types.SchedulerCfg, error) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		cfgs, ok := f.areas[areaID]
+		if !ok {
+			return nil, redis.Nil
+		}
+		return cfgs, nil
+	}
+
+	dialer := func(ctx context.Context, cfg *types.SchedulerCfg) (api.Scheduler, func(), error) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.dials[cfg.SchedulerURL]++
+		url := cfg.SchedulerURL
+		return &fakeScheduler{url: url}, func() {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			f.closed[url]++
+		}, nil
+	}
+
+	prober := func(ctx context.Context, cli api.Scheduler) error {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.down[cli.(*fakeScheduler).url] {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+
+	return NewRegistry(config.SchedulerRegistryConfig{MaxFailures: 2}, loader, dialer, prober)
+}
+
+func (f *fakeCluster) setDown(url string, down bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down[url] = down
+}
+
+func mustGet(t *testing.T, r *Registry, areaID string) string {
+	t.Helper()
+	cli, err := r.Get(context.Background(), areaID)
+	if err != nil {
+		t.Fatalf("get scheduler of %s: %v", areaID, err)
+	}
+	return cli.(*fakeScheduler).url
+}
+
+func TestRegistryFailover(t *testing.T) {
+	ctx := context.Background()
+	cluster := newFakeCluster()
+	r := cluster.registry()
+
+	if url := mustGet(t, r, "area-1"); url != "http://a" {
+		t.Fatalf("expected first scheduler, got %s", url)
+	}
+
+	cluster.setDown("http://a", true)
+	r.probeAll(ctx)
+	if url := mustGet(t, r, "area-1"); url != "http://a" {
+		t.Fatalf("scheduler should stay healthy below max failures, got %s", url)
+	}
+
+	r.probeAll(ctx)
+	if url := mustGet(t, r, "area-1"); url != "http://b" {
+		t.Fatalf("expected failover to second scheduler, got %s", url)
+	}
+	if cluster.closed["http://a"] != 1 {
+		t.Fatalf("dead client should be closed, closed %d times", cluster.closed["http://a"])
+	}
+
+	cluster.setDown("http://a", false)
+	r.probeAll(ctx)
+	if url := mustGet(t, r, "area-1"); url != "http://a" {
+		t.Fatalf("expected recovered scheduler, got %s", url)
+	}
+	if cluster.dials["http://a"] != 2 {
+		t.Fatalf("dead client should be rebuilt, dialed %d times", cluster.dials["http://a"])
+	}
+}
+
+func TestRegistryFallbackToDefaultArea(t *testing.T) {
+	r := newFakeCluster().registry()
+
+	if url := mustGet(t, r, "unknown-area"); url != "http://default" {
+		t.Fatalf("expected default area scheduler, got %s", url)
+	}
+}
+
+func TestRegistryURL(t *testing.T) {
+	ctx := context.Background()
+	cluster := newFakeCluster()
+	r := cluster.registry()
+
+	if url, err := r.URL(ctx, "area-1"); err != nil || url != "http://a" {
+		t.Fatalf("expected http://a, got %s %v", url, err)
+	}
+
+	cluster.setDown("http://a", true)
+	r.probeAll(ctx)
+	r.probeAll(ctx)
+	if url, err := r.URL(ctx, "area-1"); err != nil || url != "http://b" {
+		t.Fatalf("expected failover to http://b, got %s %v", url, err)
+	}
+
+	if url, err := r.URL(ctx, "unknown-area"); err != nil || url != "http://default" {
+		t.Fatalf("expected default area scheduler, got %s %v", url, err)
+	}
+}
+
+func TestRegistryRefresh(t *testing.T) {
+	ctx := context.Background()
+	cluster := newFakeCluster()
+	r := cluster.registry()
+
+	mustGet(t, r, "area-1")
+
+	cluster.mu.Lock()
+	cluster.areas["area-1"] = []*types.SchedulerCfg{{AreaID: "area-1", SchedulerURL: "http://b"}}
+	cluster.mu.Unlock()
+
+	r.refresh(ctx)
+
+	if url := mustGet(t, r, "area-1"); url != "http://b" {
+		t.Fatalf("expected remaining scheduler, got %s", url)
+	}
+	if cluster.closed["http://a"] != 1 {
+		t.Fatalf("removed scheduler should be closed, closed %d times", cluster.closed["http://a"])
+	}
+
+	health := r.Health()
+	if len(health) != 1 || health[0].URL != "http://b" {
+		t.Fatalf("unexpected health %+v", health)
+	}
+}
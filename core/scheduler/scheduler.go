@@ -0,0 +1,73 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Filecoin-Titan/titan/api"
+	"github.com/Filecoin-Titan/titan/api/types"
+	"github.com/gnasnik/titan-explorer/config"
+	"github.com/go-redis/redis/v9"
+)
+
+// DefaultRegistry 默认的调度器注册表, api 和 job 共用
+var DefaultRegistry = NewRegistry(config.SchedulerRegistryConfig{}, loadConfigsFromCache, dialScheduler, probeScheduler)
+
+// Init 使用配置初始化默认注册表并启动后台探活
+func Init(ctx context.Context, cfg config.SchedulerRegistryConfig) {
+	DefaultRegistry = NewRegistry(cfg, loadConfigsFromCache, dialScheduler, probeScheduler)
+	go DefaultRegistry.Run(ctx)
+}
+
+// Get 获取区域下一个可用的调度器客户端
+func Get(ctx context.Context, areaID string) (api.Scheduler, error) {
+	return DefaultRegistry.Get(ctx, areaID)
+}
+
+// URL 返回区域下首选调度器的地址
+func URL(ctx context.Context, areaID string) (string, error) {
+	return DefaultRegistry.URL(ctx, areaID)
+}
+
+// Areas 返回默认注册表已加载的区域
+func Areas() []string {
+	return DefaultRegistry.Areas()
+}
+
+// Health 返回默认注册表中所有调度器的健康状态
+func Health() []*Status {
+	return DefaultRegistry.Health()
+}
+
+// Use 替换默认注册表, 返回恢复原注册表的函数; 用于测试中注入离线的调度器, 不要在服务运行中调用
+func Use(r *Registry) (restore func()) {
+	prev := DefaultRegistry
+	DefaultRegistry = r
+	return func() {
+		DefaultRegistry = prev
+	}
+}
+
+// NewStaticRegistry 使用固定的客户端创建注册表, 不读取配置也不探活, 键为区域 ID
+func NewStaticRegistry(clients map[string]api.Scheduler) *Registry {
+	loader := func(ctx context.Context, areaID string) ([]*types.SchedulerCfg, error) {
+		if _, ok := clients[areaID]; !ok {
+			return nil, redis.Nil
+		}
+		return []*types.SchedulerCfg{{AreaID: areaID, SchedulerURL: "static://" + areaID}}, nil
+	}
+
+	dialer := func(ctx context.Context, cfg *types.SchedulerCfg) (api.Scheduler, func(), error) {
+		cli, ok := clients[cfg.AreaID]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w in area %s", ErrNoScheduler, cfg.AreaID)
+		}
+		return cli, nil, nil
+	}
+
+	prober := func(ctx context.Context, cli api.Scheduler) error {
+		return nil
+	}
+
+	return NewRegistry(config.SchedulerRegistryConfig{}, loader, dialer, prober)
+}
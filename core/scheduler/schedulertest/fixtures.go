@@ -0,0 +1,59 @@
+package schedulertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Filecoin-Titan/titan/api/types"
+)
+
+// Fixtures 某个区域调度器的初始数据, Titan 的类型按字段名解析
+type Fixtures struct {
+	AreaID    string               `json:"area_id"`
+	Assets    []*types.AssetRecord `json:"assets"`
+	Nodes     []*types.NodeInfo    `json:"nodes"`
+	Downloads []*DownloadFixture   `json:"downloads"`
+}
+
+// DownloadFixture 在 Time 时刻产生的下载记录
+type DownloadFixture struct {
+	Time   time.Time                     `json:"time"`
+	Result *types.AssetDownloadResultRsp `json:"result"`
+}
+
+// Seed 写入初始数据
+func (s *Scheduler) Seed(f *Fixtures) {
+	s.AddAsset(f.Assets...)
+	s.AddNode(f.Nodes...)
+	for _, d := range f.Downloads {
+		s.AddDownloadResult(d.Time, d.Result)
+	}
+}
+
+// LoadFixtures 从 json 文件加载初始数据, 文件内容为 Fixtures 数组, 每个区域创建一个调度器
+func LoadFixtures(path string) ([]*Scheduler, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fixtures []*Fixtures
+	if err := json.Unmarshal(b, &fixtures); err != nil {
+		return nil, fmt.Errorf("parse fixtures %s: %w", path, err)
+	}
+
+	out := make([]*Scheduler, 0, len(fixtures))
+	for _, f := range fixtures {
+		if f.AreaID == "" {
+			return nil, fmt.Errorf("parse fixtures %s: area_id is required", path)
+		}
+
+		s := New(f.AreaID)
+		s.Seed(f)
+		out = append(out, s)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,384 @@
+// Package schedulertest 提供进程内的离线调度器, 用于在没有 Titan 集群的环境下做集成测试.
+//
+// 只实现了 explorer 用到的接口: 文件记录, 分享链接, 下载记录, 节点信息和节点停用;
+// 调用其他接口会因为内嵌的 api.Scheduler 为 nil 而 panic, 需要时再补充.
+package schedulertest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Filecoin-Titan/titan/api"
+	"github.com/Filecoin-Titan/titan/api/types"
+	"github.com/gnasnik/titan-explorer/core/scheduler"
+	"github.com/gnasnik/titan-explorer/core/statistics"
+)
+
+var (
+	ErrAssetNotFound = errors.New("asset not found")
+	ErrNodeNotFound  = errors.New("node not found")
+)
+
+// download 带时间的下载记录, 用于按时间段查询
+type download struct {
+	At     time.Time
+	Result *types.AssetDownloadResultRsp
+}
+
+// Scheduler 离线调度器, 数据保存在内存中, 并发安全
+type Scheduler struct {
+	api.Scheduler
+
+	AreaID string
+	// ShareURL 生成分享链接的地址前缀
+	ShareURL string
+
+	mu          sync.Mutex
+	assets      map[string]*types.AssetRecord
+	nodes       map[string]*types.NodeInfo
+	downloads   []download
+	deactivated map[string]time.Time
+	shares      []*types.ShareAssetReq
+	syncs       []*types.CreateSyncAssetReq
+	errs        map[string]error
+	calls       map[string]int
+}
+
+// New 新建区域下的离线调度器
+func New(areaID string) *Scheduler {
+	return &Scheduler{
+		AreaID:      areaID,
+		ShareURL:    fmt.Sprintf("http://%s.scheduler.test", areaID),
+		assets:      make(map[string]*types.AssetRecord),
+		nodes:       make(map[string]*types.NodeInfo),
+		deactivated: make(map[string]time.Time),
+		errs:        make(map[string]error),
+		calls:       make(map[string]int),
+	}
+}
+
+// Install 把离线调度器注入到默认注册表, api 和 job 获取调度器客户端时会拿到这些调度器, 返回恢复原注册表的函数
+func Install(fakes ...*Scheduler) (restore func()) {
+	clients := make(map[string]api.Scheduler, len(fakes))
+	for _, s := range fakes {
+		clients[s.AreaID] = s
+	}
+	return scheduler.Use(scheduler.NewStaticRegistry(clients))
+}
+
+// Statistics 返回给 statistics 拉取任务使用的调度器
+func (s *Scheduler) Statistics() *statistics.Scheduler {
+	return &statistics.Scheduler{
+		Uuid:   s.AreaID,
+		AreaId: s.AreaID,
+		Api:    s,
+		Closer: func() {},
+	}
+}
+
+// AddAsset 添加文件记录, 已存在时覆盖
+func (s *Scheduler) AddAsset(records ...*types.AssetRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range records {
+		s.assets[r.CID] = r
+	}
+}
+
+// AddNode 添加节点, 已存在时覆盖
+func (s *Scheduler) AddNode(nodes ...*types.NodeInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, n := range nodes {
+		s.nodes[n.NodeID] = n
+	}
+}
+
+// AddDownloadResult 添加一条在 at 时刻产生的下载记录
+func (s *Scheduler) AddDownloadResult(at time.Time, results ...*types.AssetDownloadResultRsp) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range results {
+		s.downloads = append(s.downloads, download{At: at, Result: r})
+	}
+}
+
+// FailOn 让接口返回指定的错误, err 为 nil 时恢复正常
+func (s *Scheduler) FailOn(method string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err == nil {
+		delete(s.errs, method)
+		return
+	}
+	s.errs[method] = err
+}
+
+// Calls 返回接口被调用的次数
+func (s *Scheduler) Calls(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[method]
+}
+
+// Deactivated 返回节点的停用截止时间
+func (s *Scheduler) Deactivated(nodeID string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.deactivated[nodeID]
+	return t, ok
+}
+
+// Shares 返回收到的分享请求
+func (s *Scheduler) Shares() []*types.ShareAssetReq {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*types.ShareAssetReq(nil), s.shares...)
+}
+
+// Syncs 返回收到的同步文件请求
+func (s *Scheduler) Syncs() []*types.CreateSyncAssetReq {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*types.CreateSyncAssetReq(nil), s.syncs...)
+}
+
+// call 记录调用次数并返回注入的错误, 调用方需持有锁
+func (s *Scheduler) call(method string) error {
+	s.calls[method]++
+	return s.errs[method]
+}
+
+func (s *Scheduler) GetAssetRecord(ctx context.Context, cid string) (*types.AssetRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.call("GetAssetRecord"); err != nil {
+		return nil, err
+	}
+
+	record, ok := s.assets[cid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrAssetNotFound, cid)
+	}
+
+	out := *record
+	return &out, nil
+}
+
+func (s *Scheduler) GetAssetRecordsWithCIDs(ctx context.Context, cids []string) ([]*types.AssetRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.call("GetAssetRecordsWithCIDs"); err != nil {
+		return nil, err
+	}
+
+	var out []*types.AssetRecord
+	for _, cid := range cids {
+		if record, ok := s.assets[cid]; ok {
+			r := *record
+			out = append(out, &r)
+		}
+	}
+
+	return out, nil
+}
+
+// GetAssetRecordsByDateRange 按创建时间升序分页返回时间段内的文件记录
+func (s *Scheduler) GetAssetRecordsByDateRange(ctx context.Context, offset, limit int, start, end time.Time) (*types.ListAssetRecordRsp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.call("GetAssetRecordsByDateRange"); err != nil {
+		return nil, err
+	}
+
+	var matched []*types.AssetRecord
+	for _, record := range s.assets {
+		if record.CreatedTime.Before(start) || record.CreatedTime.After(end) {
+			continue
+		}
+		r := *record
+		matched = append(matched, &r)
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		if !matched[i].CreatedTime.Equal(matched[j].CreatedTime) {
+			return matched[i].CreatedTime.Before(matched[j].CreatedTime)
+		}
+		return matched[i].CID < matched[j].CID
+	})
+
+	return &types.ListAssetRecordRsp{Total: int64(len(matched)), List: page(matched, offset, limit)}, nil
+}
+
+func (s *Scheduler) RemoveAssetRecord(ctx context.Context, cid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.call("RemoveAssetRecord"); err != nil {
+		return err
+	}
+
+	delete(s.assets, cid)
+	return nil
+}
+
+func (s *Scheduler) CreateSyncAsset(ctx context.Context, req *types.CreateSyncAssetReq) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.call("CreateSyncAsset"); err != nil {
+		return err
+	}
+
+	s.syncs = append(s.syncs, req)
+	return nil
+}
+
+// ShareAssetV2 文件存在时返回一个分享链接, 链接中带上请求的用户和过期时间便于断言
+func (s *Scheduler) ShareAssetV2(ctx context.Context, req *types.ShareAssetReq) (*types.ShareAssetRsp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.call("ShareAssetV2"); err != nil {
+		return nil, err
+	}
+
+	if _, ok := s.assets[req.AssetCID]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrAssetNotFound, req.AssetCID)
+	}
+
+	s.shares = append(s.shares, req)
+
+	url := fmt.Sprintf("%s/ipfs/%s?user=%s&expire=%d", s.ShareURL, req.AssetCID, req.UserID, req.ExpireTime.Unix())
+	return &types.ShareAssetRsp{URLs: []string{url}}, nil
+}
+
+// GetDownloadResultsFromAssets 返回时间段内的下载记录, hashes 为空时返回所有文件的记录
+func (s *Scheduler) GetDownloadResultsFromAssets(ctx context.Context, hashes []string, start, end time.Time) ([]*types.AssetDownloadResultRsp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.call("GetDownloadResultsFromAssets"); err != nil {
+		return nil, err
+	}
+
+	filter := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		filter[hash] = true
+	}
+
+	var out []*types.AssetDownloadResultRsp
+	for _, d := range s.downloads {
+		if d.At.Before(start) || !d.At.Before(end) {
+			continue
+		}
+		if len(filter) > 0 && !filter[d.Result.Hash] {
+			continue
+		}
+		r := *d.Result
+		out = append(out, &r)
+	}
+
+	return out, nil
+}
+
+func (s *Scheduler) GetNodeInfo(ctx context.Context, nodeID string) (*types.NodeInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.call("GetNodeInfo"); err != nil {
+		return nil, err
+	}
+
+	node, ok := s.nodes[nodeID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNodeNotFound, nodeID)
+	}
+
+	out := *node
+	return &out, nil
+}
+
+// GetNodeList 按节点 ID 排序分页返回节点
+func (s *Scheduler) GetNodeList(ctx context.Context, offset, limit int) (*types.ListNodesRsp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.call("GetNodeList"); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(s.nodes))
+	for id := range s.nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var data []types.NodeInfo
+	for _, id := range page(ids, offset, limit) {
+		data = append(data, *s.nodes[id])
+	}
+
+	return &types.ListNodesRsp{Data: data, Total: int64(len(ids))}, nil
+}
+
+// DeactivateNode 记录节点停用的截止时间, 可以通过 Deactivated 断言
+func (s *Scheduler) DeactivateNode(ctx context.Context, nodeID string, hours int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.call("DeactivateNode"); err != nil {
+		return err
+	}
+
+	if _, ok := s.nodes[nodeID]; !ok {
+		return fmt.Errorf("%w: %s", ErrNodeNotFound, nodeID)
+	}
+
+	s.deactivated[nodeID] = time.Now().Add(time.Duration(hours) * time.Hour)
+	return nil
+}
+
+func (s *Scheduler) UndoNodeDeactivation(ctx context.Context, nodeID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.call("UndoNodeDeactivation"); err != nil {
+		return err
+	}
+
+	if _, ok := s.nodes[nodeID]; !ok {
+		return fmt.Errorf("%w: %s", ErrNodeNotFound, nodeID)
+	}
+
+	delete(s.deactivated, nodeID)
+	return nil
+}
+
+func page[T any](list []T, offset, limit int) []T {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= len(list) {
+		return nil
+	}
+
+	end := len(list)
+	if limit > 0 && offset+limit < end {
+		end = offset + limit
+	}
+
+	return list[offset:end]
+}
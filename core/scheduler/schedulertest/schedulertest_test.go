@@ -0,0 +1,131 @@
+package schedulertest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Filecoin-Titan/titan/api/types"
+	"github.com/gnasnik/titan-explorer/core/scheduler"
+)
+
+const (
+	testCID  = "bafybeic6sx6kvnndanrzlddltcpw7nerjfkahfxzj536die4nmojwlnmqi"
+	testNode = "e_5f1c2a3b-4d5e-6f70-8192-a3b4c5d6e7f8"
+)
+
+func TestInstallFixtures(t *testing.T) {
+	ctx := context.Background()
+
+	fakes, err := LoadFixtures("testdata/fixtures.json")
+	if err != nil {
+		t.Fatalf("load fixtures: %v", err)
+	}
+
+	restore := Install(fakes...)
+	defer restore()
+
+	cli, err := scheduler.Get(ctx, "NorthAmerica-UnitedStates")
+	if err != nil {
+		t.Fatalf("get scheduler: %v", err)
+	}
+	if cli != fakes[1] {
+		t.Fatalf("expected the fake of NorthAmerica-UnitedStates")
+	}
+
+	// 没有配置的区域回退到默认区域
+	cli, err = scheduler.Get(ctx, "Europe-Germany")
+	if err != nil {
+		t.Fatalf("get scheduler: %v", err)
+	}
+	if cli != fakes[0] {
+		t.Fatalf("expected fallback to %s", scheduler.DefaultAreaId)
+	}
+
+	record, err := cli.GetAssetRecord(ctx, testCID)
+	if err != nil {
+		t.Fatalf("get asset record: %v", err)
+	}
+	if record.TotalSize != 1048576 {
+		t.Fatalf("unexpected asset size %d", record.TotalSize)
+	}
+
+	list, err := cli.GetAssetRecordsByDateRange(ctx, 0, 1, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("list asset records: %v", err)
+	}
+	if list.Total != 2 || len(list.List) != 1 || list.List[0].CID != testCID {
+		t.Fatalf("unexpected asset records: total %d, list %d", list.Total, len(list.List))
+	}
+}
+
+func TestShareAndDownloads(t *testing.T) {
+	ctx := context.Background()
+
+	s := New(scheduler.DefaultAreaId)
+	s.AddAsset(&types.AssetRecord{CID: testCID, Hash: "hash"})
+	at := time.Date(2025, 1, 2, 9, 10, 0, 0, time.UTC)
+	s.AddDownloadResult(at, &types.AssetDownloadResultRsp{Hash: "hash", TotalTraffic: 100})
+
+	ret, err := s.ShareAssetV2(ctx, &types.ShareAssetReq{UserID: "user", AssetCID: testCID})
+	if err != nil {
+		t.Fatalf("share asset: %v", err)
+	}
+	if len(ret.URLs) != 1 || len(s.Shares()) != 1 {
+		t.Fatalf("unexpected share result %v", ret.URLs)
+	}
+
+	if _, err := s.ShareAssetV2(ctx, &types.ShareAssetReq{AssetCID: "unknown"}); !errors.Is(err, ErrAssetNotFound) {
+		t.Fatalf("expected ErrAssetNotFound, got %v", err)
+	}
+
+	results, err := s.GetDownloadResultsFromAssets(ctx, nil, at.Truncate(time.Hour), at.Truncate(time.Hour).Add(time.Hour))
+	if err != nil || len(results) != 1 {
+		t.Fatalf("expected 1 download result, got %d: %v", len(results), err)
+	}
+
+	results, _ = s.GetDownloadResultsFromAssets(ctx, nil, at.Add(time.Hour), at.Add(2*time.Hour))
+	if len(results) != 0 {
+		t.Fatalf("expected no download result out of range, got %d", len(results))
+	}
+
+	injected := errors.New("scheduler unavailable")
+	s.FailOn("ShareAssetV2", injected)
+	if _, err := s.ShareAssetV2(ctx, &types.ShareAssetReq{AssetCID: testCID}); !errors.Is(err, injected) {
+		t.Fatalf("expected injected error, got %v", err)
+	}
+	if s.Calls("ShareAssetV2") != 3 {
+		t.Fatalf("expected 3 calls, got %d", s.Calls("ShareAssetV2"))
+	}
+}
+
+func TestDeactivateNode(t *testing.T) {
+	ctx := context.Background()
+
+	s := New(scheduler.DefaultAreaId)
+	s.AddNode(&types.NodeInfo{NodeID: testNode})
+
+	if err := s.DeactivateNode(ctx, testNode, 24); err != nil {
+		t.Fatalf("deactivate node: %v", err)
+	}
+	if until, ok := s.Deactivated(testNode); !ok || until.Before(time.Now().Add(23*time.Hour)) {
+		t.Fatalf("unexpected deactivation %v %v", until, ok)
+	}
+
+	if err := s.UndoNodeDeactivation(ctx, testNode); err != nil {
+		t.Fatalf("undo deactivation: %v", err)
+	}
+	if _, ok := s.Deactivated(testNode); ok {
+		t.Fatalf("expected node to be active")
+	}
+
+	if err := s.DeactivateNode(ctx, "unknown", 1); !errors.Is(err, ErrNodeNotFound) {
+		t.Fatalf("expected ErrNodeNotFound, got %v", err)
+	}
+
+	nodes, err := s.GetNodeList(ctx, 0, 10)
+	if err != nil || nodes.Total != 1 || nodes.Data[0].NodeID != testNode {
+		t.Fatalf("unexpected node list: %v", err)
+	}
+}
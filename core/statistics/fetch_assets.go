@@ -31,6 +31,19 @@ func newAssertFetcher() Fetcher {
 	return &AssertFetcher{BaseFetcher: newBaseFetcher()}
 }
 
+// Name returns the name of AssertFetcher.
+func (a AssertFetcher) Name() string {
+	return "asset"
+}
+
+// Options returns the default options of AssertFetcher.
+func (a AssertFetcher) Options() FetcherOptions {
+	return FetcherOptions{
+		Timeout:     30 * time.Minute,
+		Concurrency: 1,
+	}
+}
+
 // Fetch fetches asset information.
 func (a AssertFetcher) Fetch(ctx context.Context, scheduler *Scheduler) error {
 	log.Info("Start to fetch assets")
@@ -45,18 +58,30 @@ func (a AssertFetcher) Fetch(ctx context.Context, scheduler *Scheduler) error {
 	}
 
 	var (
-		startTime, endTime time.Time
-		limit, offset      int
+		startTime time.Time
+		latestCid string
 	)
 
 	if latest == nil || latest.EndTime.IsZero() {
 		startTime = carbon.Now().StartOfDay().SubDays(defaultBackupDays).StdTime()
 	} else {
 		startTime = latest.EndTime
+		latestCid = latest.Cid
 	}
 
-	limit = defaultRequestLimit
-	endTime = carbon.Now().EndOfDay().StdTime()
+	return a.fetchAssets(ctx, scheduler, startTime, carbon.Now().EndOfDay().StdTime(), latestCid)
+}
+
+// Backfill 重新拉取 [start, end) 时间段内完成的文件记录, 已存在的记录会被更新
+func (a AssertFetcher) Backfill(ctx context.Context, scheduler *Scheduler, start, end time.Time) error {
+	log.Infof("Start to backfill assets of %s from %v to %v", scheduler.AreaId, start, end)
+	return a.fetchAssets(ctx, scheduler, start, end, "")
+}
+
+// fetchAssets 分页拉取时间段内的文件记录, 只返回 latestCid 一条记录时说明没有新数据
+func (a AssertFetcher) fetchAssets(ctx context.Context, scheduler *Scheduler, startTime, endTime time.Time, latestCid string) error {
+	var offset int
+	limit := defaultRequestLimit
 
 Loop:
 	assetRecords, err := scheduler.Api.GetAssetRecordsByDateRange(ctx, offset, limit, startTime, endTime)
@@ -67,7 +92,7 @@ Loop:
 
 	offset += len(assetRecords.List)
 
-	if len(assetRecords.List) == 1 && assetRecords.List[0].CID == latest.Cid {
+	if latestCid != "" && len(assetRecords.List) == 1 && assetRecords.List[0].CID == latestCid {
 		return nil
 	}
 
@@ -138,4 +163,7 @@ func (a AssertFetcher) Finalize() error {
 	return nil
 }
 
-var _ Fetcher = &AssertFetcher{}
+var (
+	_ Fetcher    = &AssertFetcher{}
+	_ Backfiller = &AssertFetcher{}
+)
@@ -2,17 +2,39 @@ package statistics
 
 import (
 	"context"
+	"time"
+
 	"github.com/Filecoin-Titan/titan/api"
 )
 
 // Fetcher is an interface for fetching and processing data.
 type Fetcher interface {
+	// Name 拉取任务的名称, 同时也是配置中 Statistic.Fetchers 的键
+	Name() string
+	// Options 默认的运行参数, 可以被配置覆盖
+	Options() FetcherOptions
 	Fetch(ctx context.Context, scheduler *Scheduler) error
 	Push(ctx context.Context, job Job)
 	GetJobQueue() chan Job
 	Finalize() error
 }
 
+// Backfiller 支持回补历史时间段数据的拉取任务
+type Backfiller interface {
+	Backfill(ctx context.Context, scheduler *Scheduler, start, end time.Time) error
+}
+
+// FetcherOptions 拉取任务的运行参数
+type FetcherOptions struct {
+	Disable bool
+	// Crontab 为空时使用 Statistic.Crontab
+	Crontab string
+	// Timeout 单次运行的超时时间, 包括队列中写库的任务
+	Timeout time.Duration
+	// Concurrency 同时拉取的调度器数量, 0 表示不限制
+	Concurrency int
+}
+
 type Scheduler struct {
 	Uuid   string
 	AreaId string
@@ -18,6 +18,9 @@ import (
 
 const maxPageSize = 1000
 
+// backfillLookback 回补时向前查找节点数据的最大时间
+const backfillLookback = 24 * time.Hour
+
 const (
 	DeviceStatusOffline  = "offline"
 	DeviceStatusOnline   = "online"
@@ -28,8 +31,6 @@ const (
 	DeviceStatusCodeAbnormal = 2
 )
 
-var AllL1NodesMap = make(map[string]*model.DeviceInfo)
-
 // NodeFetcher handles fetching information about all nodes
 type NodeFetcher struct {
 	BaseFetcher
@@ -45,6 +46,18 @@ func newNodeFetcher() Fetcher {
 	return &NodeFetcher{BaseFetcher: newBaseFetcher()}
 }
 
+// Name returns the name of NodeFetcher.
+func (n *NodeFetcher) Name() string {
+	return "node"
+}
+
+// Options returns the default options of NodeFetcher.
+func (n *NodeFetcher) Options() FetcherOptions {
+	return FetcherOptions{
+		Timeout: 10 * time.Minute,
+	}
+}
+
 // Fetch fetches information about all nodes
 // 流程如下:
 // 1. 遍历拉取节点的数据, 每次上限为 1000 个(调度器那边设置上限也是1000)
@@ -52,10 +65,13 @@ func newNodeFetcher() Fetcher {
 // 2.1 更新 device_info表, 使用的是 INSERT INTO ... ON DUPLICATE KEY UPDATE ... , 在线的需要更新多个字段, 离线的只更新在线状态为离线
 // 2.2 写入 device_info_hour 表, 每次拉取都会记录到这个表, 5分钟一条记录
 // 2.3 统计每个节点当天的 收益,在线等数据, 并写到 device_info_daily 表, 唯一主键为 device_id  和 time, 每个节点每天增加一条记录
+// 2.4 对比节点上一次的状态, 为开启告警规则的用户生成离线, NAT 变差和磁盘使用率告警
+// 2.5 更新节点的内存索引 Nodes
 // 3. 把任务 Push 到队列等待执行
 // 4. Finalize 任务, 执行以下统计
 // 4.1 统计每个节点的每日收益,昨日收益,七天收益和月收益等, 更新到 device_info 表
 // 4.2 统计所有节点的总收益,总内存和总的存储等总览页面数据的统计
+// 4.3 从内存索引中移除长时间没有拉取到的节点
 func (n *NodeFetcher) Fetch(ctx context.Context, scheduler *Scheduler) error {
 	log.Infof("start fetching all nodes from scheduler: %s", scheduler.AreaId)
 	start := time.Now()
@@ -136,6 +152,9 @@ loop:
 			}
 		}
 
+		// SumDailyReward 会把收益等字段改为当天的增量, 在此之前写入索引
+		Nodes.Put(allNodes, start)
+
 		if len(deviceInfoHours) > 0 {
 			if err = AddDeviceInfoHours(ctx, start, deviceInfoHours); err != nil {
 				log.Errorf("add device info hours: %v", err)
@@ -146,10 +165,8 @@ loop:
 			log.Errorf("add device info daily reward: %v", err)
 		}
 
-		for _, node := range allNodes {
-			if strings.Contains(node.DeviceID, "c_") {
-				AllL1NodesMap[node.DeviceID] = node
-			}
+		if err := alertNodes(ctx, allNodes, userInDevice, start); err != nil {
+			log.Errorf("alert nodes: %v", err)
 		}
 
 		return nil
@@ -162,6 +179,49 @@ loop:
 	return nil
 }
 
+// Backfill 回补 [start, end) 时间段内 device_info_hour 缺失的整点数据, 并重新统计涉及日期的 device_info_daily.
+// 调度器只能获取节点当前的数据, 无法还原历史数据, 所以缺失的整点使用之前最近一次的节点数据填充,
+// 这样停机期间的收益和流量会计入恢复后的第一次拉取, 而不会丢失或重复统计.
+func (n *NodeFetcher) Backfill(ctx context.Context, scheduler *Scheduler, start, end time.Time) error {
+	log.Infof("start backfill nodes of %s from %v to %v", scheduler.AreaId, start, end)
+
+	slots, err := dao.GetDeviceInfoHourSlots(ctx, scheduler.AreaId, start, end)
+	if err != nil {
+		return errs.Wrap(err, "get device info hour slots")
+	}
+
+	var missing []time.Time
+	for slot := start.Truncate(time.Hour); slot.Before(end); slot = slot.Add(time.Hour) {
+		if slot.Before(start) || slots[slot] {
+			continue
+		}
+		missing = append(missing, slot)
+	}
+
+	log.Infof("backfill nodes of %s: %d missing hour slots", scheduler.AreaId, len(missing))
+
+	n.Push(ctx, func() error {
+		// 按时间顺序填充, 后面的整点可以使用前一个整点回补的数据
+		for _, slot := range missing {
+			count, err := dao.CarryForwardDeviceInfoHours(ctx, scheduler.AreaId, slot, backfillLookback)
+			if err != nil {
+				return errs.Wrapf(err, "carry forward device info hours at %v", slot)
+			}
+			log.Infof("backfill %s device info hours at %v: %d", scheduler.AreaId, slot, count)
+		}
+
+		for day := carbon.CreateFromStdTime(start).StartOfDay(); day.Lt(carbon.CreateFromStdTime(end)); day = day.AddDay() {
+			if err := sumDeviceInfoDailyByDay(ctx, day); err != nil {
+				return errs.Wrapf(err, "sum device info daily of %s", day.ToDateString())
+			}
+		}
+
+		return nil
+	})
+
+	return nil
+}
+
 func (n *NodeFetcher) Finalize() error {
 	st := time.Now()
 	log.Infof("finialize start")
@@ -189,6 +249,10 @@ func (n *NodeFetcher) Finalize() error {
 		log.Errorf("runGenOnlineIncentive: %v", err)
 	}
 
+	if count := Nodes.Evict(time.Now().Add(-nodeIndexTTL)); count > 0 {
+		log.Infof("evict %d stale nodes from index", count)
+	}
+
 	return nil
 }
 
@@ -263,13 +327,18 @@ func SumDailyReward(ctx context.Context, sumTime time.Time, devices []*model.Dev
 	return nil
 }
 
+// DailyTime 返回 t 所在当天在 device_info_daily 中的 time
+func DailyTime(t time.Time) time.Time {
+	return carbon.CreateFromStdTime(t).StartOfDay().AddHours(8).StdTime()
+}
+
 func deviceInfoToDailyInfo(deviceInfo *model.DeviceInfo) *model.DeviceInfoDaily {
 	return &model.DeviceInfoDaily{
 		CreatedAt:         time.Now(),
 		UpdatedAt:         time.Now(),
 		UserID:            deviceInfo.UserID,
 		DeviceID:          deviceInfo.DeviceID,
-		Time:              carbon.CreateFromStdTime(deviceInfo.UpdatedAt).StartOfDay().AddHours(8).StdTime(),
+		Time:              DailyTime(deviceInfo.UpdatedAt),
 		Income:            deviceInfo.CumulativeProfit,
 		OnlineTime:        deviceInfo.OnlineTime,
 		PenaltyProfit:     deviceInfo.PenaltyProfit,
@@ -416,4 +485,7 @@ func applyLocationInfo(deviceInfo *model.DeviceInfo) {
 	deviceInfo.Latitude, _ = strconv.ParseFloat(loc.Latitude, 64)
 }
 
-var _ Fetcher = &NodeFetcher{}
+var (
+	_ Fetcher    = &NodeFetcher{}
+	_ Backfiller = &NodeFetcher{}
+)
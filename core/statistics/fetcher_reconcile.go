@@ -0,0 +1,154 @@
+package statistics
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/gnasnik/titan-explorer/config"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/pkg/formatter"
+	errs "github.com/pkg/errors"
+)
+
+const defaultReconcileTolerance = 0.01
+
+// ReconcileFetcher 对账节点的收益: 对比调度器上节点的累计收益和 device_info_daily 中每日收益之和,
+// 差值超过容差的记录到 reward_reconcile_item, 由管理员批准后修复
+type ReconcileFetcher struct {
+	BaseFetcher
+}
+
+func init() {
+	RegisterFetcher(newReconcileFetcher)
+}
+
+func newReconcileFetcher() Fetcher {
+	return &ReconcileFetcher{BaseFetcher: newBaseFetcher()}
+}
+
+// Name returns the name of ReconcileFetcher.
+func (r *ReconcileFetcher) Name() string {
+	return "reconcile"
+}
+
+// Options returns the default options of ReconcileFetcher, 每天凌晨运行一次.
+func (r *ReconcileFetcher) Options() FetcherOptions {
+	return FetcherOptions{
+		Crontab:     "0 30 1 * * *",
+		Timeout:     30 * time.Minute,
+		Concurrency: 2,
+	}
+}
+
+// Fetch 分页拉取调度器的所有节点, 每个调度器生成一条对账记录
+func (r *ReconcileFetcher) Fetch(ctx context.Context, scheduler *Scheduler) error {
+	tolerance := config.Cfg.RewardReconcile.Tolerance
+	if tolerance <= 0 {
+		tolerance = defaultReconcileTolerance
+	}
+
+	run := &model.RewardReconcileRun{
+		AreaID:    scheduler.AreaId,
+		State:     dao.RewardReconcileRunStateRunning,
+		Tolerance: tolerance,
+		StartedAt: time.Now(),
+	}
+	if err := dao.AddRewardReconcileRun(ctx, run); err != nil {
+		return errs.Wrap(err, "add reward reconcile run")
+	}
+
+	err := r.reconcile(ctx, scheduler, run)
+
+	run.State, run.FinishedAt = dao.RewardReconcileRunStateDone, time.Now()
+	if err != nil {
+		run.State, run.Error = dao.RewardReconcileRunStateFailed, err.Error()
+	}
+	run.TotalDiff = formatter.ToFixed(run.TotalDiff, 6)
+
+	log.Infof("reconcile rewards of %s: %d nodes, %d discrepancies", scheduler.AreaId, run.NodeCount, run.DiscrepancyCount)
+
+	if uerr := dao.UpdateRewardReconcileRun(ctx, run); uerr != nil {
+		log.Errorf("update reward reconcile run %d: %v", run.ID, uerr)
+	}
+	return err
+}
+
+func (r *ReconcileFetcher) reconcile(ctx context.Context, scheduler *Scheduler, run *model.RewardReconcileRun) error {
+	var total int64
+	for page := 0; ; page++ {
+		resp, err := scheduler.Api.GetNodeList(ctx, page*maxPageSize, maxPageSize)
+		if err != nil {
+			return errs.Wrap(err, "get node list")
+		}
+
+		var nodes []*model.DeviceInfo
+		for _, node := range resp.Data {
+			if node.NodeID != "" {
+				nodes = append(nodes, ToDeviceInfo(node, scheduler.AreaId))
+			}
+		}
+		total += int64(len(resp.Data))
+
+		ids := make([]string, 0, len(nodes))
+		for _, node := range nodes {
+			ids = append(ids, node.DeviceID)
+		}
+		sums, err := dao.SumDeviceDailyIncome(ctx, ids)
+		if err != nil {
+			return errs.Wrap(err, "sum device daily income")
+		}
+
+		items := reconcileNodes(nodes, sums, run.Tolerance, time.Now())
+		for _, item := range items {
+			item.RunID = run.ID
+			run.TotalDiff += math.Abs(item.Diff)
+		}
+		if err := dao.AddRewardReconcileItems(ctx, items); err != nil {
+			return errs.Wrap(err, "add reward reconcile items")
+		}
+
+		run.NodeCount += int64(len(nodes))
+		run.DiscrepancyCount += int64(len(items))
+
+		if len(resp.Data) == 0 || total >= resp.Total {
+			return nil
+		}
+	}
+}
+
+// reconcileNodes 对比节点的累计收益和每日收益之和, 返回差值超过容差的节点
+func reconcileNodes(nodes []*model.DeviceInfo, sums map[string]*dao.DeviceIncomeSum, tolerance float64, now time.Time) []*model.RewardReconcileItem {
+	var out []*model.RewardReconcileItem
+	for _, node := range nodes {
+		var dailySum float64
+		var userID string
+		if s, ok := sums[node.DeviceID]; ok {
+			dailySum, userID = s.Income, s.UserID
+		}
+
+		diff := formatter.ToFixed(node.CumulativeProfit-dailySum, 6)
+		if math.Abs(diff) <= tolerance {
+			continue
+		}
+
+		out = append(out, &model.RewardReconcileItem{
+			DeviceID:        node.DeviceID,
+			UserID:          userID,
+			AreaID:          node.AreaID,
+			SchedulerProfit: node.CumulativeProfit,
+			DailySum:        dailySum,
+			Diff:            diff,
+			State:           dao.RewardReconcileItemStateFlagged,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+		})
+	}
+	return out
+}
+
+// Finalize 对账不需要汇总统计
+func (r *ReconcileFetcher) Finalize() error {
+	return nil
+}
@@ -0,0 +1,47 @@
+package statistics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+)
+
+func TestReconcileNodes(t *testing.T) {
+	now := time.Date(2025, 5, 5, 1, 30, 0, 0, time.Local)
+	nodes := []*model.DeviceInfo{
+		{DeviceID: "e_1", AreaID: "Asia-China", CumulativeProfit: 10.005}, // 在容差内
+		{DeviceID: "e_2", AreaID: "Asia-China", CumulativeProfit: 8},      // 少算了收益
+		{DeviceID: "e_3", AreaID: "Asia-China", CumulativeProfit: 5},      // 重复的每日记录
+		{DeviceID: "e_4", AreaID: "Asia-China", CumulativeProfit: 1.5},    // 没有每日记录
+	}
+	sums := map[string]*dao.DeviceIncomeSum{
+		"e_1": {DeviceID: "e_1", UserID: "u1", Income: 10},
+		"e_2": {DeviceID: "e_2", UserID: "u1", Income: 7.25},
+		"e_3": {DeviceID: "e_3", UserID: "u2", Income: 6.1},
+	}
+
+	items := reconcileNodes(nodes, sums, 0.01, now)
+	if len(items) != 3 {
+		t.Fatalf("expect 3 items, got %d", len(items))
+	}
+
+	expect := []struct {
+		deviceID, userID string
+		dailySum, diff   float64
+	}{
+		{"e_2", "u1", 7.25, 0.75},
+		{"e_3", "u2", 6.1, -1.1},
+		{"e_4", "", 0, 1.5},
+	}
+	for i, e := range expect {
+		item := items[i]
+		if item.DeviceID != e.deviceID || item.UserID != e.userID || item.DailySum != e.dailySum || item.Diff != e.diff {
+			t.Fatalf("item %d: expect %+v, got %+v", i, e, item)
+		}
+		if item.State != dao.RewardReconcileItemStateFlagged || item.AreaID != "Asia-China" || !item.CreatedAt.Equal(now) {
+			t.Fatalf("item %d: unexpected %+v", i, item)
+		}
+	}
+}
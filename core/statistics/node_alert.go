@@ -0,0 +1,243 @@
+package statistics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gnasnik/titan-explorer/config"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/core/opasynq"
+	errs "github.com/pkg/errors"
+)
+
+// nodeAlertSnapshotTTL 上一次的状态超过该时间没有更新时重新作为基线, 避免服务停止或规则关闭期间的变化产生告警
+const nodeAlertSnapshotTTL = time.Hour
+
+// natRanks NAT 类型从好到差排序, 未知的类型不参与比较
+var natRanks = map[string]int{
+	"NoNAT":             5,
+	"FullConeNAT":       4,
+	"RestrictedNAT":     3,
+	"PortRestrictedNAT": 2,
+	"SymmetricNAT":      1,
+}
+
+// alertNodes 对比节点本次和上一次拉取时的状态, 为开启了告警规则的用户生成告警;
+// 离线节点没有设置 UserID, 从 owners 中查找所属用户
+func alertNodes(ctx context.Context, nodes []*model.DeviceInfo, owners map[string]string, now time.Time) error {
+	if config.Cfg.NodeAlert.Disable {
+		return nil
+	}
+
+	nodeOwners := make(map[string]string)
+	users := make(map[string]struct{})
+	var userIDs []string
+	for _, node := range nodes {
+		owner := node.UserID
+		if owner == "" {
+			owner = owners[node.DeviceID]
+		}
+		if owner == "" {
+			continue
+		}
+		nodeOwners[node.DeviceID] = owner
+		if _, ok := users[owner]; !ok {
+			users[owner] = struct{}{}
+			userIDs = append(userIDs, owner)
+		}
+	}
+
+	rules, err := dao.GetEnabledNodeAlertRules(ctx, userIDs)
+	if err != nil {
+		return errs.Wrap(err, "get node alert rules")
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	var deviceIDs []string
+	for _, node := range nodes {
+		if _, ok := rules[nodeOwners[node.DeviceID]]; ok {
+			deviceIDs = append(deviceIDs, node.DeviceID)
+		}
+	}
+
+	prevs, err := dao.GetNodeAlertSnapshots(ctx, deviceIDs)
+	if err != nil {
+		return errs.Wrap(err, "get node alert snapshots")
+	}
+
+	snapshots := make(map[string]*dao.NodeAlertSnapshot)
+	for _, node := range nodes {
+		rule, ok := rules[nodeOwners[node.DeviceID]]
+		if !ok {
+			continue
+		}
+
+		prev := prevs[node.DeviceID]
+		if prev != nil && now.Sub(prev.UpdatedAt) > nodeAlertSnapshotTTL {
+			prev = nil
+		}
+
+		next, alerts := evalNodeAlert(rule, prev, node, now)
+		snapshots[node.DeviceID] = next
+
+		for _, alert := range alerts {
+			if err := addNodeAlert(ctx, rule, alert, now); err != nil {
+				log.Errorf("add node alert %s of %s: %v", alert.AlertType, alert.DeviceID, err)
+			}
+		}
+	}
+
+	return dao.SetNodeAlertSnapshots(ctx, snapshots)
+}
+
+// addNodeAlert 保存告警并加入发送队列, 去重时间内已有同类告警时忽略
+func addNodeAlert(ctx context.Context, rule *model.NodeAlertRule, alert *model.NodeAlert, now time.Time) error {
+	if rule.DedupMinutes > 0 {
+		exists, err := dao.NodeAlertExists(ctx, alert.DeviceID, alert.AlertType, now.Add(-time.Duration(rule.DedupMinutes)*time.Minute))
+		if err != nil {
+			return err
+		}
+		if exists {
+			return nil
+		}
+	}
+
+	alert.UserID = rule.UserID
+	alert.State = dao.NodeAlertStatePending
+	alert.NotifyAt = quietUntil(rule, now)
+	alert.CreatedAt, alert.UpdatedAt = now, now
+
+	if err := dao.AddNodeAlert(ctx, alert); err != nil {
+		return err
+	}
+
+	return opasynq.DefaultCli.EnqueueNodeAlert(ctx, opasynq.NodeAlertPayload{ID: alert.ID}, alert.NotifyAt)
+}
+
+// evalNodeAlert 根据规则计算节点的状态变化, 返回本次的状态和需要发送的告警; 首次记录的状态只作为基线, 不产生告警
+func evalNodeAlert(rule *model.NodeAlertRule, prev *dao.NodeAlertSnapshot, node *model.DeviceInfo, now time.Time) (*dao.NodeAlertSnapshot, []*model.NodeAlert) {
+	offline := node.DeviceStatus == DeviceStatusOffline
+	next := &dao.NodeAlertSnapshot{Status: node.DeviceStatus, NATType: node.NATType, UpdatedAt: now}
+
+	// NAT 检测中或离线时类型未知, 保留上一次的类型用于比较
+	if _, ok := natRanks[node.NATType]; !ok && prev != nil {
+		next.NATType = prev.NATType
+	}
+
+	if prev == nil {
+		if offline {
+			next.OfflineSince, next.OfflineAlerted = offlineSince(node, now), true
+		}
+		next.DiskAlerted = rule.DiskThreshold > 0 && node.DiskUsage >= rule.DiskThreshold
+		return next, nil
+	}
+
+	name := node.DeviceName
+	if name == "" {
+		name = node.DeviceID
+	}
+
+	var alerts []*model.NodeAlert
+	if offline {
+		if prev.Status == DeviceStatusOffline {
+			next.OfflineSince, next.OfflineAlerted = prev.OfflineSince, prev.OfflineAlerted
+		} else {
+			next.OfflineSince = offlineSince(node, now)
+			alerts = append(alerts, newNodeAlert(node, dao.NodeAlertTypeOffline,
+				fmt.Sprintf("Node %s went offline at %s", name, next.OfflineSince.In(ruleLocation(rule)).Format(time.DateTime))))
+		}
+
+		window := time.Duration(rule.OfflineMinutes) * time.Minute
+		if rule.OfflineMinutes > 0 && !next.OfflineAlerted && now.Sub(next.OfflineSince) >= window {
+			next.OfflineAlerted = true
+			alerts = append(alerts, newNodeAlert(node, dao.NodeAlertTypeOfflineLong,
+				fmt.Sprintf("Node %s has been offline for more than %d minutes", name, rule.OfflineMinutes)))
+		}
+
+		// 离线时的磁盘数据不是最新的, 不参与判断
+		next.DiskAlerted = prev.DiskAlerted
+		return next, alerts
+	}
+
+	if rule.NATDegrade {
+		prevRank, ok1 := natRanks[prev.NATType]
+		curRank, ok2 := natRanks[node.NATType]
+		if ok1 && ok2 && curRank < prevRank {
+			alerts = append(alerts, newNodeAlert(node, dao.NodeAlertTypeNATDegraded,
+				fmt.Sprintf("NAT type of node %s degraded from %s to %s", name, prev.NATType, node.NATType)))
+		}
+	}
+
+	if rule.DiskThreshold > 0 && node.DiskUsage >= rule.DiskThreshold {
+		next.DiskAlerted = true
+		if !prev.DiskAlerted {
+			alerts = append(alerts, newNodeAlert(node, dao.NodeAlertTypeDiskUsage,
+				fmt.Sprintf("Disk usage of node %s reached %.2f%%, above the threshold %.2f%%", name, node.DiskUsage, rule.DiskThreshold)))
+		}
+	}
+
+	return next, alerts
+}
+
+func newNodeAlert(node *model.DeviceInfo, alertType, message string) *model.NodeAlert {
+	return &model.NodeAlert{
+		DeviceID:  node.DeviceID,
+		AlertType: alertType,
+		Message:   message,
+	}
+}
+
+// offlineSince 节点最后在线的时间作为离线开始时间
+func offlineSince(node *model.DeviceInfo, now time.Time) time.Time {
+	if !node.LastSeen.IsZero() && node.LastSeen.Before(now) {
+		return node.LastSeen
+	}
+	return now
+}
+
+func ruleLocation(rule *model.NodeAlertRule) *time.Location {
+	if rule.Timezone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(rule.Timezone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// quietUntil 返回告警的发送时间, 处于免打扰时段时延后到时段结束, 支持跨零点的时段
+func quietUntil(rule *model.NodeAlertRule, now time.Time) time.Time {
+	start, err := time.Parse("15:04", rule.QuietStart)
+	if err != nil {
+		return now
+	}
+	end, err := time.Parse("15:04", rule.QuietEnd)
+	if err != nil || start.Equal(end) {
+		return now
+	}
+
+	local := now.In(ruleLocation(rule))
+	y, m, d := local.Date()
+	startAt := time.Date(y, m, d, start.Hour(), start.Minute(), 0, 0, local.Location())
+	endAt := time.Date(y, m, d, end.Hour(), end.Minute(), 0, 0, local.Location())
+
+	if startAt.Before(endAt) {
+		if !local.Before(startAt) && local.Before(endAt) {
+			return endAt
+		}
+		return now
+	}
+
+	if local.Before(endAt) {
+		return endAt
+	}
+	if !local.Before(startAt) {
+		return time.Date(y, m, d+1, end.Hour(), end.Minute(), 0, 0, local.Location())
+	}
+	return now
+}
@@ -0,0 +1,79 @@
+package statistics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+)
+
+func TestEvalNodeAlert(t *testing.T) {
+	rule := &model.NodeAlertRule{OfflineMinutes: 30, NATDegrade: true, DiskThreshold: 90}
+	now := time.Date(2025, 4, 14, 12, 0, 0, 0, time.UTC)
+
+	online := &model.DeviceInfo{DeviceID: "e_1", DeviceStatus: DeviceStatusOnline, NATType: "FullConeNAT", DiskUsage: 50}
+	prev, alerts := evalNodeAlert(rule, nil, online, now)
+	if len(alerts) != 0 {
+		t.Fatalf("baseline should not alert, got %d", len(alerts))
+	}
+
+	offline := &model.DeviceInfo{DeviceID: "e_1", DeviceStatus: DeviceStatusOffline, LastSeen: now.Add(-5 * time.Minute)}
+	prev, alerts = evalNodeAlert(rule, prev, offline, now)
+	if len(alerts) != 1 || alerts[0].AlertType != dao.NodeAlertTypeOffline {
+		t.Fatalf("expect offline alert, got %+v", alerts)
+	}
+	if !prev.OfflineSince.Equal(offline.LastSeen) || prev.NATType != "FullConeNAT" {
+		t.Fatalf("unexpected snapshot %+v", prev)
+	}
+
+	prev, alerts = evalNodeAlert(rule, prev, offline, now.Add(10*time.Minute))
+	if len(alerts) != 0 {
+		t.Fatalf("expect no alert within offline window, got %+v", alerts)
+	}
+
+	prev, alerts = evalNodeAlert(rule, prev, offline, now.Add(30*time.Minute))
+	if len(alerts) != 1 || alerts[0].AlertType != dao.NodeAlertTypeOfflineLong {
+		t.Fatalf("expect offline_long alert, got %+v", alerts)
+	}
+
+	prev, alerts = evalNodeAlert(rule, prev, offline, now.Add(60*time.Minute))
+	if len(alerts) != 0 {
+		t.Fatalf("offline_long should alert once, got %+v", alerts)
+	}
+
+	degraded := &model.DeviceInfo{DeviceID: "e_1", DeviceStatus: DeviceStatusOnline, NATType: "SymmetricNAT", DiskUsage: 95}
+	prev, alerts = evalNodeAlert(rule, prev, degraded, now.Add(65*time.Minute))
+	if len(alerts) != 2 || alerts[0].AlertType != dao.NodeAlertTypeNATDegraded || alerts[1].AlertType != dao.NodeAlertTypeDiskUsage {
+		t.Fatalf("expect nat and disk alerts, got %+v", alerts)
+	}
+
+	_, alerts = evalNodeAlert(rule, prev, degraded, now.Add(70*time.Minute))
+	if len(alerts) != 0 {
+		t.Fatalf("disk alert should not repeat while above threshold, got %+v", alerts)
+	}
+}
+
+func TestQuietUntil(t *testing.T) {
+	rule := &model.NodeAlertRule{QuietStart: "22:00", QuietEnd: "07:00", Timezone: "UTC"}
+
+	cases := []struct {
+		now  time.Time
+		want time.Time
+	}{
+		{time.Date(2025, 4, 14, 12, 0, 0, 0, time.UTC), time.Date(2025, 4, 14, 12, 0, 0, 0, time.UTC)},
+		{time.Date(2025, 4, 14, 23, 0, 0, 0, time.UTC), time.Date(2025, 4, 15, 7, 0, 0, 0, time.UTC)},
+		{time.Date(2025, 4, 14, 3, 0, 0, 0, time.UTC), time.Date(2025, 4, 14, 7, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		if got := quietUntil(rule, c.now); !got.Equal(c.want) {
+			t.Errorf("quietUntil(%v) = %v, want %v", c.now, got, c.want)
+		}
+	}
+
+	rule = &model.NodeAlertRule{QuietStart: "12:00", QuietEnd: "14:00", Timezone: "UTC"}
+	now := time.Date(2025, 4, 14, 13, 0, 0, 0, time.UTC)
+	if got := quietUntil(rule, now); !got.Equal(time.Date(2025, 4, 14, 14, 0, 0, 0, time.UTC)) {
+		t.Errorf("quietUntil(%v) = %v", now, got)
+	}
+}
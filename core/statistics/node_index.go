@@ -0,0 +1,264 @@
+package statistics
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/pkg/formatter"
+)
+
+// nodeIndexTTL 超过该时间没有从调度器拉取到的节点会被移除
+const nodeIndexTTL = 30 * time.Minute
+
+// Nodes 最近一次拉取到的所有节点, 由 NodeFetcher 更新
+var Nodes = NewNodeIndex()
+
+type indexedNode struct {
+	node   model.DeviceInfo
+	seenAt time.Time
+}
+
+// NodeIndex 节点的内存索引, 可以并发使用; 按区域, 用户, IP 和状态建立二级索引.
+// 写入和读取的都是节点数据的副本, 调用方修改返回的数据不会影响索引.
+type NodeIndex struct {
+	mu       sync.RWMutex
+	seenAt   time.Time
+	nodes    map[string]*indexedNode
+	byArea   map[string]map[string]struct{}
+	byUser   map[string]map[string]struct{}
+	byIP     map[string]map[string]struct{}
+	byStatus map[string]map[string]struct{}
+}
+
+// NewNodeIndex 新建一个空的节点索引
+func NewNodeIndex() *NodeIndex {
+	return &NodeIndex{
+		nodes:    make(map[string]*indexedNode),
+		byArea:   make(map[string]map[string]struct{}),
+		byUser:   make(map[string]map[string]struct{}),
+		byIP:     make(map[string]map[string]struct{}),
+		byStatus: make(map[string]map[string]struct{}),
+	}
+}
+
+// Put 写入或更新节点, seenAt 为拉取的时间; 离线节点没有所属用户的信息, 沿用之前记录的用户
+func (idx *NodeIndex) Put(nodes []*model.DeviceInfo, seenAt time.Time) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if seenAt.After(idx.seenAt) {
+		idx.seenAt = seenAt
+	}
+	for _, node := range nodes {
+		if node.DeviceID == "" {
+			continue
+		}
+
+		entry := &indexedNode{node: *node, seenAt: seenAt}
+		if old, ok := idx.nodes[node.DeviceID]; ok {
+			if entry.node.UserID == "" {
+				entry.node.UserID = old.node.UserID
+			}
+			idx.unlink(&old.node)
+		}
+
+		idx.nodes[node.DeviceID] = entry
+		idx.link(&entry.node)
+	}
+}
+
+// Evict 移除 before 之前拉取到的节点, 返回移除的数量
+func (idx *NodeIndex) Evict(before time.Time) int {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	var count int
+	for id, entry := range idx.nodes {
+		if entry.seenAt.Before(before) {
+			idx.unlink(&entry.node)
+			delete(idx.nodes, id)
+			count++
+		}
+	}
+	return count
+}
+
+// Len 返回索引中的节点数量
+func (idx *NodeIndex) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return len(idx.nodes)
+}
+
+// Fresh 索引在 nodeIndexTTL 内是否更新过; 只有拉取节点的实例会更新索引, 其他实例的索引为空或已过期, 需要查询数据库
+func (idx *NodeIndex) Fresh() bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return len(idx.nodes) > 0 && time.Since(idx.seenAt) < nodeIndexTTL
+}
+
+// Get 获取节点
+func (idx *NodeIndex) Get(deviceID string) (*model.DeviceInfo, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	entry, ok := idx.nodes[deviceID]
+	if !ok {
+		return nil, false
+	}
+	node := entry.node
+	return &node, true
+}
+
+// Filter 返回满足条件的节点, fn 为空时返回所有节点
+func (idx *NodeIndex) Filter(fn func(node *model.DeviceInfo) bool) []*model.DeviceInfo {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var out []*model.DeviceInfo
+	for _, entry := range idx.nodes {
+		if fn != nil && !fn(&entry.node) {
+			continue
+		}
+		node := entry.node
+		out = append(out, &node)
+	}
+	return out
+}
+
+// NodesByArea 获取区域下的节点
+func (idx *NodeIndex) NodesByArea(areaID string) []*model.DeviceInfo {
+	return idx.lookup(idx.byArea, areaID)
+}
+
+// NodesByUser 获取用户的节点
+func (idx *NodeIndex) NodesByUser(userID string) []*model.DeviceInfo {
+	return idx.lookup(idx.byUser, userID)
+}
+
+// NodesByIP 获取公网 IP 下的节点
+func (idx *NodeIndex) NodesByIP(ip string) []*model.DeviceInfo {
+	return idx.lookup(idx.byIP, ip)
+}
+
+// NodesByStatus 获取指定状态的节点, 如 online, offline
+func (idx *NodeIndex) NodesByStatus(status string) []*model.DeviceInfo {
+	return idx.lookup(idx.byStatus, status)
+}
+
+// OnlineCountByArea 统计每个区域在线的节点数量
+func (idx *NodeIndex) OnlineCountByArea() map[string]int64 {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	out := make(map[string]int64)
+	for id := range idx.byStatus[DeviceStatusOnline] {
+		out[idx.nodes[id].node.AreaID]++
+	}
+	return out
+}
+
+// NodesInfoByUser 按用户统计已激活节点的数量, 存储空间和上行带宽; orderField 支持 node_count, disk_space, bandwidth_up,
+// order 为 asc 时从小到大, 其他值从大到小, 不支持的字段按节点数量从多到少排序
+func (idx *NodeIndex) NodesInfoByUser(orderField, order string) []model.NodesInfo {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	out := make([]model.NodesInfo, 0, len(idx.byUser))
+	for userID, ids := range idx.byUser {
+		info := model.NodesInfo{UserId: userID}
+		for id := range ids {
+			node := &idx.nodes[id].node
+			if node.ActiveStatus != 1 {
+				continue
+			}
+			info.NodeCount++
+			info.NodeType = strconv.FormatInt(node.NodeType, 10)
+			info.DiskSpace += node.DiskSpace
+			info.BandwidthUp += node.BandwidthUp
+		}
+		if info.NodeCount == 0 {
+			continue
+		}
+		info.DiskSpace = formatter.ToFixed(info.DiskSpace, 2)
+		info.BandwidthUp = formatter.ToFixed(info.BandwidthUp, 2)
+		out = append(out, info)
+	}
+
+	value := func(info *model.NodesInfo) float64 {
+		switch orderField {
+		case "disk_space":
+			return info.DiskSpace
+		case "bandwidth_up":
+			return info.BandwidthUp
+		default:
+			return float64(info.NodeCount)
+		}
+	}
+	asc := strings.EqualFold(order, "asc")
+	sort.Slice(out, func(i, j int) bool {
+		if vi, vj := value(&out[i]), value(&out[j]); vi != vj {
+			return vi > vj != asc
+		}
+		return out[i].UserId < out[j].UserId
+	})
+	return out
+}
+
+func (idx *NodeIndex) lookup(index map[string]map[string]struct{}, key string) []*model.DeviceInfo {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	out := make([]*model.DeviceInfo, 0, len(index[key]))
+	for id := range index[key] {
+		node := idx.nodes[id].node
+		out = append(out, &node)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].DeviceID < out[j].DeviceID
+	})
+	return out
+}
+
+func (idx *NodeIndex) link(node *model.DeviceInfo) {
+	addToIndex(idx.byArea, node.AreaID, node.DeviceID)
+	// 没有所属用户的节点不参与按用户的统计
+	if node.UserID != "" {
+		addToIndex(idx.byUser, node.UserID, node.DeviceID)
+	}
+	addToIndex(idx.byIP, node.ExternalIp, node.DeviceID)
+	addToIndex(idx.byStatus, node.DeviceStatus, node.DeviceID)
+}
+
+func (idx *NodeIndex) unlink(node *model.DeviceInfo) {
+	removeFromIndex(idx.byArea, node.AreaID, node.DeviceID)
+	removeFromIndex(idx.byUser, node.UserID, node.DeviceID)
+	removeFromIndex(idx.byIP, node.ExternalIp, node.DeviceID)
+	removeFromIndex(idx.byStatus, node.DeviceStatus, node.DeviceID)
+}
+
+func addToIndex(index map[string]map[string]struct{}, key, id string) {
+	ids, ok := index[key]
+	if !ok {
+		ids = make(map[string]struct{})
+		index[key] = ids
+	}
+	ids[id] = struct{}{}
+}
+
+func removeFromIndex(index map[string]map[string]struct{}, key, id string) {
+	ids, ok := index[key]
+	if !ok {
+		return
+	}
+	delete(ids, id)
+	if len(ids) == 0 {
+		delete(index, key)
+	}
+}
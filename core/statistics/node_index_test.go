@@ -0,0 +1,74 @@
+package statistics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+)
+
+func TestNodeIndex(t *testing.T) {
+	idx := NewNodeIndex()
+	now := time.Now()
+
+	idx.Put([]*model.DeviceInfo{
+		{DeviceID: "c_1", AreaID: "Asia-China", UserID: "u1", ExternalIp: "1.1.1.1", DeviceStatus: DeviceStatusOnline, DiskSpace: 10, ActiveStatus: 1},
+		{DeviceID: "e_1", AreaID: "Asia-China", UserID: "u1", ExternalIp: "1.1.1.1", DeviceStatus: DeviceStatusOnline, DiskSpace: 20, ActiveStatus: 1},
+		{DeviceID: "e_2", AreaID: "Europe-UK", UserID: "u2", ExternalIp: "2.2.2.2", DeviceStatus: DeviceStatusOnline, ActiveStatus: 1},
+		{DeviceID: "e_3", AreaID: "Europe-UK", UserID: "u3", ExternalIp: "4.4.4.4", DeviceStatus: DeviceStatusOnline, DiskSpace: 50},
+		{DeviceID: "e_4", AreaID: "Europe-UK", ExternalIp: "5.5.5.5", DeviceStatus: DeviceStatusOnline, ActiveStatus: 1},
+	}, now.Add(-time.Hour))
+
+	// 超过 nodeIndexTTL 没有更新的索引需要回退到数据库
+	if idx.Fresh() {
+		t.Fatalf("expect a stale index")
+	}
+
+	if got := idx.OnlineCountByArea(); got["Asia-China"] != 2 || got["Europe-UK"] != 3 {
+		t.Fatalf("unexpected online count %v", got)
+	}
+	if got := idx.NodesByIP("1.1.1.1"); len(got) != 2 || got[0].DeviceID != "c_1" {
+		t.Fatalf("unexpected nodes by ip %v", got)
+	}
+
+	// 离线的节点沿用之前的用户, 状态和 IP 的索引随之更新
+	idx.Put([]*model.DeviceInfo{
+		{DeviceID: "e_1", AreaID: "Asia-China", ExternalIp: "3.3.3.3", DeviceStatus: DeviceStatusOffline, DiskSpace: 20, ActiveStatus: 1},
+	}, now)
+
+	if !idx.Fresh() {
+		t.Fatalf("expect a fresh index")
+	}
+	if got := idx.OnlineCountByArea(); got["Asia-China"] != 1 {
+		t.Fatalf("unexpected online count %v", got)
+	}
+	if got := idx.NodesByIP("1.1.1.1"); len(got) != 1 {
+		t.Fatalf("unexpected nodes by ip %v", got)
+	}
+	if got := idx.NodesByUser("u1"); len(got) != 2 {
+		t.Fatalf("unexpected nodes by user %v", got)
+	}
+
+	// 未激活和没有所属用户的节点不参与统计
+	info := idx.NodesInfoByUser("", "")
+	if len(info) != 2 || info[0].UserId != "u1" || info[0].NodeCount != 2 || info[0].DiskSpace != 30 {
+		t.Fatalf("unexpected nodes info %+v", info)
+	}
+	if info = idx.NodesInfoByUser("disk_space", "asc"); len(info) != 2 || info[0].UserId != "u2" {
+		t.Fatalf("unexpected nodes info ordered by disk space %+v", info)
+	}
+
+	// 返回的是副本
+	node, _ := idx.Get("e_2")
+	node.AreaID = "changed"
+	if node, _ = idx.Get("e_2"); node.AreaID != "Europe-UK" {
+		t.Fatalf("index modified through returned node")
+	}
+
+	if count := idx.Evict(now.Add(-time.Minute)); count != 4 {
+		t.Fatalf("expect 4 evicted, got %d", count)
+	}
+	if idx.Len() != 1 || len(idx.NodesByArea("Europe-UK")) != 0 || len(idx.NodesByStatus(DeviceStatusOnline)) != 0 {
+		t.Fatalf("stale nodes are not evicted")
+	}
+}
@@ -0,0 +1,231 @@
+package statistics
+
+import (
+	"context"
+	"time"
+
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	errs "github.com/pkg/errors"
+)
+
+const (
+	// uptimeSampleMinGap 与上一条间隔小于该时间的数据忽略, 如整点时额外写入的冗余数据
+	uptimeSampleMinGap = 2 * time.Minute
+	// uptimeSampleMaxGap 相邻两条数据间隔超过该时间时, 这段时间没有拉取数据, 不计入可用性统计
+	uptimeSampleMaxGap = 20 * time.Minute
+	// uptimeOnlineRatio 相邻两条数据之间在线时长的增量低于间隔的该比例时, 这段时间视为离线
+	uptimeOnlineRatio = 0.5
+	// uptimeSettleDelay 最近一段时间的数据可能还在写入, 延后统计
+	uptimeSettleDelay = 10 * time.Minute
+	// uptimeInitialLookback 首次统计时的起点, device_info_hour 默认保留两天
+	uptimeInitialLookback = 46 * time.Hour
+	// uptimeMaxLookback 统计落后时最多补统计这么久之前的数据, 需要小于 cleanup 最多保留的时间
+	uptimeMaxLookback = 6 * 24 * time.Hour
+	// uptimeMaxWindow 每次最多统计的时长, 落后较多时分多次补上
+	uptimeMaxWindow = 6 * time.Hour
+	uptimeBatchSize = 500
+)
+
+type uptimeSegment struct {
+	Start time.Time
+	End   time.Time
+	Down  bool
+}
+
+// RollupNodeUptime 从 device_info_hour 计算节点上次统计之后的在线和离线区间, 累加到 device_uptime_daily,
+// 离线区间写入 device_outage. 每个节点记录已统计到的时间, 重复执行不会重复统计.
+func RollupNodeUptime(ctx context.Context, now time.Time) error {
+	from, err := dao.GetNodeUptimeRolledTo(ctx)
+	if err != nil {
+		return errs.Wrap(err, "get node uptime rolled to")
+	}
+	if from.IsZero() {
+		from = now.Add(-uptimeInitialLookback)
+	}
+	if earliest := now.Add(-uptimeMaxLookback); from.Before(earliest) {
+		log.Warnf("node uptime between %v and %v is lost", from, earliest)
+		from = earliest
+	}
+
+	to := now.Add(-uptimeSettleDelay)
+	if to.Sub(from) > uptimeMaxWindow {
+		to = from.Add(uptimeMaxWindow)
+	}
+	if !from.Before(to) {
+		return nil
+	}
+
+	var cursor string
+	for {
+		owners, err := dao.ListDeviceOwners(ctx, cursor, uptimeBatchSize)
+		if err != nil {
+			return errs.Wrap(err, "list device owners")
+		}
+		if len(owners) == 0 {
+			break
+		}
+		cursor = owners[len(owners)-1].DeviceID
+
+		if err := rollupNodeUptimeBatch(ctx, owners, from, to, now); err != nil {
+			return errs.Wrapf(err, "rollup node uptime after %s", owners[0].DeviceID)
+		}
+
+		if len(owners) < uptimeBatchSize {
+			break
+		}
+	}
+
+	// 节点没有新的数据时离线区间无法延长, 之后的数据与区间不再相邻, 直接结束
+	closed, err := dao.CloseStaleDeviceOutages(ctx, to.Add(-uptimeSampleMaxGap), now)
+	if err != nil {
+		return errs.Wrap(err, "close stale device outages")
+	}
+
+	log.Infof("rollup node uptime from %v to %v, close %d stale outages", from, to, closed)
+
+	return dao.SetNodeUptimeRolledTo(ctx, to)
+}
+
+func rollupNodeUptimeBatch(ctx context.Context, owners []*model.DeviceInfo, from, to, now time.Time) error {
+	ids := make([]string, 0, len(owners))
+	for _, owner := range owners {
+		ids = append(ids, owner.DeviceID)
+	}
+
+	samples, err := dao.GetUptimeSamples(ctx, ids, from.Add(-uptimeSampleMaxGap), to)
+	if err != nil {
+		return err
+	}
+	rolledTo, err := dao.GetDeviceUptimeRolledTo(ctx, ids, from.Add(-uptimeMaxLookback))
+	if err != nil {
+		return err
+	}
+	ongoing, err := dao.GetOngoingDeviceOutages(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	var (
+		daily   []*model.DeviceUptimeDaily
+		outages []*model.DeviceOutage
+	)
+	for _, owner := range owners {
+		start := from
+		if t, ok := rolledTo[owner.DeviceID]; ok {
+			start = t
+		}
+
+		segs := uptimeSegments(samples[owner.DeviceID], start)
+		if len(segs) == 0 {
+			continue
+		}
+
+		daily = append(daily, dailyUptime(owner, segs, now)...)
+		outages = append(outages, deviceOutages(owner, segs, ongoing[owner.DeviceID], now)...)
+	}
+
+	return dao.SaveDeviceUptime(ctx, daily, outages)
+}
+
+// uptimeSegments 把相邻两条数据之间的时间作为一个区间, 根据在线时长的增量判断是否离线;
+// 只返回起点不早于 start 的区间, 回补的数据和间隔过长的区间不参与统计
+func uptimeSegments(samples []*dao.UptimeSample, start time.Time) []uptimeSegment {
+	var (
+		out  []uptimeSegment
+		prev *dao.UptimeSample
+	)
+	for _, s := range samples {
+		// 回补的数据复制的是之前的数据, 不代表节点当时的状态
+		if s.CreatedAt.Sub(s.Time) > uptimeSampleMaxGap {
+			continue
+		}
+		if prev != nil && s.Time.Sub(prev.Time) < uptimeSampleMinGap {
+			continue
+		}
+
+		if prev != nil && !prev.Time.Before(start) {
+			elapsed := s.Time.Sub(prev.Time)
+			if elapsed <= uptimeSampleMaxGap {
+				// 在线时长变小说明节点的数据被重置, 按在线处理
+				delta := s.OnlineTime - prev.OnlineTime
+				down := delta >= 0 && delta < elapsed.Minutes()*uptimeOnlineRatio
+				out = append(out, uptimeSegment{Start: prev.Time, End: s.Time, Down: down})
+			}
+		}
+		prev = s
+	}
+	return out
+}
+
+// dailyUptime 按天累加区间内的统计时长和离线时长, 跨天的区间拆分到两天
+func dailyUptime(owner *model.DeviceInfo, segs []uptimeSegment, now time.Time) []*model.DeviceUptimeDaily {
+	var out []*model.DeviceUptimeDaily
+	days := make(map[time.Time]*model.DeviceUptimeDaily)
+
+	for _, seg := range segs {
+		for t := seg.Start; t.Before(seg.End); {
+			y, m, d := t.Date()
+			day := time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+			end := day.AddDate(0, 0, 1)
+			if seg.End.Before(end) {
+				end = seg.End
+			}
+
+			row, ok := days[day]
+			if !ok {
+				row = &model.DeviceUptimeDaily{DeviceID: owner.DeviceID, UserID: owner.UserID, Date: day, UpdatedAt: now}
+				days[day] = row
+				out = append(out, row)
+			}
+
+			seconds := int64(end.Sub(t) / time.Second)
+			row.ObservedSeconds += seconds
+			if seg.Down {
+				row.DownSeconds += seconds
+			}
+			if end.After(row.RolledTo) {
+				row.RolledTo = end
+			}
+			t = end
+		}
+	}
+	return out
+}
+
+// deviceOutages 合并连续的离线区间; open 为上次统计时未结束的离线区间, 本次第一个区间紧接着离线时继续延长, 否则结束
+func deviceOutages(owner *model.DeviceInfo, segs []uptimeSegment, open *model.DeviceOutage, now time.Time) []*model.DeviceOutage {
+	var (
+		out []*model.DeviceOutage
+		cur *model.DeviceOutage
+	)
+
+	if open != nil {
+		if segs[0].Down && segs[0].Start.Equal(open.EndTime) {
+			cur = open
+		} else {
+			open.Ongoing, open.UpdatedAt = false, now
+		}
+		out = append(out, open)
+	}
+
+	for i, seg := range segs {
+		if cur != nil && (!seg.Down || (i > 0 && !seg.Start.Equal(segs[i-1].End))) {
+			cur.Ongoing = false
+			cur = nil
+		}
+		if !seg.Down {
+			continue
+		}
+
+		if cur == nil {
+			cur = &model.DeviceOutage{DeviceID: owner.DeviceID, UserID: owner.UserID, StartTime: seg.Start, CreatedAt: now}
+			out = append(out, cur)
+		}
+		cur.EndTime = seg.End
+		cur.Duration = int64(cur.EndTime.Sub(cur.StartTime) / time.Second)
+		cur.Ongoing = true
+		cur.UpdatedAt = now
+	}
+	return out
+}
@@ -0,0 +1,76 @@
+package statistics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+)
+
+func TestNodeUptime(t *testing.T) {
+	base := time.Date(2025, 4, 1, 23, 40, 0, 0, time.Local)
+	sample := func(minute int, online float64) *dao.UptimeSample {
+		ts := base.Add(time.Duration(minute) * time.Minute)
+		return &dao.UptimeSample{DeviceID: "e_1", Time: ts, OnlineTime: online, CreatedAt: ts}
+	}
+
+	samples := []*dao.UptimeSample{
+		sample(0, 100),
+		sample(5, 105),
+		sample(10, 106), // 离线
+		sample(15, 106), // 离线
+		sample(19, 111), // 整点的冗余数据
+		sample(20, 111),
+		sample(25, 116),
+		sample(60, 151), // 间隔过长, 不统计
+		sample(65, 151), // 离线
+	}
+	// 回补的数据
+	backfilled := sample(62, 151)
+	backfilled.CreatedAt = backfilled.Time.Add(time.Hour)
+	samples = append(samples[:8], append([]*dao.UptimeSample{backfilled}, samples[8:]...)...)
+
+	segs := uptimeSegments(samples, base)
+	if len(segs) != 6 {
+		t.Fatalf("expect 6 segments, got %+v", segs)
+	}
+	if segs[1].Down != true || segs[2].Down != true || segs[3].Down || segs[5].Down != true {
+		t.Fatalf("unexpected segments %+v", segs)
+	}
+	if got := uptimeSegments(samples, base.Add(19*time.Minute)); len(got) != 2 {
+		t.Fatalf("expect 2 segments after start, got %+v", got)
+	}
+
+	owner := &model.DeviceInfo{DeviceID: "e_1", UserID: "u1"}
+	now := base.Add(2 * time.Hour)
+
+	daily := dailyUptime(owner, segs, now)
+	if len(daily) != 2 {
+		t.Fatalf("expect 2 days, got %d", len(daily))
+	}
+	if daily[0].ObservedSeconds != 20*60 || daily[0].DownSeconds != 10*60 || !daily[0].RolledTo.Equal(base.Add(20*time.Minute)) {
+		t.Fatalf("unexpected first day %+v", daily[0])
+	}
+	if daily[1].ObservedSeconds != 10*60 || daily[1].DownSeconds != 5*60 || !daily[1].RolledTo.Equal(base.Add(65*time.Minute)) {
+		t.Fatalf("unexpected second day %+v", daily[1])
+	}
+
+	outages := deviceOutages(owner, segs, nil, now)
+	if len(outages) != 2 || outages[0].Duration != 10*60 || outages[0].Ongoing || !outages[1].Ongoing {
+		t.Fatalf("unexpected outages %+v", outages)
+	}
+
+	// 上次未结束的离线区间紧接着本次的离线区间时延长
+	open := &model.DeviceOutage{ID: 1, DeviceID: "e_1", StartTime: base.Add(-time.Hour), EndTime: base.Add(5 * time.Minute), Ongoing: true}
+	outages = deviceOutages(owner, segs[1:], open, now)
+	if len(outages) != 2 || outages[0] != open || open.Duration != 75*60 || open.Ongoing {
+		t.Fatalf("unexpected outages %+v", outages)
+	}
+
+	open = &model.DeviceOutage{ID: 1, DeviceID: "e_1", StartTime: base.Add(-time.Hour), EndTime: base, Ongoing: true}
+	outages = deviceOutages(owner, segs[1:], open, now)
+	if len(outages) != 3 || open.Ongoing || !open.EndTime.Equal(base) {
+		t.Fatalf("unexpected outages %+v", outages)
+	}
+}
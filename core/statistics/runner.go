@@ -0,0 +1,263 @@
+package statistics
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	FetcherStateIdle     = "idle"
+	FetcherStateFetching = "fetching"
+	FetcherStateWriting  = "writing"
+	FetcherStateFinished = "finished"
+)
+
+var (
+	ErrFetcherRunning        = errors.New("fetcher is running")
+	ErrFetcherNotFound       = errors.New("fetcher not found")
+	ErrFetcherNotBackfilling = errors.New("fetcher does not support backfill")
+	ErrStatisticDisabled     = errors.New("statistics is disabled")
+
+	// errRunFinished 结束信号任务的返回值, 不计入任务数
+	errRunFinished = errors.New("run finished")
+)
+
+// FetcherProgress 拉取任务最近一次运行的进度
+type FetcherProgress struct {
+	Name             string    `json:"name"`
+	Crontab          string    `json:"crontab"`
+	Disable          bool      `json:"disable"`
+	State            string    `json:"state"`
+	Backfill         bool      `json:"backfill"`
+	AreaID           string    `json:"area_id,omitempty"`
+	WindowStart      time.Time `json:"window_start,omitempty"`
+	WindowEnd        time.Time `json:"window_end,omitempty"`
+	SchedulersTotal  int       `json:"schedulers_total"`
+	SchedulersDone   int       `json:"schedulers_done"`
+	SchedulersFailed int       `json:"schedulers_failed"`
+	JobsDone         int64     `json:"jobs_done"`
+	JobsFailed       int64     `json:"jobs_failed"`
+	JobsPending      int       `json:"jobs_pending"`
+	StartedAt        time.Time `json:"started_at"`
+	FinishedAt       time.Time `json:"finished_at"`
+	LastError        string    `json:"last_error"`
+}
+
+// backfillWindow 回补数据的时间段
+type backfillWindow struct {
+	AreaID string
+	Start  time.Time
+	End    time.Time
+}
+
+// fetcherRunner 按拉取任务自己的参数运行, 同一时间只会有一次运行
+type fetcherRunner struct {
+	fetcher Fetcher
+	opts    FetcherOptions
+
+	mu       sync.Mutex
+	running  bool
+	cancel   context.CancelFunc
+	progress FetcherProgress
+}
+
+func newFetcherRunner(fetcher Fetcher, opts FetcherOptions) *fetcherRunner {
+	return &fetcherRunner{
+		fetcher: fetcher,
+		opts:    opts,
+		progress: FetcherProgress{
+			Name:    fetcher.Name(),
+			Crontab: opts.Crontab,
+			Disable: opts.Disable,
+			State:   FetcherStateIdle,
+		},
+	}
+}
+
+// run 并发拉取所有调度器的数据, 拉取完成后往队列塞入结束信号, 结束信号被执行时说明之前的写库任务都已完成, 随后执行 Finalize
+func (r *fetcherRunner) run(parent context.Context, schedulers []*Scheduler, window *backfillWindow) error {
+	if window != nil {
+		if _, ok := r.fetcher.(Backfiller); !ok {
+			return ErrFetcherNotBackfilling
+		}
+	}
+
+	ctx, err := r.begin(parent, len(schedulers), window)
+	if err != nil {
+		return err
+	}
+
+	r.execute(ctx, schedulers, window)
+	return nil
+}
+
+// execute 执行已经 begin 的一次运行
+func (r *fetcherRunner) execute(ctx context.Context, schedulers []*Scheduler, window *backfillWindow) {
+	var backfiller Backfiller
+	if window != nil {
+		backfiller, _ = r.fetcher.(Backfiller)
+	}
+
+	concurrency := r.opts.Concurrency
+	if concurrency <= 0 || concurrency > len(schedulers) {
+		concurrency = len(schedulers)
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for _, scheduler := range schedulers {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(scheduler *Scheduler) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			var err error
+			if backfiller != nil {
+				err = backfiller.Backfill(ctx, scheduler, window.Start, window.End)
+			} else {
+				err = r.fetcher.Fetch(ctx, scheduler)
+			}
+			if err != nil {
+				log.Errorf("run fetcher %s on %s: %v", r.fetcher.Name(), scheduler.AreaId, err)
+			}
+			r.schedulerDone(err)
+		}(scheduler)
+	}
+	wg.Wait()
+
+	r.setState(FetcherStateWriting)
+
+	// 使用 Background, 超时后也要塞入结束信号, 否则任务会一直处于运行状态
+	r.fetcher.Push(context.Background(), r.finish)
+}
+
+func (r *fetcherRunner) begin(parent context.Context, total int, window *backfillWindow) (context.Context, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.running {
+		return nil, ErrFetcherRunning
+	}
+
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if r.opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, r.opts.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(parent)
+	}
+
+	r.running = true
+	r.cancel = cancel
+	r.progress = FetcherProgress{
+		Name:            r.fetcher.Name(),
+		Crontab:         r.opts.Crontab,
+		Disable:         r.opts.Disable,
+		State:           FetcherStateFetching,
+		SchedulersTotal: total,
+		StartedAt:       time.Now(),
+	}
+	if window != nil {
+		r.progress.Backfill = true
+		r.progress.AreaID = window.AreaID
+		r.progress.WindowStart = window.Start
+		r.progress.WindowEnd = window.End
+	}
+
+	return ctx, nil
+}
+
+// finish 结束信号, 在任务队列中执行
+func (r *fetcherRunner) finish() error {
+	if err := r.fetcher.Finalize(); err != nil {
+		log.Errorf("finalize fetcher %s: %v", r.fetcher.Name(), err)
+		r.setError(err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cancel != nil {
+		r.cancel()
+	}
+	r.running = false
+	r.progress.State = FetcherStateFinished
+	r.progress.FinishedAt = time.Now()
+
+	log.Infof("fetcher %s finished, cost: %v", r.fetcher.Name(), r.progress.FinishedAt.Sub(r.progress.StartedAt))
+
+	return errRunFinished
+}
+
+// handleJobs 执行拉取任务队列中的写库任务, 每个拉取任务一个协程, 避免并行写入数据库获取不到锁
+func (r *fetcherRunner) handleJobs(ctx context.Context) {
+	for {
+		select {
+		case job := <-r.fetcher.GetJobQueue():
+			r.jobDone(job())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *fetcherRunner) isRunning() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.running
+}
+
+func (r *fetcherRunner) schedulerDone(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.progress.SchedulersDone++
+	if err != nil {
+		r.progress.SchedulersFailed++
+		r.progress.LastError = err.Error()
+	}
+}
+
+func (r *fetcherRunner) jobDone(err error) {
+	if errors.Is(err, errRunFinished) {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.progress.JobsDone++
+	if err != nil {
+		log.Errorf("run job of %s: %v", r.fetcher.Name(), err)
+		r.progress.JobsFailed++
+		r.progress.LastError = err.Error()
+	}
+}
+
+func (r *fetcherRunner) setState(state string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.progress.State = state
+}
+
+func (r *fetcherRunner) setError(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.progress.LastError = err.Error()
+}
+
+func (r *fetcherRunner) getProgress() FetcherProgress {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p := r.progress
+	p.JobsPending = len(r.fetcher.GetJobQueue())
+	return p
+}
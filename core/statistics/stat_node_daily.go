@@ -118,10 +118,15 @@ func (s *Statistic) SumDeviceInfoDaily() error {
 }
 
 func (s *Statistic) calculateAndUpsertDailyInfo() error {
-	startOfTodayTime := carbon.Now().StartOfDay().String()
-	endOfTodayTime := carbon.Now().Tomorrow().StartOfDay().String()
+	return sumDeviceInfoDailyByDay(s.ctx, carbon.Now())
+}
+
+// sumDeviceInfoDailyByDay 根据 device_info_hour 重新统计某一天的 device_info_daily
+func sumDeviceInfoDailyByDay(ctx context.Context, day carbon.Carbon) error {
+	startOfTodayTime := day.StartOfDay().String()
+	endOfTodayTime := day.StartOfDay().AddDay().String()
 
-	total, err := s.countDeviceInfoHour(startOfTodayTime, endOfTodayTime)
+	total, err := countDeviceInfoHour(ctx, startOfTodayTime, endOfTodayTime)
 	if err != nil {
 		return errs.Wrap(err, "count device info hour")
 	}
@@ -143,7 +148,7 @@ func (s *Statistic) calculateAndUpsertDailyInfo() error {
 		return errs.Wrap(err, "get query data list")
 	}
 
-	dailyInfos, err := s.buildDailyInfos(dataList)
+	dailyInfos, err := buildDailyInfos(dataList)
 	if err != nil {
 		return errs.Wrap(err, "build daily infos")
 	}
@@ -156,17 +161,17 @@ func (s *Statistic) calculateAndUpsertDailyInfo() error {
 	return nil
 }
 
-func (s *Statistic) countDeviceInfoHour(start, end string) (int64, error) {
+func countDeviceInfoHour(ctx context.Context, start, end string) (int64, error) {
 	where := fmt.Sprintf("where time>='%s' and time<='%s'", start, end)
 	var total int64
-	err := dao.DB.GetContext(s.ctx, &total, fmt.Sprintf(`SELECT count(*) FROM %s %s`, "device_info_hour", where))
+	err := dao.DB.GetContext(ctx, &total, fmt.Sprintf(`SELECT count(*) FROM %s %s`, "device_info_hour", where))
 	if err != nil {
 		return 0, err
 	}
 	return total, nil
 }
 
-func (s *Statistic) buildDailyInfos(dataList []map[string]string) ([]*model.DeviceInfoDaily, error) {
+func buildDailyInfos(dataList []map[string]string) ([]*model.DeviceInfoDaily, error) {
 	var dailyInfos []*model.DeviceInfoDaily
 	for _, data := range dataList {
 		var daily model.DeviceInfoDaily
@@ -1,8 +1,9 @@
 package statistics
 
 import (
+	"errors"
 	"fmt"
-	"reflect"
+	"strings"
 	"sync"
 	"time"
 
@@ -31,16 +32,22 @@ func RegisterFetcher(fetcher func() Fetcher) {
 	FetcherRegistry = append(FetcherRegistry, fetcher)
 }
 
+// DefaultStatistic 默认的统计实例, 用于管理接口查询进度和触发回补
+var DefaultStatistic *Statistic
+
 // Statistic represents the statistics manager.
 type Statistic struct {
 	ctx        context.Context
 	cfg        config.StatisticsConfig
 	cron       *cron.Cron
 	locker     *redislock.Client
-	fetchers   []Fetcher
+	runners    []*fetcherRunner
 	slk        sync.Mutex
 	schedulers []*Scheduler
 	etcdClient *EtcdClient
+
+	// obtainLock 获取分布式锁, 返回释放锁的函数, 锁被其他服务持有时返回 redislock.ErrNotObtained
+	obtainLock func(key string) (func(), error)
 }
 
 // New creates a new Statistic instance.
@@ -62,21 +69,49 @@ func New(cfg config.StatisticsConfig, client *EtcdClient) *Statistic {
 		cfg:        cfg,
 		schedulers: schedulers,
 		locker:     redislock.New(dao.RedisCache),
-		fetchers:   make([]Fetcher, 0),
+		runners:    make([]*fetcherRunner, 0),
 		etcdClient: client,
 	}
+	s.obtainLock = s.obtainRedisLock
 
 	//  监听 Etcd 的变化，更新调度器
 	go s.watchEtcdSchedulerConfig()
 
 	// 加载注册的数据拉取任务
-	for _, fetcher := range FetcherRegistry {
-		s.fetchers = append(s.fetchers, fetcher())
+	for _, newFetcher := range FetcherRegistry {
+		fetcher := newFetcher()
+		s.runners = append(s.runners, newFetcherRunner(fetcher, s.fetcherOptions(fetcher)))
 	}
 
+	DefaultStatistic = s
+
 	return s
 }
 
+// fetcherOptions 合并拉取任务的默认参数和配置
+func (s *Statistic) fetcherOptions(fetcher Fetcher) FetcherOptions {
+	opts := fetcher.Options()
+
+	if fc, ok := s.cfg.Fetchers[strings.ToLower(fetcher.Name())]; ok {
+		opts.Disable = fc.Disable
+		if fc.Crontab != "" {
+			opts.Crontab = fc.Crontab
+		}
+		if fc.Timeout > 0 {
+			opts.Timeout = fc.Timeout
+		}
+		if fc.Concurrency > 0 {
+			opts.Concurrency = fc.Concurrency
+		}
+	}
+
+	if opts.Crontab == "" {
+		opts.Crontab = s.cfg.Crontab
+	}
+
+	return opts
+}
+
 func (s *Statistic) UpdateSchedulers(schedulers []*Scheduler) {
 	s.slk.Lock()
 	defer s.slk.Unlock()
@@ -84,87 +119,116 @@ func (s *Statistic) UpdateSchedulers(schedulers []*Scheduler) {
 	s.schedulers = schedulers
 }
 
+func (s *Statistic) getSchedulers() []*Scheduler {
+	s.slk.Lock()
+	defer s.slk.Unlock()
+
+	out := make([]*Scheduler, len(s.schedulers))
+	copy(out, s.schedulers)
+	return out
+}
+
 // Run starts the cron jobs for statistics.
 func (s *Statistic) Run() {
 	if s.cfg.Disable {
 		return
 	}
 
-	s.cron.AddFunc(s.cfg.Crontab, s.Once("FETCHER", s.runFetchers))
-	s.cron.Start()
-	s.handleJobs()
-}
+	for _, r := range s.runners {
+		go r.handleJobs(s.ctx)
 
-// handleJobs Fetcher的任务队列，对于第个不同类型的数据下载,都开一个协程处理,使用队列是避免并行写入数据库,获取不到锁写入失败的问题
-func (s *Statistic) handleJobs() {
-	for _, fetcher := range s.fetchers {
-		go func(f Fetcher) {
-			for {
-				select {
-				case job := <-f.GetJobQueue():
-					t := reflect.TypeOf(f)
-					log.Infof("%v jobqueue count: %d", t, len(f.GetJobQueue()))
-					if err := job(); err != nil {
-						log.Errorf("run job: %v", err)
-					}
-
-					// 当执行完所有的任务之后,调用 Finalize, 主要用于拉取节点数据完成之后的整个节点数据重新统计
-					if len(f.GetJobQueue()) == 0 && hasFinished(f) {
-						err := f.Finalize()
-						if err != nil {
-							log.Errorf("handle finalize: %v", err)
-						}
-					}
-
-				case <-s.ctx.Done():
-					return
-				}
+		if r.opts.Disable {
+			log.Infof("fetcher %s is disabled", r.fetcher.Name())
+			continue
+		}
+
+		runner := r
+		_, err := s.cron.AddFunc(runner.opts.Crontab, s.Once(fetcherLockKey(runner.fetcher.Name()), func() error {
+			err := runner.run(s.ctx, s.getSchedulers(), nil)
+			if err == ErrFetcherRunning {
+				log.Warnf("fetcher %s: previous run is not finished, skip", runner.fetcher.Name())
+				return nil
 			}
-		}(fetcher)
+			return err
+		}))
+		if err != nil {
+			log.Errorf("add fetcher %s with crontab %s: %v", runner.fetcher.Name(), runner.opts.Crontab, err)
+		}
 	}
+
+	s.cron.Start()
 }
 
-func hasFinished(f Fetcher) bool {
-	ticker := time.NewTicker(time.Second)
-	defer ticker.Stop()
+// Backfill 回补拉取任务在 [start, end) 时间段的数据, areaID 为空时回补所有区域, 在后台运行, 进度通过 Progress 查询;
+// 统计停用时没有消费任务队列的协程, 直接返回错误; 本服务或其他服务正在运行该拉取任务时返回 ErrFetcherRunning
+func (s *Statistic) Backfill(name, areaID string, start, end time.Time) error {
+	if s.cfg.Disable {
+		return ErrStatisticDisabled
+	}
 
-	confirmed := 0
+	runner := s.getRunner(name)
+	if runner == nil {
+		return ErrFetcherNotFound
+	}
 
-	for {
-		select {
-		case <-ticker.C:
-			if confirmed >= 10 {
-				return true
-			}
+	if _, ok := runner.fetcher.(Backfiller); !ok {
+		return ErrFetcherNotBackfilling
+	}
 
-			if len(f.GetJobQueue()) > 0 {
-				return false
-			}
+	if runner.isRunning() {
+		return ErrFetcherRunning
+	}
 
-			confirmed++
+	var schedulers []*Scheduler
+	for _, scheduler := range s.getSchedulers() {
+		if areaID == "" || scheduler.AreaId == areaID {
+			schedulers = append(schedulers, scheduler)
 		}
 	}
+
+	if len(schedulers) == 0 {
+		return fmt.Errorf("no scheduler found in area %s", areaID)
+	}
+
+	// 同步获取锁和开始运行, 没有真正开始回补时把错误返回给调用方
+	release, err := s.obtainLock(fetcherLockKey(runner.fetcher.Name()))
+	if errors.Is(err, redislock.ErrNotObtained) {
+		return ErrFetcherRunning
+	}
+	if err != nil {
+		return err
+	}
+
+	window := &backfillWindow{AreaID: areaID, Start: start, End: end}
+	ctx, err := runner.begin(s.ctx, len(schedulers), window)
+	if err != nil {
+		release()
+		return err
+	}
+
+	go func() {
+		defer release()
+		runner.execute(ctx, schedulers, window)
+	}()
+
+	return nil
 }
 
-// runFetchers 遍历所有的调度器,每个调度器开一个协程,并行处理任务
-func (s *Statistic) runFetchers() error {
-	var wg sync.WaitGroup
-	wg.Add(len(s.schedulers))
-	s.slk.Lock()
-	for _, scheduler := range s.schedulers {
-		go func(scheduler *Scheduler) {
-			defer wg.Done()
-			for _, fetcher := range s.fetchers {
-				err := fetcher.Fetch(s.ctx, scheduler)
-				if err != nil {
-					log.Errorf("run fetcher: %v", err)
-				}
-			}
-		}(scheduler)
+// Progress 获取所有拉取任务的进度
+func (s *Statistic) Progress() []FetcherProgress {
+	var out []FetcherProgress
+	for _, r := range s.runners {
+		out = append(out, r.getProgress())
 	}
-	s.slk.Unlock()
-	wg.Wait()
+	return out
+}
 
+func (s *Statistic) getRunner(name string) *fetcherRunner {
+	for _, r := range s.runners {
+		if strings.EqualFold(r.fetcher.Name(), name) {
+			return r
+		}
+	}
 	return nil
 }
 
@@ -182,10 +246,9 @@ func (s *Statistic) Stop() {
 // Once 使用 redis 分布式锁, 当部署多个服务时,保证只有一个服务进行数据拉取和统计,避免重复执行任务,获得锁的服务会执行任务,获取不到锁的则跳过.
 func (s *Statistic) Once(key string, fn func() error) func() {
 	return func() {
-		dKey := fmt.Sprintf("%s::%s", statisticLockerKeyPrefix, key)
-		lock, err := s.locker.Obtain(s.ctx, dKey, LockerTTL, nil)
-		if err == redislock.ErrNotObtained {
-			log.Debugf("%s: %v", dKey, redislock.ErrNotObtained)
+		release, err := s.obtainLock(key)
+		if errors.Is(err, redislock.ErrNotObtained) {
+			log.Debugf("%s: %v", key, redislock.ErrNotObtained)
 			return
 		}
 
@@ -194,13 +257,27 @@ func (s *Statistic) Once(key string, fn func() error) func() {
 			return
 		}
 
-		defer lock.Release(s.ctx)
+		defer release()
 		if err = fn(); err != nil {
 			log.Errorf("execute cron job: %v", err)
 		}
 	}
 }
 
+// obtainRedisLock 获取 redis 分布式锁
+func (s *Statistic) obtainRedisLock(key string) (func(), error) {
+	lock, err := s.locker.Obtain(s.ctx, fmt.Sprintf("%s::%s", statisticLockerKeyPrefix, key), LockerTTL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return func() { lock.Release(s.ctx) }, nil
+}
+
+// fetcherLockKey 拉取任务的分布式锁, 定时运行和回补共用
+func fetcherLockKey(name string) string {
+	return fmt.Sprintf("FETCHER::%s", name)
+}
+
 // watchEtcdSchedulerConfig 监听 Etcd 中调度器的增加和减少变化
 func (s *Statistic) watchEtcdSchedulerConfig() {
 	watchChan := s.etcdClient.cli.WatchServers(context.Background(), types.NodeScheduler.String())
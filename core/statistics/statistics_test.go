@@ -0,0 +1,183 @@
+package statistics
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bsm/redislock"
+	"github.com/gnasnik/titan-explorer/config"
+)
+
+// testBackfillFetcher 记录回补调用的拉取任务, failArea 区域回补失败
+type testBackfillFetcher struct {
+	BaseFetcher
+	failArea string
+
+	mu        sync.Mutex
+	areas     []string
+	finalized int
+}
+
+func (f *testBackfillFetcher) Name() string            { return "TestBackfill" }
+func (f *testBackfillFetcher) Options() FetcherOptions { return FetcherOptions{} }
+
+func (f *testBackfillFetcher) Fetch(ctx context.Context, scheduler *Scheduler) error {
+	return errors.New("unexpected fetch")
+}
+
+func (f *testBackfillFetcher) Backfill(ctx context.Context, scheduler *Scheduler, start, end time.Time) error {
+	f.mu.Lock()
+	f.areas = append(f.areas, scheduler.AreaId)
+	f.mu.Unlock()
+
+	if scheduler.AreaId == f.failArea {
+		return errors.New("backfill failed")
+	}
+	f.Push(ctx, func() error { return nil })
+	return nil
+}
+
+func (f *testBackfillFetcher) Finalize() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.finalized++
+	return nil
+}
+
+// testLocker 进程内的分布式锁
+type testLocker struct {
+	mu   sync.Mutex
+	held map[string]bool
+}
+
+func (l *testLocker) obtain(key string) (func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.held[key] {
+		return nil, redislock.ErrNotObtained
+	}
+	l.held[key] = true
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.held, key)
+	}, nil
+}
+
+func newTestStatistic(t *testing.T, fetcher Fetcher, areas ...string) (*Statistic, *testLocker) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	locker := &testLocker{held: make(map[string]bool)}
+	s := &Statistic{
+		ctx:        ctx,
+		cfg:        config.StatisticsConfig{},
+		runners:    []*fetcherRunner{newFetcherRunner(fetcher, fetcher.Options())},
+		obtainLock: locker.obtain,
+	}
+	for _, area := range areas {
+		s.schedulers = append(s.schedulers, &Scheduler{AreaId: area})
+	}
+
+	go s.runners[0].handleJobs(ctx)
+	return s, locker
+}
+
+func waitFetcherFinished(t *testing.T, s *Statistic) FetcherProgress {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if p := s.Progress()[0]; p.State == FetcherStateFinished {
+			return p
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("fetcher not finished: %+v", s.Progress()[0])
+	return FetcherProgress{}
+}
+
+func TestBackfill(t *testing.T) {
+	fetcher := &testBackfillFetcher{BaseFetcher: newBaseFetcher(), failArea: "area-2"}
+	s, locker := newTestStatistic(t, fetcher, "area-1", "area-2", "area-3")
+
+	start := time.Date(2025, 4, 1, 0, 0, 0, 0, time.Local)
+	end := start.Add(24 * time.Hour)
+
+	if err := s.Backfill("testbackfill", "area-4", start, end); err == nil {
+		t.Fatalf("expected error for area without scheduler")
+	}
+
+	// 其他服务持有锁时不会开始回补
+	release, _ := locker.obtain(fetcherLockKey(fetcher.Name()))
+	if err := s.Backfill("testbackfill", "", start, end); err != ErrFetcherRunning {
+		t.Fatalf("expected ErrFetcherRunning when the lock is held, got %v", err)
+	}
+	release()
+	if len(fetcher.areas) != 0 || s.Progress()[0].State != FetcherStateIdle {
+		t.Fatalf("backfill should not run without the lock, areas %v", fetcher.areas)
+	}
+
+	if err := s.Backfill("testbackfill", "", start, end); err != nil {
+		t.Fatalf("Backfill: %v", err)
+	}
+	p := waitFetcherFinished(t, s)
+
+	if !p.Backfill || !p.WindowStart.Equal(start) || !p.WindowEnd.Equal(end) {
+		t.Fatalf("unexpected backfill window %+v", p)
+	}
+	if p.SchedulersTotal != 3 || p.SchedulersDone != 3 || p.SchedulersFailed != 1 || p.LastError != "backfill failed" {
+		t.Fatalf("unexpected scheduler progress %+v", p)
+	}
+	if p.JobsDone != 2 || p.JobsFailed != 0 {
+		t.Fatalf("unexpected job progress %+v", p)
+	}
+	if fetcher.finalized != 1 {
+		t.Fatalf("expected finalize once, got %d", fetcher.finalized)
+	}
+
+	// 运行结束后释放锁
+	if _, err := locker.obtain(fetcherLockKey(fetcher.Name())); err != nil {
+		t.Fatalf("lock should be released after backfill, got %v", err)
+	}
+}
+
+func TestBackfillArea(t *testing.T) {
+	fetcher := &testBackfillFetcher{BaseFetcher: newBaseFetcher()}
+	s, _ := newTestStatistic(t, fetcher, "area-1", "area-2")
+
+	start := time.Date(2025, 4, 1, 0, 0, 0, 0, time.Local)
+	if err := s.Backfill("TestBackfill", "area-2", start, start.Add(time.Hour)); err != nil {
+		t.Fatalf("Backfill: %v", err)
+	}
+	p := waitFetcherFinished(t, s)
+
+	if p.AreaID != "area-2" || p.SchedulersTotal != 1 || len(fetcher.areas) != 1 || fetcher.areas[0] != "area-2" {
+		t.Fatalf("expected backfill of area-2 only, got %v %+v", fetcher.areas, p)
+	}
+}
+
+func TestBackfillRejected(t *testing.T) {
+	fetcher := &testBackfillFetcher{BaseFetcher: newBaseFetcher()}
+	s, _ := newTestStatistic(t, fetcher, "area-1")
+	start := time.Date(2025, 4, 1, 0, 0, 0, 0, time.Local)
+
+	if err := s.Backfill("unknown", "", start, start.Add(time.Hour)); err != ErrFetcherNotFound {
+		t.Fatalf("expected ErrFetcherNotFound, got %v", err)
+	}
+
+	// 本服务正在运行时直接拒绝
+	if _, err := s.runners[0].begin(s.ctx, 1, nil); err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if err := s.Backfill("TestBackfill", "", start, start.Add(time.Hour)); err != ErrFetcherRunning {
+		t.Fatalf("expected ErrFetcherRunning, got %v", err)
+	}
+
+	s.cfg.Disable = true
+	if err := s.Backfill("TestBackfill", "", start, start.Add(time.Hour)); err != ErrStatisticDisabled {
+		t.Fatalf("expected ErrStatisticDisabled, got %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package job
 
 import (
 	"log"
+	"time"
 
 	"github.com/gnasnik/titan-explorer/config"
 	"github.com/gnasnik/titan-explorer/core/opasynq"
@@ -15,6 +16,7 @@ var MonitorHandler *asynqmon.HTTPHandler
 func StartAsynqServer() {
 	go startExplorerServer()
 	go startTenantServer()
+	go startOplogServer()
 }
 
 func startExplorerServer() {
@@ -32,6 +34,10 @@ func startExplorerServer() {
 	mux.HandleFunc(opasynq.TypeAssetGroupID, deleteAssetGroup)
 	mux.HandleFunc(opasynq.TypeDeleteAssetOperation, deleteAsset)
 	mux.HandleFunc(opasynq.TypeSyncIPFSRecord, operateSyncIPFSRecord)
+	mux.HandleFunc(opasynq.TypeAssetBatch, assetBatch)
+	mux.HandleFunc(opasynq.TypeGroupPublish, groupPublish)
+	mux.HandleFunc(opasynq.TaskTypeNodeAlert, nodeAlert)
+	mux.HandleFunc(opasynq.TaskTypeRewardRepair, rewardRepair)
 
 	if err := srv.Run(mux); err != nil {
 		log.Fatalf("Explorer server encountered an error: %v", err)
@@ -53,8 +59,34 @@ func startTenantServer() {
 	tenantMux := asynq.NewServeMux()
 	tenantMux.HandleFunc(opasynq.TaskTypeAssetUploadedNotify, assetUploadNotify)
 	tenantMux.HandleFunc(opasynq.TaskTypeAssetDeleteNotify, assetDeleteNotify)
+	tenantMux.HandleFunc(opasynq.TaskTypeTenantEvent, dispatchTenantEvent)
+	tenantMux.HandleFunc(opasynq.TaskTypeTenantWebhook, tenantWebhook)
 
 	if err := tenantSrv.Run(tenantMux); err != nil {
 		log.Fatalf("Tenant server encountered an error: %v", err)
 	}
 }
+
+func startOplogServer() {
+	oplogSrv := asynq.NewServer(
+		asynq.RedisClientOpt{Addr: config.Cfg.RedisAddr, Password: config.Cfg.RedisPassword},
+		asynq.Config{
+			Concurrency: 2,
+			Queues: map[string]int{
+				opasynq.TaskQueueOplog: 1,
+			},
+			GroupAggregator:  asynq.GroupAggregatorFunc(aggregateOplog),
+			GroupMaxSize:     200,
+			GroupGracePeriod: 2 * time.Second,
+			GroupMaxDelay:    10 * time.Second,
+		},
+	)
+
+	oplogMux := asynq.NewServeMux()
+	oplogMux.HandleFunc(opasynq.TaskTypeLoginLogBatch, batchLoginLog)
+	oplogMux.HandleFunc(opasynq.TaskTypeOperationLogBatch, batchOperationLog)
+
+	if err := oplogSrv.Run(oplogMux); err != nil {
+		log.Fatalf("Oplog server encountered an error: %v", err)
+	}
+}
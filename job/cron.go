@@ -18,8 +18,6 @@ import (
 	"github.com/go-redsync/redsync/v4/redis/goredis/v9"
 	logging "github.com/ipfs/go-log/v2"
 	goredislib "github.com/redis/go-redis/v9"
-	"github.com/robfig/cron/v3"
-	"golang.org/x/exp/rand"
 )
 
 var (
@@ -47,71 +45,39 @@ func newRedSync() *redsync.Redsync {
 }
 
 // SyncShedulersAsset 同步调度器文件
-func SyncShedulersAsset() {
-	c := cron.New(cron.WithLocation(time.Local))
-
-	// 初始化分布式锁
-	redsync := newRedSync()
-
-	c.AddFunc("@every 10s", func() {
-		// 防止同时竞争一把锁
-		time.Sleep(time.Duration(rand.Intn(100)) * time.Millisecond)
-		mutex := redsync.NewMutex("syncUserScheduler-lock")
-		if err := mutex.Lock(); err != nil {
-			log.Printf("syncUserScheduler is already running on another instance: %v", err)
-			return
-		}
-		syncUserScheduler()
-	})
-	c.AddFunc("@every 10s", func() {
-		time.Sleep(time.Duration(rand.Intn(100)) * time.Millisecond)
-		mutex := redsync.NewMutex("getsyncipfs-lock")
-		if err := mutex.Lock(); err != nil {
-			log.Printf("syncUserScheduler is already running on another instance: %v", err)
-			return
-		}
-		GetSyncIPFSRecords()
-	})
-	c.AddFunc("@every 15s", func() {
-		time.Sleep(time.Duration(rand.Intn(100)) * time.Millisecond)
-		mutex := redsync.NewMutex("syncUnLoginAsset-lock")
-		if err := mutex.Lock(); err != nil {
-			log.Printf("syncUnLoginAsset is already running on another instance: %v", err)
-			return
-		}
-		syncUnLoginAsset()
-	})
-	c.AddFunc("0,10,20,30,40,50 * * * *", func() {
-		// 防止同时竞争一把锁
-		time.Sleep(time.Duration(rand.Intn(100)) * time.Millisecond)
-		mutex := redsync.NewMutex("syncDashboard-lock")
-		if err := mutex.Lock(); err != nil {
-			log.Printf("syncDashboard is already running on another instance: %v", err)
-			return
-		}
-		syncDashboard()
-	})
-	c.AddFunc("@every 60s", func() {
-		// 防止同时竞争一把锁
-		time.Sleep(time.Duration(rand.Intn(100)) * time.Millisecond)
-		mutex := redsync.NewMutex("getSyncSuccessAsset-lock")
-		if err := mutex.Lock(); err != nil {
-			log.Printf("getSyncSuccessAsset is already running on another instance: %v", err)
-			return
+func SyncShedulersAsset() *Runner {
+	runner := NewRunner(newRedSync())
+
+	jobs := []CronJob{
+		{Name: "syncUserScheduler", Spec: "@every 10s", Run: syncUserScheduler},
+		{Name: "getsyncipfs", Spec: "@every 10s", Run: GetSyncIPFSRecords},
+		{Name: "syncUnLoginAsset", Spec: "@every 15s", Run: syncUnLoginAsset},
+		{Name: "syncDashboard", Spec: "0,10,20,30,40,50 * * * *", Run: syncDashboard, LeaseTTL: 2 * time.Minute},
+		{Name: "getSyncSuccessAsset", Spec: "@every 60s", Run: getSyncSuccessAsset, LeaseTTL: time.Minute},
+		{Name: "notifyExpiredShareLinks", Spec: "@every 60s", Run: notifyExpiredShareLinks},
+		{Name: "cleanupJobRuns", Spec: "@daily", Run: cleanupJobRuns},
+		{Name: "expireUploadSessions", Spec: "@every 5m", Run: expireUploadSessions},
+		{Name: "purgeExpiredTrash", Spec: "@every 10m", Run: purgeExpiredTrash, LeaseTTL: 10 * time.Minute},
+		{Name: "rollupNodeUptime", Spec: "5 * * * *", Run: rollupNodeUptime, LeaseTTL: 10 * time.Minute},
+	}
+
+	for _, job := range jobs {
+		if err := runner.Register(job); err != nil {
+			log.Fatal(err)
 		}
-		getSyncSuccessAsset()
-	})
+	}
+
+	runner.Start()
 
-	c.Start()
+	return runner
 }
 
 // syncUserScheduler 同步登陆后用户的调度器信息
-func syncUserScheduler() {
+func syncUserScheduler(ctx context.Context) error {
 	// 获取 schedulers
 	payloads, err := oprds.GetClient().GetAllSchedulerInfos(ctx)
 	if err != nil {
-		cronLog.Errorf("get all scheduler infos error:%v", err)
-		return
+		return fmt.Errorf("get all scheduler infos error:%w", err)
 	}
 	wg := new(sync.WaitGroup)
 	for _, v := range payloads {
@@ -153,14 +119,15 @@ func syncUserScheduler() {
 		}(v)
 	}
 	wg.Wait()
+
+	return nil
 }
 
-func syncUnLoginAsset() {
+func syncUnLoginAsset(ctx context.Context) error {
 	// 获取 schedulers
 	payloads, err := oprds.GetClient().GetAllAreaIDs(ctx)
 	if err != nil {
-		cronLog.Errorf("get all scheduler infos error:%v", err)
-		return
+		return fmt.Errorf("get all area ids error:%w", err)
 	}
 	wg := new(sync.WaitGroup)
 	for _, v := range payloads {
@@ -197,9 +164,11 @@ func syncUnLoginAsset() {
 		}(v)
 	}
 	wg.Wait()
+
+	return nil
 }
 
-func syncDashboard() {
+func syncDashboard(ctx context.Context) error {
 	var (
 		wg            = new(sync.WaitGroup)
 		trafficMaps   = new(sync.Map)
@@ -214,8 +183,7 @@ func syncDashboard() {
 
 	areaIDs, err := getAllAreaIDs()
 	if err != nil {
-		cronLog.Errorf("get all areaids error:%v", err)
-		return
+		return fmt.Errorf("get all areaids error:%w", err)
 	}
 
 	for _, v := range areaIDs {
@@ -245,12 +213,14 @@ func syncDashboard() {
 
 	err = storeAssetHourStorages(trafficMaps, bandwidthMaps, pendTime)
 	if err != nil {
-		cronLog.Errorf("storeAssetHourStorages error:%v", err)
+		return fmt.Errorf("storeAssetHourStorages error:%w", err)
 	}
+
+	return nil
 }
 
 // getSyncSuccessAsset 更新
-func getSyncSuccessAsset() {
+func getSyncSuccessAsset(ctx context.Context) error {
 	var (
 		wg = new(sync.WaitGroup)
 	)
@@ -258,8 +228,7 @@ func getSyncSuccessAsset() {
 	// 获取所有调度器区域
 	areaIDs, err := getAllAreaIDs()
 	if err != nil {
-		log.Println(err)
-		return
+		return fmt.Errorf("get all areaids error:%w", err)
 	}
 	for _, v := range areaIDs {
 		wg.Add(1)
@@ -271,17 +240,26 @@ func getSyncSuccessAsset() {
 				cronLog.Errorf("getSyncSuccessHash error:%v", err)
 				return
 			}
+			// 记录本次状态变更的文件, 用于判断是否已同步到所有区域
+			changed, err := dao.GetUnSyncAssetAreas(ctx, v, hashs)
+			if err != nil {
+				cronLog.Errorf("GetUnSyncAssetAreas error:%v", err)
+			}
 			err = dao.UpdateSyncAssetAreas(ctx, v, hashs)
 			if err != nil {
 				cronLog.Errorf("UpdateSyncAssetAreas error:%v", err)
+				return
 			}
+			notifyAssetSynced(ctx, changed)
 		}(v)
 	}
 	wg.Wait()
+
+	return nil
 }
 
 // GetSyncIPFSRecords 获取ipfs上传完成的信息
-func GetSyncIPFSRecords() {
+func GetSyncIPFSRecords(ctx context.Context) error {
 	var (
 		cidAreaMaps = make(map[string][]string)
 		wg          = new(sync.WaitGroup)
@@ -290,8 +268,7 @@ func GetSyncIPFSRecords() {
 	// 获取未同步的ipfs记录，调用调度器去查询文件信息，判断是否上传成功
 	irs, err := dao.GetUnSyncIPFSRecords(ctx)
 	if err != nil {
-		cronLog.Errorf("get unsync ipfs records error:%v", err)
-		return
+		return fmt.Errorf("get unsync ipfs records error:%w", err)
 	}
 	for _, v := range irs {
 		cidAreaMaps[v.AreaID] = append(cidAreaMaps[v.AreaID], v.CID)
@@ -337,4 +314,6 @@ func GetSyncIPFSRecords() {
 		}(k, v)
 	}
 	wg.Wait()
+
+	return nil
 }
@@ -0,0 +1,22 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/gnasnik/titan-explorer/api"
+	"github.com/gnasnik/titan-explorer/core/opasynq"
+	"github.com/hibiken/asynq"
+)
+
+// assetBatch 执行文件批量操作任务
+func assetBatch(ctx context.Context, t *asynq.Task) error {
+	var payload opasynq.AssetBatchPayload
+
+	err := json.Unmarshal(t.Payload(), &payload)
+	if err != nil {
+		return err
+	}
+
+	return api.RunAssetBatchJob(ctx, payload.JobID)
+}
@@ -43,24 +43,21 @@ func deleteAssetGroup(ctx context.Context, t *asynq.Task) error {
 // deleteAssetByGroup 通过文件组id删除文件组内的文件
 func deleteAssetByGroup(ctx context.Context, uid string, gids []int64) error {
 	// 删除指定文件组下的文件内容
-	err := dao.DeleteUserGroupAsset(ctx, uid, gids)
+	released, err := dao.DeleteUserGroupAsset(ctx, uid, gids)
 	if err != nil {
 		log.Printf("DeleteUserGroupAsset error:%v-----\n", err)
 		opasynq.DefaultCli.EnqueueAssetGroupID(ctx, opasynq.AssetGroupPayload{UserID: uid, GroupID: gids})
 		return nil
 	}
-
-	// 获取唯一存在的文件的区域映射表
-	maps, err := dao.GetOnlyAssetsByUIDAndGroupID(ctx, uid, gids)
-	if err != nil {
-		log.Printf("GetOnlyAssetsByUIDAndGroupID error:%v-----\n", err)
-		return nil
-	}
-	if len(maps) == 0 {
+	if len(released) == 0 {
 		return nil
 	}
 
-	// 调用调度器删除文件
+	// 区域中已经没有引用的内容, 按区域从调度器删除
+	maps := make(map[string][]string)
+	for _, content := range released {
+		maps[content.AreaID] = append(maps[content.AreaID], content.Cid)
+	}
 	for k, v := range maps {
 		scli, err := api.GetSchedulerClient(context.Background(), k)
 		if err != nil {
@@ -0,0 +1,22 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/gnasnik/titan-explorer/api"
+	"github.com/gnasnik/titan-explorer/core/opasynq"
+	"github.com/hibiken/asynq"
+)
+
+// groupPublish 将文件组发布为 UnixFS 目录
+func groupPublish(ctx context.Context, t *asynq.Task) error {
+	var payload opasynq.GroupPublishPayload
+
+	err := json.Unmarshal(t.Payload(), &payload)
+	if err != nil {
+		return err
+	}
+
+	return api.RunGroupPublish(ctx, payload.ID)
+}
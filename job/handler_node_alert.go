@@ -0,0 +1,22 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/gnasnik/titan-explorer/api"
+	"github.com/gnasnik/titan-explorer/core/opasynq"
+	"github.com/hibiken/asynq"
+)
+
+// nodeAlert 发送节点告警通知
+func nodeAlert(ctx context.Context, t *asynq.Task) error {
+	var payload opasynq.NodeAlertPayload
+
+	err := json.Unmarshal(t.Payload(), &payload)
+	if err != nil {
+		return err
+	}
+
+	return api.RunNodeAlertNotify(ctx, payload.ID)
+}
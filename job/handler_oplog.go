@@ -0,0 +1,69 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/core/opasynq"
+	"github.com/hibiken/asynq"
+)
+
+var oplogBatchTypes = map[string]string{
+	opasynq.TaskTypeLoginLog:     opasynq.TaskTypeLoginLogBatch,
+	opasynq.TaskTypeOperationLog: opasynq.TaskTypeOperationLogBatch,
+}
+
+// aggregateOplog 把同组的日志任务合并成一个批量写入任务, 载体为 JSON 数组
+func aggregateOplog(group string, tasks []*asynq.Task) *asynq.Task {
+	items := make([]json.RawMessage, 0, len(tasks))
+	for _, t := range tasks {
+		items = append(items, t.Payload())
+	}
+
+	payload, err := json.Marshal(items)
+	if err != nil {
+		cronLog.Errorf("aggregate oplog %s: %v", group, err)
+	}
+
+	typename, ok := oplogBatchTypes[group]
+	if !ok {
+		typename = fmt.Sprintf("%s:batch", group)
+	}
+
+	return asynq.NewTask(typename, payload, asynq.MaxRetry(10))
+}
+
+// batchLoginLog 批量写入登录日志
+func batchLoginLog(ctx context.Context, t *asynq.Task) error {
+	var logs []*model.LoginLog
+	if err := json.Unmarshal(t.Payload(), &logs); err != nil {
+		cronLog.Errorf("unable to parse message %+v", t.Payload())
+		return fmt.Errorf("%v: %w", err, asynq.SkipRetry)
+	}
+
+	if err := dao.AddLoginLogs(ctx, logs); err != nil {
+		cronLog.Errorf("add login logs: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// batchOperationLog 批量写入操作日志
+func batchOperationLog(ctx context.Context, t *asynq.Task) error {
+	var logs []*model.OperationLog
+	if err := json.Unmarshal(t.Payload(), &logs); err != nil {
+		cronLog.Errorf("unable to parse message %+v", t.Payload())
+		return fmt.Errorf("%v: %w", err, asynq.SkipRetry)
+	}
+
+	if err := dao.AddOperationLogs(ctx, logs); err != nil {
+		cronLog.Errorf("add operation logs: %v", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,22 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/gnasnik/titan-explorer/api"
+	"github.com/gnasnik/titan-explorer/core/opasynq"
+	"github.com/hibiken/asynq"
+)
+
+// rewardRepair 修复对账中已批准的收益差异
+func rewardRepair(ctx context.Context, t *asynq.Task) error {
+	var payload opasynq.RewardRepairPayload
+
+	err := json.Unmarshal(t.Payload(), &payload)
+	if err != nil {
+		return err
+	}
+
+	return api.RunRewardRepair(ctx, payload.RunID)
+}
@@ -0,0 +1,68 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/opasynq"
+	"github.com/hibiken/asynq"
+)
+
+// dispatchTenantEvent 按租户的订阅把事件分发到各个回调地址
+func dispatchTenantEvent(ctx context.Context, t *asynq.Task) error {
+	var payload opasynq.TenantEventPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		cronLog.Errorf("unable to parse message %+v", t.Payload())
+		return err
+	}
+
+	// 没有事件ID时使用分发任务的ID, 分发任务重试时每个订阅的投递任务ID不变
+	if payload.EventID == "" {
+		payload.EventID, _ = asynq.GetTaskID(ctx)
+	}
+
+	subs, err := dao.ListWebhookSubscriptions(ctx, payload.TenantID)
+	if err != nil {
+		cronLog.Errorf("unable to list webhook subscriptions of %s: %+v", payload.TenantID, err)
+		return err
+	}
+
+	for _, sub := range subs {
+		if !sub.Subscribed(payload.Event) {
+			continue
+		}
+
+		err = opasynq.DefaultCli.EnqueueTenantWebhook(ctx, opasynq.TenantWebhookPayload{
+			TenantEventPayload: payload,
+			SubscriptionID:     sub.ID,
+			Url:                sub.Url,
+		})
+		if err != nil {
+			cronLog.Errorf("unable to enqueue webhook of subscription %d: %+v", sub.ID, err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// tenantWebhook 投递租户事件到订阅地址
+func tenantWebhook(ctx context.Context, t *asynq.Task) error {
+	var payload opasynq.TenantWebhookPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		cronLog.Errorf("unable to parse message %+v", t.Payload())
+		return err
+	}
+
+	tenantInfo, err := dao.GetTenantByBuilder(ctx, squirrel.Select("*").Where("tenant_id = ?", payload.TenantID))
+	if err != nil {
+		cronLog.Errorf("unable to find tenant info %+v", err)
+		return err
+	}
+
+	bodyData, _ := json.Marshal(payload.TenantEventPayload)
+
+	return deliverWebhook(ctx, t, subscriptionHTTPClient, tenantInfo, payload.Event, payload.DeliveryID, payload.Url, bodyData)
+}
@@ -0,0 +1,13 @@
+package job
+
+import (
+	"context"
+	"time"
+
+	"github.com/gnasnik/titan-explorer/core/statistics"
+)
+
+// rollupNodeUptime 在 device_info_hour 被清理之前统计节点的可用性和离线区间
+func rollupNodeUptime(ctx context.Context) error {
+	return statistics.RollupNodeUptime(ctx, time.Now())
+}
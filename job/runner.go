@@ -0,0 +1,168 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/pkg/formatter"
+	"github.com/go-redsync/redsync/v4"
+	"github.com/robfig/cron/v3"
+	"golang.org/x/exp/rand"
+)
+
+const (
+	defaultLeaseTTL      = 30 * time.Second
+	jobRunRetention      = 7 * 24 * time.Hour
+	jobLockerKeyPrefix   = "TITAN::CRON"
+	maxJobRunErrorLength = 2048
+)
+
+// CronJob 定时任务, 由 Runner 保证同一时刻只有一个实例在执行
+type CronJob struct {
+	Name string
+	Spec string
+	Run  func(ctx context.Context) error
+	// LeaseTTL 分布式锁的租约时长, 任务执行期间会定期续约
+	LeaseTTL time.Duration
+}
+
+// Runner 执行定时任务: 获取租约, 执行期间续约, 结束后释放, 并记录每次执行的结果到 job_runs 表
+type Runner struct {
+	cron     *cron.Cron
+	rs       *redsync.Redsync
+	instance string
+}
+
+// NewRunner 新建定时任务执行器
+func NewRunner(rs *redsync.Redsync) *Runner {
+	hostname, _ := os.Hostname()
+
+	return &Runner{
+		cron:     cron.New(cron.WithLocation(time.Local)),
+		rs:       rs,
+		instance: fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+	}
+}
+
+// Register 注册定时任务
+func (r *Runner) Register(job CronJob) error {
+	if job.LeaseTTL <= 0 {
+		job.LeaseTTL = defaultLeaseTTL
+	}
+
+	_, err := r.cron.AddFunc(job.Spec, func() {
+		r.run(job)
+	})
+	if err != nil {
+		return fmt.Errorf("register job %s: %w", job.Name, err)
+	}
+
+	return nil
+}
+
+// Start 启动所有定时任务
+func (r *Runner) Start() {
+	r.cron.Start()
+}
+
+// Stop 停止调度, 并等待正在执行的任务结束
+func (r *Runner) Stop() {
+	<-r.cron.Stop().Done()
+}
+
+func (r *Runner) run(job CronJob) {
+	// 防止同时竞争一把锁
+	time.Sleep(time.Duration(rand.Intn(100)) * time.Millisecond)
+
+	mutex := r.rs.NewMutex(fmt.Sprintf("%s::%s", jobLockerKeyPrefix, job.Name), redsync.WithExpiry(job.LeaseTTL), redsync.WithTries(1))
+	if err := mutex.TryLockContext(ctx); err != nil {
+		cronLog.Debugf("%s is already running on another instance: %v", job.Name, err)
+		return
+	}
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	leaseDone := make(chan struct{})
+	go r.keepLease(jobCtx, cancel, job, mutex, leaseDone)
+
+	run := &model.JobRun{
+		JobName:   job.Name,
+		Instance:  r.instance,
+		Status:    dao.JobRunStatusRunning,
+		StartedAt: time.Now(),
+	}
+	if err := dao.AddJobRun(ctx, run); err != nil {
+		cronLog.Errorf("add job run of %s: %v", job.Name, err)
+	}
+
+	err := r.execute(jobCtx, job)
+
+	cancel()
+	<-leaseDone
+
+	if _, uerr := mutex.UnlockContext(ctx); uerr != nil {
+		cronLog.Warnf("release lock of %s: %v", job.Name, uerr)
+	}
+
+	run.FinishedAt = time.Now()
+	run.DurationMs = run.FinishedAt.Sub(run.StartedAt).Milliseconds()
+	run.Status = dao.JobRunStatusSuccess
+	if err != nil {
+		cronLog.Errorf("run job %s: %v", job.Name, err)
+		run.Status = dao.JobRunStatusFailed
+		run.Error = formatter.Truncate(err.Error(), maxJobRunErrorLength)
+	}
+
+	if run.ID == 0 {
+		return
+	}
+
+	if err := dao.FinishJobRun(ctx, run); err != nil {
+		cronLog.Errorf("finish job run of %s: %v", job.Name, err)
+	}
+}
+
+// execute 执行任务, 任务 panic 时记为失败
+func (r *Runner) execute(ctx context.Context, job CronJob) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("panic: %v", e)
+		}
+	}()
+
+	return job.Run(ctx)
+}
+
+// keepLease 在任务执行期间定期续约, 续约失败说明锁已经丢失, 取消任务避免多个实例同时执行
+func (r *Runner) keepLease(ctx context.Context, cancel context.CancelFunc, job CronJob, mutex *redsync.Mutex, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(job.LeaseTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if ok, err := mutex.ExtendContext(ctx); !ok || err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				cronLog.Errorf("extend lease of %s: %v", job.Name, err)
+				cancel()
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// cleanupJobRuns 清理过期的任务执行记录
+func cleanupJobRuns(ctx context.Context) error {
+	return dao.DeleteJobRunsBefore(ctx, time.Now().Add(-jobRunRetention))
+}
@@ -0,0 +1,85 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gnasnik/titan-explorer/api"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/core/opasynq"
+	"github.com/go-redis/redis/v9"
+)
+
+const shareExpiredCheckpointKey = "TITAN::WEBHOOK::SHARE_EXPIRED_CHECKPOINT"
+
+// notifyAssetSynced 文件在所有区域都同步完成后通知租户
+func notifyAssetSynced(ctx context.Context, areas []*model.UserAssetArea) {
+	for _, a := range areas {
+		unSynced, err := dao.GetUnSyncAreaIDs(ctx, a.UserID, a.Hash)
+		if err != nil {
+			cronLog.Errorf("GetUnSyncAreaIDs error:%v", err)
+			continue
+		}
+		if len(unSynced) > 0 {
+			continue
+		}
+
+		user, err := dao.GetUserByUsername(ctx, a.UserID)
+		if err != nil || user.TenantID == "" {
+			continue
+		}
+
+		asset, err := dao.GetUserAsset(ctx, a.Hash, a.UserID)
+		if err != nil {
+			cronLog.Errorf("GetUserAsset error:%v", err)
+			continue
+		}
+
+		areaIDs, err := dao.GetUserAssetAreaIDs(ctx, a.Hash, a.UserID)
+		if err != nil {
+			cronLog.Errorf("GetUserAssetAreaIDs error:%v", err)
+		}
+
+		// 多个区域同时完成时可能重复触发, 使用固定的事件ID去重
+		eventID := fmt.Sprintf("%s:%s:%s", opasynq.WebhookEventAssetSynced, a.UserID, a.Hash)
+		api.PublishTenantEvent(ctx, user.TenantID, opasynq.WebhookEventAssetSynced, eventID, api.WebhookAssetData{
+			UserID:   a.UserID,
+			ExtraID:  asset.ExtraID,
+			AssetCID: asset.Cid,
+			AreaIDs:  areaIDs,
+		})
+	}
+}
+
+// notifyExpiredShareLinks 通知租户子账户的分享链接已过期
+func notifyExpiredShareLinks(ctx context.Context) error {
+	now := time.Now()
+
+	start := now.Add(-time.Minute)
+	checkpoint, err := dao.RedisCache.Get(ctx, shareExpiredCheckpointKey).Int64()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("get checkpoint error:%w", err)
+	}
+	if checkpoint > 0 {
+		start = time.Unix(checkpoint, 0)
+	}
+
+	links, err := dao.GetTenantExpiredLinks(ctx, start, now)
+	if err != nil {
+		return fmt.Errorf("get expired links error:%w", err)
+	}
+
+	for _, link := range links {
+		eventID := fmt.Sprintf("%s:%d", opasynq.WebhookEventShareExpired, link.ID)
+		api.PublishTenantEvent(ctx, link.TenantID, opasynq.WebhookEventShareExpired, eventID, api.WebhookShareData{
+			UserID:    link.UserName,
+			Cid:       link.Cid,
+			ShortLink: link.ShortLink,
+			ExpireAt:  link.ExpireAt,
+		})
+	}
+
+	return dao.RedisCache.Set(ctx, shareExpiredCheckpointKey, now.Unix(), 0).Err()
+}
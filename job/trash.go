@@ -0,0 +1,35 @@
+package job
+
+import (
+	"context"
+	"time"
+
+	"github.com/gnasnik/titan-explorer/api"
+	"github.com/gnasnik/titan-explorer/core/dao"
+)
+
+// purgeTrashBatchSize 每次彻底删除的回收站记录数量
+const purgeTrashBatchSize = 200
+
+// purgeExpiredTrash 彻底删除回收站中已到期的文件和文件组, 释放用户的存储空间
+func purgeExpiredTrash(ctx context.Context) error {
+	items, err := dao.ListExpiredTrash(ctx, time.Now(), purgeTrashBatchSize)
+	if err != nil {
+		return err
+	}
+
+	var purged int
+	for _, item := range items {
+		if err := api.PurgeTrash(ctx, item); err != nil {
+			cronLog.Errorf("purge trash %d of %s: %v", item.ID, item.UserID, err)
+			continue
+		}
+		purged++
+	}
+
+	if purged > 0 {
+		cronLog.Infof("purged %d trash items", purged)
+	}
+
+	return nil
+}
@@ -0,0 +1,24 @@
+package job
+
+import (
+	"context"
+	"time"
+
+	"github.com/gnasnik/titan-explorer/core/dao"
+)
+
+// uploadSessionRetention 已结束的上传会话保留时间
+const uploadSessionRetention = 7 * 24 * time.Hour
+
+// expireUploadSessions 标记过期的上传会话, 释放预占的存储空间, 并清理已结束较久的会话
+func expireUploadSessions(ctx context.Context) error {
+	expired, err := dao.ExpireUploadSessions(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	if expired > 0 {
+		cronLog.Infof("expired %d upload sessions", expired)
+	}
+
+	return dao.DeleteUploadSessionsBefore(ctx, time.Now().Add(-uploadSessionRetention))
+}
@@ -0,0 +1,152 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/core/storage"
+	"github.com/gnasnik/titan-explorer/pkg/formatter"
+	"github.com/gnasnik/titan-explorer/pkg/iptool"
+	"github.com/hibiken/asynq"
+)
+
+const (
+	maxWebhookResponseBytes = 4096
+	// maxWebhookErrorLength tenant_webhook_attempts.error 和 tenant_webhook_deliveries.last_error 的长度
+	maxWebhookErrorLength = 1024
+)
+
+// signedHeaders 投递时记录的请求头
+var signedHeaders = []string{"Content-Type", "X-Delivery-Id", "X-Timestamp", "X-Nonce", "X-Signature", "X-Signature-Previous"}
+
+// subscriptionHTTPClient 投递租户自行订阅的回调地址, 只允许连接公网地址
+var subscriptionHTTPClient = iptool.NewPublicHTTPClient(30 * time.Second)
+
+// deliverWebhook 签名并投递租户回调, 每次尝试都会记录到 tenant_webhook_attempts, 重试次数用尽后投递记录进入 dead 状态
+func deliverWebhook(ctx context.Context, t *asynq.Task, client *http.Client, tenant *model.Tenant, event, deliveryID, notifyUrl string, body []byte) error {
+	if deliveryID == "" {
+		deliveryID, _ = asynq.GetTaskID(ctx)
+	}
+
+	err := dao.AddWebhookDelivery(ctx, &model.TenantWebhookDelivery{
+		ID:       deliveryID,
+		TenantID: tenant.TenantID,
+		Event:    event,
+		Url:      notifyUrl,
+		Payload:  string(t.Payload()),
+		State:    dao.WebhookDeliveryStatePending,
+	})
+	if err != nil {
+		cronLog.Errorf("unable to add webhook delivery %s: %+v", deliveryID, err)
+	}
+
+	retried, _ := asynq.GetRetryCount(ctx)
+	attempt := &model.TenantWebhookAttempt{
+		DeliveryID:  deliveryID,
+		Attempt:     int64(retried + 1),
+		RequestUrl:  notifyUrl,
+		RequestBody: string(body),
+	}
+
+	state := dao.WebhookDeliveryStateSuccess
+	err = sendWebhook(ctx, client, tenant, notifyUrl, body, attempt)
+	if err != nil {
+		attempt.Error = formatter.Truncate(err.Error(), maxWebhookErrorLength)
+		state = dao.WebhookDeliveryStateFailed
+		if maxRetry, ok := asynq.GetMaxRetry(ctx); ok && retried >= maxRetry {
+			cronLog.Errorf("webhook delivery %s of tenant %s exhausted %d retries", deliveryID, tenant.TenantID, maxRetry)
+			state = dao.WebhookDeliveryStateDead
+		}
+	}
+
+	if aerr := dao.AddWebhookAttempt(ctx, attempt, state); aerr != nil {
+		cronLog.Errorf("unable to add webhook attempt of %s: %+v", deliveryID, aerr)
+	}
+
+	return err
+}
+
+func sendWebhook(ctx context.Context, client *http.Client, tenant *model.Tenant, notifyUrl string, body []byte, attempt *model.TenantWebhookAttempt) error {
+	pair, err := storage.LoadTenantKeyPairFromBlob(tenant.ApiKey)
+	if err != nil {
+		cronLog.Errorf("unable to generate secret with pair %+v", err)
+		return err
+	}
+
+	address, err := url.Parse(notifyUrl)
+	if err != nil {
+		cronLog.Errorf("invalid URL %+v", err)
+		return err
+	}
+
+	method := http.MethodPost
+	req, err := http.NewRequestWithContext(ctx, method, notifyUrl, bytes.NewBuffer(body))
+	if err != nil {
+		cronLog.Errorf("unable to generate req %+v", err)
+		return err
+	}
+
+	// 租户可以根据投递ID去重
+	req.Header.Set("X-Delivery-Id", attempt.DeliveryID)
+
+	if err := setAuthorization(req, pair.ApiSecret, method, address.Path, string(body)); err != nil {
+		cronLog.Errorf("unable to set authorization for req %+v", err)
+		return err
+	}
+
+	// 密钥轮换的宽限期内同时带上旧密钥的签名, 租户可以用任一密钥验证
+	if tenant.InKeyGracePeriod() {
+		prev, err := storage.LoadTenantKeyPairFromBlob(tenant.PrevApiKey)
+		if err != nil {
+			cronLog.Errorf("unable to load previous key pair %+v", err)
+		} else {
+			req.Header.Set("X-Signature-Previous", genCallbackSignature(prev.ApiSecret, method, address.Path, string(body), req.Header.Get("X-Timestamp"), req.Header.Get("X-Nonce")))
+		}
+	}
+
+	headers := make(map[string]string, len(signedHeaders))
+	for _, h := range signedHeaders {
+		headers[h] = req.Header.Get(h)
+	}
+	headerData, _ := json.Marshal(headers)
+	attempt.RequestHeaders = string(headerData)
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	attempt.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		cronLog.Errorf("unable to send post to %s with err %+v", notifyUrl, err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	respData, err := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponseBytes))
+	attempt.ResponseCode = int64(resp.StatusCode)
+	attempt.ResponseBody = string(respData)
+	if err != nil {
+		cronLog.Errorf("unable to read response body %+v", err)
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		cronLog.Errorf("received non ok http code %d with body %s", resp.StatusCode, string(respData))
+		return fmt.Errorf("received non ok http code %d with body %s", resp.StatusCode, string(respData))
+	}
+
+	if string(respData) != "success" {
+		cronLog.Errorf("unexpected resp %s", respData)
+		return fmt.Errorf("unexpected resp %s", respData)
+	}
+
+	cronLog.Infof("Notified client %s, status code %d", notifyUrl, resp.StatusCode)
+
+	return nil
+}
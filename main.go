@@ -12,8 +12,8 @@ import (
 	"github.com/gnasnik/titan-explorer/config"
 	"github.com/gnasnik/titan-explorer/core/dao"
 	"github.com/gnasnik/titan-explorer/core/opasynq"
-	"github.com/gnasnik/titan-explorer/core/oplog"
 	"github.com/gnasnik/titan-explorer/core/oprds"
+	"github.com/gnasnik/titan-explorer/core/scheduler"
 	"github.com/gnasnik/titan-explorer/job"
 	"github.com/gnasnik/titan-explorer/pkg/oss"
 	logging "github.com/ipfs/go-log/v2"
@@ -54,9 +54,9 @@ func main() {
 		log.Fatalf("init oss: %v\n", err)
 	}
 
-	oplog.Subscribe(context.Background())
 	oprds.Init()
 	opasynq.Init()
+	scheduler.Init(context.Background(), cfg.SchedulerRegistry)
 
 	api.InitManagers(&cfg)
 
@@ -65,11 +65,12 @@ func main() {
 		log.Fatalf("create api server: %v\n", err)
 	}
 	go srv.Run()
-	job.SyncShedulersAsset()
+	cronRunner := job.SyncShedulersAsset()
 	go job.StartAsynqServer()
 
 	signal.Notify(OsSignal, syscall.SIGINT, syscall.SIGTERM)
 	_ = <-OsSignal
+	cronRunner.Stop()
 	srv.Close()
 
 	fmt.Printf("Exiting received OsSignal\n")
@@ -6,7 +6,9 @@ import (
 	"math"
 	"math/rand"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 var log = logging.Logger("pkg")
@@ -79,3 +81,20 @@ func RandFloat64() float64 {
 	}
 	return randFloat
 }
+
+// Truncate 截断字符串到最多 n 个字符, 按字符而不是字节截断, 无效的 UTF-8 字节会被丢弃, 用于写入 varchar 字段
+func Truncate(s string, n int) string {
+	s = strings.ToValidUTF8(s, "")
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	var count int
+	for i := range s {
+		if count == n {
+			return s[:i]
+		}
+		count++
+	}
+	return s
+}
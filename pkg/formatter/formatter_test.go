@@ -0,0 +1,22 @@
+package formatter
+
+import "testing"
+
+func TestTruncate(t *testing.T) {
+	cases := []struct {
+		in     string
+		n      int
+		expect string
+	}{
+		{"hello", 10, "hello"},
+		{"hello", 3, "hel"},
+		{"节点离线告警", 4, "节点离线"},
+		{"ab\xffcd", 3, "abc"},
+		{"", 3, ""},
+	}
+	for _, c := range cases {
+		if got := Truncate(c.in, c.n); got != c.expect {
+			t.Fatalf("Truncate(%q, %d): expect %q, got %q", c.in, c.n, c.expect, got)
+		}
+	}
+}
@@ -1,12 +1,16 @@
 package iptool
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"strings"
+	"syscall"
+	"time"
 )
 
 var privateIPNets = []string{
@@ -30,6 +34,62 @@ func IsPrivateIP(ip net.IP) bool {
 	return false
 }
 
+// IsPublicIP 判断是否为公网地址, 回环, 内网, 链路本地 (包括云厂商的元数据地址) 和未指定地址都不是公网地址
+func IsPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	return !IsPrivateIP(ip)
+}
+
+// CheckPublicURL 校验用户提供的回调地址, 只允许 http(s), 并且域名解析出的所有地址都必须是公网地址
+func CheckPublicURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("invalid url %s", rawURL)
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return fmt.Errorf("resolve %s: %w", u.Hostname(), err)
+	}
+	for _, addr := range addrs {
+		if !IsPublicIP(addr.IP) {
+			return fmt.Errorf("url %s resolves to non-public address %s", rawURL, addr.IP)
+		}
+	}
+	return nil
+}
+
+// NewPublicHTTPClient 返回只能连接公网地址的 http client, 在建立连接时校验解析后的地址,
+// 防止域名在 CheckPublicURL 之后重新解析到内网, 重定向也同样受限
+func NewPublicHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !IsPublicIP(ip) {
+				return fmt.Errorf("connect to non-public address %s is not allowed", address)
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
 func GetClientIP(r *http.Request) string {
 	ip := strings.TrimSpace(strings.Split(r.Header.Get("X-Original-Forwarded-For"), ",")[0])
 	if ip != "" {
@@ -0,0 +1,52 @@
+package iptool
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	cases := map[string]bool{
+		"8.8.8.8":          true,
+		"2001:4860::8888":  true,
+		"127.0.0.1":        false,
+		"10.1.2.3":         false,
+		"172.20.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"::1":              false,
+		"fe80::1":          false,
+		"::ffff:127.0.0.1": false,
+	}
+	for ip, expect := range cases {
+		if got := IsPublicIP(net.ParseIP(ip)); got != expect {
+			t.Fatalf("IsPublicIP(%s): expect %v, got %v", ip, expect, got)
+		}
+	}
+}
+
+func TestCheckPublicURL(t *testing.T) {
+	for _, u := range []string{"ftp://8.8.8.8/", "http://127.0.0.1:8080/hook", "http://[::1]/", "http://169.254.169.254/latest/meta-data", "http:///"} {
+		if err := CheckPublicURL(context.Background(), u); err == nil {
+			t.Fatalf("expect %s to be rejected", u)
+		}
+	}
+	if err := CheckPublicURL(context.Background(), "https://8.8.8.8/hook"); err != nil {
+		t.Fatalf("expect public url to be accepted: %v", err)
+	}
+}
+
+func TestPublicHTTPClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	if _, err := NewPublicHTTPClient(time.Second).Get(srv.URL); err == nil {
+		t.Fatal("expect loopback connection to be rejected")
+	}
+}
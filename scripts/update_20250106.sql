@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS `job_runs` (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,
+    `job_name` varchar(64) NOT NULL DEFAULT '',
+    `instance` varchar(128) NOT NULL DEFAULT '' COMMENT '执行任务的实例',
+    `status` enum('running', 'success', 'failed') NOT NULL DEFAULT 'running',
+    `error` varchar(2048) NOT NULL DEFAULT '',
+    `started_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    `finished_at` DATETIME(3) NOT NULL DEFAULT '1970-01-01 00:00:00.000',
+    `duration_ms` bigint(20) NOT NULL DEFAULT 0,
+    PRIMARY KEY (`id`),
+    KEY `idx_job_name_started_at` (`job_name`, `started_at`) USING BTREE,
+    KEY `idx_started_at` (`started_at`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT '定时任务执行记录';
@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS `tenant_webhook_deliveries` (
+    `id` char(36) PRIMARY KEY NOT NULL,
+    `tenant_id` char(36) NOT NULL DEFAULT '',
+    `event` varchar(64) NOT NULL DEFAULT '',
+    `url` varchar(255) NOT NULL DEFAULT '',
+    `payload` text NOT NULL COMMENT '任务载体, 用于重新投递',
+    `state` enum('pending', 'success', 'failed', 'dead') NOT NULL DEFAULT 'pending' COMMENT 'failed:等待重试 dead:重试次数用尽',
+    `attempts` int(10) NOT NULL DEFAULT 0,
+    `last_status_code` int(10) NOT NULL DEFAULT 0,
+    `last_error` varchar(1024) NOT NULL DEFAULT '',
+    `created_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    `updated_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
+    KEY `idx_tenant_state` (`tenant_id`, `state`) USING BTREE,
+    KEY `idx_tenant_created_at` (`tenant_id`, `created_at`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT '租户回调投递记录';
+
+CREATE TABLE IF NOT EXISTS `tenant_webhook_attempts` (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,
+    `delivery_id` char(36) NOT NULL DEFAULT '',
+    `attempt` int(10) NOT NULL DEFAULT 0,
+    `request_url` varchar(255) NOT NULL DEFAULT '',
+    `request_headers` varchar(1024) NOT NULL DEFAULT '' COMMENT '签名相关的请求头',
+    `request_body` text NOT NULL,
+    `response_code` int(10) NOT NULL DEFAULT 0,
+    `response_body` text NOT NULL,
+    `error` varchar(1024) NOT NULL DEFAULT '',
+    `latency_ms` int(10) NOT NULL DEFAULT 0,
+    `created_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    PRIMARY KEY (`id`),
+    KEY `idx_delivery_id` (`delivery_id`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT '租户回调投递尝试记录';
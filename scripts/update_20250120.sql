@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS `tenant_webhook_subscriptions` (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,
+    `tenant_id` char(36) NOT NULL DEFAULT '',
+    `url` varchar(255) NOT NULL DEFAULT '',
+    `events` varchar(1024) NOT NULL DEFAULT '' COMMENT '订阅的事件, 逗号分隔, * 表示全部',
+    `enabled` tinyint(1) NOT NULL DEFAULT 1,
+    `created_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    `updated_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
+    PRIMARY KEY (`id`),
+    KEY `idx_tenant_id` (`tenant_id`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT '租户回调订阅';
@@ -0,0 +1,4 @@
+ALTER TABLE tenants ADD COLUMN `prev_api_key` varbinary(512) NOT NULL DEFAULT '' COMMENT '轮换前的 key/secret, 宽限期内仍然有效';
+ALTER TABLE tenants ADD COLUMN `prev_key_expire_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3);
+ALTER TABLE tenants ADD COLUMN `storage_quota` bigint(20) NOT NULL DEFAULT 0 COMMENT '所有子账户的存储空间上限, 0 表示不限制';
+ALTER TABLE tenants ADD COLUMN `traffic_quota` bigint(20) NOT NULL DEFAULT 0 COMMENT '所有子账户的下载流量上限, 0 表示不限制';
@@ -0,0 +1,12 @@
+ALTER TABLE operation_log ADD COLUMN `action` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '操作类型, 如 group.delete';
+ALTER TABLE operation_log ADD COLUMN `actor` VARCHAR(128) NOT NULL DEFAULT '' COMMENT '操作者, 用户名或租户ID';
+ALTER TABLE operation_log ADD COLUMN `target_type` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '操作对象类型';
+ALTER TABLE operation_log ADD COLUMN `target_id` VARCHAR(255) NOT NULL DEFAULT '' COMMENT '操作对象ID';
+ALTER TABLE operation_log ADD COLUMN `before_value` TEXT COMMENT '操作前的数据(JSON)';
+ALTER TABLE operation_log ADD COLUMN `after_value` TEXT COMMENT '操作后的数据(JSON)';
+ALTER TABLE operation_log ADD COLUMN `user_agent` VARCHAR(512) NOT NULL DEFAULT '';
+ALTER TABLE operation_log MODIFY COLUMN `operator_param` TEXT;
+ALTER TABLE operation_log ADD INDEX idx_operator_username (`operator_username`, `created_at`);
+ALTER TABLE operation_log ADD INDEX idx_action (`action`, `created_at`);
+ALTER TABLE operation_log ADD INDEX idx_target (`target_type`, `target_id`);
+ALTER TABLE operation_log ADD INDEX idx_created_at (`created_at`);
@@ -0,0 +1,41 @@
+CREATE TABLE IF NOT EXISTS `upload_session` (
+    `id` varchar(64) NOT NULL COMMENT '上传会话 ID',
+    `user_id` varchar(255) NOT NULL DEFAULT '',
+    `tenant_id` varchar(64) NOT NULL DEFAULT '',
+    `asset_cid` varchar(255) NOT NULL DEFAULT '',
+    `hash` varchar(255) NOT NULL DEFAULT '',
+    `asset_name` varchar(255) NOT NULL DEFAULT '',
+    `asset_type` varchar(64) NOT NULL DEFAULT '',
+    `asset_size` bigint(20) NOT NULL DEFAULT 0 COMMENT '文件大小, 会话未结束时作为预占的存储空间',
+    `md5` varchar(64) NOT NULL DEFAULT '',
+    `group_id` bigint(20) NOT NULL DEFAULT 0,
+    `extra_id` varchar(255) NOT NULL DEFAULT '',
+    `password` varchar(255) NOT NULL DEFAULT '',
+    `area_ids` varchar(2048) NOT NULL DEFAULT '' COMMENT '上传的区域, 第一个为实际上传的区域',
+    `node_id` varchar(128) NOT NULL DEFAULT '',
+    `trace_id` varchar(128) NOT NULL DEFAULT '',
+    `client_ip` varchar(64) NOT NULL DEFAULT '',
+    `part_size` bigint(20) NOT NULL DEFAULT 0,
+    `part_count` int(11) NOT NULL DEFAULT 0,
+    `uploaded_size` bigint(20) NOT NULL DEFAULT 0,
+    `state` enum('uploading', 'committed', 'expired', 'aborted') NOT NULL DEFAULT 'uploading',
+    `expire_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    `committed_at` DATETIME(3) NOT NULL DEFAULT '1970-01-01 00:00:00.000',
+    `created_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    `updated_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
+    PRIMARY KEY (`id`),
+    KEY `idx_user_state` (`user_id`, `state`) USING BTREE,
+    KEY `idx_tenant_state` (`tenant_id`, `state`) USING BTREE,
+    KEY `idx_state_expire_at` (`state`, `expire_at`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT '可续传的上传会话';
+
+CREATE TABLE IF NOT EXISTS `upload_session_part` (
+    `session_id` varchar(64) NOT NULL,
+    `part_number` int(11) NOT NULL,
+    `size` bigint(20) NOT NULL DEFAULT 0,
+    `md5` varchar(64) NOT NULL DEFAULT '',
+    `area_id` varchar(255) NOT NULL DEFAULT '' COMMENT '接收分片的区域',
+    `node_id` varchar(128) NOT NULL DEFAULT '' COMMENT '接收分片的节点',
+    `created_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    PRIMARY KEY (`session_id`, `part_number`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT '上传会话的分片';
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS `content` (
+    `hash` varchar(255) NOT NULL,
+    `area_id` varchar(255) NOT NULL,
+    `cid` varchar(255) NOT NULL DEFAULT '',
+    `size` bigint(20) NOT NULL DEFAULT 0,
+    `md5` varchar(64) NOT NULL DEFAULT '',
+    `ref_count` bigint(20) NOT NULL DEFAULT 0 COMMENT '区域中引用该内容的用户文件数',
+    `created_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    `updated_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
+    PRIMARY KEY (`hash`, `area_id`),
+    KEY `idx_md5_area` (`md5`, `area_id`) USING BTREE,
+    KEY `idx_area_id` (`area_id`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT '按区域引用计数的文件内容';
+
+-- 根据已有的用户文件初始化引用计数
+INSERT INTO `content` (`hash`, `area_id`, `cid`, `size`, `md5`, `ref_count`)
+SELECT uaa.`hash`, uaa.`area_id`, MAX(ua.`cid`), MAX(ua.`total_size`), MAX(ua.`md5`), COUNT(*)
+FROM `user_asset_area` uaa
+INNER JOIN `user_asset` ua ON ua.`hash` = uaa.`hash` AND ua.`user_id` = uaa.`user_id`
+GROUP BY uaa.`hash`, uaa.`area_id`
+ON DUPLICATE KEY UPDATE `ref_count` = VALUES(`ref_count`);
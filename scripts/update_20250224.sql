@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS `user_trash` (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,
+    `user_id` varchar(255) NOT NULL DEFAULT '',
+    `item_type` enum('asset', 'group') NOT NULL DEFAULT 'asset',
+    `hash` varchar(255) NOT NULL DEFAULT '' COMMENT '文件 hash, 类型为 asset 时有效',
+    `cid` varchar(255) NOT NULL DEFAULT '',
+    `group_id` bigint(20) NOT NULL DEFAULT 0 COMMENT '文件组 ID, 类型为 group 时有效',
+    `name` varchar(255) NOT NULL DEFAULT '',
+    `size` bigint(20) NOT NULL DEFAULT 0 COMMENT '文件或文件组内所有文件的大小, 清除前仍然计入已使用的存储空间',
+    `origin_group_id` bigint(20) NOT NULL DEFAULT 0 COMMENT '删除前所在的文件组, 恢复时放回该文件组',
+    `deleted_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    `purge_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) COMMENT '到期后彻底删除',
+    PRIMARY KEY (`id`),
+    KEY `idx_user_id` (`user_id`, `deleted_at`) USING BTREE,
+    KEY `idx_purge_at` (`purge_at`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT '用户回收站';
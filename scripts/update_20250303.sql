@@ -0,0 +1,13 @@
+ALTER TABLE `link`
+    ADD COLUMN `max_downloads` bigint(20) NOT NULL DEFAULT 0 COMMENT '最大下载次数, 0 表示不限制',
+    ADD COLUMN `download_count` bigint(20) NOT NULL DEFAULT 0 COMMENT '已下载次数',
+    ADD COLUMN `allowed_countries` varchar(1024) NOT NULL DEFAULT '' COMMENT '允许访问的国家, 逗号分隔, 为空时不限制',
+    ADD COLUMN `allowed_referers` varchar(1024) NOT NULL DEFAULT '' COMMENT '允许的来源域名, 逗号分隔, 为空时不限制',
+    ADD COLUMN `disable_preview` tinyint(1) NOT NULL DEFAULT 0 COMMENT '禁止在线预览',
+    ADD COLUMN `revoked` tinyint(1) NOT NULL DEFAULT 0 COMMENT '已撤销的链接不能再访问',
+    ADD COLUMN `revoked_at` DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00';
+
+ALTER TABLE `asset_transfer_log`
+    ADD COLUMN `link_id` bigint(20) NOT NULL DEFAULT 0 COMMENT '通过分享链接下载时的链接 ID',
+    ADD COLUMN `country` varchar(128) NOT NULL DEFAULT '' COMMENT '下载者所在的国家',
+    ADD KEY `idx_link_id_created_at` (`link_id`, `created_at`);
@@ -0,0 +1,6 @@
+ALTER TABLE `link` ADD COLUMN `short_id` varchar(32) NOT NULL DEFAULT '' COMMENT '短链接的随机 ID';
+
+-- 已有的链接生成随机 ID, 旧的短链接通过兼容路径访问
+UPDATE `link` SET `short_id` = SUBSTRING(SHA2(CONCAT(`id`, '-', UUID(), '-', RAND()), 256), 1, 22) WHERE `short_id` = '';
+
+ALTER TABLE `link` ADD UNIQUE KEY `uniq_short_id` (`short_id`), ADD KEY `idx_short_link` (`short_link`(191));
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS `quota_plan` (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,
+    `name` varchar(64) NOT NULL DEFAULT '',
+    `storage_size` bigint(20) NOT NULL DEFAULT 0 COMMENT '存储空间, 0 表示使用账户原有的存储空间',
+    `monthly_traffic` bigint(20) NOT NULL DEFAULT 0 COMMENT '每月下载流量, 0 表示不限制',
+    `peak_bandwidth` bigint(20) NOT NULL DEFAULT 0 COMMENT '峰值带宽, 超过时只提醒, 0 表示不限制',
+    `file_count` bigint(20) NOT NULL DEFAULT 0 COMMENT '文件数量, 0 表示不限制',
+    `max_file_size` bigint(20) NOT NULL DEFAULT 0 COMMENT '单个文件大小, 0 表示不限制',
+    `api_key_count` bigint(20) NOT NULL DEFAULT 0 COMMENT 'API key 数量, 0 表示不限制',
+    `is_default` tinyint(1) NOT NULL DEFAULT 0 COMMENT '未分配套餐的用户使用默认套餐',
+    `created_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    `updated_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uniq_name` (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT '存储和流量套餐';
+
+CREATE TABLE IF NOT EXISTS `quota_plan_assign` (
+    `subject_type` enum('user', 'tenant') NOT NULL DEFAULT 'user',
+    `subject_id` varchar(255) NOT NULL DEFAULT '' COMMENT '用户名或租户 ID',
+    `plan_id` bigint(20) NOT NULL DEFAULT 0,
+    `updated_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    PRIMARY KEY (`subject_type`, `subject_id`),
+    KEY `idx_plan_id` (`plan_id`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT '用户和租户的套餐';
+
+-- 与原来的流量限制保持一致: 普通用户每月 1GB, vip 用户每月 1000GB
+INSERT IGNORE INTO `quota_plan` (`name`, `monthly_traffic`, `is_default`) VALUES ('free', 1073741824, 1), ('vip', 1073741824000, 0);
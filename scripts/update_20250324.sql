@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS `user_asset_tag` (
+    `user_id` varchar(128) NOT NULL,
+    `hash` varchar(128) NOT NULL,
+    `tag` varchar(64) NOT NULL,
+    `created_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    PRIMARY KEY (`user_id`, `hash`, `tag`),
+    KEY `idx_user_tag` (`user_id`, `tag`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT '用户文件的标签';
+
+CREATE TABLE IF NOT EXISTS `user_asset_meta` (
+    `user_id` varchar(128) NOT NULL,
+    `hash` varchar(128) NOT NULL,
+    `meta_key` varchar(64) NOT NULL,
+    `meta_value` varchar(1024) NOT NULL DEFAULT '',
+    PRIMARY KEY (`user_id`, `hash`, `meta_key`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT '用户文件的自定义元数据';
+
+-- 文件搜索按用户过滤后排序
+ALTER TABLE `user_asset` ADD KEY `idx_user_created_time` (`user_id`, `created_time`), ADD KEY `idx_user_total_size` (`user_id`, `total_size`);
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS `asset_batch_job` (
+    `id` varchar(64) NOT NULL,
+    `user_id` varchar(128) NOT NULL,
+    `operation` varchar(32) NOT NULL DEFAULT '' COMMENT 'delete, move, share, unshare, tag, export',
+    `params` varchar(2048) NOT NULL DEFAULT '' COMMENT '操作参数, json 格式',
+    `state` varchar(16) NOT NULL DEFAULT 'pending' COMMENT 'pending, running, done, failed',
+    `total` int(11) NOT NULL DEFAULT 0,
+    `succeeded` int(11) NOT NULL DEFAULT 0,
+    `failed` int(11) NOT NULL DEFAULT 0,
+    `created_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    `updated_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    PRIMARY KEY (`id`),
+    KEY `idx_user_created` (`user_id`, `created_at`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT '文件批量操作任务';
+
+CREATE TABLE IF NOT EXISTS `asset_batch_item` (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,
+    `job_id` varchar(64) NOT NULL,
+    `item_type` enum('asset', 'group') NOT NULL DEFAULT 'asset',
+    `target` varchar(255) NOT NULL DEFAULT '' COMMENT '文件 cid 或文件组 id',
+    `state` varchar(16) NOT NULL DEFAULT 'pending' COMMENT 'pending, success, failed',
+    `error` varchar(512) NOT NULL DEFAULT '',
+    `updated_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    PRIMARY KEY (`id`),
+    KEY `idx_job_id` (`job_id`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT '文件批量操作任务的每一项';
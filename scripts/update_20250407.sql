@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS `asset_group_publish` (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,
+    `user_id` varchar(128) NOT NULL,
+    `group_id` bigint(20) NOT NULL,
+    `version` int(11) NOT NULL DEFAULT 1 COMMENT '同一文件组每次发布递增',
+    `area_id` varchar(64) NOT NULL DEFAULT '',
+    `root_cid` varchar(255) NOT NULL DEFAULT '' COMMENT 'UnixFS 目录的根 CID',
+    `size` bigint(20) NOT NULL DEFAULT 0 COMMENT '目录 DAG 的 CAR 文件大小',
+    `asset_count` int(11) NOT NULL DEFAULT 0,
+    `state` varchar(16) NOT NULL DEFAULT 'pending' COMMENT 'pending, published, failed',
+    `error` varchar(512) NOT NULL DEFAULT '',
+    `created_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    `updated_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uniq_group_version` (`user_id`, `group_id`, `version`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT '文件组发布为 UnixFS 目录的记录';
@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS `node_alert_rule` (
+    `user_id` varchar(128) NOT NULL,
+    `enabled` tinyint(1) NOT NULL DEFAULT 0,
+    `notify_email` tinyint(1) NOT NULL DEFAULT 1 COMMENT '发送邮件到用户账号邮箱',
+    `webhook_url` varchar(512) NOT NULL DEFAULT '' COMMENT '为空时不发送 webhook',
+    `offline_minutes` int(11) NOT NULL DEFAULT 30 COMMENT '离线超过该时长再次告警, 0 表示关闭',
+    `nat_degrade` tinyint(1) NOT NULL DEFAULT 1 COMMENT 'NAT 类型变差时告警',
+    `disk_threshold` double NOT NULL DEFAULT 90 COMMENT '磁盘使用率(%)超过该值时告警, 0 表示关闭',
+    `quiet_start` varchar(5) NOT NULL DEFAULT '' COMMENT '免打扰开始时间 HH:MM',
+    `quiet_end` varchar(5) NOT NULL DEFAULT '' COMMENT '免打扰结束时间 HH:MM',
+    `timezone` varchar(64) NOT NULL DEFAULT '',
+    `dedup_minutes` int(11) NOT NULL DEFAULT 60 COMMENT '同一节点同类告警的最短间隔',
+    `created_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    `updated_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    PRIMARY KEY (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT '节点告警规则';
+
+CREATE TABLE IF NOT EXISTS `node_alert` (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,
+    `user_id` varchar(128) NOT NULL,
+    `device_id` varchar(128) NOT NULL,
+    `alert_type` varchar(32) NOT NULL DEFAULT '' COMMENT 'offline, offline_long, nat_degraded, disk_usage',
+    `message` varchar(512) NOT NULL DEFAULT '',
+    `state` varchar(16) NOT NULL DEFAULT 'pending' COMMENT 'pending, sent, failed, skipped',
+    `channels` varchar(32) NOT NULL DEFAULT '' COMMENT '已发送的通知方式',
+    `error` varchar(512) NOT NULL DEFAULT '',
+    `notify_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) COMMENT '免打扰时段内的告警延后到结束时发送',
+    `created_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    `updated_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    PRIMARY KEY (`id`),
+    KEY `idx_user_created` (`user_id`, `created_at`) USING BTREE,
+    KEY `idx_device_type` (`device_id`, `alert_type`, `created_at`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT '节点告警记录';
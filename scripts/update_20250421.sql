@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS `device_label` (
+    `device_id` varchar(128) NOT NULL,
+    `label` varchar(64) NOT NULL,
+    `user_id` varchar(128) NOT NULL,
+    `created_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    PRIMARY KEY (`device_id`, `label`),
+    KEY `idx_user_label` (`user_id`, `label`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT '节点标签';
+
+CREATE TABLE IF NOT EXISTS `device_group` (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,
+    `user_id` varchar(128) NOT NULL,
+    `name` varchar(64) NOT NULL,
+    `created_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    `updated_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uniq_user_name` (`user_id`, `name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT '节点分组';
+
+CREATE TABLE IF NOT EXISTS `device_group_member` (
+    `group_id` bigint(20) NOT NULL,
+    `device_id` varchar(128) NOT NULL,
+    `created_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    PRIMARY KEY (`group_id`, `device_id`),
+    KEY `idx_device` (`device_id`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT '节点分组成员';
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS `device_uptime_daily` (
+    `device_id` varchar(128) NOT NULL,
+    `date` DATE NOT NULL,
+    `user_id` varchar(128) NOT NULL DEFAULT '',
+    `observed_seconds` bigint(20) NOT NULL DEFAULT 0 COMMENT '有拉取数据覆盖的时长',
+    `down_seconds` bigint(20) NOT NULL DEFAULT 0 COMMENT '离线时长',
+    `rolled_to` DATETIME NOT NULL COMMENT '已统计到的最后一条 device_info_hour 的时间',
+    `updated_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    PRIMARY KEY (`device_id`, `date`),
+    KEY `idx_user_date` (`user_id`, `date`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT '节点每日可用性';
+
+CREATE TABLE IF NOT EXISTS `device_outage` (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,
+    `device_id` varchar(128) NOT NULL,
+    `user_id` varchar(128) NOT NULL DEFAULT '',
+    `start_time` DATETIME NOT NULL,
+    `end_time` DATETIME NOT NULL,
+    `duration` bigint(20) NOT NULL DEFAULT 0 COMMENT '离线时长, 单位秒',
+    `ongoing` tinyint(1) NOT NULL DEFAULT 0 COMMENT '最后一次统计时节点仍然离线',
+    `created_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    `updated_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    PRIMARY KEY (`id`),
+    KEY `idx_device_start` (`device_id`, `start_time`) USING BTREE,
+    KEY `idx_user_start` (`user_id`, `start_time`) USING BTREE,
+    KEY `idx_ongoing` (`ongoing`, `device_id`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT '节点离线区间';
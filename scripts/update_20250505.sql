@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS `reward_reconcile_run` (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,
+    `area_id` varchar(64) NOT NULL,
+    `state` varchar(16) NOT NULL DEFAULT 'running' COMMENT 'running, done, failed',
+    `tolerance` DECIMAL(20,6) NOT NULL DEFAULT 0,
+    `node_count` bigint(20) NOT NULL DEFAULT 0,
+    `discrepancy_count` bigint(20) NOT NULL DEFAULT 0,
+    `total_diff` DECIMAL(20,6) NOT NULL DEFAULT 0 COMMENT '差异绝对值之和',
+    `error` varchar(1024) NOT NULL DEFAULT '',
+    `started_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    `finished_at` DATETIME(3) NOT NULL DEFAULT '1970-01-01 00:00:00.000',
+    PRIMARY KEY (`id`),
+    KEY `idx_area_started` (`area_id`, `started_at`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT '收益对账记录';
+
+CREATE TABLE IF NOT EXISTS `reward_reconcile_item` (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,
+    `run_id` bigint(20) NOT NULL,
+    `device_id` varchar(128) NOT NULL,
+    `user_id` varchar(128) NOT NULL DEFAULT '',
+    `area_id` varchar(64) NOT NULL,
+    `scheduler_profit` DECIMAL(20,6) NOT NULL DEFAULT 0 COMMENT '调度器的累计收益',
+    `daily_sum` DECIMAL(20,6) NOT NULL DEFAULT 0 COMMENT 'device_info_daily 的收益之和',
+    `diff` DECIMAL(20,6) NOT NULL DEFAULT 0 COMMENT 'scheduler_profit - daily_sum',
+    `state` varchar(16) NOT NULL DEFAULT 'flagged' COMMENT 'flagged, approved, repaired, failed',
+    `approved_by` varchar(128) NOT NULL DEFAULT '',
+    `adjustment` DECIMAL(20,6) NOT NULL DEFAULT 0 COMMENT '修复时对每日收益的调整',
+    `error` varchar(1024) NOT NULL DEFAULT '',
+    `created_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    `updated_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    PRIMARY KEY (`id`),
+    KEY `idx_run_state` (`run_id`, `state`) USING BTREE,
+    KEY `idx_device` (`device_id`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT '收益对账差异';
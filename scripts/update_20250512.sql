@@ -0,0 +1,15 @@
+ALTER TABLE `user_asset` ADD COLUMN `trashed_at` DATETIME(3) NULL DEFAULT NULL COMMENT '放入回收站的时间, 为空时不在回收站中';
+ALTER TABLE `user_asset_group` ADD COLUMN `trashed_at` DATETIME(3) NULL DEFAULT NULL COMMENT '放入回收站的时间, 为空时不在回收站中';
+
+-- 回收站中的文件和文件组原来挂在 -1 文件组下, 改为记录放入回收站的时间并放回原来的文件组
+UPDATE `user_asset` ua INNER JOIN `user_trash` t ON t.user_id = ua.user_id AND t.item_type = 'asset' AND t.hash = ua.hash
+SET ua.trashed_at = t.deleted_at, ua.group_id = t.origin_group_id WHERE ua.group_id = -1;
+UPDATE `user_asset_group` ag INNER JOIN `user_trash` t ON t.user_id = ag.user_id AND t.item_type = 'group' AND t.group_id = ag.id
+SET ag.trashed_at = t.deleted_at, ag.parent = t.origin_group_id WHERE ag.parent = -1;
+
+-- 没有回收站记录的放回根目录
+UPDATE `user_asset` SET group_id = 0 WHERE group_id = -1;
+UPDATE `user_asset_group` SET parent = 0 WHERE parent = -1;
+
+-- 每个文件或文件组在回收站中只有一条记录
+ALTER TABLE `user_trash` ADD UNIQUE KEY `uk_user_item` (`user_id`, `item_type`, `hash`, `group_id`);
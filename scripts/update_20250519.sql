@@ -0,0 +1,6 @@
+ALTER TABLE `quota_plan` MODIFY COLUMN `peak_bandwidth` bigint(20) NOT NULL DEFAULT 0 COMMENT '本月峰值带宽, 超过后不能下载和分享, 0 表示不限制';
+ALTER TABLE `quota_plan` ADD COLUMN `share_count` bigint(20) NOT NULL DEFAULT 0 COMMENT '有效的分享链接数量, 临时文件为每个文件的分享次数, 0 表示不限制' AFTER `api_key_count`;
+ALTER TABLE `quota_plan` ADD COLUMN `download_count` bigint(20) NOT NULL DEFAULT 0 COMMENT '每个分享文件的下载次数, 0 表示不限制' AFTER `share_count`;
+
+-- 未登录用户上传的临时文件使用 temp 套餐, 与原来的限制保持一致: 每个文件最多分享 60 次, 下载 20 次
+INSERT IGNORE INTO `quota_plan` (`name`, `share_count`, `download_count`, `is_default`) VALUES ('temp', 60, 20, 0);